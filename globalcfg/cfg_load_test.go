@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log/slog"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -17,6 +18,8 @@ func TestLoadConfig(t *testing.T) {
 	as.Equal(int64(123456789), cfg.God)
 	as.Equal([]int64{-1001471592463}, cfg.MyChats)
 	as.Nil(cfg.AIChats)
+	as.False(cfg.AIPrivateMode)
+	as.Equal([]int64{10001}, cfg.AIPrivateUsers)
 
 	as.Equal("https://example-ocr.cognitiveservices.azure.com", cfg.ContentModerator.Endpoint)
 	as.Equal("1234567890abcdef", cfg.ContentModerator.ApiKey)
@@ -31,6 +34,22 @@ func TestLoadConfig(t *testing.T) {
 	as.Equal("http://localhost:8081", cfg.TgApiUrl)
 	as.False(cfg.DropPendingUpdates)
 	as.Equal("ABCDEFGHIJKLMNOPQRST", cfg.GeminiKey)
+	as.Equal(int64(2000000), cfg.GeminiQuota.ChatDaily)
+	as.Equal(int64(30000000), cfg.GeminiQuota.ChatMonthly)
+	as.Equal(int64(500000), cfg.GeminiQuota.UserDaily)
+	as.Equal(int64(0), cfg.GeminiQuota.UserMonthly)
+	price, ok := cfg.GeminiQuota.PriceOf("gemini-3.1-flash-lite-preview")
+	as.True(ok)
+	as.Equal(GeminiPrice{Model: "gemini-3.1-flash-lite-preview", Input: 0.25, Output: 1.5}, price)
+	as.Equal(int32(150000), cfg.GeminiCompaction.TokenThreshold)
+	as.Equal(DefaultGeminiCompactKeepRecent, cfg.GeminiCompaction.KeepRecent)
+	as.Equal(GeminiRateLimit{
+		UserPerMinute: 2,
+		UserBurst:     DefaultGeminiUserBurst,
+		ChatPerMinute: DefaultGeminiChatPerMinute,
+		ChatBurst:     8,
+		MaxQueue:      DefaultGeminiMaxQueue,
+	}, cfg.GeminiRateLimit)
 
 	as.Equal("http://localhost:7700", cfg.MeiliConfig.BaseUrl)
 	as.Equal("tgmsgs", cfg.MeiliConfig.IndexName)
@@ -42,6 +61,7 @@ func TestLoadConfig(t *testing.T) {
 	as.Equal(":memory:", cfg.MsgDbPath)
 	as.Equal("meili-wal.db", cfg.MeiliWalDbPath)
 	as.Equal(500, cfg.MeiliWalBatchSize)
+	as.Equal(30*time.Minute, cfg.StatFlushInterval)
 	logger := GetLogger("test", -1)
 	fmt.Println(logger)
 	logger.Info("test logger")
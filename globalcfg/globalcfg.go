@@ -41,24 +41,70 @@ type MeiliConfig struct {
 	MasterKey  string `koanf:"master-key"`
 }
 
+// GeminiPrice 模型价格，单位为美元/百万token
+type GeminiPrice struct {
+	Model  string  `koanf:"model"`
+	Input  float64 `koanf:"input"`
+	Output float64 `koanf:"output"`
+}
+
+// GeminiQuota token预算，0表示不限制
+type GeminiQuota struct {
+	ChatDaily   int64         `koanf:"chat-daily"`
+	ChatMonthly int64         `koanf:"chat-monthly"`
+	UserDaily   int64         `koanf:"user-daily"`
+	UserMonthly int64         `koanf:"user-monthly"`
+	Prices      []GeminiPrice `koanf:"prices"` // 模型名中含有"."，不能作为koanf的key，故使用列表
+}
+
+func (q *GeminiQuota) PriceOf(model string) (GeminiPrice, bool) {
+	for _, p := range q.Prices {
+		if p.Model == model {
+			return p, true
+		}
+	}
+	return GeminiPrice{}, false
+}
+
+// GeminiCompaction 会话压缩配置，会话token数超过阈值时将较早的消息总结为摘要
+type GeminiCompaction struct {
+	TokenThreshold int32 `koanf:"token-threshold"`
+	KeepRecent     int   `koanf:"keep-recent"` // 压缩时保留不被总结的最近消息数
+}
+
+// GeminiRateLimit 回复频率限制，令牌桶每分钟补充 PerMinute 个，最多积攒 Burst 个
+type GeminiRateLimit struct {
+	UserPerMinute float64 `koanf:"user-per-minute"`
+	UserBurst     int     `koanf:"user-burst"`
+	ChatPerMinute float64 `koanf:"chat-per-minute"`
+	ChatBurst     int     `koanf:"chat-burst"`
+	MaxQueue      int     `koanf:"max-queue"` // 每个话题最多排队等待的请求数
+}
+
 type Config struct {
-	BotToken           string      `koanf:"bot-token"`
-	God                int64       `koanf:"god"`
-	MyChats            []int64     `koanf:"my-chats"`
-	AIChats            []int64     `koanf:"ai-chats"`
-	MeiliConfig        MeiliConfig `koanf:"meili-config"`
-	ContentModerator   Azure       `koanf:"content-moderator"`
-	Ocr                OcrConfig   `koanf:"ocr"`
-	QrScanUrl          string      `koanf:"qr-scan-url"`
-	SaveMessage        bool        `koanf:"save-message"`
-	TgApiUrl           string      `koanf:"tg-api-url"`
-	DropPendingUpdates bool        `koanf:"drop-pending-updates"`
-	LogLevel           int8        `koanf:"log-level"`
-	DatabasePath       string      `koanf:"database-path"`
-	GeminiKey          string      `koanf:"gemini-key"`
-	MsgDbPath          string      `koanf:"msg-db-path"`
-	MeiliWalDbPath     string      `koanf:"meili-wal-db-path"`
-	MeiliWalBatchSize  int         `koanf:"meili-wal-batch-size"`
+	BotToken           string           `koanf:"bot-token"`
+	God                int64            `koanf:"god"`
+	MyChats            []int64          `koanf:"my-chats"`
+	AIChats            []int64          `koanf:"ai-chats"`
+	AIPrivateMode      bool             `koanf:"ai-private-mode"`  // 是否允许私聊使用AI
+	AIPrivateUsers     []int64          `koanf:"ai-private-users"` // 私聊AI白名单，也可以通过邀请码加入
+	MeiliConfig        MeiliConfig      `koanf:"meili-config"`
+	ContentModerator   Azure            `koanf:"content-moderator"`
+	Ocr                OcrConfig        `koanf:"ocr"`
+	QrScanUrl          string           `koanf:"qr-scan-url"`
+	SaveMessage        bool             `koanf:"save-message"`
+	TgApiUrl           string           `koanf:"tg-api-url"`
+	DropPendingUpdates bool             `koanf:"drop-pending-updates"`
+	LogLevel           int8             `koanf:"log-level"`
+	DatabasePath       string           `koanf:"database-path"`
+	GeminiKey          string           `koanf:"gemini-key"`
+	GeminiQuota        GeminiQuota      `koanf:"gemini-quota"`
+	GeminiCompaction   GeminiCompaction `koanf:"gemini-compaction"`
+	GeminiRateLimit    GeminiRateLimit  `koanf:"gemini-rate-limit"`
+	MsgDbPath          string           `koanf:"msg-db-path"`
+	MeiliWalDbPath     string           `koanf:"meili-wal-db-path"`
+	MeiliWalBatchSize  int              `koanf:"meili-wal-batch-size"`
+	StatFlushInterval  time.Duration    `koanf:"stat-flush-interval"` // 定期保存内存中的统计，避免崩溃时丢失
 
 	LogFile  string `koanf:"log-file"`
 	NoStdout bool   `koanf:"no-stdout"`
@@ -67,6 +113,16 @@ type Config struct {
 const (
 	DefaultMeiliWalDbPath    = "meili-wal.db"
 	DefaultMeiliWalBatchSize = 500
+	DefaultStatFlushInterval = time.Hour
+
+	DefaultGeminiCompactTokenThreshold = 200000
+	DefaultGeminiCompactKeepRecent     = 40
+
+	DefaultGeminiUserPerMinute = 3
+	DefaultGeminiUserBurst     = 3
+	DefaultGeminiChatPerMinute = 20
+	DefaultGeminiChatBurst     = 10
+	DefaultGeminiMaxQueue      = 5
 )
 
 var gMu sync.Mutex
@@ -178,6 +234,31 @@ func normalizeConfig(cfg *Config) {
 	if cfg.MeiliWalBatchSize <= 0 {
 		cfg.MeiliWalBatchSize = DefaultMeiliWalBatchSize
 	}
+	if cfg.StatFlushInterval <= 0 {
+		cfg.StatFlushInterval = DefaultStatFlushInterval
+	}
+	if cfg.GeminiCompaction.TokenThreshold <= 0 {
+		cfg.GeminiCompaction.TokenThreshold = DefaultGeminiCompactTokenThreshold
+	}
+	if cfg.GeminiCompaction.KeepRecent <= 0 {
+		cfg.GeminiCompaction.KeepRecent = DefaultGeminiCompactKeepRecent
+	}
+	rl := &cfg.GeminiRateLimit
+	if rl.UserPerMinute <= 0 {
+		rl.UserPerMinute = DefaultGeminiUserPerMinute
+	}
+	if rl.UserBurst <= 0 {
+		rl.UserBurst = DefaultGeminiUserBurst
+	}
+	if rl.ChatPerMinute <= 0 {
+		rl.ChatPerMinute = DefaultGeminiChatPerMinute
+	}
+	if rl.ChatBurst <= 0 {
+		rl.ChatBurst = DefaultGeminiChatBurst
+	}
+	if rl.MaxQueue <= 0 {
+		rl.MaxQueue = DefaultGeminiMaxQueue
+	}
 }
 
 func getCfgFilename() string {
@@ -240,7 +321,10 @@ func InitConfig() {
 		_ = msgDb.Close()
 		msgDb = db
 	}
-	Q, err = q.PrepareWithLogger(context.Background(), db, nil)
+	if err := MigrateMainDbSchema(context.Background(), db); err != nil {
+		panic(err)
+	}
+	Q, err = q.PrepareWithLogger(context.Background(), db, GetLogger("db", slog.LevelInfo))
 	if err != nil {
 		panic(err)
 	}
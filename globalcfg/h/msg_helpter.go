@@ -15,6 +15,7 @@ import (
 	"strings"
 	"time"
 
+	g "main/globalcfg"
 	"main/helpers/lrusf"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
@@ -59,6 +60,37 @@ func MentionUserHtml(user *gotgbot.User) string {
 	return fmt.Sprintf(`<a href="tg://user?id=%d">%s</a>`, user.Id, html.EscapeString(name))
 }
 
+// MsgLink 返回超级群组中消息的 t.me/c 链接，普通群组和私聊的消息没有链接
+func MsgLink(chatId, msgId int64) (string, bool) {
+	const supergroupPrefix = -1000000000000
+	if chatId >= supergroupPrefix {
+		return "", false
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d", supergroupPrefix-chatId, msgId), true
+}
+
+// IsSenderAdmin 判断消息的发送者是否为 bot 的所有者或聊天的管理员，私聊中总是返回true
+func IsSenderAdmin(bot *gotgbot.Bot, msg *gotgbot.Message) bool {
+	userId := msg.GetSender().Id()
+	return userId == g.GetConfig().God || IsChatAdmin(bot, &msg.Chat, userId)
+}
+
+// IsChatAdmin 判断用户是否为群组的管理员或创建者，私聊中总是返回true
+func IsChatAdmin(bot *gotgbot.Bot, chat *gotgbot.Chat, userId int64) bool {
+	if chat.Type == gotgbot.ChatTypePrivate {
+		return true
+	}
+	member, err := bot.GetChatMember(chat.Id, userId, nil)
+	if err != nil {
+		return false
+	}
+	switch member.GetStatus() {
+	case "creator", "administrator":
+		return true
+	}
+	return false
+}
+
 func LocalFile(filename string) gotgbot.InputFileOrString {
 	if !filepath.IsAbs(filename) {
 		var err error
@@ -179,12 +211,12 @@ func DownloadToMemoryCached(bot *gotgbot.Bot, fileId string) (data []byte, err e
 }
 
 func init() {
-	memCache = lrusf.NewCache[string, []byte](128, idToKey, nil)
+	memCache = lrusf.NewCache[string, []byte](128, idToKey, nil).Named("file_mem")
 	diskCache = lrusf.NewCache[string, diskCacheEntry](2048, idToKey, func(_ string, entry diskCacheEntry) {
 		if entry.removeOnEvict {
 			_ = os.Remove(entry.path)
 		}
-	})
+	}).Named("file_disk")
 }
 
 func writeBytesToPath(target string, data []byte) error {
@@ -24,21 +24,48 @@ func New(db DBTX) *Queries {
 func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	q := Queries{db: db}
 	var err error
+	if q.addChatKeywordCountStmt, err = db.PrepareContext(ctx, addChatKeywordCount); err != nil {
+		return nil, fmt.Errorf("error preparing query AddChatKeywordCount: %w", err)
+	}
 	if q.addGeminiMessageStmt, err = db.PrepareContext(ctx, addGeminiMessage); err != nil {
 		return nil, fmt.Errorf("error preparing query AddGeminiMessage: %w", err)
 	}
+	if q.addGeminiPrivateUserStmt, err = db.PrepareContext(ctx, addGeminiPrivateUser); err != nil {
+		return nil, fmt.Errorf("error preparing query AddGeminiPrivateUser: %w", err)
+	}
+	if q.addGeminiSystemPromptHistoryStmt, err = db.PrepareContext(ctx, addGeminiSystemPromptHistory); err != nil {
+		return nil, fmt.Errorf("error preparing query AddGeminiSystemPromptHistory: %w", err)
+	}
+	if q.addGeminiUsageStmt, err = db.PrepareContext(ctx, addGeminiUsage); err != nil {
+		return nil, fmt.Errorf("error preparing query AddGeminiUsage: %w", err)
+	}
 	if q.createBiliInlineDataStmt, err = db.PrepareContext(ctx, createBiliInlineData); err != nil {
 		return nil, fmt.Errorf("error preparing query CreateBiliInlineData: %w", err)
 	}
 	if q.createChatCfgStmt, err = db.PrepareContext(ctx, createChatCfg); err != nil {
 		return nil, fmt.Errorf("error preparing query CreateChatCfg: %w", err)
 	}
+	if q.createGeminiBlobStmt, err = db.PrepareContext(ctx, createGeminiBlob); err != nil {
+		return nil, fmt.Errorf("error preparing query CreateGeminiBlob: %w", err)
+	}
+	if q.createGeminiInviteCodeStmt, err = db.PrepareContext(ctx, createGeminiInviteCode); err != nil {
+		return nil, fmt.Errorf("error preparing query CreateGeminiInviteCode: %w", err)
+	}
 	if q.createGeminiMemoryStmt, err = db.PrepareContext(ctx, createGeminiMemory); err != nil {
 		return nil, fmt.Errorf("error preparing query CreateGeminiMemory: %w", err)
 	}
+	if q.createGeminiScheduledPromptStmt, err = db.PrepareContext(ctx, createGeminiScheduledPrompt); err != nil {
+		return nil, fmt.Errorf("error preparing query CreateGeminiScheduledPrompt: %w", err)
+	}
 	if q.createNewGeminiSessionStmt, err = db.PrepareContext(ctx, createNewGeminiSession); err != nil {
 		return nil, fmt.Errorf("error preparing query CreateNewGeminiSession: %w", err)
 	}
+	if q.createOrUpdateGeminiChatSettingsStmt, err = db.PrepareContext(ctx, createOrUpdateGeminiChatSettings); err != nil {
+		return nil, fmt.Errorf("error preparing query CreateOrUpdateGeminiChatSettings: %w", err)
+	}
+	if q.createOrUpdateGeminiPromptPresetStmt, err = db.PrepareContext(ctx, createOrUpdateGeminiPromptPreset); err != nil {
+		return nil, fmt.Errorf("error preparing query CreateOrUpdateGeminiPromptPreset: %w", err)
+	}
 	if q.createOrUpdateGeminiSystemPromptStmt, err = db.PrepareContext(ctx, createOrUpdateGeminiSystemPrompt); err != nil {
 		return nil, fmt.Errorf("error preparing query CreateOrUpdateGeminiSystemPrompt: %w", err)
 	}
@@ -48,18 +75,75 @@ func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	if q.deleteGeminiMemoryStmt, err = db.PrepareContext(ctx, deleteGeminiMemory); err != nil {
 		return nil, fmt.Errorf("error preparing query DeleteGeminiMemory: %w", err)
 	}
+	if q.deleteGeminiPrivateUserStmt, err = db.PrepareContext(ctx, deleteGeminiPrivateUser); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteGeminiPrivateUser: %w", err)
+	}
+	if q.deleteGeminiPromptPresetStmt, err = db.PrepareContext(ctx, deleteGeminiPromptPreset); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteGeminiPromptPreset: %w", err)
+	}
+	if q.deleteGeminiScheduledPromptStmt, err = db.PrepareContext(ctx, deleteGeminiScheduledPrompt); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteGeminiScheduledPrompt: %w", err)
+	}
+	if q.deleteOrphanGeminiContentsStmt, err = db.PrepareContext(ctx, deleteOrphanGeminiContents); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteOrphanGeminiContents: %w", err)
+	}
+	if q.deleteUnusedGeminiBlobsStmt, err = db.PrepareContext(ctx, deleteUnusedGeminiBlobs); err != nil {
+		return nil, fmt.Errorf("error preparing query DeleteUnusedGeminiBlobs: %w", err)
+	}
 	if q.getBiliInlineDataStmt, err = db.PrepareContext(ctx, getBiliInlineData); err != nil {
 		return nil, fmt.Errorf("error preparing query GetBiliInlineData: %w", err)
 	}
+	if q.getChatGeminiUsageSinceStmt, err = db.PrepareContext(ctx, getChatGeminiUsageSince); err != nil {
+		return nil, fmt.Errorf("error preparing query GetChatGeminiUsageSince: %w", err)
+	}
+	if q.getChatTopicNameStmt, err = db.PrepareContext(ctx, getChatTopicName); err != nil {
+		return nil, fmt.Errorf("error preparing query GetChatTopicName: %w", err)
+	}
+	if q.getChatUserStatRankStmt, err = db.PrepareContext(ctx, getChatUserStatRank); err != nil {
+		return nil, fmt.Errorf("error preparing query GetChatUserStatRank: %w", err)
+	}
+	if q.getChatUserStatTotalStmt, err = db.PrepareContext(ctx, getChatUserStatTotal); err != nil {
+		return nil, fmt.Errorf("error preparing query GetChatUserStatTotal: %w", err)
+	}
 	if q.getCocCharAllAttrStmt, err = db.PrepareContext(ctx, getCocCharAllAttr); err != nil {
 		return nil, fmt.Errorf("error preparing query GetCocCharAllAttr: %w", err)
 	}
 	if q.getCocCharAttrStmt, err = db.PrepareContext(ctx, getCocCharAttr); err != nil {
 		return nil, fmt.Errorf("error preparing query GetCocCharAttr: %w", err)
 	}
+	if q.getFirstGeminiContentStmt, err = db.PrepareContext(ctx, getFirstGeminiContent); err != nil {
+		return nil, fmt.Errorf("error preparing query GetFirstGeminiContent: %w", err)
+	}
+	if q.getGeminiBlobDataStmt, err = db.PrepareContext(ctx, getGeminiBlobData); err != nil {
+		return nil, fmt.Errorf("error preparing query GetGeminiBlobData: %w", err)
+	}
+	if q.getGeminiChatSettingsStmt, err = db.PrepareContext(ctx, getGeminiChatSettings); err != nil {
+		return nil, fmt.Errorf("error preparing query GetGeminiChatSettings: %w", err)
+	}
+	if q.getGeminiPrivateUserStmt, err = db.PrepareContext(ctx, getGeminiPrivateUser); err != nil {
+		return nil, fmt.Errorf("error preparing query GetGeminiPrivateUser: %w", err)
+	}
+	if q.getGeminiPromptPresetStmt, err = db.PrepareContext(ctx, getGeminiPromptPreset); err != nil {
+		return nil, fmt.Errorf("error preparing query GetGeminiPromptPreset: %w", err)
+	}
+	if q.getGeminiScheduledPromptStmt, err = db.PrepareContext(ctx, getGeminiScheduledPrompt); err != nil {
+		return nil, fmt.Errorf("error preparing query GetGeminiScheduledPrompt: %w", err)
+	}
 	if q.getGeminiSystemPromptStmt, err = db.PrepareContext(ctx, getGeminiSystemPrompt); err != nil {
 		return nil, fmt.Errorf("error preparing query GetGeminiSystemPrompt: %w", err)
 	}
+	if q.getGeminiSystemPromptLatestVersionStmt, err = db.PrepareContext(ctx, getGeminiSystemPromptLatestVersion); err != nil {
+		return nil, fmt.Errorf("error preparing query GetGeminiSystemPromptLatestVersion: %w", err)
+	}
+	if q.getGeminiSystemPromptVersionStmt, err = db.PrepareContext(ctx, getGeminiSystemPromptVersion); err != nil {
+		return nil, fmt.Errorf("error preparing query GetGeminiSystemPromptVersion: %w", err)
+	}
+	if q.getLastChatStatDateStmt, err = db.PrepareContext(ctx, getLastChatStatDate); err != nil {
+		return nil, fmt.Errorf("error preparing query GetLastChatStatDate: %w", err)
+	}
+	if q.getLatestGeminiSummaryStmt, err = db.PrepareContext(ctx, getLatestGeminiSummary); err != nil {
+		return nil, fmt.Errorf("error preparing query GetLatestGeminiSummary: %w", err)
+	}
 	if q.getNsfwPicByFileUidStmt, err = db.PrepareContext(ctx, getNsfwPicByFileUid); err != nil {
 		return nil, fmt.Errorf("error preparing query GetNsfwPicByFileUid: %w", err)
 	}
@@ -72,6 +156,9 @@ func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	if q.getSessionIdByMessageStmt, err = db.PrepareContext(ctx, getSessionIdByMessage); err != nil {
 		return nil, fmt.Errorf("error preparing query GetSessionIdByMessage: %w", err)
 	}
+	if q.getUserGeminiUsageSinceStmt, err = db.PrepareContext(ctx, getUserGeminiUsageSince); err != nil {
+		return nil, fmt.Errorf("error preparing query GetUserGeminiUsageSince: %w", err)
+	}
 	if q.getYtDlpDbCacheStmt, err = db.PrepareContext(ctx, getYtDlpDbCache); err != nil {
 		return nil, fmt.Errorf("error preparing query GetYtDlpDbCache: %w", err)
 	}
@@ -81,18 +168,63 @@ func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	if q.incrementSessionTokenCountersStmt, err = db.PrepareContext(ctx, incrementSessionTokenCounters); err != nil {
 		return nil, fmt.Errorf("error preparing query IncrementSessionTokenCounters: %w", err)
 	}
+	if q.listAllGeminiScheduledPromptsStmt, err = db.PrepareContext(ctx, listAllGeminiScheduledPrompts); err != nil {
+		return nil, fmt.Errorf("error preparing query ListAllGeminiScheduledPrompts: %w", err)
+	}
+	if q.listChatGeminiScheduledPromptsStmt, err = db.PrepareContext(ctx, listChatGeminiScheduledPrompts); err != nil {
+		return nil, fmt.Errorf("error preparing query ListChatGeminiScheduledPrompts: %w", err)
+	}
+	if q.listChatGeminiUsageSinceStmt, err = db.PrepareContext(ctx, listChatGeminiUsageSince); err != nil {
+		return nil, fmt.Errorf("error preparing query ListChatGeminiUsageSince: %w", err)
+	}
+	if q.listChatKeywordScansStmt, err = db.PrepareContext(ctx, listChatKeywordScans); err != nil {
+		return nil, fmt.Errorf("error preparing query ListChatKeywordScans: %w", err)
+	}
+	if q.listDailyStatChatsStmt, err = db.PrepareContext(ctx, listDailyStatChats); err != nil {
+		return nil, fmt.Errorf("error preparing query ListDailyStatChats: %w", err)
+	}
 	if q.listGeminiMemoryStmt, err = db.PrepareContext(ctx, listGeminiMemory); err != nil {
 		return nil, fmt.Errorf("error preparing query ListGeminiMemory: %w", err)
 	}
+	if q.listGeminiPrivateUsersStmt, err = db.PrepareContext(ctx, listGeminiPrivateUsers); err != nil {
+		return nil, fmt.Errorf("error preparing query ListGeminiPrivateUsers: %w", err)
+	}
+	if q.listGeminiPromptPresetsStmt, err = db.PrepareContext(ctx, listGeminiPromptPresets); err != nil {
+		return nil, fmt.Errorf("error preparing query ListGeminiPromptPresets: %w", err)
+	}
+	if q.listGeminiSystemPromptHistoryStmt, err = db.PrepareContext(ctx, listGeminiSystemPromptHistory); err != nil {
+		return nil, fmt.Errorf("error preparing query ListGeminiSystemPromptHistory: %w", err)
+	}
 	if q.listNsfwPicUserRatesByFileUidStmt, err = db.PrepareContext(ctx, listNsfwPicUserRatesByFileUid); err != nil {
 		return nil, fmt.Errorf("error preparing query ListNsfwPicUserRatesByFileUid: %w", err)
 	}
+	if q.listRecentGeminiSessionsStmt, err = db.PrepareContext(ctx, listRecentGeminiSessions); err != nil {
+		return nil, fmt.Errorf("error preparing query ListRecentGeminiSessions: %w", err)
+	}
+	if q.listTopChatKeywordsStmt, err = db.PrepareContext(ctx, listTopChatKeywords); err != nil {
+		return nil, fmt.Errorf("error preparing query ListTopChatKeywords: %w", err)
+	}
+	if q.markChatStatSentStmt, err = db.PrepareContext(ctx, markChatStatSent); err != nil {
+		return nil, fmt.Errorf("error preparing query MarkChatStatSent: %w", err)
+	}
+	if q.pruneChatKeywordsStmt, err = db.PrepareContext(ctx, pruneChatKeywords); err != nil {
+		return nil, fmt.Errorf("error preparing query PruneChatKeywords: %w", err)
+	}
+	if q.recountGeminiBlobRefsStmt, err = db.PrepareContext(ctx, recountGeminiBlobRefs); err != nil {
+		return nil, fmt.Errorf("error preparing query RecountGeminiBlobRefs: %w", err)
+	}
 	if q.resetGeminiSystemPromptStmt, err = db.PrepareContext(ctx, resetGeminiSystemPrompt); err != nil {
 		return nil, fmt.Errorf("error preparing query ResetGeminiSystemPrompt: %w", err)
 	}
+	if q.setChatKeywordScanStmt, err = db.PrepareContext(ctx, setChatKeywordScan); err != nil {
+		return nil, fmt.Errorf("error preparing query SetChatKeywordScan: %w", err)
+	}
 	if q.setCocCharAttrStmt, err = db.PrepareContext(ctx, setCocCharAttr); err != nil {
 		return nil, fmt.Errorf("error preparing query SetCocCharAttr: %w", err)
 	}
+	if q.setGeminiSessionFrozenStmt, err = db.PrepareContext(ctx, setGeminiSessionFrozen); err != nil {
+		return nil, fmt.Errorf("error preparing query SetGeminiSessionFrozen: %w", err)
+	}
 	if q.setPrprCacheStmt, err = db.PrepareContext(ctx, setPrprCache); err != nil {
 		return nil, fmt.Errorf("error preparing query SetPrprCache: %w", err)
 	}
@@ -108,9 +240,18 @@ func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	if q.updateGeminiMemoryStmt, err = db.PrepareContext(ctx, updateGeminiMemory); err != nil {
 		return nil, fmt.Errorf("error preparing query UpdateGeminiMemory: %w", err)
 	}
+	if q.updateGeminiScheduledPromptRunStmt, err = db.PrepareContext(ctx, updateGeminiScheduledPromptRun); err != nil {
+		return nil, fmt.Errorf("error preparing query UpdateGeminiScheduledPromptRun: %w", err)
+	}
 	if q.updateYtDlpCacheStmt, err = db.PrepareContext(ctx, updateYtDlpCache); err != nil {
 		return nil, fmt.Errorf("error preparing query UpdateYtDlpCache: %w", err)
 	}
+	if q.useGeminiInviteCodeStmt, err = db.PrepareContext(ctx, useGeminiInviteCode); err != nil {
+		return nil, fmt.Errorf("error preparing query UseGeminiInviteCode: %w", err)
+	}
+	if q.addChatUserStatTotalStmt, err = db.PrepareContext(ctx, addChatUserStatTotal); err != nil {
+		return nil, fmt.Errorf("error preparing query addChatUserStatTotal: %w", err)
+	}
 	if q.createChatStatDailyStmt, err = db.PrepareContext(ctx, createChatStatDaily); err != nil {
 		return nil, fmt.Errorf("error preparing query createChatStatDaily: %w", err)
 	}
@@ -150,12 +291,21 @@ func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 	if q.getUserByIdStmt, err = db.PrepareContext(ctx, getUserById); err != nil {
 		return nil, fmt.Errorf("error preparing query getUserById: %w", err)
 	}
+	if q.listChatStatRangeStmt, err = db.PrepareContext(ctx, listChatStatRange); err != nil {
+		return nil, fmt.Errorf("error preparing query listChatStatRange: %w", err)
+	}
+	if q.listLegacyChatStatsStmt, err = db.PrepareContext(ctx, listLegacyChatStats); err != nil {
+		return nil, fmt.Errorf("error preparing query listLegacyChatStats: %w", err)
+	}
 	if q.listNsfwPicRateCounterStmt, err = db.PrepareContext(ctx, listNsfwPicRateCounter); err != nil {
 		return nil, fmt.Errorf("error preparing query listNsfwPicRateCounter: %w", err)
 	}
 	if q.updateChatCfgStmt, err = db.PrepareContext(ctx, updateChatCfg); err != nil {
 		return nil, fmt.Errorf("error preparing query updateChatCfg: %w", err)
 	}
+	if q.updateLegacyChatStatStmt, err = db.PrepareContext(ctx, updateLegacyChatStat); err != nil {
+		return nil, fmt.Errorf("error preparing query updateLegacyChatStat: %w", err)
+	}
 	if q.updateNsfwPicUserRateStmt, err = db.PrepareContext(ctx, updateNsfwPicUserRate); err != nil {
 		return nil, fmt.Errorf("error preparing query updateNsfwPicUserRate: %w", err)
 	}
@@ -173,11 +323,31 @@ func Prepare(ctx context.Context, db DBTX) (*Queries, error) {
 
 func (q *Queries) Close() error {
 	var err error
+	if q.addChatKeywordCountStmt != nil {
+		if cerr := q.addChatKeywordCountStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing addChatKeywordCountStmt: %w", cerr)
+		}
+	}
 	if q.addGeminiMessageStmt != nil {
 		if cerr := q.addGeminiMessageStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing addGeminiMessageStmt: %w", cerr)
 		}
 	}
+	if q.addGeminiPrivateUserStmt != nil {
+		if cerr := q.addGeminiPrivateUserStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing addGeminiPrivateUserStmt: %w", cerr)
+		}
+	}
+	if q.addGeminiSystemPromptHistoryStmt != nil {
+		if cerr := q.addGeminiSystemPromptHistoryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing addGeminiSystemPromptHistoryStmt: %w", cerr)
+		}
+	}
+	if q.addGeminiUsageStmt != nil {
+		if cerr := q.addGeminiUsageStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing addGeminiUsageStmt: %w", cerr)
+		}
+	}
 	if q.createBiliInlineDataStmt != nil {
 		if cerr := q.createBiliInlineDataStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing createBiliInlineDataStmt: %w", cerr)
@@ -188,16 +358,41 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing createChatCfgStmt: %w", cerr)
 		}
 	}
+	if q.createGeminiBlobStmt != nil {
+		if cerr := q.createGeminiBlobStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing createGeminiBlobStmt: %w", cerr)
+		}
+	}
+	if q.createGeminiInviteCodeStmt != nil {
+		if cerr := q.createGeminiInviteCodeStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing createGeminiInviteCodeStmt: %w", cerr)
+		}
+	}
 	if q.createGeminiMemoryStmt != nil {
 		if cerr := q.createGeminiMemoryStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing createGeminiMemoryStmt: %w", cerr)
 		}
 	}
+	if q.createGeminiScheduledPromptStmt != nil {
+		if cerr := q.createGeminiScheduledPromptStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing createGeminiScheduledPromptStmt: %w", cerr)
+		}
+	}
 	if q.createNewGeminiSessionStmt != nil {
 		if cerr := q.createNewGeminiSessionStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing createNewGeminiSessionStmt: %w", cerr)
 		}
 	}
+	if q.createOrUpdateGeminiChatSettingsStmt != nil {
+		if cerr := q.createOrUpdateGeminiChatSettingsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing createOrUpdateGeminiChatSettingsStmt: %w", cerr)
+		}
+	}
+	if q.createOrUpdateGeminiPromptPresetStmt != nil {
+		if cerr := q.createOrUpdateGeminiPromptPresetStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing createOrUpdateGeminiPromptPresetStmt: %w", cerr)
+		}
+	}
 	if q.createOrUpdateGeminiSystemPromptStmt != nil {
 		if cerr := q.createOrUpdateGeminiSystemPromptStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing createOrUpdateGeminiSystemPromptStmt: %w", cerr)
@@ -213,11 +408,56 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing deleteGeminiMemoryStmt: %w", cerr)
 		}
 	}
+	if q.deleteGeminiPrivateUserStmt != nil {
+		if cerr := q.deleteGeminiPrivateUserStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteGeminiPrivateUserStmt: %w", cerr)
+		}
+	}
+	if q.deleteGeminiPromptPresetStmt != nil {
+		if cerr := q.deleteGeminiPromptPresetStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteGeminiPromptPresetStmt: %w", cerr)
+		}
+	}
+	if q.deleteGeminiScheduledPromptStmt != nil {
+		if cerr := q.deleteGeminiScheduledPromptStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteGeminiScheduledPromptStmt: %w", cerr)
+		}
+	}
+	if q.deleteOrphanGeminiContentsStmt != nil {
+		if cerr := q.deleteOrphanGeminiContentsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteOrphanGeminiContentsStmt: %w", cerr)
+		}
+	}
+	if q.deleteUnusedGeminiBlobsStmt != nil {
+		if cerr := q.deleteUnusedGeminiBlobsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing deleteUnusedGeminiBlobsStmt: %w", cerr)
+		}
+	}
 	if q.getBiliInlineDataStmt != nil {
 		if cerr := q.getBiliInlineDataStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing getBiliInlineDataStmt: %w", cerr)
 		}
 	}
+	if q.getChatGeminiUsageSinceStmt != nil {
+		if cerr := q.getChatGeminiUsageSinceStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getChatGeminiUsageSinceStmt: %w", cerr)
+		}
+	}
+	if q.getChatTopicNameStmt != nil {
+		if cerr := q.getChatTopicNameStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getChatTopicNameStmt: %w", cerr)
+		}
+	}
+	if q.getChatUserStatRankStmt != nil {
+		if cerr := q.getChatUserStatRankStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getChatUserStatRankStmt: %w", cerr)
+		}
+	}
+	if q.getChatUserStatTotalStmt != nil {
+		if cerr := q.getChatUserStatTotalStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getChatUserStatTotalStmt: %w", cerr)
+		}
+	}
 	if q.getCocCharAllAttrStmt != nil {
 		if cerr := q.getCocCharAllAttrStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing getCocCharAllAttrStmt: %w", cerr)
@@ -228,11 +468,61 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing getCocCharAttrStmt: %w", cerr)
 		}
 	}
+	if q.getFirstGeminiContentStmt != nil {
+		if cerr := q.getFirstGeminiContentStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getFirstGeminiContentStmt: %w", cerr)
+		}
+	}
+	if q.getGeminiBlobDataStmt != nil {
+		if cerr := q.getGeminiBlobDataStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getGeminiBlobDataStmt: %w", cerr)
+		}
+	}
+	if q.getGeminiChatSettingsStmt != nil {
+		if cerr := q.getGeminiChatSettingsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getGeminiChatSettingsStmt: %w", cerr)
+		}
+	}
+	if q.getGeminiPrivateUserStmt != nil {
+		if cerr := q.getGeminiPrivateUserStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getGeminiPrivateUserStmt: %w", cerr)
+		}
+	}
+	if q.getGeminiPromptPresetStmt != nil {
+		if cerr := q.getGeminiPromptPresetStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getGeminiPromptPresetStmt: %w", cerr)
+		}
+	}
+	if q.getGeminiScheduledPromptStmt != nil {
+		if cerr := q.getGeminiScheduledPromptStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getGeminiScheduledPromptStmt: %w", cerr)
+		}
+	}
 	if q.getGeminiSystemPromptStmt != nil {
 		if cerr := q.getGeminiSystemPromptStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing getGeminiSystemPromptStmt: %w", cerr)
 		}
 	}
+	if q.getGeminiSystemPromptLatestVersionStmt != nil {
+		if cerr := q.getGeminiSystemPromptLatestVersionStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getGeminiSystemPromptLatestVersionStmt: %w", cerr)
+		}
+	}
+	if q.getGeminiSystemPromptVersionStmt != nil {
+		if cerr := q.getGeminiSystemPromptVersionStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getGeminiSystemPromptVersionStmt: %w", cerr)
+		}
+	}
+	if q.getLastChatStatDateStmt != nil {
+		if cerr := q.getLastChatStatDateStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getLastChatStatDateStmt: %w", cerr)
+		}
+	}
+	if q.getLatestGeminiSummaryStmt != nil {
+		if cerr := q.getLatestGeminiSummaryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getLatestGeminiSummaryStmt: %w", cerr)
+		}
+	}
 	if q.getNsfwPicByFileUidStmt != nil {
 		if cerr := q.getNsfwPicByFileUidStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing getNsfwPicByFileUidStmt: %w", cerr)
@@ -253,6 +543,11 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing getSessionIdByMessageStmt: %w", cerr)
 		}
 	}
+	if q.getUserGeminiUsageSinceStmt != nil {
+		if cerr := q.getUserGeminiUsageSinceStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing getUserGeminiUsageSinceStmt: %w", cerr)
+		}
+	}
 	if q.getYtDlpDbCacheStmt != nil {
 		if cerr := q.getYtDlpDbCacheStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing getYtDlpDbCacheStmt: %w", cerr)
@@ -268,26 +563,101 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing incrementSessionTokenCountersStmt: %w", cerr)
 		}
 	}
+	if q.listAllGeminiScheduledPromptsStmt != nil {
+		if cerr := q.listAllGeminiScheduledPromptsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listAllGeminiScheduledPromptsStmt: %w", cerr)
+		}
+	}
+	if q.listChatGeminiScheduledPromptsStmt != nil {
+		if cerr := q.listChatGeminiScheduledPromptsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listChatGeminiScheduledPromptsStmt: %w", cerr)
+		}
+	}
+	if q.listChatGeminiUsageSinceStmt != nil {
+		if cerr := q.listChatGeminiUsageSinceStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listChatGeminiUsageSinceStmt: %w", cerr)
+		}
+	}
+	if q.listChatKeywordScansStmt != nil {
+		if cerr := q.listChatKeywordScansStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listChatKeywordScansStmt: %w", cerr)
+		}
+	}
+	if q.listDailyStatChatsStmt != nil {
+		if cerr := q.listDailyStatChatsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listDailyStatChatsStmt: %w", cerr)
+		}
+	}
 	if q.listGeminiMemoryStmt != nil {
 		if cerr := q.listGeminiMemoryStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing listGeminiMemoryStmt: %w", cerr)
 		}
 	}
+	if q.listGeminiPrivateUsersStmt != nil {
+		if cerr := q.listGeminiPrivateUsersStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listGeminiPrivateUsersStmt: %w", cerr)
+		}
+	}
+	if q.listGeminiPromptPresetsStmt != nil {
+		if cerr := q.listGeminiPromptPresetsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listGeminiPromptPresetsStmt: %w", cerr)
+		}
+	}
+	if q.listGeminiSystemPromptHistoryStmt != nil {
+		if cerr := q.listGeminiSystemPromptHistoryStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listGeminiSystemPromptHistoryStmt: %w", cerr)
+		}
+	}
 	if q.listNsfwPicUserRatesByFileUidStmt != nil {
 		if cerr := q.listNsfwPicUserRatesByFileUidStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing listNsfwPicUserRatesByFileUidStmt: %w", cerr)
 		}
 	}
+	if q.listRecentGeminiSessionsStmt != nil {
+		if cerr := q.listRecentGeminiSessionsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listRecentGeminiSessionsStmt: %w", cerr)
+		}
+	}
+	if q.listTopChatKeywordsStmt != nil {
+		if cerr := q.listTopChatKeywordsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listTopChatKeywordsStmt: %w", cerr)
+		}
+	}
+	if q.markChatStatSentStmt != nil {
+		if cerr := q.markChatStatSentStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing markChatStatSentStmt: %w", cerr)
+		}
+	}
+	if q.pruneChatKeywordsStmt != nil {
+		if cerr := q.pruneChatKeywordsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing pruneChatKeywordsStmt: %w", cerr)
+		}
+	}
+	if q.recountGeminiBlobRefsStmt != nil {
+		if cerr := q.recountGeminiBlobRefsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing recountGeminiBlobRefsStmt: %w", cerr)
+		}
+	}
 	if q.resetGeminiSystemPromptStmt != nil {
 		if cerr := q.resetGeminiSystemPromptStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing resetGeminiSystemPromptStmt: %w", cerr)
 		}
 	}
+	if q.setChatKeywordScanStmt != nil {
+		if cerr := q.setChatKeywordScanStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing setChatKeywordScanStmt: %w", cerr)
+		}
+	}
 	if q.setCocCharAttrStmt != nil {
 		if cerr := q.setCocCharAttrStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing setCocCharAttrStmt: %w", cerr)
 		}
 	}
+	if q.setGeminiSessionFrozenStmt != nil {
+		if cerr := q.setGeminiSessionFrozenStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing setGeminiSessionFrozenStmt: %w", cerr)
+		}
+	}
 	if q.setPrprCacheStmt != nil {
 		if cerr := q.setPrprCacheStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing setPrprCacheStmt: %w", cerr)
@@ -313,11 +683,26 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing updateGeminiMemoryStmt: %w", cerr)
 		}
 	}
+	if q.updateGeminiScheduledPromptRunStmt != nil {
+		if cerr := q.updateGeminiScheduledPromptRunStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing updateGeminiScheduledPromptRunStmt: %w", cerr)
+		}
+	}
 	if q.updateYtDlpCacheStmt != nil {
 		if cerr := q.updateYtDlpCacheStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing updateYtDlpCacheStmt: %w", cerr)
 		}
 	}
+	if q.useGeminiInviteCodeStmt != nil {
+		if cerr := q.useGeminiInviteCodeStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing useGeminiInviteCodeStmt: %w", cerr)
+		}
+	}
+	if q.addChatUserStatTotalStmt != nil {
+		if cerr := q.addChatUserStatTotalStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing addChatUserStatTotalStmt: %w", cerr)
+		}
+	}
 	if q.createChatStatDailyStmt != nil {
 		if cerr := q.createChatStatDailyStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing createChatStatDailyStmt: %w", cerr)
@@ -383,6 +768,16 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing getUserByIdStmt: %w", cerr)
 		}
 	}
+	if q.listChatStatRangeStmt != nil {
+		if cerr := q.listChatStatRangeStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listChatStatRangeStmt: %w", cerr)
+		}
+	}
+	if q.listLegacyChatStatsStmt != nil {
+		if cerr := q.listLegacyChatStatsStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing listLegacyChatStatsStmt: %w", cerr)
+		}
+	}
 	if q.listNsfwPicRateCounterStmt != nil {
 		if cerr := q.listNsfwPicRateCounterStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing listNsfwPicRateCounterStmt: %w", cerr)
@@ -393,6 +788,11 @@ func (q *Queries) Close() error {
 			err = fmt.Errorf("error closing updateChatCfgStmt: %w", cerr)
 		}
 	}
+	if q.updateLegacyChatStatStmt != nil {
+		if cerr := q.updateLegacyChatStatStmt.Close(); cerr != nil {
+			err = fmt.Errorf("error closing updateLegacyChatStatStmt: %w", cerr)
+		}
+	}
 	if q.updateNsfwPicUserRateStmt != nil {
 		if cerr := q.updateNsfwPicUserRateStmt.Close(); cerr != nil {
 			err = fmt.Errorf("error closing updateNsfwPicUserRateStmt: %w", cerr)
@@ -450,109 +850,209 @@ func (q *Queries) queryRow(ctx context.Context, stmt *sql.Stmt, query string, ar
 }
 
 type Queries struct {
-	db                                   DBTX
-	tx                                   *sql.Tx
-	addGeminiMessageStmt                 *sql.Stmt
-	createBiliInlineDataStmt             *sql.Stmt
-	createChatCfgStmt                    *sql.Stmt
-	createGeminiMemoryStmt               *sql.Stmt
-	createNewGeminiSessionStmt           *sql.Stmt
-	createOrUpdateGeminiSystemPromptStmt *sql.Stmt
-	delCocCharAttrStmt                   *sql.Stmt
-	deleteGeminiMemoryStmt               *sql.Stmt
-	getBiliInlineDataStmt                *sql.Stmt
-	getCocCharAllAttrStmt                *sql.Stmt
-	getCocCharAttrStmt                   *sql.Stmt
-	getGeminiSystemPromptStmt            *sql.Stmt
-	getNsfwPicByFileUidStmt              *sql.Stmt
-	getPrprCacheStmt                     *sql.Stmt
-	getSessionByIdStmt                   *sql.Stmt
-	getSessionIdByMessageStmt            *sql.Stmt
-	getYtDlpDbCacheStmt                  *sql.Stmt
-	incYtDlUploadCountStmt               *sql.Stmt
-	incrementSessionTokenCountersStmt    *sql.Stmt
-	listGeminiMemoryStmt                 *sql.Stmt
-	listNsfwPicUserRatesByFileUidStmt    *sql.Stmt
-	resetGeminiSystemPromptStmt          *sql.Stmt
-	setCocCharAttrStmt                   *sql.Stmt
-	setPrprCacheStmt                     *sql.Stmt
-	updateBiliInlineMsgIdStmt            *sql.Stmt
-	updateChatStatDailyStmt              *sql.Stmt
-	updateChatTopicNameStmt              *sql.Stmt
-	updateGeminiMemoryStmt               *sql.Stmt
-	updateYtDlpCacheStmt                 *sql.Stmt
-	createChatStatDailyStmt              *sql.Stmt
-	createNewUserStmt                    *sql.Stmt
-	createNsfwPicUserRateStmt            *sql.Stmt
-	createOrUpdateChatAttrStmt           *sql.Stmt
-	createOrUpdateNsfwPicStmt            *sql.Stmt
-	getAllMsgInSessionReversedStmt       *sql.Stmt
-	getChatCfgByIdStmt                   *sql.Stmt
-	getChatIdByWebIdStmt                 *sql.Stmt
-	getChatStatStmt                      *sql.Stmt
-	getNsfwPicByRateAndRandKeyStmt       *sql.Stmt
-	getNsfwPicByRateFirstStmt            *sql.Stmt
-	getNsfwPicRateByUserIdStmt           *sql.Stmt
-	getUserByIdStmt                      *sql.Stmt
-	listNsfwPicRateCounterStmt           *sql.Stmt
-	updateChatCfgStmt                    *sql.Stmt
-	updateNsfwPicUserRateStmt            *sql.Stmt
-	updateUserBaseStmt                   *sql.Stmt
-	updateUserProfilePhotoStmt           *sql.Stmt
-	updateUserTimeZoneStmt               *sql.Stmt
+	db                                     DBTX
+	tx                                     *sql.Tx
+	addChatKeywordCountStmt                *sql.Stmt
+	addGeminiMessageStmt                   *sql.Stmt
+	addGeminiPrivateUserStmt               *sql.Stmt
+	addGeminiSystemPromptHistoryStmt       *sql.Stmt
+	addGeminiUsageStmt                     *sql.Stmt
+	createBiliInlineDataStmt               *sql.Stmt
+	createChatCfgStmt                      *sql.Stmt
+	createGeminiBlobStmt                   *sql.Stmt
+	createGeminiInviteCodeStmt             *sql.Stmt
+	createGeminiMemoryStmt                 *sql.Stmt
+	createGeminiScheduledPromptStmt        *sql.Stmt
+	createNewGeminiSessionStmt             *sql.Stmt
+	createOrUpdateGeminiChatSettingsStmt   *sql.Stmt
+	createOrUpdateGeminiPromptPresetStmt   *sql.Stmt
+	createOrUpdateGeminiSystemPromptStmt   *sql.Stmt
+	delCocCharAttrStmt                     *sql.Stmt
+	deleteGeminiMemoryStmt                 *sql.Stmt
+	deleteGeminiPrivateUserStmt            *sql.Stmt
+	deleteGeminiPromptPresetStmt           *sql.Stmt
+	deleteGeminiScheduledPromptStmt        *sql.Stmt
+	deleteOrphanGeminiContentsStmt         *sql.Stmt
+	deleteUnusedGeminiBlobsStmt            *sql.Stmt
+	getBiliInlineDataStmt                  *sql.Stmt
+	getChatGeminiUsageSinceStmt            *sql.Stmt
+	getChatTopicNameStmt                   *sql.Stmt
+	getChatUserStatRankStmt                *sql.Stmt
+	getChatUserStatTotalStmt               *sql.Stmt
+	getCocCharAllAttrStmt                  *sql.Stmt
+	getCocCharAttrStmt                     *sql.Stmt
+	getFirstGeminiContentStmt              *sql.Stmt
+	getGeminiBlobDataStmt                  *sql.Stmt
+	getGeminiChatSettingsStmt              *sql.Stmt
+	getGeminiPrivateUserStmt               *sql.Stmt
+	getGeminiPromptPresetStmt              *sql.Stmt
+	getGeminiScheduledPromptStmt           *sql.Stmt
+	getGeminiSystemPromptStmt              *sql.Stmt
+	getGeminiSystemPromptLatestVersionStmt *sql.Stmt
+	getGeminiSystemPromptVersionStmt       *sql.Stmt
+	getLastChatStatDateStmt                *sql.Stmt
+	getLatestGeminiSummaryStmt             *sql.Stmt
+	getNsfwPicByFileUidStmt                *sql.Stmt
+	getPrprCacheStmt                       *sql.Stmt
+	getSessionByIdStmt                     *sql.Stmt
+	getSessionIdByMessageStmt              *sql.Stmt
+	getUserGeminiUsageSinceStmt            *sql.Stmt
+	getYtDlpDbCacheStmt                    *sql.Stmt
+	incYtDlUploadCountStmt                 *sql.Stmt
+	incrementSessionTokenCountersStmt      *sql.Stmt
+	listAllGeminiScheduledPromptsStmt      *sql.Stmt
+	listChatGeminiScheduledPromptsStmt     *sql.Stmt
+	listChatGeminiUsageSinceStmt           *sql.Stmt
+	listChatKeywordScansStmt               *sql.Stmt
+	listDailyStatChatsStmt                 *sql.Stmt
+	listGeminiMemoryStmt                   *sql.Stmt
+	listGeminiPrivateUsersStmt             *sql.Stmt
+	listGeminiPromptPresetsStmt            *sql.Stmt
+	listGeminiSystemPromptHistoryStmt      *sql.Stmt
+	listNsfwPicUserRatesByFileUidStmt      *sql.Stmt
+	listRecentGeminiSessionsStmt           *sql.Stmt
+	listTopChatKeywordsStmt                *sql.Stmt
+	markChatStatSentStmt                   *sql.Stmt
+	pruneChatKeywordsStmt                  *sql.Stmt
+	recountGeminiBlobRefsStmt              *sql.Stmt
+	resetGeminiSystemPromptStmt            *sql.Stmt
+	setChatKeywordScanStmt                 *sql.Stmt
+	setCocCharAttrStmt                     *sql.Stmt
+	setGeminiSessionFrozenStmt             *sql.Stmt
+	setPrprCacheStmt                       *sql.Stmt
+	updateBiliInlineMsgIdStmt              *sql.Stmt
+	updateChatStatDailyStmt                *sql.Stmt
+	updateChatTopicNameStmt                *sql.Stmt
+	updateGeminiMemoryStmt                 *sql.Stmt
+	updateGeminiScheduledPromptRunStmt     *sql.Stmt
+	updateYtDlpCacheStmt                   *sql.Stmt
+	useGeminiInviteCodeStmt                *sql.Stmt
+	addChatUserStatTotalStmt               *sql.Stmt
+	createChatStatDailyStmt                *sql.Stmt
+	createNewUserStmt                      *sql.Stmt
+	createNsfwPicUserRateStmt              *sql.Stmt
+	createOrUpdateChatAttrStmt             *sql.Stmt
+	createOrUpdateNsfwPicStmt              *sql.Stmt
+	getAllMsgInSessionReversedStmt         *sql.Stmt
+	getChatCfgByIdStmt                     *sql.Stmt
+	getChatIdByWebIdStmt                   *sql.Stmt
+	getChatStatStmt                        *sql.Stmt
+	getNsfwPicByRateAndRandKeyStmt         *sql.Stmt
+	getNsfwPicByRateFirstStmt              *sql.Stmt
+	getNsfwPicRateByUserIdStmt             *sql.Stmt
+	getUserByIdStmt                        *sql.Stmt
+	listChatStatRangeStmt                  *sql.Stmt
+	listLegacyChatStatsStmt                *sql.Stmt
+	listNsfwPicRateCounterStmt             *sql.Stmt
+	updateChatCfgStmt                      *sql.Stmt
+	updateLegacyChatStatStmt               *sql.Stmt
+	updateNsfwPicUserRateStmt              *sql.Stmt
+	updateUserBaseStmt                     *sql.Stmt
+	updateUserProfilePhotoStmt             *sql.Stmt
+	updateUserTimeZoneStmt                 *sql.Stmt
 }
 
 func (q *Queries) WithTx(tx *sql.Tx) *Queries {
 	return &Queries{
-		db:                                   tx,
-		tx:                                   tx,
-		addGeminiMessageStmt:                 q.addGeminiMessageStmt,
-		createBiliInlineDataStmt:             q.createBiliInlineDataStmt,
-		createChatCfgStmt:                    q.createChatCfgStmt,
-		createGeminiMemoryStmt:               q.createGeminiMemoryStmt,
-		createNewGeminiSessionStmt:           q.createNewGeminiSessionStmt,
-		createOrUpdateGeminiSystemPromptStmt: q.createOrUpdateGeminiSystemPromptStmt,
-		delCocCharAttrStmt:                   q.delCocCharAttrStmt,
-		deleteGeminiMemoryStmt:               q.deleteGeminiMemoryStmt,
-		getBiliInlineDataStmt:                q.getBiliInlineDataStmt,
-		getCocCharAllAttrStmt:                q.getCocCharAllAttrStmt,
-		getCocCharAttrStmt:                   q.getCocCharAttrStmt,
-		getGeminiSystemPromptStmt:            q.getGeminiSystemPromptStmt,
-		getNsfwPicByFileUidStmt:              q.getNsfwPicByFileUidStmt,
-		getPrprCacheStmt:                     q.getPrprCacheStmt,
-		getSessionByIdStmt:                   q.getSessionByIdStmt,
-		getSessionIdByMessageStmt:            q.getSessionIdByMessageStmt,
-		getYtDlpDbCacheStmt:                  q.getYtDlpDbCacheStmt,
-		incYtDlUploadCountStmt:               q.incYtDlUploadCountStmt,
-		incrementSessionTokenCountersStmt:    q.incrementSessionTokenCountersStmt,
-		listGeminiMemoryStmt:                 q.listGeminiMemoryStmt,
-		listNsfwPicUserRatesByFileUidStmt:    q.listNsfwPicUserRatesByFileUidStmt,
-		resetGeminiSystemPromptStmt:          q.resetGeminiSystemPromptStmt,
-		setCocCharAttrStmt:                   q.setCocCharAttrStmt,
-		setPrprCacheStmt:                     q.setPrprCacheStmt,
-		updateBiliInlineMsgIdStmt:            q.updateBiliInlineMsgIdStmt,
-		updateChatStatDailyStmt:              q.updateChatStatDailyStmt,
-		updateChatTopicNameStmt:              q.updateChatTopicNameStmt,
-		updateGeminiMemoryStmt:               q.updateGeminiMemoryStmt,
-		updateYtDlpCacheStmt:                 q.updateYtDlpCacheStmt,
-		createChatStatDailyStmt:              q.createChatStatDailyStmt,
-		createNewUserStmt:                    q.createNewUserStmt,
-		createNsfwPicUserRateStmt:            q.createNsfwPicUserRateStmt,
-		createOrUpdateChatAttrStmt:           q.createOrUpdateChatAttrStmt,
-		createOrUpdateNsfwPicStmt:            q.createOrUpdateNsfwPicStmt,
-		getAllMsgInSessionReversedStmt:       q.getAllMsgInSessionReversedStmt,
-		getChatCfgByIdStmt:                   q.getChatCfgByIdStmt,
-		getChatIdByWebIdStmt:                 q.getChatIdByWebIdStmt,
-		getChatStatStmt:                      q.getChatStatStmt,
-		getNsfwPicByRateAndRandKeyStmt:       q.getNsfwPicByRateAndRandKeyStmt,
-		getNsfwPicByRateFirstStmt:            q.getNsfwPicByRateFirstStmt,
-		getNsfwPicRateByUserIdStmt:           q.getNsfwPicRateByUserIdStmt,
-		getUserByIdStmt:                      q.getUserByIdStmt,
-		listNsfwPicRateCounterStmt:           q.listNsfwPicRateCounterStmt,
-		updateChatCfgStmt:                    q.updateChatCfgStmt,
-		updateNsfwPicUserRateStmt:            q.updateNsfwPicUserRateStmt,
-		updateUserBaseStmt:                   q.updateUserBaseStmt,
-		updateUserProfilePhotoStmt:           q.updateUserProfilePhotoStmt,
-		updateUserTimeZoneStmt:               q.updateUserTimeZoneStmt,
+		db:                                     tx,
+		tx:                                     tx,
+		addChatKeywordCountStmt:                q.addChatKeywordCountStmt,
+		addGeminiMessageStmt:                   q.addGeminiMessageStmt,
+		addGeminiPrivateUserStmt:               q.addGeminiPrivateUserStmt,
+		addGeminiSystemPromptHistoryStmt:       q.addGeminiSystemPromptHistoryStmt,
+		addGeminiUsageStmt:                     q.addGeminiUsageStmt,
+		createBiliInlineDataStmt:               q.createBiliInlineDataStmt,
+		createChatCfgStmt:                      q.createChatCfgStmt,
+		createGeminiBlobStmt:                   q.createGeminiBlobStmt,
+		createGeminiInviteCodeStmt:             q.createGeminiInviteCodeStmt,
+		createGeminiMemoryStmt:                 q.createGeminiMemoryStmt,
+		createGeminiScheduledPromptStmt:        q.createGeminiScheduledPromptStmt,
+		createNewGeminiSessionStmt:             q.createNewGeminiSessionStmt,
+		createOrUpdateGeminiChatSettingsStmt:   q.createOrUpdateGeminiChatSettingsStmt,
+		createOrUpdateGeminiPromptPresetStmt:   q.createOrUpdateGeminiPromptPresetStmt,
+		createOrUpdateGeminiSystemPromptStmt:   q.createOrUpdateGeminiSystemPromptStmt,
+		delCocCharAttrStmt:                     q.delCocCharAttrStmt,
+		deleteGeminiMemoryStmt:                 q.deleteGeminiMemoryStmt,
+		deleteGeminiPrivateUserStmt:            q.deleteGeminiPrivateUserStmt,
+		deleteGeminiPromptPresetStmt:           q.deleteGeminiPromptPresetStmt,
+		deleteGeminiScheduledPromptStmt:        q.deleteGeminiScheduledPromptStmt,
+		deleteOrphanGeminiContentsStmt:         q.deleteOrphanGeminiContentsStmt,
+		deleteUnusedGeminiBlobsStmt:            q.deleteUnusedGeminiBlobsStmt,
+		getBiliInlineDataStmt:                  q.getBiliInlineDataStmt,
+		getChatGeminiUsageSinceStmt:            q.getChatGeminiUsageSinceStmt,
+		getChatTopicNameStmt:                   q.getChatTopicNameStmt,
+		getChatUserStatRankStmt:                q.getChatUserStatRankStmt,
+		getChatUserStatTotalStmt:               q.getChatUserStatTotalStmt,
+		getCocCharAllAttrStmt:                  q.getCocCharAllAttrStmt,
+		getCocCharAttrStmt:                     q.getCocCharAttrStmt,
+		getFirstGeminiContentStmt:              q.getFirstGeminiContentStmt,
+		getGeminiBlobDataStmt:                  q.getGeminiBlobDataStmt,
+		getGeminiChatSettingsStmt:              q.getGeminiChatSettingsStmt,
+		getGeminiPrivateUserStmt:               q.getGeminiPrivateUserStmt,
+		getGeminiPromptPresetStmt:              q.getGeminiPromptPresetStmt,
+		getGeminiScheduledPromptStmt:           q.getGeminiScheduledPromptStmt,
+		getGeminiSystemPromptStmt:              q.getGeminiSystemPromptStmt,
+		getGeminiSystemPromptLatestVersionStmt: q.getGeminiSystemPromptLatestVersionStmt,
+		getGeminiSystemPromptVersionStmt:       q.getGeminiSystemPromptVersionStmt,
+		getLastChatStatDateStmt:                q.getLastChatStatDateStmt,
+		getLatestGeminiSummaryStmt:             q.getLatestGeminiSummaryStmt,
+		getNsfwPicByFileUidStmt:                q.getNsfwPicByFileUidStmt,
+		getPrprCacheStmt:                       q.getPrprCacheStmt,
+		getSessionByIdStmt:                     q.getSessionByIdStmt,
+		getSessionIdByMessageStmt:              q.getSessionIdByMessageStmt,
+		getUserGeminiUsageSinceStmt:            q.getUserGeminiUsageSinceStmt,
+		getYtDlpDbCacheStmt:                    q.getYtDlpDbCacheStmt,
+		incYtDlUploadCountStmt:                 q.incYtDlUploadCountStmt,
+		incrementSessionTokenCountersStmt:      q.incrementSessionTokenCountersStmt,
+		listAllGeminiScheduledPromptsStmt:      q.listAllGeminiScheduledPromptsStmt,
+		listChatGeminiScheduledPromptsStmt:     q.listChatGeminiScheduledPromptsStmt,
+		listChatGeminiUsageSinceStmt:           q.listChatGeminiUsageSinceStmt,
+		listChatKeywordScansStmt:               q.listChatKeywordScansStmt,
+		listDailyStatChatsStmt:                 q.listDailyStatChatsStmt,
+		listGeminiMemoryStmt:                   q.listGeminiMemoryStmt,
+		listGeminiPrivateUsersStmt:             q.listGeminiPrivateUsersStmt,
+		listGeminiPromptPresetsStmt:            q.listGeminiPromptPresetsStmt,
+		listGeminiSystemPromptHistoryStmt:      q.listGeminiSystemPromptHistoryStmt,
+		listNsfwPicUserRatesByFileUidStmt:      q.listNsfwPicUserRatesByFileUidStmt,
+		listRecentGeminiSessionsStmt:           q.listRecentGeminiSessionsStmt,
+		listTopChatKeywordsStmt:                q.listTopChatKeywordsStmt,
+		markChatStatSentStmt:                   q.markChatStatSentStmt,
+		pruneChatKeywordsStmt:                  q.pruneChatKeywordsStmt,
+		recountGeminiBlobRefsStmt:              q.recountGeminiBlobRefsStmt,
+		resetGeminiSystemPromptStmt:            q.resetGeminiSystemPromptStmt,
+		setChatKeywordScanStmt:                 q.setChatKeywordScanStmt,
+		setCocCharAttrStmt:                     q.setCocCharAttrStmt,
+		setGeminiSessionFrozenStmt:             q.setGeminiSessionFrozenStmt,
+		setPrprCacheStmt:                       q.setPrprCacheStmt,
+		updateBiliInlineMsgIdStmt:              q.updateBiliInlineMsgIdStmt,
+		updateChatStatDailyStmt:                q.updateChatStatDailyStmt,
+		updateChatTopicNameStmt:                q.updateChatTopicNameStmt,
+		updateGeminiMemoryStmt:                 q.updateGeminiMemoryStmt,
+		updateGeminiScheduledPromptRunStmt:     q.updateGeminiScheduledPromptRunStmt,
+		updateYtDlpCacheStmt:                   q.updateYtDlpCacheStmt,
+		useGeminiInviteCodeStmt:                q.useGeminiInviteCodeStmt,
+		addChatUserStatTotalStmt:               q.addChatUserStatTotalStmt,
+		createChatStatDailyStmt:                q.createChatStatDailyStmt,
+		createNewUserStmt:                      q.createNewUserStmt,
+		createNsfwPicUserRateStmt:              q.createNsfwPicUserRateStmt,
+		createOrUpdateChatAttrStmt:             q.createOrUpdateChatAttrStmt,
+		createOrUpdateNsfwPicStmt:              q.createOrUpdateNsfwPicStmt,
+		getAllMsgInSessionReversedStmt:         q.getAllMsgInSessionReversedStmt,
+		getChatCfgByIdStmt:                     q.getChatCfgByIdStmt,
+		getChatIdByWebIdStmt:                   q.getChatIdByWebIdStmt,
+		getChatStatStmt:                        q.getChatStatStmt,
+		getNsfwPicByRateAndRandKeyStmt:         q.getNsfwPicByRateAndRandKeyStmt,
+		getNsfwPicByRateFirstStmt:              q.getNsfwPicByRateFirstStmt,
+		getNsfwPicRateByUserIdStmt:             q.getNsfwPicRateByUserIdStmt,
+		getUserByIdStmt:                        q.getUserByIdStmt,
+		listChatStatRangeStmt:                  q.listChatStatRangeStmt,
+		listLegacyChatStatsStmt:                q.listLegacyChatStatsStmt,
+		listNsfwPicRateCounterStmt:             q.listNsfwPicRateCounterStmt,
+		updateChatCfgStmt:                      q.updateChatCfgStmt,
+		updateLegacyChatStatStmt:               q.updateLegacyChatStatStmt,
+		updateNsfwPicUserRateStmt:              q.updateNsfwPicUserRateStmt,
+		updateUserBaseStmt:                     q.updateUserBaseStmt,
+		updateUserProfilePhotoStmt:             q.updateUserProfilePhotoStmt,
+		updateUserTimeZoneStmt:                 q.updateUserTimeZoneStmt,
 	}
 }
@@ -31,6 +31,19 @@ type ChatAttr struct {
 	IsForum   bool           `json:"is_forum"`
 }
 
+type ChatKeywordDaily struct {
+	ChatID   int64  `json:"chat_id"`
+	StatDate int64  `json:"stat_date"`
+	Word     string `json:"word"`
+	Count    int64  `json:"count"`
+}
+
+type ChatKeywordScan struct {
+	ChatID       int64 `json:"chat_id"`
+	StatDate     int64 `json:"stat_date"`
+	ScannedUntil int64 `json:"scanned_until"`
+}
+
 type ChatStatDaily struct {
 	ChatID             int64          `json:"chat_id"`
 	StatDate           int64          `json:"stat_date"`
@@ -58,6 +71,36 @@ type ChatTopic struct {
 	Name     string `json:"name"`
 }
 
+type ChatUserStatTotal struct {
+	ChatID       int64 `json:"chat_id"`
+	UserID       int64 `json:"user_id"`
+	MsgCount     int64 `json:"msg_count"`
+	MsgLen       int64 `json:"msg_len"`
+	PhotoCount   int64 `json:"photo_count"`
+	VideoCount   int64 `json:"video_count"`
+	StickerCount int64 `json:"sticker_count"`
+	ForwardCount int64 `json:"forward_count"`
+}
+
+type GeminiBlob struct {
+	Hash      string   `json:"hash"`
+	Data      []byte   `json:"data"`
+	Size      int64    `json:"size"`
+	RefCount  int64    `json:"ref_count"`
+	CreatedAt UnixTime `json:"created_at"`
+}
+
+type GeminiChatSetting struct {
+	ChatID              int64   `json:"chat_id"`
+	ThreadID            int64   `json:"thread_id"`
+	Model               string  `json:"model"`
+	Temperature         float64 `json:"temperature"`
+	ThinkingBudget      int64   `json:"thinking_budget"`
+	EnableSearch        bool    `json:"enable_search"`
+	EnableCodeExecution bool    `json:"enable_code_execution"`
+	MaxHistory          int64   `json:"max_history"`
+}
+
 type GeminiContent struct {
 	SessionID        int64          `json:"session_id"`
 	ChatID           int64          `json:"chat_id"`
@@ -68,7 +111,7 @@ type GeminiContent struct {
 	MsgType          string         `json:"msg_type"`
 	ReplyToMsgID     sql.NullInt64  `json:"reply_to_msg_id"`
 	Text             sql.NullString `json:"text"`
-	Blob             []byte         `json:"blob"`
+	BlobHash         sql.NullString `json:"blob_hash"`
 	MimeType         sql.NullString `json:"mime_type"`
 	QuotePart        sql.NullString `json:"quote_part"`
 	ThoughtSignature sql.NullString `json:"thought_signature"`
@@ -76,6 +119,15 @@ type GeminiContent struct {
 	UserID           int64          `json:"user_id"`
 }
 
+type GeminiInviteCode struct {
+	Code      string   `json:"code"`
+	CreatedBy int64    `json:"created_by"`
+	MaxUses   int64    `json:"max_uses"`
+	UsedCount int64    `json:"used_count"`
+	CreatedAt UnixTime `json:"created_at"`
+	ExpiresAt UnixTime `json:"expires_at"`
+}
+
 type GeminiMemory struct {
 	ID      int64  `json:"id"`
 	ChatID  int64  `json:"chat_id"`
@@ -83,6 +135,32 @@ type GeminiMemory struct {
 	Content string `json:"content"`
 }
 
+type GeminiPrivateUser struct {
+	UserID     int64    `json:"user_id"`
+	InviteCode string   `json:"invite_code"`
+	AddedBy    int64    `json:"added_by"`
+	CreatedAt  UnixTime `json:"created_at"`
+}
+
+type GeminiPromptPreset struct {
+	Name      string   `json:"name"`
+	Prompt    string   `json:"prompt"`
+	AuthorID  int64    `json:"author_id"`
+	UpdatedAt UnixTime `json:"updated_at"`
+}
+
+type GeminiScheduledPrompt struct {
+	ID        int64    `json:"id"`
+	ChatID    int64    `json:"chat_id"`
+	ThreadID  int64    `json:"thread_id"`
+	Cron      string   `json:"cron"`
+	Prompt    string   `json:"prompt"`
+	SessionID int64    `json:"session_id"`
+	CreatedBy int64    `json:"created_by"`
+	CreatedAt UnixTime `json:"created_at"`
+	LastRunAt UnixTime `json:"last_run_at"`
+}
+
 type GeminiSession struct {
 	ID                int64  `json:"id"`
 	ChatID            int64  `json:"chat_id"`
@@ -99,6 +177,24 @@ type GeminiSystemPrompt struct {
 	Prompt   string `json:"prompt"`
 }
 
+type GeminiSystemPromptHistory struct {
+	ChatID    int64    `json:"chat_id"`
+	ThreadID  int64    `json:"thread_id"`
+	Version   int64    `json:"version"`
+	Prompt    string   `json:"prompt"`
+	AuthorID  int64    `json:"author_id"`
+	CreatedAt UnixTime `json:"created_at"`
+}
+
+type GeminiUsage struct {
+	ChatID       int64  `json:"chat_id"`
+	UserID       int64  `json:"user_id"`
+	Model        string `json:"model"`
+	UsageDate    int64  `json:"usage_date"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
 type PicRateCounter struct {
 	Rate  int64 `json:"rate"`
 	Count int64 `json:"count"`
@@ -135,6 +231,7 @@ type User struct {
 	ProfileUpdateAt UnixTime       `json:"profile_update_at"`
 	ProfilePhoto    sql.NullString `json:"profile_photo"`
 	Timezone        int64          `json:"timezone"`
+	TimezoneName    string         `json:"timezone_name"`
 }
 
 type YtDlResult struct {
@@ -160,4 +257,12 @@ type chatCfg struct {
 	EnableCoc      bool          `json:"enable_coc"`
 	RespNsfwMsg    bool          `json:"resp_nsfw_msg"`
 	Timezone       int64         `json:"timezone"`
+	DailyDigest    bool          `json:"daily_digest"`
+	DigestOnly     bool          `json:"digest_only"`
+	AutoTranslate  bool          `json:"auto_translate"`
+	TranslateLang  string        `json:"translate_lang"`
+	DailyStat      bool          `json:"daily_stat"`
+	StatTime       int64         `json:"stat_time"`
+	StatTemplate   string        `json:"stat_template"`
+	TimezoneName   string        `json:"timezone_name"`
 }
@@ -10,11 +10,29 @@ import (
 	"database/sql"
 )
 
+const addChatKeywordCount = `-- name: AddChatKeywordCount :exec
+INSERT INTO chat_keyword_daily (chat_id, stat_date, word, count)
+VALUES (?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET count=count + excluded.count
+`
+
+func (q *Queries) AddChatKeywordCount(ctx context.Context, chatID int64, statDate int64, word string, count int64) error {
+	_, err := q.exec(ctx, q.addChatKeywordCountStmt, addChatKeywordCount,
+		chatID,
+		statDate,
+		word,
+		count,
+	)
+	return err
+}
+
 const createChatCfg = `-- name: CreateChatCfg :exec
 INSERT INTO chat_cfg (id, web_id, auto_cvt_bili, auto_ocr, auto_calculate, auto_exchange, auto_check_adult,
-                      save_messages, enable_coc, resp_nsfw_msg, timezone)
+                      save_messages, enable_coc, resp_nsfw_msg, timezone, daily_digest, digest_only,
+                      auto_translate, translate_lang, daily_stat, stat_time, stat_template, timezone_name)
 VALUES (?, ?, ?, ?, ?, ?,
-        ?, ?, ?, ?, ?)
+        ?, ?, ?, ?, ?, ?, ?,
+        ?, ?, ?, ?, ?, ?)
 `
 
 type CreateChatCfgParams struct {
@@ -29,6 +47,14 @@ type CreateChatCfgParams struct {
 	EnableCoc      bool          `json:"enable_coc"`
 	RespNsfwMsg    bool          `json:"resp_nsfw_msg"`
 	Timezone       int64         `json:"timezone"`
+	DailyDigest    bool          `json:"daily_digest"`
+	DigestOnly     bool          `json:"digest_only"`
+	AutoTranslate  bool          `json:"auto_translate"`
+	TranslateLang  string        `json:"translate_lang"`
+	DailyStat      bool          `json:"daily_stat"`
+	StatTime       int64         `json:"stat_time"`
+	StatTemplate   string        `json:"stat_template"`
+	TimezoneName   string        `json:"timezone_name"`
 }
 
 func (q *Queries) CreateChatCfg(ctx context.Context, arg CreateChatCfgParams) error {
@@ -44,10 +70,248 @@ func (q *Queries) CreateChatCfg(ctx context.Context, arg CreateChatCfgParams) er
 		arg.EnableCoc,
 		arg.RespNsfwMsg,
 		arg.Timezone,
+		arg.DailyDigest,
+		arg.DigestOnly,
+		arg.AutoTranslate,
+		arg.TranslateLang,
+		arg.DailyStat,
+		arg.StatTime,
+		arg.StatTemplate,
+		arg.TimezoneName,
 	)
 	return err
 }
 
+const getChatTopicName = `-- name: GetChatTopicName :one
+SELECT name
+FROM chat_topics
+WHERE chat_id = ?
+  AND thread_id = ?
+`
+
+func (q *Queries) GetChatTopicName(ctx context.Context, chatID int64, threadID int64) (string, error) {
+	row := q.queryRow(ctx, q.getChatTopicNameStmt, getChatTopicName, chatID, threadID)
+	var name string
+	err := row.Scan(&name)
+	return name, err
+}
+
+const getChatUserStatRank = `-- name: GetChatUserStatRank :one
+SELECT COUNT(*) + 1 AS user_rank
+FROM chat_user_stat_total
+WHERE chat_id = ?
+  AND msg_count > ?
+`
+
+func (q *Queries) GetChatUserStatRank(ctx context.Context, chatID int64, msgCount int64) (int64, error) {
+	row := q.queryRow(ctx, q.getChatUserStatRankStmt, getChatUserStatRank, chatID, msgCount)
+	var user_rank int64
+	err := row.Scan(&user_rank)
+	return user_rank, err
+}
+
+const getChatUserStatTotal = `-- name: GetChatUserStatTotal :one
+SELECT chat_id, user_id, msg_count, msg_len, photo_count, video_count, sticker_count, forward_count
+FROM chat_user_stat_total
+WHERE chat_id = ?
+  AND user_id = ?
+`
+
+func (q *Queries) GetChatUserStatTotal(ctx context.Context, chatID int64, userID int64) (ChatUserStatTotal, error) {
+	row := q.queryRow(ctx, q.getChatUserStatTotalStmt, getChatUserStatTotal, chatID, userID)
+	var i ChatUserStatTotal
+	err := row.Scan(
+		&i.ChatID,
+		&i.UserID,
+		&i.MsgCount,
+		&i.MsgLen,
+		&i.PhotoCount,
+		&i.VideoCount,
+		&i.StickerCount,
+		&i.ForwardCount,
+	)
+	return i, err
+}
+
+const getLastChatStatDate = `-- name: GetLastChatStatDate :one
+SELECT CAST(COALESCE(MAX(stat_date), 0) AS INTEGER) AS stat_date
+FROM chat_stat_daily
+WHERE chat_id = ?
+`
+
+func (q *Queries) GetLastChatStatDate(ctx context.Context, chatID int64) (int64, error) {
+	row := q.queryRow(ctx, q.getLastChatStatDateStmt, getLastChatStatDate, chatID)
+	var stat_date int64
+	err := row.Scan(&stat_date)
+	return stat_date, err
+}
+
+const listChatKeywordScans = `-- name: ListChatKeywordScans :many
+SELECT stat_date, scanned_until
+FROM chat_keyword_scan
+WHERE chat_id = ?
+  AND stat_date BETWEEN ? AND ?
+`
+
+type ListChatKeywordScansRow struct {
+	StatDate     int64 `json:"stat_date"`
+	ScannedUntil int64 `json:"scanned_until"`
+}
+
+func (q *Queries) ListChatKeywordScans(ctx context.Context, chatID int64, statDate int64, statDate_2 int64) ([]ListChatKeywordScansRow, error) {
+	rows, err := q.query(ctx, q.listChatKeywordScansStmt, listChatKeywordScans, chatID, statDate, statDate_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChatKeywordScansRow
+	for rows.Next() {
+		var i ListChatKeywordScansRow
+		if err := rows.Scan(&i.StatDate, &i.ScannedUntil); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDailyStatChats = `-- name: ListDailyStatChats :many
+SELECT id
+FROM chat_cfg
+WHERE daily_stat = 1
+ORDER BY id
+`
+
+func (q *Queries) ListDailyStatChats(ctx context.Context) ([]int64, error) {
+	rows, err := q.query(ctx, q.listDailyStatChatsStmt, listDailyStatChats)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listTopChatKeywords = `-- name: ListTopChatKeywords :many
+SELECT word, CAST(sum(count) AS INTEGER) AS total
+FROM chat_keyword_daily
+WHERE chat_id = ?
+  AND stat_date BETWEEN ? AND ?
+GROUP BY word
+ORDER BY total DESC, word
+LIMIT ?
+`
+
+type ListTopChatKeywordsRow struct {
+	Word  string `json:"word"`
+	Total int64  `json:"total"`
+}
+
+func (q *Queries) ListTopChatKeywords(ctx context.Context, chatID int64, statDate int64, statDate_2 int64, limit int64) ([]ListTopChatKeywordsRow, error) {
+	rows, err := q.query(ctx, q.listTopChatKeywordsStmt, listTopChatKeywords,
+		chatID,
+		statDate,
+		statDate_2,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListTopChatKeywordsRow
+	for rows.Next() {
+		var i ListTopChatKeywordsRow
+		if err := rows.Scan(&i.Word, &i.Total); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const markChatStatSent = `-- name: MarkChatStatSent :execrows
+INSERT INTO chat_stat_sent (chat_id, stat_date)
+VALUES (?, ?)
+ON CONFLICT DO UPDATE SET stat_date = excluded.stat_date
+WHERE stat_date < excluded.stat_date
+`
+
+func (q *Queries) MarkChatStatSent(ctx context.Context, chatID int64, statDate int64) (int64, error) {
+	result, err := q.exec(ctx, q.markChatStatSentStmt, markChatStatSent, chatID, statDate)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const pruneChatKeywords = `-- name: PruneChatKeywords :exec
+DELETE
+FROM chat_keyword_daily
+WHERE chat_id = ?
+  AND stat_date = ?
+  AND word NOT IN (SELECT word
+                   FROM chat_keyword_daily
+                   WHERE chat_id = ?
+                     AND stat_date = ?
+                   ORDER BY count DESC, word
+                   LIMIT ?)
+`
+
+type PruneChatKeywordsParams struct {
+	ChatID     int64 `json:"chat_id"`
+	StatDate   int64 `json:"stat_date"`
+	ChatID_2   int64 `json:"chat_id_2"`
+	StatDate_2 int64 `json:"stat_date_2"`
+	Limit      int64 `json:"limit"`
+}
+
+func (q *Queries) PruneChatKeywords(ctx context.Context, arg PruneChatKeywordsParams) error {
+	_, err := q.exec(ctx, q.pruneChatKeywordsStmt, pruneChatKeywords,
+		arg.ChatID,
+		arg.StatDate,
+		arg.ChatID_2,
+		arg.StatDate_2,
+		arg.Limit,
+	)
+	return err
+}
+
+const setChatKeywordScan = `-- name: SetChatKeywordScan :exec
+INSERT INTO chat_keyword_scan (chat_id, stat_date, scanned_until)
+VALUES (?, ?, ?)
+ON CONFLICT DO UPDATE SET scanned_until=excluded.scanned_until
+`
+
+func (q *Queries) SetChatKeywordScan(ctx context.Context, chatID int64, statDate int64, scannedUntil int64) error {
+	_, err := q.exec(ctx, q.setChatKeywordScanStmt, setChatKeywordScan, chatID, statDate, scannedUntil)
+	return err
+}
+
 const updateChatStatDaily = `-- name: UpdateChatStatDaily :exec
 UPDATE chat_stat_daily
 SET message_count        = ?,
@@ -128,6 +392,43 @@ func (q *Queries) UpdateChatTopicName(ctx context.Context, chatID int64, threadI
 	return err
 }
 
+const addChatUserStatTotal = `-- name: addChatUserStatTotal :exec
+INSERT INTO chat_user_stat_total (chat_id, user_id, msg_count, msg_len, photo_count, video_count, sticker_count,
+                                  forward_count)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET msg_count     = msg_count + excluded.msg_count,
+                          msg_len       = msg_len + excluded.msg_len,
+                          photo_count   = photo_count + excluded.photo_count,
+                          video_count   = video_count + excluded.video_count,
+                          sticker_count = sticker_count + excluded.sticker_count,
+                          forward_count = forward_count + excluded.forward_count
+`
+
+type addChatUserStatTotalParams struct {
+	ChatID       int64 `json:"chat_id"`
+	UserID       int64 `json:"user_id"`
+	MsgCount     int64 `json:"msg_count"`
+	MsgLen       int64 `json:"msg_len"`
+	PhotoCount   int64 `json:"photo_count"`
+	VideoCount   int64 `json:"video_count"`
+	StickerCount int64 `json:"sticker_count"`
+	ForwardCount int64 `json:"forward_count"`
+}
+
+func (q *Queries) addChatUserStatTotal(ctx context.Context, arg addChatUserStatTotalParams) error {
+	_, err := q.exec(ctx, q.addChatUserStatTotalStmt, addChatUserStatTotal,
+		arg.ChatID,
+		arg.UserID,
+		arg.MsgCount,
+		arg.MsgLen,
+		arg.PhotoCount,
+		arg.VideoCount,
+		arg.StickerCount,
+		arg.ForwardCount,
+	)
+	return err
+}
+
 const createChatStatDaily = `-- name: createChatStatDaily :one
 INSERT INTO chat_stat_daily (chat_id, stat_date)
 VALUES (?, ?)
@@ -196,7 +497,7 @@ func (q *Queries) createOrUpdateChatAttr(ctx context.Context, arg createOrUpdate
 
 const getChatCfgById = `-- name: getChatCfgById :one
 
-SELECT id, web_id, auto_cvt_bili, auto_ocr, auto_calculate, auto_exchange, auto_check_adult, save_messages, enable_coc, resp_nsfw_msg, timezone
+SELECT id, web_id, auto_cvt_bili, auto_ocr, auto_calculate, auto_exchange, auto_check_adult, save_messages, enable_coc, resp_nsfw_msg, timezone, daily_digest, digest_only, auto_translate, translate_lang, daily_stat, stat_time, stat_template, timezone_name
 FROM chat_cfg
 WHERE id = ?
 `
@@ -217,6 +518,14 @@ func (q *Queries) getChatCfgById(ctx context.Context, id int64) (chatCfg, error)
 		&i.EnableCoc,
 		&i.RespNsfwMsg,
 		&i.Timezone,
+		&i.DailyDigest,
+		&i.DigestOnly,
+		&i.AutoTranslate,
+		&i.TranslateLang,
+		&i.DailyStat,
+		&i.StatTime,
+		&i.StatTemplate,
+		&i.TimezoneName,
 	)
 	return i, err
 }
@@ -267,6 +576,102 @@ func (q *Queries) getChatStat(ctx context.Context, chatID int64, statDate int64)
 	return i, err
 }
 
+const listChatStatRange = `-- name: listChatStatRange :many
+SELECT chat_id, stat_date, message_count, photo_count, video_count, sticker_count, forward_count, mars_count, max_mars_count, racy_count, adult_count, download_video_count, download_audio_count, dio_add_user_count, dio_ban_user_count, user_msg_stat, msg_count_by_time, msg_id_at_time_start
+FROM chat_stat_daily
+WHERE chat_id = ?
+  AND stat_date BETWEEN ? AND ?
+ORDER BY stat_date
+`
+
+func (q *Queries) listChatStatRange(ctx context.Context, chatID int64, statDate int64, statDate_2 int64) ([]ChatStatDaily, error) {
+	rows, err := q.query(ctx, q.listChatStatRangeStmt, listChatStatRange, chatID, statDate, statDate_2)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ChatStatDaily
+	for rows.Next() {
+		var i ChatStatDaily
+		if err := rows.Scan(
+			&i.ChatID,
+			&i.StatDate,
+			&i.MessageCount,
+			&i.PhotoCount,
+			&i.VideoCount,
+			&i.StickerCount,
+			&i.ForwardCount,
+			&i.MarsCount,
+			&i.MaxMarsCount,
+			&i.RacyCount,
+			&i.AdultCount,
+			&i.DownloadVideoCount,
+			&i.DownloadAudioCount,
+			&i.DioAddUserCount,
+			&i.DioBanUserCount,
+			&i.UserMsgStat,
+			&i.MsgCountByTime,
+			&i.MsgIDAtTimeStart,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLegacyChatStats = `-- name: listLegacyChatStats :many
+SELECT chat_id, stat_date, user_msg_stat, msg_count_by_time, msg_id_at_time_start
+FROM chat_stat_daily
+WHERE (length(user_msg_stat) > 0 AND substr(user_msg_stat, 1, 1) != x'81')
+   OR (length(msg_count_by_time) > 0 AND substr(msg_count_by_time, 1, 1) != x'81')
+   OR (length(msg_id_at_time_start) > 0 AND substr(msg_id_at_time_start, 1, 1) != x'81')
+LIMIT ?
+`
+
+type listLegacyChatStatsRow struct {
+	ChatID           int64          `json:"chat_id"`
+	StatDate         int64          `json:"stat_date"`
+	UserMsgStat      UserMsgStatMap `json:"user_msg_stat"`
+	MsgCountByTime   TenMinuteStats `json:"msg_count_by_time"`
+	MsgIDAtTimeStart TenMinuteStats `json:"msg_id_at_time_start"`
+}
+
+func (q *Queries) listLegacyChatStats(ctx context.Context, limit int64) ([]listLegacyChatStatsRow, error) {
+	rows, err := q.query(ctx, q.listLegacyChatStatsStmt, listLegacyChatStats, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []listLegacyChatStatsRow
+	for rows.Next() {
+		var i listLegacyChatStatsRow
+		if err := rows.Scan(
+			&i.ChatID,
+			&i.StatDate,
+			&i.UserMsgStat,
+			&i.MsgCountByTime,
+			&i.MsgIDAtTimeStart,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const updateChatCfg = `-- name: updateChatCfg :exec
 UPDATE chat_cfg
 SET auto_cvt_bili=?,
@@ -276,20 +681,38 @@ SET auto_cvt_bili=?,
     auto_check_adult=?,
     save_messages=?,
     enable_coc=?,
-    resp_nsfw_msg=?
+    resp_nsfw_msg=?,
+    daily_digest=?,
+    digest_only=?,
+    auto_translate=?,
+    translate_lang=?,
+    daily_stat=?,
+    stat_time=?,
+    stat_template=?,
+    timezone=?,
+    timezone_name=?
 WHERE id = ?
 `
 
 type updateChatCfgParams struct {
-	AutoCvtBili    bool  `json:"auto_cvt_bili"`
-	AutoOcr        bool  `json:"auto_ocr"`
-	AutoCalculate  bool  `json:"auto_calculate"`
-	AutoExchange   bool  `json:"auto_exchange"`
-	AutoCheckAdult bool  `json:"auto_check_adult"`
-	SaveMessages   bool  `json:"save_messages"`
-	EnableCoc      bool  `json:"enable_coc"`
-	RespNsfwMsg    bool  `json:"resp_nsfw_msg"`
-	ID             int64 `json:"id"`
+	AutoCvtBili    bool   `json:"auto_cvt_bili"`
+	AutoOcr        bool   `json:"auto_ocr"`
+	AutoCalculate  bool   `json:"auto_calculate"`
+	AutoExchange   bool   `json:"auto_exchange"`
+	AutoCheckAdult bool   `json:"auto_check_adult"`
+	SaveMessages   bool   `json:"save_messages"`
+	EnableCoc      bool   `json:"enable_coc"`
+	RespNsfwMsg    bool   `json:"resp_nsfw_msg"`
+	DailyDigest    bool   `json:"daily_digest"`
+	DigestOnly     bool   `json:"digest_only"`
+	AutoTranslate  bool   `json:"auto_translate"`
+	TranslateLang  string `json:"translate_lang"`
+	DailyStat      bool   `json:"daily_stat"`
+	StatTime       int64  `json:"stat_time"`
+	StatTemplate   string `json:"stat_template"`
+	Timezone       int64  `json:"timezone"`
+	TimezoneName   string `json:"timezone_name"`
+	ID             int64  `json:"id"`
 }
 
 func (q *Queries) updateChatCfg(ctx context.Context, arg updateChatCfgParams) error {
@@ -302,7 +725,47 @@ func (q *Queries) updateChatCfg(ctx context.Context, arg updateChatCfgParams) er
 		arg.SaveMessages,
 		arg.EnableCoc,
 		arg.RespNsfwMsg,
+		arg.DailyDigest,
+		arg.DigestOnly,
+		arg.AutoTranslate,
+		arg.TranslateLang,
+		arg.DailyStat,
+		arg.StatTime,
+		arg.StatTemplate,
+		arg.Timezone,
+		arg.TimezoneName,
 		arg.ID,
 	)
 	return err
 }
+
+const updateLegacyChatStat = `-- name: updateLegacyChatStat :exec
+UPDATE chat_stat_daily
+SET user_msg_stat        = ?,
+    msg_count_by_time    = ?,
+    msg_id_at_time_start = ?
+WHERE chat_id = ?
+  AND stat_date = ?
+  AND ((length(user_msg_stat) > 0 AND substr(user_msg_stat, 1, 1) != x'81')
+    OR (length(msg_count_by_time) > 0 AND substr(msg_count_by_time, 1, 1) != x'81')
+    OR (length(msg_id_at_time_start) > 0 AND substr(msg_id_at_time_start, 1, 1) != x'81'))
+`
+
+type updateLegacyChatStatParams struct {
+	UserMsgStat      UserMsgStatMap `json:"user_msg_stat"`
+	MsgCountByTime   TenMinuteStats `json:"msg_count_by_time"`
+	MsgIDAtTimeStart TenMinuteStats `json:"msg_id_at_time_start"`
+	ChatID           int64          `json:"chat_id"`
+	StatDate         int64          `json:"stat_date"`
+}
+
+func (q *Queries) updateLegacyChatStat(ctx context.Context, arg updateLegacyChatStatParams) error {
+	_, err := q.exec(ctx, q.updateLegacyChatStatStmt, updateLegacyChatStat,
+		arg.UserMsgStat,
+		arg.MsgCountByTime,
+		arg.MsgIDAtTimeStart,
+		arg.ChatID,
+		arg.StatDate,
+	)
+	return err
+}
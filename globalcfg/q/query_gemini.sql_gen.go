@@ -20,11 +20,13 @@ INSERT INTO gemini_contents (session_id,
                              msg_type,
                              reply_to_msg_id,
                              text,
-                             blob,
+                             blob_hash,
                              mime_type,
                              quote_part,
-                             thought_signature)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+                             thought_signature,
+                             atable_username,
+                             user_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 `
 
 type AddGeminiMessageParams struct {
@@ -37,10 +39,12 @@ type AddGeminiMessageParams struct {
 	MsgType          string         `json:"msg_type"`
 	ReplyToMsgID     sql.NullInt64  `json:"reply_to_msg_id"`
 	Text             sql.NullString `json:"text"`
-	Blob             []byte         `json:"blob"`
+	BlobHash         sql.NullString `json:"blob_hash"`
 	MimeType         sql.NullString `json:"mime_type"`
 	QuotePart        sql.NullString `json:"quote_part"`
 	ThoughtSignature sql.NullString `json:"thought_signature"`
+	AtableUsername   sql.NullString `json:"atable_username"`
+	UserID           int64          `json:"user_id"`
 }
 
 func (q *Queries) AddGeminiMessage(ctx context.Context, arg AddGeminiMessageParams) error {
@@ -54,10 +58,117 @@ func (q *Queries) AddGeminiMessage(ctx context.Context, arg AddGeminiMessagePara
 		arg.MsgType,
 		arg.ReplyToMsgID,
 		arg.Text,
-		arg.Blob,
+		arg.BlobHash,
 		arg.MimeType,
 		arg.QuotePart,
 		arg.ThoughtSignature,
+		arg.AtableUsername,
+		arg.UserID,
+	)
+	return err
+}
+
+const addGeminiPrivateUser = `-- name: AddGeminiPrivateUser :exec
+INSERT INTO gemini_private_users (user_id, invite_code, added_by, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT DO NOTHING
+`
+
+func (q *Queries) AddGeminiPrivateUser(ctx context.Context, userID int64, inviteCode string, addedBy int64, createdAt UnixTime) error {
+	_, err := q.exec(ctx, q.addGeminiPrivateUserStmt, addGeminiPrivateUser,
+		userID,
+		inviteCode,
+		addedBy,
+		createdAt,
+	)
+	return err
+}
+
+const addGeminiSystemPromptHistory = `-- name: AddGeminiSystemPromptHistory :exec
+INSERT INTO gemini_system_prompt_history (chat_id, thread_id, version, prompt, author_id, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+`
+
+type AddGeminiSystemPromptHistoryParams struct {
+	ChatID    int64    `json:"chat_id"`
+	ThreadID  int64    `json:"thread_id"`
+	Version   int64    `json:"version"`
+	Prompt    string   `json:"prompt"`
+	AuthorID  int64    `json:"author_id"`
+	CreatedAt UnixTime `json:"created_at"`
+}
+
+func (q *Queries) AddGeminiSystemPromptHistory(ctx context.Context, arg AddGeminiSystemPromptHistoryParams) error {
+	_, err := q.exec(ctx, q.addGeminiSystemPromptHistoryStmt, addGeminiSystemPromptHistory,
+		arg.ChatID,
+		arg.ThreadID,
+		arg.Version,
+		arg.Prompt,
+		arg.AuthorID,
+		arg.CreatedAt,
+	)
+	return err
+}
+
+const addGeminiUsage = `-- name: AddGeminiUsage :exec
+INSERT INTO gemini_usage (chat_id, user_id, model, usage_date, input_tokens, output_tokens)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET input_tokens=input_tokens + excluded.input_tokens,
+                          output_tokens=output_tokens + excluded.output_tokens
+`
+
+type AddGeminiUsageParams struct {
+	ChatID       int64  `json:"chat_id"`
+	UserID       int64  `json:"user_id"`
+	Model        string `json:"model"`
+	UsageDate    int64  `json:"usage_date"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+func (q *Queries) AddGeminiUsage(ctx context.Context, arg AddGeminiUsageParams) error {
+	_, err := q.exec(ctx, q.addGeminiUsageStmt, addGeminiUsage,
+		arg.ChatID,
+		arg.UserID,
+		arg.Model,
+		arg.UsageDate,
+		arg.InputTokens,
+		arg.OutputTokens,
+	)
+	return err
+}
+
+const createGeminiBlob = `-- name: CreateGeminiBlob :exec
+INSERT INTO gemini_blobs (hash, data, size, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (hash) DO UPDATE SET created_at = excluded.created_at
+`
+
+func (q *Queries) CreateGeminiBlob(ctx context.Context, hash string, data []byte, size int64, createdAt UnixTime) error {
+	_, err := q.exec(ctx, q.createGeminiBlobStmt, createGeminiBlob, hash, data, size, createdAt)
+	return err
+}
+
+const createGeminiInviteCode = `-- name: CreateGeminiInviteCode :exec
+INSERT INTO gemini_invite_codes (code, created_by, max_uses, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?)
+`
+
+type CreateGeminiInviteCodeParams struct {
+	Code      string   `json:"code"`
+	CreatedBy int64    `json:"created_by"`
+	MaxUses   int64    `json:"max_uses"`
+	CreatedAt UnixTime `json:"created_at"`
+	ExpiresAt UnixTime `json:"expires_at"`
+}
+
+func (q *Queries) CreateGeminiInviteCode(ctx context.Context, arg CreateGeminiInviteCodeParams) error {
+	_, err := q.exec(ctx, q.createGeminiInviteCodeStmt, createGeminiInviteCode,
+		arg.Code,
+		arg.CreatedBy,
+		arg.MaxUses,
+		arg.CreatedAt,
+		arg.ExpiresAt,
 	)
 	return err
 }
@@ -80,6 +191,45 @@ func (q *Queries) CreateGeminiMemory(ctx context.Context, chatID int64, topicID
 	return i, err
 }
 
+const createGeminiScheduledPrompt = `-- name: CreateGeminiScheduledPrompt :one
+INSERT INTO gemini_scheduled_prompts (chat_id, thread_id, cron, prompt, created_by, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING id, chat_id, thread_id, cron, prompt, session_id, created_by, created_at, last_run_at
+`
+
+type CreateGeminiScheduledPromptParams struct {
+	ChatID    int64    `json:"chat_id"`
+	ThreadID  int64    `json:"thread_id"`
+	Cron      string   `json:"cron"`
+	Prompt    string   `json:"prompt"`
+	CreatedBy int64    `json:"created_by"`
+	CreatedAt UnixTime `json:"created_at"`
+}
+
+func (q *Queries) CreateGeminiScheduledPrompt(ctx context.Context, arg CreateGeminiScheduledPromptParams) (GeminiScheduledPrompt, error) {
+	row := q.queryRow(ctx, q.createGeminiScheduledPromptStmt, createGeminiScheduledPrompt,
+		arg.ChatID,
+		arg.ThreadID,
+		arg.Cron,
+		arg.Prompt,
+		arg.CreatedBy,
+		arg.CreatedAt,
+	)
+	var i GeminiScheduledPrompt
+	err := row.Scan(
+		&i.ID,
+		&i.ChatID,
+		&i.ThreadID,
+		&i.Cron,
+		&i.Prompt,
+		&i.SessionID,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.LastRunAt,
+	)
+	return i, err
+}
+
 const createNewGeminiSession = `-- name: CreateNewGeminiSession :one
 
 INSERT INTO gemini_sessions (chat_id, chat_name, chat_type)
@@ -103,6 +253,61 @@ func (q *Queries) CreateNewGeminiSession(ctx context.Context, chatID int64, chat
 	return i, err
 }
 
+const createOrUpdateGeminiChatSettings = `-- name: CreateOrUpdateGeminiChatSettings :exec
+INSERT INTO gemini_chat_settings (chat_id, thread_id, model, temperature, thinking_budget,
+                                  enable_search, enable_code_execution, max_history)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET model=excluded.model,
+                          temperature=excluded.temperature,
+                          thinking_budget=excluded.thinking_budget,
+                          enable_search=excluded.enable_search,
+                          enable_code_execution=excluded.enable_code_execution,
+                          max_history=excluded.max_history
+`
+
+type CreateOrUpdateGeminiChatSettingsParams struct {
+	ChatID              int64   `json:"chat_id"`
+	ThreadID            int64   `json:"thread_id"`
+	Model               string  `json:"model"`
+	Temperature         float64 `json:"temperature"`
+	ThinkingBudget      int64   `json:"thinking_budget"`
+	EnableSearch        bool    `json:"enable_search"`
+	EnableCodeExecution bool    `json:"enable_code_execution"`
+	MaxHistory          int64   `json:"max_history"`
+}
+
+func (q *Queries) CreateOrUpdateGeminiChatSettings(ctx context.Context, arg CreateOrUpdateGeminiChatSettingsParams) error {
+	_, err := q.exec(ctx, q.createOrUpdateGeminiChatSettingsStmt, createOrUpdateGeminiChatSettings,
+		arg.ChatID,
+		arg.ThreadID,
+		arg.Model,
+		arg.Temperature,
+		arg.ThinkingBudget,
+		arg.EnableSearch,
+		arg.EnableCodeExecution,
+		arg.MaxHistory,
+	)
+	return err
+}
+
+const createOrUpdateGeminiPromptPreset = `-- name: CreateOrUpdateGeminiPromptPreset :exec
+INSERT INTO gemini_prompt_presets (name, prompt, author_id, updated_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET prompt=excluded.prompt,
+                          author_id=excluded.author_id,
+                          updated_at=excluded.updated_at
+`
+
+func (q *Queries) CreateOrUpdateGeminiPromptPreset(ctx context.Context, name string, prompt string, authorID int64, updatedAt UnixTime) error {
+	_, err := q.exec(ctx, q.createOrUpdateGeminiPromptPresetStmt, createOrUpdateGeminiPromptPreset,
+		name,
+		prompt,
+		authorID,
+		updatedAt,
+	)
+	return err
+}
+
 const createOrUpdateGeminiSystemPrompt = `-- name: CreateOrUpdateGeminiSystemPrompt :exec
 INSERT INTO gemini_system_prompt (chat_id, thread_id, prompt)
 VALUES (?, ?, ?)
@@ -125,6 +330,220 @@ func (q *Queries) DeleteGeminiMemory(ctx context.Context, id int64) error {
 	return err
 }
 
+const deleteGeminiPrivateUser = `-- name: DeleteGeminiPrivateUser :execrows
+DELETE
+FROM gemini_private_users
+WHERE user_id = ?
+`
+
+func (q *Queries) DeleteGeminiPrivateUser(ctx context.Context, userID int64) (int64, error) {
+	result, err := q.exec(ctx, q.deleteGeminiPrivateUserStmt, deleteGeminiPrivateUser, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteGeminiPromptPreset = `-- name: DeleteGeminiPromptPreset :execrows
+DELETE
+FROM gemini_prompt_presets
+WHERE name = ?
+`
+
+func (q *Queries) DeleteGeminiPromptPreset(ctx context.Context, name string) (int64, error) {
+	result, err := q.exec(ctx, q.deleteGeminiPromptPresetStmt, deleteGeminiPromptPreset, name)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteGeminiScheduledPrompt = `-- name: DeleteGeminiScheduledPrompt :execrows
+DELETE
+FROM gemini_scheduled_prompts
+WHERE id = ?
+  AND chat_id = ?
+`
+
+func (q *Queries) DeleteGeminiScheduledPrompt(ctx context.Context, iD int64, chatID int64) (int64, error) {
+	result, err := q.exec(ctx, q.deleteGeminiScheduledPromptStmt, deleteGeminiScheduledPrompt, iD, chatID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteOrphanGeminiContents = `-- name: DeleteOrphanGeminiContents :execrows
+DELETE
+FROM gemini_contents
+WHERE NOT EXISTS (SELECT 1 FROM gemini_sessions WHERE gemini_sessions.id = gemini_contents.session_id)
+`
+
+func (q *Queries) DeleteOrphanGeminiContents(ctx context.Context) (int64, error) {
+	result, err := q.exec(ctx, q.deleteOrphanGeminiContentsStmt, deleteOrphanGeminiContents)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteUnusedGeminiBlobs = `-- name: DeleteUnusedGeminiBlobs :execrows
+DELETE
+FROM gemini_blobs
+WHERE ref_count <= 0
+  AND created_at < ?
+  AND NOT EXISTS (SELECT 1 FROM gemini_contents WHERE gemini_contents.blob_hash = gemini_blobs.hash)
+`
+
+func (q *Queries) DeleteUnusedGeminiBlobs(ctx context.Context, createdAt UnixTime) (int64, error) {
+	result, err := q.exec(ctx, q.deleteUnusedGeminiBlobsStmt, deleteUnusedGeminiBlobs, createdAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const getChatGeminiUsageSince = `-- name: GetChatGeminiUsageSince :one
+SELECT CAST(COALESCE(SUM(input_tokens + output_tokens), 0) AS INTEGER) AS total
+FROM gemini_usage
+WHERE chat_id = ?
+  AND usage_date >= ?
+`
+
+func (q *Queries) GetChatGeminiUsageSince(ctx context.Context, chatID int64, usageDate int64) (int64, error) {
+	row := q.queryRow(ctx, q.getChatGeminiUsageSinceStmt, getChatGeminiUsageSince, chatID, usageDate)
+	var total int64
+	err := row.Scan(&total)
+	return total, err
+}
+
+const getFirstGeminiContent = `-- name: GetFirstGeminiContent :one
+SELECT session_id, chat_id, msg_id, role, sent_time, username, msg_type, reply_to_msg_id, text, blob_hash, mime_type, quote_part, thought_signature, atable_username, user_id
+FROM gemini_contents
+WHERE session_id = ?
+  AND msg_id > 0
+ORDER BY msg_id
+LIMIT 1
+`
+
+func (q *Queries) GetFirstGeminiContent(ctx context.Context, sessionID int64) (GeminiContent, error) {
+	row := q.queryRow(ctx, q.getFirstGeminiContentStmt, getFirstGeminiContent, sessionID)
+	var i GeminiContent
+	err := row.Scan(
+		&i.SessionID,
+		&i.ChatID,
+		&i.MsgID,
+		&i.Role,
+		&i.SentTime,
+		&i.Username,
+		&i.MsgType,
+		&i.ReplyToMsgID,
+		&i.Text,
+		&i.BlobHash,
+		&i.MimeType,
+		&i.QuotePart,
+		&i.ThoughtSignature,
+		&i.AtableUsername,
+		&i.UserID,
+	)
+	return i, err
+}
+
+const getGeminiBlobData = `-- name: GetGeminiBlobData :one
+SELECT data
+FROM gemini_blobs
+WHERE hash = ?
+`
+
+func (q *Queries) GetGeminiBlobData(ctx context.Context, hash string) ([]byte, error) {
+	row := q.queryRow(ctx, q.getGeminiBlobDataStmt, getGeminiBlobData, hash)
+	var data []byte
+	err := row.Scan(&data)
+	return data, err
+}
+
+const getGeminiChatSettings = `-- name: GetGeminiChatSettings :one
+SELECT chat_id, thread_id, model, temperature, thinking_budget, enable_search, enable_code_execution, max_history
+FROM gemini_chat_settings
+WHERE chat_id = ?
+  AND thread_id = ?
+`
+
+func (q *Queries) GetGeminiChatSettings(ctx context.Context, chatID int64, threadID int64) (GeminiChatSetting, error) {
+	row := q.queryRow(ctx, q.getGeminiChatSettingsStmt, getGeminiChatSettings, chatID, threadID)
+	var i GeminiChatSetting
+	err := row.Scan(
+		&i.ChatID,
+		&i.ThreadID,
+		&i.Model,
+		&i.Temperature,
+		&i.ThinkingBudget,
+		&i.EnableSearch,
+		&i.EnableCodeExecution,
+		&i.MaxHistory,
+	)
+	return i, err
+}
+
+const getGeminiPrivateUser = `-- name: GetGeminiPrivateUser :one
+SELECT user_id, invite_code, added_by, created_at
+FROM gemini_private_users
+WHERE user_id = ?
+`
+
+func (q *Queries) GetGeminiPrivateUser(ctx context.Context, userID int64) (GeminiPrivateUser, error) {
+	row := q.queryRow(ctx, q.getGeminiPrivateUserStmt, getGeminiPrivateUser, userID)
+	var i GeminiPrivateUser
+	err := row.Scan(
+		&i.UserID,
+		&i.InviteCode,
+		&i.AddedBy,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getGeminiPromptPreset = `-- name: GetGeminiPromptPreset :one
+SELECT name, prompt, author_id, updated_at
+FROM gemini_prompt_presets
+WHERE name = ?
+`
+
+func (q *Queries) GetGeminiPromptPreset(ctx context.Context, name string) (GeminiPromptPreset, error) {
+	row := q.queryRow(ctx, q.getGeminiPromptPresetStmt, getGeminiPromptPreset, name)
+	var i GeminiPromptPreset
+	err := row.Scan(
+		&i.Name,
+		&i.Prompt,
+		&i.AuthorID,
+		&i.UpdatedAt,
+	)
+	return i, err
+}
+
+const getGeminiScheduledPrompt = `-- name: GetGeminiScheduledPrompt :one
+SELECT id, chat_id, thread_id, cron, prompt, session_id, created_by, created_at, last_run_at
+FROM gemini_scheduled_prompts
+WHERE id = ?
+`
+
+func (q *Queries) GetGeminiScheduledPrompt(ctx context.Context, id int64) (GeminiScheduledPrompt, error) {
+	row := q.queryRow(ctx, q.getGeminiScheduledPromptStmt, getGeminiScheduledPrompt, id)
+	var i GeminiScheduledPrompt
+	err := row.Scan(
+		&i.ID,
+		&i.ChatID,
+		&i.ThreadID,
+		&i.Cron,
+		&i.Prompt,
+		&i.SessionID,
+		&i.CreatedBy,
+		&i.CreatedAt,
+		&i.LastRunAt,
+	)
+	return i, err
+}
+
 const getGeminiSystemPrompt = `-- name: GetGeminiSystemPrompt :one
 SELECT prompt
 FROM gemini_system_prompt
@@ -139,6 +558,74 @@ func (q *Queries) GetGeminiSystemPrompt(ctx context.Context, chatID int64, threa
 	return prompt, err
 }
 
+const getGeminiSystemPromptLatestVersion = `-- name: GetGeminiSystemPromptLatestVersion :one
+SELECT CAST(COALESCE(MAX(version), 0) AS INTEGER) AS version
+FROM gemini_system_prompt_history
+WHERE chat_id = ?
+  AND thread_id = ?
+`
+
+func (q *Queries) GetGeminiSystemPromptLatestVersion(ctx context.Context, chatID int64, threadID int64) (int64, error) {
+	row := q.queryRow(ctx, q.getGeminiSystemPromptLatestVersionStmt, getGeminiSystemPromptLatestVersion, chatID, threadID)
+	var version int64
+	err := row.Scan(&version)
+	return version, err
+}
+
+const getGeminiSystemPromptVersion = `-- name: GetGeminiSystemPromptVersion :one
+SELECT chat_id, thread_id, version, prompt, author_id, created_at
+FROM gemini_system_prompt_history
+WHERE chat_id = ?
+  AND thread_id = ?
+  AND version = ?
+`
+
+func (q *Queries) GetGeminiSystemPromptVersion(ctx context.Context, chatID int64, threadID int64, version int64) (GeminiSystemPromptHistory, error) {
+	row := q.queryRow(ctx, q.getGeminiSystemPromptVersionStmt, getGeminiSystemPromptVersion, chatID, threadID, version)
+	var i GeminiSystemPromptHistory
+	err := row.Scan(
+		&i.ChatID,
+		&i.ThreadID,
+		&i.Version,
+		&i.Prompt,
+		&i.AuthorID,
+		&i.CreatedAt,
+	)
+	return i, err
+}
+
+const getLatestGeminiSummary = `-- name: GetLatestGeminiSummary :one
+SELECT session_id, chat_id, msg_id, role, sent_time, username, msg_type, reply_to_msg_id, text, blob_hash, mime_type, quote_part, thought_signature, atable_username, user_id
+FROM gemini_contents
+WHERE session_id = ?
+  AND msg_type = 'summary'
+ORDER BY msg_id
+LIMIT 1
+`
+
+func (q *Queries) GetLatestGeminiSummary(ctx context.Context, sessionID int64) (GeminiContent, error) {
+	row := q.queryRow(ctx, q.getLatestGeminiSummaryStmt, getLatestGeminiSummary, sessionID)
+	var i GeminiContent
+	err := row.Scan(
+		&i.SessionID,
+		&i.ChatID,
+		&i.MsgID,
+		&i.Role,
+		&i.SentTime,
+		&i.Username,
+		&i.MsgType,
+		&i.ReplyToMsgID,
+		&i.Text,
+		&i.BlobHash,
+		&i.MimeType,
+		&i.QuotePart,
+		&i.ThoughtSignature,
+		&i.AtableUsername,
+		&i.UserID,
+	)
+	return i, err
+}
+
 const getSessionById = `-- name: GetSessionById :one
 SELECT id, chat_id, chat_name, chat_type, frozen, total_input_tokens, total_output_tokens
 FROM gemini_sessions
@@ -174,6 +661,20 @@ func (q *Queries) GetSessionIdByMessage(ctx context.Context, chatID int64, msgID
 	return session_id, err
 }
 
+const getUserGeminiUsageSince = `-- name: GetUserGeminiUsageSince :one
+SELECT CAST(COALESCE(SUM(input_tokens + output_tokens), 0) AS INTEGER) AS total
+FROM gemini_usage
+WHERE user_id = ?
+  AND usage_date >= ?
+`
+
+func (q *Queries) GetUserGeminiUsageSince(ctx context.Context, userID int64, usageDate int64) (int64, error) {
+	row := q.queryRow(ctx, q.getUserGeminiUsageSinceStmt, getUserGeminiUsageSince, userID, usageDate)
+	var total int64
+	err := row.Scan(&total)
+	return total, err
+}
+
 const incrementSessionTokenCounters = `-- name: IncrementSessionTokenCounters :exec
 UPDATE gemini_sessions
 SET total_input_tokens = total_input_tokens + ?,
@@ -186,6 +687,131 @@ func (q *Queries) IncrementSessionTokenCounters(ctx context.Context, totalInputT
 	return err
 }
 
+const listAllGeminiScheduledPrompts = `-- name: ListAllGeminiScheduledPrompts :many
+SELECT id, chat_id, thread_id, cron, prompt, session_id, created_by, created_at, last_run_at
+FROM gemini_scheduled_prompts
+ORDER BY id
+`
+
+func (q *Queries) ListAllGeminiScheduledPrompts(ctx context.Context) ([]GeminiScheduledPrompt, error) {
+	rows, err := q.query(ctx, q.listAllGeminiScheduledPromptsStmt, listAllGeminiScheduledPrompts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GeminiScheduledPrompt
+	for rows.Next() {
+		var i GeminiScheduledPrompt
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChatID,
+			&i.ThreadID,
+			&i.Cron,
+			&i.Prompt,
+			&i.SessionID,
+			&i.CreatedBy,
+			&i.CreatedAt,
+			&i.LastRunAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChatGeminiScheduledPrompts = `-- name: ListChatGeminiScheduledPrompts :many
+SELECT id, chat_id, thread_id, cron, prompt, session_id, created_by, created_at, last_run_at
+FROM gemini_scheduled_prompts
+WHERE chat_id = ?
+ORDER BY id
+`
+
+func (q *Queries) ListChatGeminiScheduledPrompts(ctx context.Context, chatID int64) ([]GeminiScheduledPrompt, error) {
+	rows, err := q.query(ctx, q.listChatGeminiScheduledPromptsStmt, listChatGeminiScheduledPrompts, chatID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GeminiScheduledPrompt
+	for rows.Next() {
+		var i GeminiScheduledPrompt
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChatID,
+			&i.ThreadID,
+			&i.Cron,
+			&i.Prompt,
+			&i.SessionID,
+			&i.CreatedBy,
+			&i.CreatedAt,
+			&i.LastRunAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChatGeminiUsageSince = `-- name: ListChatGeminiUsageSince :many
+SELECT user_id,
+       model,
+       CAST(SUM(input_tokens) AS INTEGER)  AS input_tokens,
+       CAST(SUM(output_tokens) AS INTEGER) AS output_tokens
+FROM gemini_usage
+WHERE chat_id = ?
+  AND usage_date >= ?
+GROUP BY user_id, model
+`
+
+type ListChatGeminiUsageSinceRow struct {
+	UserID       int64  `json:"user_id"`
+	Model        string `json:"model"`
+	InputTokens  int64  `json:"input_tokens"`
+	OutputTokens int64  `json:"output_tokens"`
+}
+
+func (q *Queries) ListChatGeminiUsageSince(ctx context.Context, chatID int64, usageDate int64) ([]ListChatGeminiUsageSinceRow, error) {
+	rows, err := q.query(ctx, q.listChatGeminiUsageSinceStmt, listChatGeminiUsageSince, chatID, usageDate)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListChatGeminiUsageSinceRow
+	for rows.Next() {
+		var i ListChatGeminiUsageSinceRow
+		if err := rows.Scan(
+			&i.UserID,
+			&i.Model,
+			&i.InputTokens,
+			&i.OutputTokens,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listGeminiMemory = `-- name: ListGeminiMemory :many
 SELECT id, chat_id, topic_id, content
 FROM gemini_memories
@@ -222,6 +848,162 @@ func (q *Queries) ListGeminiMemory(ctx context.Context, chatID int64, topicID in
 	return items, nil
 }
 
+const listGeminiPrivateUsers = `-- name: ListGeminiPrivateUsers :many
+SELECT user_id, invite_code, added_by, created_at
+FROM gemini_private_users
+ORDER BY created_at
+`
+
+func (q *Queries) ListGeminiPrivateUsers(ctx context.Context) ([]GeminiPrivateUser, error) {
+	rows, err := q.query(ctx, q.listGeminiPrivateUsersStmt, listGeminiPrivateUsers)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GeminiPrivateUser
+	for rows.Next() {
+		var i GeminiPrivateUser
+		if err := rows.Scan(
+			&i.UserID,
+			&i.InviteCode,
+			&i.AddedBy,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGeminiPromptPresets = `-- name: ListGeminiPromptPresets :many
+SELECT name, prompt, author_id, updated_at
+FROM gemini_prompt_presets
+ORDER BY name
+`
+
+func (q *Queries) ListGeminiPromptPresets(ctx context.Context) ([]GeminiPromptPreset, error) {
+	rows, err := q.query(ctx, q.listGeminiPromptPresetsStmt, listGeminiPromptPresets)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GeminiPromptPreset
+	for rows.Next() {
+		var i GeminiPromptPreset
+		if err := rows.Scan(
+			&i.Name,
+			&i.Prompt,
+			&i.AuthorID,
+			&i.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listGeminiSystemPromptHistory = `-- name: ListGeminiSystemPromptHistory :many
+SELECT chat_id, thread_id, version, prompt, author_id, created_at
+FROM gemini_system_prompt_history
+WHERE chat_id = ?
+  AND thread_id = ?
+ORDER BY version DESC
+LIMIT ?
+`
+
+func (q *Queries) ListGeminiSystemPromptHistory(ctx context.Context, chatID int64, threadID int64, limit int64) ([]GeminiSystemPromptHistory, error) {
+	rows, err := q.query(ctx, q.listGeminiSystemPromptHistoryStmt, listGeminiSystemPromptHistory, chatID, threadID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GeminiSystemPromptHistory
+	for rows.Next() {
+		var i GeminiSystemPromptHistory
+		if err := rows.Scan(
+			&i.ChatID,
+			&i.ThreadID,
+			&i.Version,
+			&i.Prompt,
+			&i.AuthorID,
+			&i.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listRecentGeminiSessions = `-- name: ListRecentGeminiSessions :many
+SELECT id, chat_id, chat_name, chat_type, frozen, total_input_tokens, total_output_tokens
+FROM gemini_sessions
+WHERE chat_id = ?
+ORDER BY id DESC
+LIMIT ?
+`
+
+func (q *Queries) ListRecentGeminiSessions(ctx context.Context, chatID int64, limit int64) ([]GeminiSession, error) {
+	rows, err := q.query(ctx, q.listRecentGeminiSessionsStmt, listRecentGeminiSessions, chatID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []GeminiSession
+	for rows.Next() {
+		var i GeminiSession
+		if err := rows.Scan(
+			&i.ID,
+			&i.ChatID,
+			&i.ChatName,
+			&i.ChatType,
+			&i.Frozen,
+			&i.TotalInputTokens,
+			&i.TotalOutputTokens,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const recountGeminiBlobRefs = `-- name: RecountGeminiBlobRefs :exec
+UPDATE gemini_blobs
+SET ref_count = (SELECT COUNT(*) FROM gemini_contents WHERE gemini_contents.blob_hash = gemini_blobs.hash)
+`
+
+func (q *Queries) RecountGeminiBlobRefs(ctx context.Context) error {
+	_, err := q.exec(ctx, q.recountGeminiBlobRefsStmt, recountGeminiBlobRefs)
+	return err
+}
+
 const resetGeminiSystemPrompt = `-- name: ResetGeminiSystemPrompt :exec
 DELETE
 FROM gemini_system_prompt
@@ -234,6 +1016,17 @@ func (q *Queries) ResetGeminiSystemPrompt(ctx context.Context, chatID int64, thr
 	return err
 }
 
+const setGeminiSessionFrozen = `-- name: SetGeminiSessionFrozen :exec
+UPDATE gemini_sessions
+SET frozen = ?
+WHERE id = ?
+`
+
+func (q *Queries) SetGeminiSessionFrozen(ctx context.Context, frozen bool, iD int64) error {
+	_, err := q.exec(ctx, q.setGeminiSessionFrozenStmt, setGeminiSessionFrozen, frozen, iD)
+	return err
+}
+
 const updateGeminiMemory = `-- name: UpdateGeminiMemory :exec
 UPDATE gemini_memories
 SET content=?2
@@ -245,16 +1038,45 @@ func (q *Queries) UpdateGeminiMemory(ctx context.Context, iD int64, content stri
 	return err
 }
 
+const updateGeminiScheduledPromptRun = `-- name: UpdateGeminiScheduledPromptRun :exec
+UPDATE gemini_scheduled_prompts
+SET session_id  = ?,
+    last_run_at = ?
+WHERE id = ?
+`
+
+func (q *Queries) UpdateGeminiScheduledPromptRun(ctx context.Context, sessionID int64, lastRunAt UnixTime, iD int64) error {
+	_, err := q.exec(ctx, q.updateGeminiScheduledPromptRunStmt, updateGeminiScheduledPromptRun, sessionID, lastRunAt, iD)
+	return err
+}
+
+const useGeminiInviteCode = `-- name: UseGeminiInviteCode :execrows
+UPDATE gemini_invite_codes
+SET used_count = used_count + 1
+WHERE code = ?
+  AND used_count < max_uses
+  AND expires_at > ?
+`
+
+func (q *Queries) UseGeminiInviteCode(ctx context.Context, code string, expiresAt UnixTime) (int64, error) {
+	result, err := q.exec(ctx, q.useGeminiInviteCodeStmt, useGeminiInviteCode, code, expiresAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllMsgInSessionReversed = `-- name: getAllMsgInSessionReversed :many
-SELECT session_id, chat_id, msg_id, role, sent_time, username, msg_type, reply_to_msg_id, text, blob, mime_type, quote_part, thought_signature, atable_username, user_id
+SELECT session_id, chat_id, msg_id, role, sent_time, username, msg_type, reply_to_msg_id, text, blob_hash, mime_type, quote_part, thought_signature, atable_username, user_id
 FROM gemini_contents
 WHERE session_id = ?
+  AND msg_id > ?
 ORDER BY msg_id DESC
 LIMIT ?
 `
 
-func (q *Queries) getAllMsgInSessionReversed(ctx context.Context, sessionID int64, limit int64) ([]GeminiContent, error) {
-	rows, err := q.query(ctx, q.getAllMsgInSessionReversedStmt, getAllMsgInSessionReversed, sessionID, limit)
+func (q *Queries) getAllMsgInSessionReversed(ctx context.Context, sessionID int64, msgID int64, limit int64) ([]GeminiContent, error) {
+	rows, err := q.query(ctx, q.getAllMsgInSessionReversedStmt, getAllMsgInSessionReversed, sessionID, msgID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -272,7 +1094,7 @@ func (q *Queries) getAllMsgInSessionReversed(ctx context.Context, sessionID int6
 			&i.MsgType,
 			&i.ReplyToMsgID,
 			&i.Text,
-			&i.Blob,
+			&i.BlobHash,
 			&i.MimeType,
 			&i.QuotePart,
 			&i.ThoughtSignature,
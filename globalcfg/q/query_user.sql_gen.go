@@ -66,7 +66,7 @@ func (q *Queries) createNewUser(ctx context.Context, arg createNewUserParams) (i
 
 const getUserById = `-- name: getUserById :one
 
-SELECT id, updated_at, user_id, first_name, last_name, username, profile_update_at, profile_photo, timezone
+SELECT id, updated_at, user_id, first_name, last_name, username, profile_update_at, profile_photo, timezone, timezone_name
 FROM users
 WHERE user_id = ?
 `
@@ -85,6 +85,7 @@ func (q *Queries) getUserById(ctx context.Context, userID int64) (User, error) {
 		&i.ProfileUpdateAt,
 		&i.ProfilePhoto,
 		&i.Timezone,
+		&i.TimezoneName,
 	)
 	return i, err
 }
@@ -134,12 +135,13 @@ func (q *Queries) updateUserProfilePhoto(ctx context.Context, userID int64, prof
 
 const updateUserTimeZone = `-- name: updateUserTimeZone :exec
 UPDATE users
-SET timezone = ?2
+SET timezone      = ?2,
+    timezone_name = ?3
 WHERE user_id = ?1
 RETURNING id
 `
 
-func (q *Queries) updateUserTimeZone(ctx context.Context, userID int64, timezone int64) error {
-	_, err := q.exec(ctx, q.updateUserTimeZoneStmt, updateUserTimeZone, userID, timezone)
+func (q *Queries) updateUserTimeZone(ctx context.Context, userID int64, timezone int64, timezoneName string) error {
+	_, err := q.exec(ctx, q.updateUserTimeZoneStmt, updateUserTimeZone, userID, timezone, timezoneName)
 	return err
 }
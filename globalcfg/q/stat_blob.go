@@ -0,0 +1,227 @@
+package q
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// 统计数据的编码格式：
+//
+//	第一个字节为 0x80|版本号，gob 流的第一个字节是消息长度，不会落在 0x80~0xF7，据此区分新旧格式
+//	v1 TenMinuteStats: uvarint(n) 加上 n 个 varint，末尾的0被省略
+//	v1 UserMsgStatMap: uvarint(用户数)，每个用户按ID升序写入 varint(与上一个ID的差)、
+//	  uvarint(非零字段的位图) 和每个非零字段的 varint，字段顺序见 userMsgStatFields
+//
+// 旧的 gob 数据在读取时仍然可以解码，写入时一律使用新格式，MigrateLegacyChatStats 负责重写历史数据
+const (
+	statBlobVersionMask byte = 0x80
+	statBlobV1               = statBlobVersionMask | 1
+)
+
+var (
+	errStatBlobTruncated = errors.New("stat blob truncated")
+	errStatBlobTooLarge  = errors.New("stat blob too large")
+)
+
+// isGobStatBlob gob 的长度前缀为单字节时小于 0x80，多字节时为 0xF8~0xFF
+func isGobStatBlob(data []byte) bool {
+	return len(data) > 0 && (data[0] < statBlobVersionMask || data[0] >= 0xF8)
+}
+
+func checkStatBlobVersion(data []byte) error {
+	if data[0] != statBlobV1 {
+		return fmt.Errorf("unsupported stat blob version %d", data[0]&^statBlobVersionMask)
+	}
+	return nil
+}
+
+// statBlobReader 按顺序读取 varint，出错后后续读取都返回0
+type statBlobReader struct {
+	data []byte
+	err  error
+}
+
+func (r *statBlobReader) uvarint() uint64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(r.data)
+	if n <= 0 {
+		r.err = errStatBlobTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *statBlobReader) varint() int64 {
+	if r.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(r.data)
+	if n <= 0 {
+		r.err = errStatBlobTruncated
+		return 0
+	}
+	r.data = r.data[n:]
+	return v
+}
+
+func (r *statBlobReader) done() error {
+	if r.err == nil && len(r.data) > 0 {
+		r.err = fmt.Errorf("stat blob has %d trailing bytes", len(r.data))
+	}
+	return r.err
+}
+
+func encodeTenMinuteStats(t *TenMinuteStats) []byte {
+	n := len(t)
+	for n > 0 && t[n-1] == 0 {
+		n--
+	}
+	buf := make([]byte, 0, 2+n*2)
+	buf = append(buf, statBlobV1)
+	buf = binary.AppendUvarint(buf, uint64(n))
+	for _, v := range t[:n] {
+		buf = binary.AppendVarint(buf, v)
+	}
+	return buf
+}
+
+func decodeTenMinuteStats(data []byte, t *TenMinuteStats) error {
+	if err := checkStatBlobVersion(data); err != nil {
+		return err
+	}
+	r := &statBlobReader{data: data[1:]}
+	n := r.uvarint()
+	if n > uint64(len(t)) {
+		return errStatBlobTooLarge
+	}
+	var res TenMinuteStats
+	for i := range n {
+		res[i] = r.varint()
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+	*t = res
+	return nil
+}
+
+// userMsgStatFields 编码的字段顺序，位图的第 i 位对应第 i 个字段，只能在末尾追加
+func userMsgStatFields(u *UserMsgStat) []*int64 {
+	fields := []*int64{&u.MsgCount, &u.MsgLen, &u.PhotoCount, &u.VideoCount, &u.StickerCount, &u.ForwardCount}
+	for i := range u.MsgCountByHour {
+		fields = append(fields, &u.MsgCountByHour[i])
+	}
+	return fields
+}
+
+func encodeUserMsgStatMap(m UserMsgStatMap) []byte {
+	ids := make([]int64, 0, len(m))
+	for id, stat := range m {
+		if stat != nil {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	buf := make([]byte, 0, 2+len(ids)*8)
+	buf = append(buf, statBlobV1)
+	buf = binary.AppendUvarint(buf, uint64(len(ids)))
+	var prev int64
+	for _, id := range ids {
+		buf = binary.AppendVarint(buf, id-prev)
+		prev = id
+		fields := userMsgStatFields(m[id])
+		var mask uint64
+		for i, f := range fields {
+			if *f != 0 {
+				mask |= 1 << i
+			}
+		}
+		buf = binary.AppendUvarint(buf, mask)
+		for _, f := range fields {
+			if *f != 0 {
+				buf = binary.AppendVarint(buf, *f)
+			}
+		}
+	}
+	return buf
+}
+
+func decodeUserMsgStatMap(data []byte, m *UserMsgStatMap) error {
+	if err := checkStatBlobVersion(data); err != nil {
+		return err
+	}
+	r := &statBlobReader{data: data[1:]}
+	n := r.uvarint()
+	// 每个用户至少占两个字节
+	if n > uint64(len(r.data)) {
+		return errStatBlobTooLarge
+	}
+	res := make(UserMsgStatMap, n)
+	var id int64
+	for range n {
+		id += r.varint()
+		stat := &UserMsgStat{}
+		fields := userMsgStatFields(stat)
+		mask := r.uvarint()
+		if mask>>len(fields) != 0 {
+			return fmt.Errorf("unknown user stat fields %#x", mask)
+		}
+		for i, f := range fields {
+			if mask&(1<<i) != 0 {
+				*f = r.varint()
+			}
+		}
+		res[id] = stat
+	}
+	if err := r.done(); err != nil {
+		return err
+	}
+	*m = res
+	return nil
+}
+
+func decodeGob(data []byte, v any) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// MigrateLegacyChatStats 把仍是 gob 编码的每日统计重写为新格式，每批 batchSize 行，直到没有旧数据为止。
+// 更新时会再次检查数据是否仍是旧格式，已经被 ChatStat.Save 以新格式写过的行不会被旧值覆盖
+func (q *Queries) MigrateLegacyChatStats(ctx context.Context, batchSize int64, interval time.Duration) (int64, error) {
+	var migrated int64
+	for {
+		rows, err := q.listLegacyChatStats(ctx, batchSize)
+		if err != nil {
+			return migrated, err
+		}
+		if len(rows) == 0 {
+			return migrated, nil
+		}
+		for _, row := range rows {
+			err = q.updateLegacyChatStat(ctx, updateLegacyChatStatParams{
+				UserMsgStat:      row.UserMsgStat,
+				MsgCountByTime:   row.MsgCountByTime,
+				MsgIDAtTimeStart: row.MsgIDAtTimeStart,
+				ChatID:           row.ChatID,
+				StatDate:         row.StatDate,
+			})
+			if err != nil {
+				return migrated, err
+			}
+			migrated++
+		}
+		select {
+		case <-ctx.Done():
+			return migrated, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package q
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func gobBytes(t *testing.T, v any) []byte {
+	buf := new(bytes.Buffer)
+	assert.NoError(t, gob.NewEncoder(buf).Encode(v))
+	return buf.Bytes()
+}
+
+func TestStatBlobRoundTrip(t *testing.T) {
+	as := assert.New(t)
+	m := UserMsgStatMap{
+		-1001234: {MsgCount: 1, MsgLen: 5, ForwardCount: 1},
+		42:       {MsgCount: 300, MsgLen: 12345, PhotoCount: 2},
+		7:        {},
+		9:        nil,
+	}
+	m[42].MsgCountByHour[23] = 300
+	v, err := m.Value()
+	as.NoError(err)
+	as.Equal(statBlobV1, v.([]byte)[0])
+
+	var decoded UserMsgStatMap
+	as.NoError(decoded.Scan(v))
+	as.Len(decoded, 3)
+	as.Equal(*m[-1001234], *decoded[-1001234])
+	as.Equal(*m[42], *decoded[42])
+	as.Equal(UserMsgStat{}, *decoded[7])
+
+	var ts TenMinuteStats
+	ts[0], ts[100] = 3, 1<<40
+	v, err = ts.Value()
+	as.NoError(err)
+	var decodedTs TenMinuteStats
+	as.NoError(decodedTs.Scan(v))
+	as.Equal(ts, decodedTs)
+
+	v, err = TenMinuteStats{}.Value()
+	as.NoError(err)
+	as.Equal([]byte{statBlobV1, 0}, v)
+}
+
+func TestStatBlobSmallerThanGob(t *testing.T) {
+	m := UserMsgStatMap{}
+	for i := int64(1); i <= 50; i++ {
+		m[100000000+i*7919] = &UserMsgStat{MsgCount: i, MsgLen: i * 20}
+	}
+	v, _ := m.Value()
+	assert.Less(t, len(v.([]byte))*3, len(gobBytes(t, m)))
+}
+
+func TestStatBlobReadsGob(t *testing.T) {
+	as := assert.New(t)
+	var ts TenMinuteStats
+	ts[5] = 9
+	var decodedTs TenMinuteStats
+	as.NoError(decodedTs.Scan(gobBytes(t, ts)))
+	as.Equal(ts, decodedTs)
+
+	// 用户多时 gob 的长度前缀为多字节
+	m := UserMsgStatMap{}
+	for i := int64(0); i < 100; i++ {
+		m[i] = &UserMsgStat{MsgCount: i + 1}
+	}
+	data := gobBytes(t, m)
+	as.True(isGobStatBlob(data))
+	var decoded UserMsgStatMap
+	as.NoError(decoded.Scan(data))
+	as.Equal(m, decoded)
+}
+
+func TestStatBlobRejectsBadData(t *testing.T) {
+	as := assert.New(t)
+	var m UserMsgStatMap
+	as.Error(m.Scan([]byte{statBlobV1, 1, 2}))
+	as.Error(m.Scan([]byte{statBlobVersionMask | 2, 0}))
+	as.Error(m.Scan([]byte{statBlobV1, 0, 0}))
+
+	var ts TenMinuteStats
+	as.Error(ts.Scan([]byte{statBlobV1, 200, 1}))
+	as.Error(ts.Scan([]byte{statBlobV1, 2, 2}))
+}
@@ -0,0 +1,120 @@
+package q
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	_ "time/tzdata" // 运行环境不一定安装了时区数据库
+)
+
+// DefaultTimezone 默认的东八区偏移（秒）
+const DefaultTimezone = 8 * 60 * 60
+
+var (
+	reUtcOffset        = regexp.MustCompile(`^(?i:UTC|GMT)?([+-])(\d{1,2})(?::?(\d{2}))?$`)
+	errInvalidTimezone = errors.New("时区格式应为 IANA 时区名（例如 Asia/Shanghai）或 ±hh:mm（例如 +08:00）")
+	locationCache      sync.Map // IANA 时区名或 FormatUtcOffset -> *time.Location
+)
+
+// ParseTimezone 解析 IANA 时区名或 UTC 偏移。IANA 时区返回时区名和当前的偏移，UTC 偏移返回空的时区名
+func ParseTimezone(s string) (name string, offset int64, err error) {
+	s = strings.TrimSpace(s)
+	if m := reUtcOffset.FindStringSubmatch(s); m != nil {
+		hours, _ := strconv.ParseInt(m[2], 10, 64)
+		var minutes int64
+		if m[3] != "" {
+			minutes, _ = strconv.ParseInt(m[3], 10, 64)
+		}
+		if hours > 14 || minutes >= 60 {
+			return "", 0, errInvalidTimezone
+		}
+		offset = hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return "", offset, nil
+	}
+	// time.LoadLocation 会把空字符串和 Local 当作 UTC 和本机时区
+	if s == "" || strings.EqualFold(s, "Local") {
+		return "", 0, errInvalidTimezone
+	}
+	loc, err := time.LoadLocation(s)
+	if err != nil {
+		return "", 0, errInvalidTimezone
+	}
+	_, off := time.Now().In(loc).Zone()
+	return loc.String(), int64(off), nil
+}
+
+// LoadTimezone name 不为空时返回 IANA 时区，否则（或时区数据中没有这个名字时）返回偏移 offset 秒的固定时区。
+// 同一个时区总是返回同一个 *time.Location
+func LoadTimezone(name string, offset int64) *time.Location {
+	if name != "" {
+		if loc, ok := locationCache.Load(name); ok {
+			return loc.(*time.Location)
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			actual, _ := locationCache.LoadOrStore(name, loc)
+			return actual.(*time.Location)
+		}
+	}
+	fixed := FormatUtcOffset(offset)
+	if loc, ok := locationCache.Load(fixed); ok {
+		return loc.(*time.Location)
+	}
+	actual, _ := locationCache.LoadOrStore(fixed, time.FixedZone(fixed, int(offset)))
+	return actual.(*time.Location)
+}
+
+// FormatUtcOffset 例如 UTC+08:00、UTC-05:30
+func FormatUtcOffset(offset int64) string {
+	sign := '+'
+	if offset < 0 {
+		sign, offset = '-', -offset
+	}
+	return fmt.Sprintf("UTC%c%02d:%02d", sign, offset/3600, offset%3600/60)
+}
+
+// FormatTimezone 显示用的时区，IANA 时区会带上当前的偏移
+func FormatTimezone(loc *time.Location) string {
+	_, off := time.Now().In(loc).Zone()
+	if name := loc.String(); !strings.HasPrefix(name, "UTC+") && !strings.HasPrefix(name, "UTC-") {
+		return fmt.Sprintf("%s（%s）", name, FormatUtcOffset(int64(off)))
+	}
+	return FormatUtcOffset(int64(off))
+}
+
+// StatDayOf 返回 unixTime 在 loc 中的日期，即从 Unix 纪元开始的天数
+func StatDayOf(unixTime int64, loc *time.Location) int64 {
+	_, off := time.Unix(unixTime, 0).In(loc).Zone()
+	return floorDiv(unixTime+int64(off), daySeconds)
+}
+
+// StatDayStart 返回 stat_date 为 day 的那一天在 loc 中开始的 Unix 时间，
+// 夏令时切换的日子不是24小时，一天的范围应该是 [StatDayStart(day), StatDayStart(day+1))
+func StatDayStart(day int64, loc *time.Location) int64 {
+	t := time.Unix(day*daySeconds, 0).UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc).Unix()
+}
+
+func floorDiv(a, b int64) int64 {
+	q := a / b
+	if a%b < 0 {
+		q--
+	}
+	return q
+}
+
+// Location 聊天的时区
+func (c *ChatCfg) Location() *time.Location {
+	return LoadTimezone(c.TimezoneName, c.Timezone)
+}
+
+// Location 用户的时区
+func (u *User) Location() *time.Location {
+	return LoadTimezone(u.TimezoneName, u.Timezone)
+}
@@ -0,0 +1,83 @@
+package q
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimezone(t *testing.T) {
+	as := assert.New(t)
+	for s, want := range map[string]int64{
+		"+08:00":    8 * 3600,
+		"+8":        8 * 3600,
+		"-05:30":    -(5*3600 + 30*60),
+		"UTC+0530":  5*3600 + 30*60,
+		"gmt-3":     -3 * 3600,
+		" +14:00  ": 14 * 3600,
+	} {
+		name, offset, err := ParseTimezone(s)
+		as.NoError(err, s)
+		as.Empty(name, s)
+		as.Equal(want, offset, s)
+	}
+
+	name, _, err := ParseTimezone("America/New_York")
+	as.NoError(err)
+	as.Equal("America/New_York", name)
+
+	for _, s := range []string{"", "Local", "+15:00", "+08:60", "Mars/Olympus", "8"} {
+		_, _, err = ParseTimezone(s)
+		as.Error(err, s)
+	}
+}
+
+func TestLoadTimezone(t *testing.T) {
+	as := assert.New(t)
+	as.Same(LoadTimezone("", 8*3600), LoadTimezone("", 8*3600))
+	as.Same(LoadTimezone("Asia/Tokyo", 0), LoadTimezone("Asia/Tokyo", 9*3600))
+	as.Equal("UTC+05:30", LoadTimezone("", 5*3600+30*60).String())
+	// 时区数据中没有的名字使用固定偏移
+	as.Equal("UTC-03:00", LoadTimezone("Mars/Olympus", -3*3600).String())
+	as.Equal("UTC-05:30", FormatTimezone(LoadTimezone("", -(5*3600+30*60))))
+}
+
+func TestStatDayAcrossDST(t *testing.T) {
+	as := assert.New(t)
+	ny := LoadTimezone("America/New_York", 0)
+	// 2024-03-10 开始夏令时，这一天只有23小时；2024-11-03 结束夏令时，这一天有25小时
+	for _, c := range []struct {
+		date  time.Time
+		hours int64
+	}{
+		{time.Date(2024, 3, 10, 0, 0, 0, 0, ny), 23},
+		{time.Date(2024, 3, 11, 0, 0, 0, 0, ny), 24},
+		{time.Date(2024, 11, 3, 0, 0, 0, 0, ny), 25},
+	} {
+		day := StatDayOf(c.date.Unix(), ny)
+		start := StatDayStart(day, ny)
+		as.Equal(c.date.Unix(), start)
+		as.Equal(c.hours*3600, StatDayStart(day+1, ny)-start)
+		as.Equal(day, StatDayOf(StatDayStart(day+1, ny)-1, ny))
+		as.Equal(day+1, StatDayOf(StatDayStart(day+1, ny), ny))
+	}
+	as.Equal(int64(-1), StatDayOf(-1, time.UTC))
+	as.Equal(int64(-1), StatDayStart(-1, time.UTC)/daySeconds)
+}
+
+func TestIncMessageDST(t *testing.T) {
+	as := assert.New(t)
+	ny := LoadTimezone("America/New_York", 0)
+	s := &ChatStat{loc: ny}
+	// 夏令时开始后的 09:30 是 UTC 13:30，按当地时间计入9点
+	s.IncMessage(1, 1, time.Date(2024, 3, 10, 13, 30, 0, 0, time.UTC).Unix(), 1, 0)
+	// 夏令时结束那天 01:30 出现两次，都计入1点
+	s.IncMessage(1, 1, time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC).Unix(), 2, 0)
+	s.IncMessage(1, 1, time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC).Unix(), 3, 0)
+	u := s.UserMsgStat[1]
+	as.Equal(int64(1), u.MsgCountByHour[9])
+	as.Equal(int64(2), u.MsgCountByHour[1])
+	as.Equal(int64(2), s.MsgCountByTime[1*6+3])
+	as.Equal(int64(2), s.MsgIDAtTimeStart[1*6+3])
+}
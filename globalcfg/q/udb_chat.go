@@ -10,6 +10,9 @@ import (
 	"github.com/PaulSonOfLars/gotgbot/v2"
 )
 
+// DefaultStatTime 默认在聊天时区的 08:00 发送每日统计
+const DefaultStatTime = 8 * 60
+
 type ChatCfg struct {
 	ID             int64         `json:"id"`
 	WebID          sql.NullInt64 `json:"web_id"`
@@ -22,6 +25,14 @@ type ChatCfg struct {
 	EnableCoc      bool          `json:"enable_coc"     btnTxt:"启用CoC辅助" pos:"3,2"`
 	RespNsfwMsg    bool          `json:"resp_nsfw_msg"  btnTxt:"响应来张色图" pos:"4,1"`
 	Timezone       int64         `json:"timezone"`
+	DailyDigest    bool          `json:"daily_digest"   btnTxt:"AI每日摘要" pos:"4,2"`
+	DigestOnly     bool          `json:"digest_only"    btnTxt:"摘要代替统计" pos:"5,1"`
+	AutoTranslate  bool          `json:"auto_translate" btnTxt:"AI自动翻译" pos:"5,2"`
+	TranslateLang  string        `json:"translate_lang"`
+	DailyStat      bool          `json:"daily_stat"     btnTxt:"每日统计" pos:"6,1"`
+	StatTime       int64         `json:"stat_time"`
+	StatTemplate   string        `json:"stat_template"`
+	TimezoneName   string        `json:"timezone_name"`
 	InDatabase     bool          `json:"in_database"`
 }
 
@@ -38,6 +49,14 @@ func fromInnerCfg(cfg *chatCfg) *ChatCfg {
 		EnableCoc:      cfg.EnableCoc,
 		RespNsfwMsg:    cfg.RespNsfwMsg,
 		Timezone:       cfg.Timezone,
+		DailyDigest:    cfg.DailyDigest,
+		DigestOnly:     cfg.DigestOnly,
+		AutoTranslate:  cfg.AutoTranslate,
+		TranslateLang:  cfg.TranslateLang,
+		DailyStat:      cfg.DailyStat,
+		StatTime:       cfg.StatTime,
+		StatTemplate:   cfg.StatTemplate,
+		TimezoneName:   cfg.TimezoneName,
 		InDatabase:     true,
 	}
 }
@@ -57,7 +76,9 @@ func defaultChagCfg(id int64) *ChatCfg {
 		SaveMessages:   true,
 		EnableCoc:      false,
 		RespNsfwMsg:    false,
-		Timezone:       8 * 60 * 60,
+		Timezone:       DefaultTimezone,
+		TranslateLang:  "zh",
+		StatTime:       DefaultStatTime,
 		InDatabase:     false,
 	}
 }
@@ -77,6 +98,14 @@ func (c *ChatCfg) Save(ctx context.Context, q *Queries) error {
 			EnableCoc:      c.EnableCoc,
 			RespNsfwMsg:    c.RespNsfwMsg,
 			Timezone:       c.Timezone,
+			DailyDigest:    c.DailyDigest,
+			DigestOnly:     c.DigestOnly,
+			AutoTranslate:  c.AutoTranslate,
+			TranslateLang:  c.TranslateLang,
+			DailyStat:      c.DailyStat,
+			StatTime:       c.StatTime,
+			StatTemplate:   c.StatTemplate,
+			TimezoneName:   c.TimezoneName,
 		})
 	}
 	return q.updateChatCfg(ctx, updateChatCfgParams{
@@ -88,6 +117,15 @@ func (c *ChatCfg) Save(ctx context.Context, q *Queries) error {
 		SaveMessages:   c.SaveMessages,
 		EnableCoc:      c.EnableCoc,
 		RespNsfwMsg:    c.RespNsfwMsg,
+		DailyDigest:    c.DailyDigest,
+		DigestOnly:     c.DigestOnly,
+		AutoTranslate:  c.AutoTranslate,
+		TranslateLang:  c.TranslateLang,
+		DailyStat:      c.DailyStat,
+		StatTime:       c.StatTime,
+		StatTemplate:   c.StatTemplate,
+		Timezone:       c.Timezone,
+		TimezoneName:   c.TimezoneName,
 		ID:             c.ID,
 	})
 }
@@ -1,10 +1,8 @@
 package q
 
 import (
-	"bytes"
 	"context"
 	"database/sql/driver"
-	"encoding/gob"
 	"fmt"
 	"main/helpers/lrusf"
 	"sync"
@@ -16,9 +14,38 @@ const (
 	tenMinutes       = 10 * 60
 )
 
+// UserMsgStat 的编码见 stat_blob.go，新增的字段在旧数据中为零值
 type UserMsgStat struct {
-	MsgCount int64
-	MsgLen   int64
+	MsgCount     int64
+	MsgLen       int64
+	PhotoCount   int64
+	VideoCount   int64
+	StickerCount int64
+	ForwardCount int64
+	// 按聊天时区的小时统计的消息数
+	MsgCountByHour [24]int64
+}
+
+// MsgMedia 消息中包含的媒体类型，可以组合使用
+type MsgMedia uint8
+
+const (
+	MediaPhoto MsgMedia = 1 << iota
+	MediaVideo
+	MediaSticker
+	MediaForward
+)
+
+func (u *UserMsgStat) merge(o *UserMsgStat) {
+	u.MsgCount += o.MsgCount
+	u.MsgLen += o.MsgLen
+	u.PhotoCount += o.PhotoCount
+	u.VideoCount += o.VideoCount
+	u.StickerCount += o.StickerCount
+	u.ForwardCount += o.ForwardCount
+	for i := range u.MsgCountByHour {
+		u.MsgCountByHour[i] += o.MsgCountByHour[i]
+	}
 }
 
 type UserMsgStatMap map[int64]*UserMsgStat
@@ -32,13 +59,29 @@ func (u *UserMsgStatMap) Scan(src any) error {
 		*u = make(UserMsgStatMap)
 		return nil
 	}
-	return gob.NewDecoder(bytes.NewReader(data)).Decode(u)
-
+	if isGobStatBlob(data) {
+		return decodeGob(data, u)
+	}
+	return decodeUserMsgStatMap(data, u)
 }
+
 func (u UserMsgStatMap) Value() (driver.Value, error) {
-	buf := new(bytes.Buffer)
-	err := gob.NewEncoder(buf).Encode(u)
-	return buf.Bytes(), err
+	return encodeUserMsgStatMap(u), nil
+}
+
+// Merge 将 o 中每个用户的统计累加到 u
+func (u UserMsgStatMap) Merge(o UserMsgStatMap) {
+	for userId, stat := range o {
+		if stat == nil {
+			continue
+		}
+		cur, ok := u[userId]
+		if !ok || cur == nil {
+			cur = &UserMsgStat{}
+			u[userId] = cur
+		}
+		cur.merge(stat)
+	}
 }
 
 type TenMinuteStats [24 * 6]int64
@@ -52,26 +95,102 @@ func (t *TenMinuteStats) Scan(src any) error {
 		*t = TenMinuteStats{}
 		return nil
 	}
-	return gob.NewDecoder(bytes.NewReader(data)).Decode(t)
+	if isGobStatBlob(data) {
+		return decodeGob(data, t)
+	}
+	return decodeTenMinuteStats(data, t)
 }
 
 func (t TenMinuteStats) Value() (driver.Value, error) {
-	buf := new(bytes.Buffer)
-	err := gob.NewEncoder(buf).Encode(t)
-	return buf.Bytes(), err
+	return encodeTenMinuteStats(&t), nil
+}
+
+// MergeChatStats 合并多天的统计，计数累加，MaxMarsCount 取最大值，
+// MsgIDAtTimeStart 保留最早一天的消息ID。返回值的 StatDate 为第一天
+func MergeChatStats(days []ChatStatDaily) ChatStatDaily {
+	merged := ChatStatDaily{UserMsgStat: make(UserMsgStatMap)}
+	for i, d := range days {
+		if i == 0 {
+			merged.ChatID = d.ChatID
+			merged.StatDate = d.StatDate
+		}
+		merged.MessageCount += d.MessageCount
+		merged.PhotoCount += d.PhotoCount
+		merged.VideoCount += d.VideoCount
+		merged.StickerCount += d.StickerCount
+		merged.ForwardCount += d.ForwardCount
+		merged.MarsCount += d.MarsCount
+		merged.MaxMarsCount = max(merged.MaxMarsCount, d.MaxMarsCount)
+		merged.RacyCount += d.RacyCount
+		merged.AdultCount += d.AdultCount
+		merged.DownloadVideoCount += d.DownloadVideoCount
+		merged.DownloadAudioCount += d.DownloadAudioCount
+		merged.DioAddUserCount += d.DioAddUserCount
+		merged.DioBanUserCount += d.DioBanUserCount
+		merged.UserMsgStat.Merge(d.UserMsgStat)
+		for j := range merged.MsgCountByTime {
+			merged.MsgCountByTime[j] += d.MsgCountByTime[j]
+			if merged.MsgIDAtTimeStart[j] == 0 {
+				merged.MsgIDAtTimeStart[j] = d.MsgIDAtTimeStart[j]
+			}
+		}
+	}
+	return merged
 }
 
+// ChatStat 内存中的当天统计。每次修改 version 加一，保存成功后记录到 savedVersion，两者不同时为脏数据
 type ChatStat struct {
-	mu       sync.Mutex
-	timezone int64
+	mu           sync.Mutex
+	saveMu       sync.Mutex // 保证同一个统计的保存按顺序进行，旧的快照不会覆盖新的
+	loc          *time.Location
+	version      uint64
+	savedVersion uint64
+	// 已经累加到 chat_user_stat_total 的用户统计，只在 saveMu 内访问
+	totalSaved UserMsgStatMap
 	ChatStatDaily
 }
 
-func (s *ChatStat) IncMessage(userId, txtLen, unixTime, messageId int64) {
+func (u UserMsgStatMap) clone() UserMsgStatMap {
+	res := make(UserMsgStatMap, len(u))
+	for userId, stat := range u {
+		if stat != nil {
+			c := *stat
+			res[userId] = &c
+		}
+	}
+	return res
+}
+
+// Snapshot 返回当前统计的深拷贝，可以在不持有锁的情况下读取
+func (s *ChatStat) Snapshot() ChatStatDaily {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapshot()
+}
+
+func (s *ChatStat) snapshot() ChatStatDaily {
+	daily := s.ChatStatDaily
+	daily.UserMsgStat = s.UserMsgStat.clone()
+	return daily
+}
+
+// Dirty 是否有尚未保存到数据库的修改
+func (s *ChatStat) Dirty() bool {
+	if s == nil {
+		return false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.version != s.savedVersion
+}
+
+// IncMessage 记录一条消息，media 中的媒体类型同时计入聊天和用户的统计
+func (s *ChatStat) IncMessage(userId, txtLen, unixTime, messageId int64, media MsgMedia) {
 	if s == nil {
 		return
 	}
 	s.mu.Lock()
+	s.version++
 	s.MessageCount++
 	if s.UserMsgStat == nil {
 		s.UserMsgStat = make(UserMsgStatMap, 4)
@@ -81,10 +200,9 @@ func (s *ChatStat) IncMessage(userId, txtLen, unixTime, messageId int64) {
 		stat = &UserMsgStat{}
 		s.UserMsgStat[userId] = stat
 	}
-	timeSec := (unixTime + s.timezone) % daySeconds
-	if timeSec < 0 {
-		timeSec += daySeconds
-	}
+	local := time.Unix(unixTime, 0).In(s.loc)
+	// 夏令时结束那天重复的一小时计入同一个时段
+	timeSec := int64(local.Hour()*3600 + local.Minute()*60 + local.Second())
 	idx := int(timeSec / tenMinutes)
 	s.MsgCountByTime[idx]++
 	if s.MsgIDAtTimeStart[idx] == 0 {
@@ -92,46 +210,32 @@ func (s *ChatStat) IncMessage(userId, txtLen, unixTime, messageId int64) {
 	}
 	stat.MsgCount++
 	stat.MsgLen += txtLen
-	s.mu.Unlock()
-}
-
-func (s *ChatStat) IncPhotoCount() {
-	if s == nil {
-		return
+	stat.MsgCountByHour[timeSec/3600]++
+	if media&MediaPhoto != 0 {
+		s.PhotoCount++
+		stat.PhotoCount++
 	}
-	s.mu.Lock()
-	s.PhotoCount++
-	s.mu.Unlock()
-}
-func (s *ChatStat) IncVideoCount() {
-	if s == nil {
-		return
+	if media&MediaVideo != 0 {
+		s.VideoCount++
+		stat.VideoCount++
 	}
-	s.mu.Lock()
-	s.VideoCount++
-	s.mu.Unlock()
-}
-func (s *ChatStat) IncStickerCount() {
-	if s == nil {
-		return
+	if media&MediaSticker != 0 {
+		s.StickerCount++
+		stat.StickerCount++
 	}
-	s.mu.Lock()
-	s.StickerCount++
-	s.mu.Unlock()
-}
-func (s *ChatStat) IncForwardCount() {
-	if s == nil {
-		return
+	if media&MediaForward != 0 {
+		s.ForwardCount++
+		stat.ForwardCount++
 	}
-	s.mu.Lock()
-	s.ForwardCount++
 	s.mu.Unlock()
 }
+
 func (s *ChatStat) IncMarsCount(maxMarsCount int64) {
 	if s == nil {
 		return
 	}
 	s.mu.Lock()
+	s.version++
 	s.MarsCount++
 	s.MaxMarsCount = max(maxMarsCount, s.MaxMarsCount)
 	s.mu.Unlock()
@@ -141,6 +245,7 @@ func (s *ChatStat) IncRacyCount() {
 		return
 	}
 	s.mu.Lock()
+	s.version++
 	s.RacyCount++
 	s.mu.Unlock()
 }
@@ -149,6 +254,7 @@ func (s *ChatStat) IncAdultCount() {
 		return
 	}
 	s.mu.Lock()
+	s.version++
 	s.AdultCount++
 	s.mu.Unlock()
 }
@@ -157,6 +263,7 @@ func (s *ChatStat) IncDownloadVideoCount() {
 		return
 	}
 	s.mu.Lock()
+	s.version++
 	s.DownloadVideoCount++
 	s.mu.Unlock()
 }
@@ -165,6 +272,7 @@ func (s *ChatStat) IncDownloadAudioCount() {
 		return
 	}
 	s.mu.Lock()
+	s.version++
 	s.DownloadAudioCount++
 	s.mu.Unlock()
 }
@@ -173,6 +281,7 @@ func (s *ChatStat) IncDioAddUserCount() {
 		return
 	}
 	s.mu.Lock()
+	s.version++
 	s.DioAddUserCount++
 	s.mu.Unlock()
 }
@@ -181,36 +290,99 @@ func (s *ChatStat) IncDioBanUserCount() {
 		return
 	}
 	s.mu.Lock()
+	s.version++
 	s.DioBanUserCount++
 	s.mu.Unlock()
 }
 
+// Save 在锁内取快照后写入数据库，写入期间不阻塞 IncMessage 等操作；没有修改时直接返回
 func (s *ChatStat) Save(ctx context.Context, q *Queries) error {
 	if s == nil {
 		return nil
 	}
+	s.saveMu.Lock()
+	defer s.saveMu.Unlock()
 	s.mu.Lock()
-	defer s.mu.Unlock()
-	return q.UpdateChatStatDaily(ctx, UpdateChatStatDailyParams{
-		MessageCount:       s.MessageCount,
-		PhotoCount:         s.PhotoCount,
-		VideoCount:         s.VideoCount,
-		StickerCount:       s.StickerCount,
-		ForwardCount:       s.ForwardCount,
-		MarsCount:          s.MarsCount,
-		MaxMarsCount:       s.MaxMarsCount,
-		RacyCount:          s.RacyCount,
-		AdultCount:         s.AdultCount,
-		DownloadVideoCount: s.DownloadVideoCount,
-		DownloadAudioCount: s.DownloadAudioCount,
-		DioAddUserCount:    s.DioAddUserCount,
-		DioBanUserCount:    s.DioBanUserCount,
-		UserMsgStat:        s.UserMsgStat,
-		MsgCountByTime:     s.MsgCountByTime,
-		MsgIDAtTimeStart:   s.MsgIDAtTimeStart,
-		ChatID:             s.ChatID,
-		StatDate:           s.StatDate,
+	if s.version == s.savedVersion {
+		s.mu.Unlock()
+		return nil
+	}
+	version := s.version
+	daily := s.snapshot()
+	s.mu.Unlock()
+
+	err := q.UpdateChatStatDaily(ctx, UpdateChatStatDailyParams{
+		MessageCount:       daily.MessageCount,
+		PhotoCount:         daily.PhotoCount,
+		VideoCount:         daily.VideoCount,
+		StickerCount:       daily.StickerCount,
+		ForwardCount:       daily.ForwardCount,
+		MarsCount:          daily.MarsCount,
+		MaxMarsCount:       daily.MaxMarsCount,
+		RacyCount:          daily.RacyCount,
+		AdultCount:         daily.AdultCount,
+		DownloadVideoCount: daily.DownloadVideoCount,
+		DownloadAudioCount: daily.DownloadAudioCount,
+		DioAddUserCount:    daily.DioAddUserCount,
+		DioBanUserCount:    daily.DioBanUserCount,
+		UserMsgStat:        daily.UserMsgStat,
+		MsgCountByTime:     daily.MsgCountByTime,
+		MsgIDAtTimeStart:   daily.MsgIDAtTimeStart,
+		ChatID:             daily.ChatID,
+		StatDate:           daily.StatDate,
 	})
+	if err != nil {
+		return err
+	}
+	if err = s.saveUserTotals(ctx, q, daily.ChatID, daily.UserMsgStat); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	s.savedVersion = version
+	s.mu.Unlock()
+	return nil
+}
+
+// saveUserTotals 把每个用户与上次累加时相比的变化累加到 chat_user_stat_total。
+// 累加失败时保留未完成的用户，下次保存时再累加，已经累加的用户不会重复计算
+func (s *ChatStat) saveUserTotals(ctx context.Context, q *Queries, chatId int64, users UserMsgStatMap) error {
+	if s.totalSaved == nil {
+		s.totalSaved = make(UserMsgStatMap)
+	}
+	ids := make(map[int64]struct{}, len(users))
+	for userId := range users {
+		ids[userId] = struct{}{}
+	}
+	for userId := range s.totalSaved {
+		ids[userId] = struct{}{}
+	}
+	for userId := range ids {
+		var cur, prev UserMsgStat
+		if u := users[userId]; u != nil {
+			cur = *u
+		}
+		if u := s.totalSaved[userId]; u != nil {
+			prev = *u
+		}
+		arg := addChatUserStatTotalParams{
+			ChatID:       chatId,
+			UserID:       userId,
+			MsgCount:     cur.MsgCount - prev.MsgCount,
+			MsgLen:       cur.MsgLen - prev.MsgLen,
+			PhotoCount:   cur.PhotoCount - prev.PhotoCount,
+			VideoCount:   cur.VideoCount - prev.VideoCount,
+			StickerCount: cur.StickerCount - prev.StickerCount,
+			ForwardCount: cur.ForwardCount - prev.ForwardCount,
+		}
+		if arg == (addChatUserStatTotalParams{ChatID: chatId, UserID: userId}) {
+			continue
+		}
+		if err := q.addChatUserStatTotal(ctx, arg); err != nil {
+			return err
+		}
+		s.totalSaved[userId] = &cur
+	}
+	return nil
 }
 
 type ChatStatKey struct {
@@ -220,19 +392,59 @@ type ChatStatKey struct {
 
 var chatStatCache *lrusf.Cache[ChatStatKey, *ChatStat]
 
-// FlushChatStats saves all in-memory chat statistics to the database.
-// It is safe to call concurrently with other stat operations.
-func (q *Queries) FlushChatStats(ctx context.Context) error {
-	var firstErr error
-	for _, stat := range chatStatCache.Range() {
+// evictingStats 已经被驱逐但还没有保存完的统计。期间再次读取同一天的统计时直接复用，
+// 否则会从数据库读到旧数据，之后保存时覆盖掉驱逐时保存的数据
+var evictingStats sync.Map
+
+// markEvictingChatStat 作为 chatStatCache 的 BeforeEvict 回调，在统计从缓存删除之前登记，
+// 这样删除之后并发的 chatStatOfDay 一定能找到它
+func markEvictingChatStat(key ChatStatKey, stat *ChatStat) {
+	if stat != nil {
+		evictingStats.Store(key, stat)
+	}
+}
+
+// saveEvictedChatStat 作为 chatStatCache 的 onEvict 回调
+func saveEvictedChatStat(q *Queries) func(ChatStatKey, *ChatStat) {
+	return func(key ChatStatKey, stat *ChatStat) {
 		if stat == nil {
+			return
+		}
+		defer evictingStats.CompareAndDelete(key, stat)
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
+		defer cancel()
+		if err := stat.Save(ctx, q); err != nil {
+			logger.Warn("save evicted chat stat failed", "chat_id", key.Id, "stat_date", key.Day, "err", err)
+		}
+	}
+}
+
+// FlushChatStats 保存内存中所有有修改的统计，返回保存的数量和遇到的第一个错误。
+// 遍历缓存时只收集统计，保存在缓存的锁外进行
+func (q *Queries) FlushChatStats(ctx context.Context) (int, error) {
+	var stats []*ChatStat
+	for _, stat := range chatStatCache.Range() {
+		if stat != nil {
+			stats = append(stats, stat)
+		}
+	}
+	var (
+		saved    int
+		firstErr error
+	)
+	for _, stat := range stats {
+		if !stat.Dirty() {
 			continue
 		}
-		if err := stat.Save(ctx, q); err != nil && firstErr == nil {
-			firstErr = err
+		if err := stat.Save(ctx, q); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
 		}
+		saved++
 	}
-	return firstErr
+	return saved, firstErr
 }
 
 func (q *Queries) getOrCreateChatStat(ctx context.Context, chatId int64, day int64) (ChatStatDaily, error) {
@@ -244,30 +456,71 @@ func (q *Queries) getOrCreateChatStat(ctx context.Context, chatId int64, day int
 
 }
 
-func (q *Queries) chatStatAtWithTimezone(ctx context.Context, chatId, unixTime, timezone int64) (*ChatStat, error) {
-	day := (unixTime + timezone) / daySeconds
+func (q *Queries) chatStatAtWithTimezone(ctx context.Context, chatId, unixTime int64, loc *time.Location) (*ChatStat, error) {
+	return q.chatStatOfDay(ctx, chatId, StatDayOf(unixTime, loc), loc)
+}
+
+// chatStatOfDay 聊天修改时区后，缓存中的统计也改为按新时区计算时段，已有的数据保持不变
+func (q *Queries) chatStatOfDay(ctx context.Context, chatId, day int64, loc *time.Location) (*ChatStat, error) {
 	key := ChatStatKey{
 		Day: day,
 		Id:  chatId,
 	}
-	return chatStatCache.Get(key, func() (*ChatStat, error) {
+	stat, err := chatStatCache.Get(key, func() (*ChatStat, error) {
+		if evicted, ok := evictingStats.Load(key); ok {
+			return evicted.(*ChatStat), nil
+		}
 		daily, err := q.getOrCreateChatStat(ctx, chatId, day)
 		if err != nil {
 			return nil, err
 		}
 		stat := &ChatStat{
 			mu:            sync.Mutex{},
-			timezone:      timezone,
+			loc:           loc,
+			totalSaved:    daily.UserMsgStat.clone(),
 			ChatStatDaily: daily}
 		return stat, nil
 	})
+	if err != nil {
+		return nil, err
+	}
+	stat.mu.Lock()
+	stat.loc = loc
+	stat.mu.Unlock()
+	return stat, nil
+}
+
+// NewChatStat 创建一个不在缓存中的空统计，用于根据消息存档重新计算
+func NewChatStat(chatId, day int64, loc *time.Location) *ChatStat {
+	return &ChatStat{
+		loc: loc,
+		ChatStatDaily: ChatStatDaily{
+			ChatID:      chatId,
+			StatDate:    day,
+			UserMsgStat: make(UserMsgStatMap),
+		},
+	}
+}
+
+// ReplaceChatStat 用 daily 覆盖 daily.StatDate 那一天的统计。
+// 替换的是缓存中的对象，之后缓存保存时不会再用旧数据覆盖数据库
+func (q *Queries) ReplaceChatStat(ctx context.Context, daily ChatStatDaily, loc *time.Location) error {
+	stat, err := q.chatStatOfDay(ctx, daily.ChatID, daily.StatDate, loc)
+	if err != nil {
+		return err
+	}
+	stat.mu.Lock()
+	stat.ChatStatDaily = daily
+	stat.UserMsgStat = daily.UserMsgStat.clone()
+	stat.version++
+	stat.mu.Unlock()
+	return stat.Save(ctx, q)
 }
 
 func (q *Queries) ChatStatAt(chatId, unixTime int64) *ChatStat {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 	defer cancel()
-	timezone := q.GetChatCfgByIdOrDefault(chatId).Timezone
-	stat, _ := q.chatStatAtWithTimezone(ctx, chatId, unixTime, timezone)
+	stat, _ := q.chatStatAtWithTimezone(ctx, chatId, unixTime, q.GetChatCfgByIdOrDefault(chatId).Location())
 	return stat
 }
 
@@ -276,14 +529,32 @@ func (q *Queries) ChatStatNow(chatId int64) (stat *ChatStat) {
 }
 
 // ChatStatOfDay returns the stat of the day which contains the unixTime in the chat's timezone.
-func (q *Queries) ChatStatOfDay(ctx context.Context, chatId, unixTime int64) (ChatStatDaily, int64, error) {
+func (q *Queries) ChatStatOfDay(ctx context.Context, chatId, unixTime int64) (ChatStatDaily, *time.Location, error) {
 	cfg, err := q.GetChatCfgById(ctx, chatId)
 	if err != nil {
-		return ChatStatDaily{}, 0, err
+		return ChatStatDaily{}, nil, err
 	}
-	daily, err := q.chatStatAtWithTimezone(ctx, chatId, unixTime, cfg.Timezone)
+	loc := cfg.Location()
+	daily, err := q.chatStatAtWithTimezone(ctx, chatId, unixTime, loc)
 	if err != nil {
-		return ChatStatDaily{}, 0, err
+		return ChatStatDaily{}, nil, err
+	}
+	return daily.Snapshot(), loc, err
+}
+
+// ListChatStatRange 返回 [fromDay, toDay] 内每天的统计，没有记录的日期不会出现在结果中。
+// 读取前会先保存内存中该聊天的统计，保证当天的数据是最新的
+func (q *Queries) ListChatStatRange(ctx context.Context, chatId, fromDay, toDay int64) ([]ChatStatDaily, error) {
+	var stats []*ChatStat
+	for key, stat := range chatStatCache.Range() {
+		if stat != nil && key.Id == chatId && key.Day >= fromDay && key.Day <= toDay {
+			stats = append(stats, stat)
+		}
+	}
+	for _, stat := range stats {
+		if err := stat.Save(ctx, q); err != nil {
+			return nil, err
+		}
 	}
-	return daily.ChatStatDaily, cfg.Timezone, err
+	return q.listChatStatRange(ctx, chatId, fromDay, toDay)
 }
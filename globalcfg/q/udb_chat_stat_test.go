@@ -0,0 +1,85 @@
+package q
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeChatStats(t *testing.T) {
+	as := assert.New(t)
+	day1 := ChatStatDaily{ChatID: -100, StatDate: 10, MessageCount: 3, PhotoCount: 1, MaxMarsCount: 5,
+		UserMsgStat: UserMsgStatMap{1: {MsgCount: 2, MsgLen: 10}, 2: {MsgCount: 1, MsgLen: 4, PhotoCount: 1}}}
+	day1.MsgCountByTime[3] = 3
+	day1.MsgIDAtTimeStart[3] = 100
+	day2 := ChatStatDaily{ChatID: -100, StatDate: 11, MessageCount: 4, PhotoCount: 2, MaxMarsCount: 2,
+		UserMsgStat: UserMsgStatMap{2: {MsgCount: 4, MsgLen: 8, PhotoCount: 1}}}
+	day2.MsgCountByTime[3] = 1
+	day2.MsgCountByTime[7] = 3
+	day2.MsgIDAtTimeStart[3] = 200
+	day2.MsgIDAtTimeStart[7] = 210
+
+	merged := MergeChatStats([]ChatStatDaily{day1, day2})
+	as.Equal(int64(-100), merged.ChatID)
+	as.Equal(int64(10), merged.StatDate)
+	as.Equal(int64(7), merged.MessageCount)
+	as.Equal(int64(3), merged.PhotoCount)
+	as.Equal(int64(5), merged.MaxMarsCount)
+	as.Equal(UserMsgStat{MsgCount: 2, MsgLen: 10}, *merged.UserMsgStat[1])
+	as.Equal(UserMsgStat{MsgCount: 5, MsgLen: 12, PhotoCount: 2}, *merged.UserMsgStat[2])
+	as.Equal(int64(4), merged.MsgCountByTime[3])
+	as.Equal(int64(3), merged.MsgCountByTime[7])
+	as.Equal(int64(100), merged.MsgIDAtTimeStart[3])
+	as.Equal(int64(210), merged.MsgIDAtTimeStart[7])
+	// 合并不能修改原来的数据
+	as.Equal(int64(4), day2.UserMsgStat[2].MsgCount)
+	as.Equal(int64(1), day1.UserMsgStat[2].MsgCount)
+
+	empty := MergeChatStats(nil)
+	as.Equal(int64(0), empty.MessageCount)
+	as.NotNil(empty.UserMsgStat)
+}
+
+func TestIncMessageMedia(t *testing.T) {
+	as := assert.New(t)
+	s := &ChatStat{loc: LoadTimezone("", 8*3600)}
+	// 1970-01-02 01:30 UTC 是东八区的 09:30
+	const unix = daySeconds + 90*60
+	s.IncMessage(1, 5, unix, 10, MediaPhoto|MediaForward)
+	s.IncMessage(1, 0, unix, 11, MediaSticker)
+	s.IncMessage(2, 3, unix, 12, 0)
+	as.Equal(int64(3), s.MessageCount)
+	as.Equal(int64(1), s.PhotoCount)
+	as.Equal(int64(1), s.StickerCount)
+	as.Equal(int64(1), s.ForwardCount)
+	u := s.UserMsgStat[1]
+	as.Equal(int64(2), u.MsgCount)
+	as.Equal(int64(1), u.PhotoCount)
+	as.Equal(int64(1), u.StickerCount)
+	as.Equal(int64(1), u.ForwardCount)
+	as.Equal(int64(2), u.MsgCountByHour[9])
+	as.Equal(int64(10), s.MsgIDAtTimeStart[9*6+3])
+}
+
+func TestUserMsgStatMapCompat(t *testing.T) {
+	as := assert.New(t)
+	// 添加媒体计数之前编码的数据
+	type oldUserMsgStat struct {
+		MsgCount int64
+		MsgLen   int64
+	}
+	buf := new(bytes.Buffer)
+	as.NoError(gob.NewEncoder(buf).Encode(map[int64]*oldUserMsgStat{7: {MsgCount: 3, MsgLen: 20}}))
+	var m UserMsgStatMap
+	as.NoError(m.Scan(buf.Bytes()))
+	as.Equal(UserMsgStat{MsgCount: 3, MsgLen: 20}, *m[7])
+
+	m[7].PhotoCount = 2
+	v, err := m.Value()
+	as.NoError(err)
+	var decoded UserMsgStatMap
+	as.NoError(decoded.Scan(v))
+	as.Equal(*m[7], *decoded[7])
+}
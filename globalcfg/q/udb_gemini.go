@@ -2,27 +2,101 @@ package q
 
 import (
 	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
 	"slices"
+	"time"
 )
 
-func (q *Queries) GetAllMsgInSession(ctx context.Context, sessionID int64, limit int64) ([]GeminiContent, error) {
-	contents, err := q.getAllMsgInSessionReversed(ctx, sessionID, limit)
+const (
+	DefaultGeminiModel      = "gemini-3-flash-preview"
+	DefaultGeminiMaxHistory = 150
+)
+
+// GetAllMsgInSession 按时间顺序返回会话中 msg_id 大于 afterMsgId 的最近 limit 条消息
+func (q *Queries) GetAllMsgInSession(ctx context.Context, sessionID int64, afterMsgId int64, limit int64) ([]GeminiContent, error) {
+	contents, err := q.getAllMsgInSessionReversed(ctx, sessionID, afterMsgId, limit)
 	slices.Reverse(contents)
 	return contents, err
 }
 func (g *GeminiContent) Save(ctx context.Context, q *Queries) error {
 	return q.AddGeminiMessage(ctx, AddGeminiMessageParams{
-		SessionID:    g.SessionID,
-		ChatID:       g.ChatID,
-		MsgID:        g.MsgID,
-		Role:         g.Role,
-		SentTime:     g.SentTime,
-		Username:     g.Username,
-		MsgType:      g.MsgType,
-		ReplyToMsgID: g.ReplyToMsgID,
-		Text:         g.Text,
-		Blob:         g.Blob,
-		MimeType:     g.MimeType,
-		QuotePart:    g.QuotePart,
+		SessionID:        g.SessionID,
+		ChatID:           g.ChatID,
+		MsgID:            g.MsgID,
+		Role:             g.Role,
+		SentTime:         g.SentTime,
+		Username:         g.Username,
+		MsgType:          g.MsgType,
+		ReplyToMsgID:     g.ReplyToMsgID,
+		Text:             g.Text,
+		BlobHash:         g.BlobHash,
+		MimeType:         g.MimeType,
+		QuotePart:        g.QuotePart,
+		ThoughtSignature: g.ThoughtSignature,
+		AtableUsername:   g.AtableUsername,
+		UserID:           g.UserID,
 	})
 }
+
+func DefaultGeminiChatSetting(chatId, threadId int64) GeminiChatSetting {
+	return GeminiChatSetting{
+		ChatID:              chatId,
+		ThreadID:            threadId,
+		Model:               DefaultGeminiModel,
+		Temperature:         1.0,
+		ThinkingBudget:      -1,
+		EnableSearch:        true,
+		EnableCodeExecution: true,
+		MaxHistory:          DefaultGeminiMaxHistory,
+	}
+}
+
+// GetGeminiChatSettingOrDefault 获取聊天/话题的模型配置，数据库中没有记录时返回默认配置。
+func (q *Queries) GetGeminiChatSettingOrDefault(ctx context.Context, chatId, threadId int64) (GeminiChatSetting, error) {
+	setting, err := q.GetGeminiChatSettings(ctx, chatId, threadId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return DefaultGeminiChatSetting(chatId, threadId), nil
+	}
+	return setting, err
+}
+
+func (s *GeminiChatSetting) Save(ctx context.Context, q *Queries) error {
+	return q.CreateOrUpdateGeminiChatSettings(ctx, CreateOrUpdateGeminiChatSettingsParams{
+		ChatID:              s.ChatID,
+		ThreadID:            s.ThreadID,
+		Model:               s.Model,
+		Temperature:         s.Temperature,
+		ThinkingBudget:      s.ThinkingBudget,
+		EnableSearch:        s.EnableSearch,
+		EnableCodeExecution: s.EnableCodeExecution,
+		MaxHistory:          s.MaxHistory,
+	})
+}
+
+// PutGeminiBlob 按内容寻址存储媒体，返回其sha256。
+// 新存入的媒体引用计数为0，直到引用它的消息写入数据库。重复存入时刷新 created_at，避免被 GC 在消息写入前删除。
+func (q *Queries) PutGeminiBlob(ctx context.Context, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	err := q.CreateGeminiBlob(ctx, hash, data, int64(len(data)), UnixTime{time.Now()})
+	return hash, err
+}
+
+// GcGeminiBlobs 删除已不存在的会话中的消息，并删除不再被引用的媒体。
+// 刚存入但尚未被消息引用的媒体在 keep 时间内不会被删除。
+// 开启外键约束时删除会话会级联删除消息，没有开启时由这里清理，两种情况下结果相同。
+func (q *Queries) GcGeminiBlobs(ctx context.Context, keep time.Duration) (contents int64, blobs int64, err error) {
+	contents, err = q.DeleteOrphanGeminiContents(ctx)
+	if err != nil {
+		return
+	}
+	// 触发器可能因为手动修改数据库等原因失准，这里重新统计一次
+	if err = q.RecountGeminiBlobRefs(ctx); err != nil {
+		return
+	}
+	blobs, err = q.DeleteUnusedGeminiBlobs(ctx, UnixTime{time.Now().Add(-keep)})
+	return
+}
@@ -47,7 +47,7 @@ func (q *Queries) CreateNewUserByTg(ctx context.Context, tgUser *gotgbot.User, b
 			LastName:     sql.NullString{String: tgUser.LastName, Valid: tgUser.LastName != ""},
 			Username:     sql.NullString{String: tgUser.Username, Valid: tgUser.Username != ""},
 			ProfilePhoto: sql.NullString{},
-			Timezone:     8 * 60 * 60,
+			Timezone:     DefaultTimezone,
 		})
 		if err != nil {
 			return nil, err
@@ -117,12 +117,16 @@ func (q *Queries) UpdateUserProfilePhoto(ctx context.Context, userID int64, prof
 	return q.updateUserProfilePhoto(ctx, userID, UnixTime{time.Now()}, sql.NullString{String: profilePhoto, Valid: profilePhoto != ""})
 }
 
-func (q *Queries) UpdateUserTimeZone(ctx context.Context, user *User, zone int64) error {
+// UpdateUserTimeZone 设置用户的时区，name 为 IANA 时区名，为空时使用固定偏移 offset 秒
+func (q *Queries) UpdateUserTimeZone(ctx context.Context, user *User, name string, offset int64) error {
 	if user == nil {
 		return errors.New("user is nil")
 	}
-	user.Timezone = zone
-	return q.updateUserTimeZone(ctx, user.ID, zone)
+	if err := q.updateUserTimeZone(ctx, user.UserID, offset, name); err != nil {
+		return err
+	}
+	user.Timezone, user.TimezoneName = offset, name
+	return nil
 }
 
 // DownloadProfilePhoto downloads the user's profile photo using provided bot and returns the local file path.
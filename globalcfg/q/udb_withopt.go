@@ -9,7 +9,12 @@ import (
 	"time"
 )
 
-func PrepareWithLogger(ctx context.Context, db DBTX, _ *slog.Logger) (*Queries, error) {
+var logger = slog.Default()
+
+func PrepareWithLogger(ctx context.Context, db DBTX, l *slog.Logger) (*Queries, error) {
+	if l != nil {
+		logger = l
+	}
 	query, err := Prepare(ctx, db)
 	if err != nil {
 		return nil, err
@@ -32,16 +37,13 @@ func chatStatCacheKey(key ChatStatKey) string {
 
 func initCaches(q *Queries) {
 	cacheOnce.Do(func() {
-		userCache = lrusf.NewCache[int64, *User](2048, id2str, nil)
+		userCache = lrusf.NewCache[int64, *User](2048, id2str, nil).Named("user")
 		chatCache = lrusf.NewCache[int64, *ChatCfg](2048, id2str, func(i int64, cfg *ChatCfg) {
 			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
 			defer cancel()
 			_ = cfg.Save(ctx, q)
-		})
-		chatStatCache = lrusf.NewCache[ChatStatKey, *ChatStat](64, chatStatCacheKey, func(key ChatStatKey, daily *ChatStat) {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second*3)
-			defer cancel()
-			_ = daily.Save(ctx, q)
-		})
+		}).Named("chat_cfg")
+		chatStatCache = lrusf.NewCache[ChatStatKey, *ChatStat](64, chatStatCacheKey, saveEvictedChatStat(q)).
+			BeforeEvict(markEvictingChatStat).Named("chat_stat")
 	})
 }
@@ -0,0 +1,482 @@
+package g
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"main/globalcfg/q"
+	"time"
+)
+
+// schemaMigration 升级已有数据库的结构，新数据库直接使用 sql/schema_*.sql 创建，因此每一步都要先检查是否需要升级，
+// 已经是新结构时什么也不做。apply 返回是否修改了数据库
+type schemaMigration struct {
+	name  string
+	apply func(ctx context.Context, tx *sql.Tx) (bool, error)
+}
+
+var schemaMigrations = []schemaMigration{
+	{"gemini_blobs", migrateGeminiBlobs},
+	{"chat_cfg_columns", addMissingColumns(chatCfgColumns)},
+	{"new_tables", createMissingTables(newTables)},
+	{"timezone_name", migrateTimezoneName},
+	{"chat_user_stat_total", migrateChatUserStatTotal},
+}
+
+// MigrateMainDbSchema 在准备查询语句之前升级主数据库的结构，每一步在单独的事务中执行
+func MigrateMainDbSchema(ctx context.Context, database *sql.DB) error {
+	conn, err := database.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// 重建表时需要关闭外键约束，否则删除旧表会级联删除数据。这个设置在事务中无效，只能在事务外修改
+	var foreignKeys bool
+	if err = conn.QueryRowContext(ctx, "PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+		return err
+	}
+	if foreignKeys {
+		if _, err = conn.ExecContext(ctx, "PRAGMA foreign_keys = OFF"); err != nil {
+			return err
+		}
+		defer func() {
+			_, _ = conn.ExecContext(context.Background(), "PRAGMA foreign_keys = ON")
+		}()
+	}
+	for _, m := range schemaMigrations {
+		if err = applySchemaMigration(ctx, conn, m); err != nil {
+			return fmt.Errorf("migrate %s: %w", m.name, err)
+		}
+	}
+	return nil
+}
+
+func applySchemaMigration(ctx context.Context, conn *sql.Conn, m schemaMigration) (err error) {
+	start := time.Now()
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	changed, err := m.apply(ctx, tx)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		return tx.Rollback()
+	}
+	var violations int
+	if err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_foreign_key_check").Scan(&violations); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+	slog.Info("migrated database schema", "name", m.name, "elapsed", time.Since(start), "foreign_key_violations", violations)
+	return nil
+}
+
+func hasColumn(ctx context.Context, tx *sql.Tx, table, column string) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", table, column).Scan(&n)
+	return n > 0, err
+}
+
+func hasTable(ctx context.Context, tx *sql.Tx, table string) (bool, error) {
+	var n int
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM sqlite_schema WHERE type = 'table' AND name = ?", table).Scan(&n)
+	return n > 0, err
+}
+
+// columnDef 新增的列，新增的列必须有默认值
+type columnDef struct {
+	table, name, def string
+}
+
+var chatCfgColumns = []columnDef{
+	{"chat_cfg", "daily_digest", "INT_BOOL NOT NULL DEFAULT FALSE CHECK ( daily_digest in (0, 1))"},
+	{"chat_cfg", "digest_only", "INT_BOOL NOT NULL DEFAULT FALSE CHECK ( digest_only in (0, 1))"},
+	{"chat_cfg", "auto_translate", "INT_BOOL NOT NULL DEFAULT FALSE CHECK ( auto_translate in (0, 1))"},
+	{"chat_cfg", "translate_lang", "TEXT NOT NULL DEFAULT 'zh'"},
+	{"chat_cfg", "daily_stat", "INT_BOOL NOT NULL DEFAULT FALSE CHECK ( daily_stat in (0, 1))"},
+	{"chat_cfg", "stat_time", "INTEGER NOT NULL DEFAULT 480 CHECK ( stat_time >= 0 AND stat_time < 1440)"},
+	{"chat_cfg", "stat_template", "TEXT NOT NULL DEFAULT ''"},
+}
+
+func addMissingColumns(columns []columnDef) func(ctx context.Context, tx *sql.Tx) (bool, error) {
+	return func(ctx context.Context, tx *sql.Tx) (bool, error) {
+		changed := false
+		for _, c := range columns {
+			exists, err := hasColumn(ctx, tx, c.table, c.name)
+			if err != nil {
+				return false, err
+			}
+			if exists {
+				continue
+			}
+			if _, err = tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.table, c.name, c.def)); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+		return changed, nil
+	}
+}
+
+// tableDef 新增的表，ddl 中可以包含建表后需要执行的建索引等语句
+type tableDef struct {
+	name, ddl string
+}
+
+var newTables = []tableDef{
+	{"gemini_chat_settings", `CREATE TABLE gemini_chat_settings
+(
+    chat_id               INTEGER  NOT NULL,
+    thread_id             INTEGER  NOT NULL,
+    model                 TEXT     NOT NULL,
+    temperature           REAL     NOT NULL DEFAULT 1.0,
+    thinking_budget       INTEGER  NOT NULL DEFAULT -1,
+    enable_search         INT_BOOL NOT NULL DEFAULT TRUE,
+    enable_code_execution INT_BOOL NOT NULL DEFAULT TRUE,
+    max_history           INTEGER  NOT NULL DEFAULT 150,
+    PRIMARY KEY (chat_id, thread_id)
+) WITHOUT ROWID;`},
+	{"gemini_usage", `CREATE TABLE gemini_usage
+(
+    chat_id       INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    model         TEXT    NOT NULL,
+    usage_date    INTEGER NOT NULL,
+    input_tokens  INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (chat_id, user_id, model, usage_date)
+) WITHOUT ROWID;
+CREATE INDEX IF NOT EXISTS idx_gemini_usage_user ON gemini_usage (user_id, usage_date);`},
+	{"gemini_scheduled_prompts", `CREATE TABLE gemini_scheduled_prompts
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id     INTEGER      NOT NULL,
+    thread_id   INTEGER      NOT NULL DEFAULT 0,
+    cron        TEXT         NOT NULL,
+    prompt      TEXT         NOT NULL,
+    session_id  INTEGER      NOT NULL DEFAULT 0,
+    created_by  INTEGER      NOT NULL,
+    created_at  INT_UNIX_SEC NOT NULL,
+    last_run_at INT_UNIX_SEC NOT NULL DEFAULT 0
+);
+CREATE INDEX IF NOT EXISTS idx_gemini_scheduled_prompts_chat ON gemini_scheduled_prompts (chat_id);`},
+	{"gemini_system_prompt_history", `CREATE TABLE gemini_system_prompt_history
+(
+    chat_id    INTEGER      NOT NULL,
+    thread_id  INTEGER      NOT NULL,
+    version    INTEGER      NOT NULL,
+    prompt     TEXT         NOT NULL,
+    author_id  INTEGER      NOT NULL,
+    created_at INT_UNIX_SEC NOT NULL,
+    PRIMARY KEY (chat_id, thread_id, version)
+) WITHOUT ROWID;`},
+	{"gemini_prompt_presets", `CREATE TABLE gemini_prompt_presets
+(
+    name       TEXT PRIMARY KEY,
+    prompt     TEXT         NOT NULL,
+    author_id  INTEGER      NOT NULL,
+    updated_at INT_UNIX_SEC NOT NULL
+) WITHOUT ROWID;`},
+	{"gemini_private_users", `CREATE TABLE gemini_private_users
+(
+    user_id     INTEGER PRIMARY KEY,
+    invite_code TEXT         NOT NULL DEFAULT '',
+    added_by    INTEGER      NOT NULL,
+    created_at  INT_UNIX_SEC NOT NULL
+) WITHOUT ROWID;`},
+	{"gemini_invite_codes", `CREATE TABLE gemini_invite_codes
+(
+    code       TEXT PRIMARY KEY,
+    created_by INTEGER      NOT NULL,
+    max_uses   INTEGER      NOT NULL,
+    used_count INTEGER      NOT NULL DEFAULT 0,
+    created_at INT_UNIX_SEC NOT NULL,
+    expires_at INT_UNIX_SEC NOT NULL
+) WITHOUT ROWID;`},
+	{"chat_keyword_daily", `CREATE TABLE chat_keyword_daily
+(
+    chat_id   INTEGER NOT NULL,
+    stat_date INTEGER NOT NULL,
+    word      TEXT    NOT NULL,
+    count     INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, stat_date, word)
+) WITHOUT ROWID;`},
+	{"chat_keyword_scan", `CREATE TABLE chat_keyword_scan
+(
+    chat_id       INTEGER NOT NULL,
+    stat_date     INTEGER NOT NULL,
+    scanned_until INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, stat_date)
+) WITHOUT ROWID;`},
+	{"chat_stat_sent", `CREATE TABLE chat_stat_sent
+(
+    chat_id   INTEGER PRIMARY KEY,
+    stat_date INTEGER NOT NULL
+) WITHOUT ROWID;`},
+}
+
+func createMissingTables(tables []tableDef) func(ctx context.Context, tx *sql.Tx) (bool, error) {
+	return func(ctx context.Context, tx *sql.Tx) (bool, error) {
+		changed := false
+		for _, t := range tables {
+			exists, err := hasTable(ctx, tx, t.name)
+			if err != nil {
+				return false, err
+			}
+			if exists {
+				continue
+			}
+			if _, err = tx.ExecContext(ctx, t.ddl); err != nil {
+				return false, err
+			}
+			changed = true
+		}
+		return changed, nil
+	}
+}
+
+const geminiBlobsSchema = `
+CREATE TABLE IF NOT EXISTS gemini_blobs
+(
+    hash       TEXT PRIMARY KEY,
+    data       BLOB         NOT NULL,
+    size       INTEGER      NOT NULL,
+    ref_count  INTEGER      NOT NULL DEFAULT 0,
+    created_at INT_UNIX_SEC NOT NULL
+);
+
+CREATE TEMP TABLE gemini_blob_hashes
+(
+    session_id INTEGER NOT NULL,
+    msg_id     INTEGER NOT NULL,
+    hash       TEXT    NOT NULL,
+    PRIMARY KEY (session_id, msg_id)
+) WITHOUT ROWID;
+
+CREATE TABLE gemini_contents_new
+(
+    session_id        INTEGER      NOT NULL,
+    chat_id           INTEGER      NOT NULL,
+    msg_id            INTEGER      NOT NULL,
+    role              TEXT         NOT NULL,
+    sent_time         INT_UNIX_SEC NOT NULL,
+    username          TEXT         NOT NULL,
+    msg_type          TEXT         NOT NULL,
+    reply_to_msg_id   INTEGER,
+    text              TEXT,
+    blob_hash         TEXT,
+    mime_type         TEXT,
+    quote_part        TEXT,
+    thought_signature TEXT,
+    atable_username   TEXT,
+    user_id           INTEGER      NOT NULL,
+    PRIMARY KEY (session_id, msg_id),
+    FOREIGN KEY (session_id)
+        REFERENCES gemini_sessions (id)
+        ON DELETE CASCADE,
+    UNIQUE (chat_id, msg_id),
+    FOREIGN KEY (blob_hash)
+        REFERENCES gemini_blobs (hash),
+    CHECK ( text IS NOT NULL OR blob_hash IS NOT NULL ),
+    CHECK (
+        (blob_hash IS NULL AND mime_type IS NULL)
+            OR
+        (blob_hash IS NOT NULL AND mime_type IS NOT NULL)
+        )
+) WITHOUT ROWID;`
+
+const geminiBlobsIndexes = `
+CREATE INDEX IF NOT EXISTS idx_gemini_contents_blob_hash ON gemini_contents (blob_hash) WHERE blob_hash IS NOT NULL;
+
+CREATE TRIGGER IF NOT EXISTS gemini_contents_blob_ref_inc
+    AFTER INSERT
+    ON gemini_contents
+    WHEN NEW.blob_hash IS NOT NULL
+BEGIN
+    UPDATE gemini_blobs SET ref_count = ref_count + 1 WHERE hash = NEW.blob_hash;
+END;
+
+CREATE TRIGGER IF NOT EXISTS gemini_contents_blob_ref_dec
+    AFTER DELETE
+    ON gemini_contents
+    WHEN OLD.blob_hash IS NOT NULL
+BEGIN
+    UPDATE gemini_blobs SET ref_count = ref_count - 1 WHERE hash = OLD.blob_hash;
+END;
+
+UPDATE gemini_blobs
+SET ref_count = (SELECT COUNT(*) FROM gemini_contents WHERE gemini_contents.blob_hash = gemini_blobs.hash);`
+
+// migrateGeminiBlobs 把 gemini_contents 中内联的 blob 移到 gemini_blobs，按 SQLite 文档的方式重建表以更新约束
+func migrateGeminiBlobs(ctx context.Context, tx *sql.Tx) (bool, error) {
+	legacy, err := hasColumn(ctx, tx, "gemini_contents", "blob")
+	if err != nil || !legacy {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, geminiBlobsSchema); err != nil {
+		return false, err
+	}
+	// 媒体可能很多，按主键分批读取
+	now := time.Now().Unix()
+	var lastSession, lastMsg int64 = -1 << 63, -1 << 63
+	for {
+		rows, err := tx.QueryContext(ctx, `SELECT session_id, msg_id, blob FROM gemini_contents
+WHERE blob IS NOT NULL AND (session_id, msg_id) > (?, ?)
+ORDER BY session_id, msg_id
+LIMIT 100`, lastSession, lastMsg)
+		if err != nil {
+			return false, err
+		}
+		type inlineBlob struct {
+			sessionId, msgId int64
+			data             []byte
+		}
+		var batch []inlineBlob
+		for rows.Next() {
+			var b inlineBlob
+			if err = rows.Scan(&b.sessionId, &b.msgId, &b.data); err != nil {
+				_ = rows.Close()
+				return false, err
+			}
+			batch = append(batch, b)
+		}
+		if err = rows.Close(); err != nil {
+			return false, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, b := range batch {
+			sum := sha256.Sum256(b.data)
+			hash := hex.EncodeToString(sum[:])
+			_, err = tx.ExecContext(ctx, `INSERT INTO gemini_blobs (hash, data, size, created_at) VALUES (?, ?, ?, ?)
+ON CONFLICT DO NOTHING`, hash, b.data, len(b.data), now)
+			if err != nil {
+				return false, err
+			}
+			_, err = tx.ExecContext(ctx, "INSERT INTO gemini_blob_hashes (session_id, msg_id, hash) VALUES (?, ?, ?)",
+				b.sessionId, b.msgId, hash)
+			if err != nil {
+				return false, err
+			}
+		}
+		last := batch[len(batch)-1]
+		lastSession, lastMsg = last.sessionId, last.msgId
+	}
+	for _, stmt := range []string{
+		`INSERT INTO gemini_contents_new
+SELECT c.session_id, c.chat_id, c.msg_id, c.role, c.sent_time, c.username, c.msg_type, c.reply_to_msg_id, c.text,
+       h.hash, c.mime_type, c.quote_part, c.thought_signature, c.atable_username, c.user_id
+FROM gemini_contents c
+         LEFT JOIN gemini_blob_hashes h ON h.session_id = c.session_id AND h.msg_id = c.msg_id`,
+		"DROP TABLE gemini_blob_hashes",
+		"DROP TABLE gemini_contents",
+		"ALTER TABLE gemini_contents_new RENAME TO gemini_contents",
+		geminiBlobsIndexes,
+	} {
+		if _, err = tx.ExecContext(ctx, stmt); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// migrateTimezoneName 添加 IANA 时区名。旧的 users.timezone 默认值 480 是按分钟写的东八区，而代码一直按秒读写，
+// 这些用户从未设置过时区，改为 28800 秒；已有的偏移没有对应的时区名，timezone_name 保持为空，即继续使用固定偏移
+func migrateTimezoneName(ctx context.Context, tx *sql.Tx) (bool, error) {
+	changed, err := addMissingColumns([]columnDef{
+		{"chat_cfg", "timezone_name", "TEXT NOT NULL DEFAULT ''"},
+		{"users", "timezone_name", "TEXT NOT NULL DEFAULT ''"},
+	})(ctx, tx)
+	if err != nil || !changed {
+		return changed, err
+	}
+	_, err = tx.ExecContext(ctx, "UPDATE users SET timezone = 28800 WHERE timezone = 480 AND timezone_name = ''")
+	return true, err
+}
+
+const chatUserStatTotalSchema = `CREATE TABLE chat_user_stat_total
+(
+    chat_id       INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    msg_count     INTEGER NOT NULL DEFAULT 0,
+    msg_len       INTEGER NOT NULL DEFAULT 0,
+    photo_count   INTEGER NOT NULL DEFAULT 0,
+    video_count   INTEGER NOT NULL DEFAULT 0,
+    sticker_count INTEGER NOT NULL DEFAULT 0,
+    forward_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (chat_id, user_id)
+) WITHOUT ROWID;`
+
+// migrateChatUserStatTotal 创建每个用户的累计统计，并用已有的每日统计填充。之后由 ChatStat.Save 累加，
+// 每日统计是编码后的 blob，只能在这里逐个聊天解码后合并
+func migrateChatUserStatTotal(ctx context.Context, tx *sql.Tx) (bool, error) {
+	exists, err := hasTable(ctx, tx, "chat_user_stat_total")
+	if err != nil || exists {
+		return false, err
+	}
+	if _, err = tx.ExecContext(ctx, chatUserStatTotalSchema); err != nil {
+		return false, err
+	}
+	rows, err := tx.QueryContext(ctx, "SELECT DISTINCT chat_id FROM chat_stat_daily")
+	if err != nil {
+		return false, err
+	}
+	var chats []int64
+	for rows.Next() {
+		var chatId int64
+		if err = rows.Scan(&chatId); err != nil {
+			_ = rows.Close()
+			return false, err
+		}
+		chats = append(chats, chatId)
+	}
+	if err = rows.Close(); err != nil {
+		return false, err
+	}
+	for _, chatId := range chats {
+		total, err := sumChatUserStats(ctx, tx, chatId)
+		if err != nil {
+			return false, err
+		}
+		for userId, s := range total {
+			_, err = tx.ExecContext(ctx, `INSERT INTO chat_user_stat_total
+(chat_id, user_id, msg_count, msg_len, photo_count, video_count, sticker_count, forward_count)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+				chatId, userId, s.MsgCount, s.MsgLen, s.PhotoCount, s.VideoCount, s.StickerCount, s.ForwardCount)
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	return true, nil
+}
+
+func sumChatUserStats(ctx context.Context, tx *sql.Tx, chatId int64) (q.UserMsgStatMap, error) {
+	rows, err := tx.QueryContext(ctx, "SELECT user_msg_stat FROM chat_stat_daily WHERE chat_id = ?", chatId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	total := make(q.UserMsgStatMap)
+	for rows.Next() {
+		var day q.UserMsgStatMap
+		if err = rows.Scan(&day); err != nil {
+			return nil, fmt.Errorf("chat %d: %w", chatId, err)
+		}
+		total.Merge(day)
+	}
+	return total, rows.Err()
+}
@@ -0,0 +1,192 @@
+package g
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"main/globalcfg/q"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func openLegacyDb(t *testing.T) *sql.DB {
+	d, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接都是独立的
+	d.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = d.Close() })
+	legacy, err := os.ReadFile("testdata/legacy_schema.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Exec(string(legacy)); err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestMigrateGeminiBlobs(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	d := openLegacyDb(t)
+	_, err := d.Exec(`PRAGMA foreign_keys = ON;
+INSERT INTO gemini_sessions (id, chat_id, chat_name, chat_type) VALUES (1, -100, 'test', 'supergroup');
+INSERT INTO gemini_contents (session_id, chat_id, msg_id, role, sent_time, username, msg_type, text, blob, mime_type, user_id)
+VALUES (1, -100, 1, 'user', 0, 'a', 'text', 'hello', NULL, NULL, 1),
+       (1, -100, 2, 'user', 0, 'a', 'sticker', NULL, x'0102', 'image/webp', 1),
+       (1, -100, 3, 'user', 0, 'a', 'sticker', 'again', x'0102', 'image/webp', 1),
+       (1, -100, 4, 'user', 0, 'a', 'photo', NULL, x'03', 'image/jpeg', 1);`)
+	as.NoError(err)
+
+	as.NoError(MigrateMainDbSchema(ctx, d))
+	var fk bool
+	as.NoError(d.QueryRow("PRAGMA foreign_keys").Scan(&fk))
+	as.True(fk, "foreign_keys should be restored")
+
+	rows, err := d.Query(`SELECT c.msg_id, c.text, b.data, b.ref_count FROM gemini_contents c
+LEFT JOIN gemini_blobs b ON b.hash = c.blob_hash ORDER BY c.msg_id`)
+	as.NoError(err)
+	type row struct {
+		msgId    int64
+		text     sql.NullString
+		data     []byte
+		refCount sql.NullInt64
+	}
+	var got []row
+	for rows.Next() {
+		var r row
+		as.NoError(rows.Scan(&r.msgId, &r.text, &r.data, &r.refCount))
+		got = append(got, r)
+	}
+	as.NoError(rows.Close())
+	as.Len(got, 4)
+	as.Nil(got[0].data)
+	as.Equal("hello", got[0].text.String)
+	as.Equal([]byte{1, 2}, got[1].data)
+	as.Equal([]byte{1, 2}, got[2].data)
+	as.Equal(int64(2), got[1].refCount.Int64)
+	as.Equal([]byte{3}, got[3].data)
+	as.Equal(int64(1), got[3].refCount.Int64)
+
+	var blobs int
+	as.NoError(d.QueryRow("SELECT COUNT(*) FROM gemini_blobs").Scan(&blobs))
+	as.Equal(2, blobs)
+	// 触发器在新表上继续维护引用计数
+	_, err = d.Exec("DELETE FROM gemini_contents WHERE msg_id = 4")
+	as.NoError(err)
+	var refCount int
+	as.NoError(d.QueryRow("SELECT ref_count FROM gemini_blobs WHERE size = 1").Scan(&refCount))
+	as.Zero(refCount)
+
+	// 重复执行时什么也不做
+	as.NoError(MigrateMainDbSchema(ctx, d))
+	as.NoError(d.QueryRow("SELECT COUNT(*) FROM gemini_contents").Scan(&blobs))
+	as.Equal(3, blobs)
+}
+
+func TestMigrateNewColumnsAndTables(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	d := openLegacyDb(t)
+	_, err := d.Exec(`INSERT INTO chat_cfg (id, auto_cvt_bili, auto_ocr, auto_calculate, auto_exchange, auto_check_adult,
+                      save_messages, enable_coc, resp_nsfw_msg, timezone)
+VALUES (-100, 1, 0, 0, 0, 0, 1, 0, 0, 28800)`)
+	as.NoError(err)
+
+	as.NoError(MigrateMainDbSchema(ctx, d))
+	var statTime int64
+	var lang, tmpl string
+	as.NoError(d.QueryRow("SELECT stat_time, translate_lang, stat_template FROM chat_cfg WHERE id = -100").Scan(&statTime, &lang, &tmpl))
+	as.Equal(int64(480), statTime)
+	as.Equal("zh", lang)
+	as.Empty(tmpl)
+	for _, table := range newTables {
+		var n int
+		as.NoError(d.QueryRow("SELECT COUNT(*) FROM sqlite_schema WHERE type = 'table' AND name = ?", table.name).Scan(&n))
+		as.Equal(1, n, table.name)
+	}
+	as.NoError(MigrateMainDbSchema(ctx, d))
+}
+
+func TestMigrateTimezoneName(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	d := openLegacyDb(t)
+	_, err := d.Exec(`INSERT INTO users (updated_at, user_id, first_name, profile_update_at) VALUES (0, 1, 'default', 0);
+INSERT INTO users (updated_at, user_id, first_name, profile_update_at, timezone) VALUES (0, 2, 'utc-5', 0, -18000);`)
+	as.NoError(err)
+
+	as.NoError(MigrateMainDbSchema(ctx, d))
+	as.NoError(MigrateMainDbSchema(ctx, d))
+	for userId, want := range map[int64]int64{1: 28800, 2: -18000} {
+		var tz int64
+		var name string
+		as.NoError(d.QueryRow("SELECT timezone, timezone_name FROM users WHERE user_id = ?", userId).Scan(&tz, &name))
+		as.Equal(want, tz)
+		as.Empty(name)
+	}
+}
+
+func TestMigrateChatUserStatTotal(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	d := openLegacyDb(t)
+	day1, err := q.UserMsgStatMap{1: {MsgCount: 2, MsgLen: 7, PhotoCount: 1}, 2: {MsgCount: 1}}.Value()
+	as.NoError(err)
+	buf := new(bytes.Buffer)
+	as.NoError(gob.NewEncoder(buf).Encode(q.UserMsgStatMap{1: {MsgCount: 3, MsgLen: 5}}))
+	_, err = d.Exec(`INSERT INTO chat_stat_daily (chat_id, stat_date, user_msg_stat)
+VALUES (-100, 1, ?), (-100, 2, ?), (-200, 1, ?)`, day1, buf.Bytes(), day1)
+	as.NoError(err)
+
+	as.NoError(MigrateMainDbSchema(ctx, d))
+	as.NoError(MigrateMainDbSchema(ctx, d))
+	var msgCount, msgLen, photoCount int64
+	as.NoError(d.QueryRow("SELECT msg_count, msg_len, photo_count FROM chat_user_stat_total WHERE chat_id = -100 AND user_id = 1").
+		Scan(&msgCount, &msgLen, &photoCount))
+	as.Equal([]int64{5, 12, 1}, []int64{msgCount, msgLen, photoCount})
+	var users int
+	as.NoError(d.QueryRow("SELECT COUNT(*) FROM chat_user_stat_total").Scan(&users))
+	as.Equal(4, users)
+}
+
+// schemaSnapshot 返回所有表的列（不含默认值，SQLite 无法修改已有列的默认值）以及索引和触发器的名字
+func schemaSnapshot(t *testing.T, d *sql.DB) map[string][]string {
+	rows, err := d.Query(`SELECT m.type, m.name, COALESCE(c.name || ' ' || c.type || ' ' || c."notnull" || ' ' || c.pk, '')
+FROM sqlite_schema m
+         LEFT JOIN pragma_table_info(m.name) c ON m.type = 'table'
+WHERE m.name NOT LIKE 'sqlite_%'
+ORDER BY m.type, m.name, c.cid`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	res := make(map[string][]string)
+	for rows.Next() {
+		var typ, name, column string
+		if err = rows.Scan(&typ, &name, &column); err != nil {
+			t.Fatal(err)
+		}
+		key := typ + " " + name
+		if column != "" {
+			res[key] = append(res[key], column)
+		} else if _, ok := res[key]; !ok {
+			res[key] = nil
+		}
+	}
+	return res
+}
+
+func TestMigratedSchemaMatchesSchemaFiles(t *testing.T) {
+	d := openLegacyDb(t)
+	if err := MigrateMainDbSchema(context.Background(), d); err != nil {
+		t.Fatal(err)
+	}
+	// 测试使用的数据库由 sql/schema_*.sql 创建
+	assert.Equal(t, schemaSnapshot(t, RawMainDb()), schemaSnapshot(t, d))
+}
@@ -0,0 +1,108 @@
+package g
+
+import (
+	"context"
+	"main/globalcfg/q"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func rawMessageCount(t *testing.T, chatId, day int64) int64 {
+	var cnt int64
+	err := RawMainDb().QueryRow(`SELECT message_count FROM chat_stat_daily WHERE chat_id = ? AND stat_date = ?`, chatId, day).Scan(&cnt)
+	assert.NoError(t, err)
+	return cnt
+}
+
+func TestFlushChatStatsOnlyDirty(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	const chatId = -1009990002
+	now := time.Now().Unix()
+	stat := Q.ChatStatAt(chatId, now)
+	as.False(stat.Dirty())
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			for j := range 50 {
+				stat.IncMessage(int64(i), 3, now, int64(i*100+j+1), 0)
+			}
+		})
+	}
+	for range 5 {
+		_, err := Q.FlushChatStats(ctx)
+		as.NoError(err)
+	}
+	wg.Wait()
+	as.True(stat.Dirty())
+	saved, err := Q.FlushChatStats(ctx)
+	as.NoError(err)
+	as.Equal(1, saved)
+	as.False(stat.Dirty())
+	as.Equal(int64(400), rawMessageCount(t, chatId, stat.StatDate))
+
+	saved, err = Q.FlushChatStats(ctx)
+	as.NoError(err)
+	as.Zero(saved)
+}
+
+func TestEvictedChatStatIsSaved(t *testing.T) {
+	const chatId = -1009990003
+	base := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC).Unix()
+	var firstDay int64
+	// 缓存容量为64，写入更多天的统计时最早的会被驱逐
+	for i := range int64(80) {
+		stat := Q.ChatStatAt(chatId, base+i*86400)
+		if i == 0 {
+			firstDay = stat.StatDate
+		}
+		stat.IncMessage(1, 1, base+i*86400, i+1, 0)
+	}
+	assert.Equal(t, int64(1), rawMessageCount(t, chatId, firstDay))
+}
+
+func TestChatUserStatTotal(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	const chatId = -1009990004
+	now := time.Now().Unix()
+	today := Q.ChatStatAt(chatId, now)
+	yesterday := Q.ChatStatAt(chatId, now-86400)
+	today.IncMessage(1, 3, now, 1, q.MediaPhoto)
+	today.IncMessage(2, 1, now, 2, 0)
+	yesterday.IncMessage(1, 2, now-86400, 3, 0)
+	_, err := Q.FlushChatStats(ctx)
+	as.NoError(err)
+	total, err := Q.GetChatUserStatTotal(ctx, chatId, 1)
+	as.NoError(err)
+	as.Equal(int64(2), total.MsgCount)
+	as.Equal(int64(5), total.MsgLen)
+	as.Equal(int64(1), total.PhotoCount)
+
+	// 再次保存只累加新增的部分
+	today.IncMessage(2, 1, now, 4, 0)
+	today.IncMessage(2, 1, now, 5, 0)
+	_, err = Q.FlushChatStats(ctx)
+	as.NoError(err)
+	total, err = Q.GetChatUserStatTotal(ctx, chatId, 2)
+	as.NoError(err)
+	as.Equal(int64(3), total.MsgCount)
+	total, err = Q.GetChatUserStatTotal(ctx, chatId, 1)
+	as.NoError(err)
+	as.Equal(int64(2), total.MsgCount)
+	rank, err := Q.GetChatUserStatRank(ctx, chatId, total.MsgCount)
+	as.NoError(err)
+	as.Equal(int64(2), rank)
+
+	// 重新计算后替换的统计按差值累加
+	daily := yesterday.Snapshot()
+	daily.UserMsgStat[1].MsgCount = 4
+	as.NoError(Q.ReplaceChatStat(ctx, daily, time.UTC))
+	total, err = Q.GetChatUserStatTotal(ctx, chatId, 1)
+	as.NoError(err)
+	as.Equal(int64(5), total.MsgCount)
+}
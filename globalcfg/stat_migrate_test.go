@@ -0,0 +1,51 @@
+package g
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"main/globalcfg/q"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMigrateLegacyChatStats(t *testing.T) {
+	as := assert.New(t)
+	ctx := context.Background()
+	encode := func(v any) []byte {
+		buf := new(bytes.Buffer)
+		as.NoError(gob.NewEncoder(buf).Encode(v))
+		return buf.Bytes()
+	}
+	users := q.UserMsgStatMap{5: {MsgCount: 2, MsgLen: 11}}
+	var counts, ids q.TenMinuteStats
+	counts[3], ids[3] = 2, 77
+	const chatId = -1009990001
+	for day := int64(100); day < 105; day++ {
+		_, err := RawMainDb().Exec(`INSERT INTO chat_stat_daily (chat_id, stat_date, message_count, user_msg_stat, msg_count_by_time, msg_id_at_time_start)
+VALUES (?, ?, 2, ?, ?, ?)`, chatId, day, encode(users), encode(counts), encode(ids))
+		as.NoError(err)
+	}
+
+	migrated, err := Q.MigrateLegacyChatStats(ctx, 2, time.Millisecond)
+	as.NoError(err)
+	as.Equal(int64(5), migrated)
+
+	var raw []byte
+	as.NoError(RawMainDb().QueryRow(`SELECT user_msg_stat FROM chat_stat_daily WHERE chat_id = ? AND stat_date = 100`, chatId).Scan(&raw))
+	as.Equal(byte(0x81), raw[0])
+	days, err := Q.ListChatStatRange(ctx, chatId, 100, 104)
+	as.NoError(err)
+	as.Len(days, 5)
+	for _, d := range days {
+		as.Equal(*users[5], *d.UserMsgStat[5])
+		as.Equal(counts, d.MsgCountByTime)
+		as.Equal(ids, d.MsgIDAtTimeStart)
+	}
+
+	migrated, err = Q.MigrateLegacyChatStats(ctx, 2, time.Millisecond)
+	as.NoError(err)
+	as.Zero(migrated)
+}
@@ -0,0 +1,298 @@
+-- 加入 MigrateMainDbSchema 之前的 sql/schema_*.sql，用于测试旧数据库的升级
+
+-- sql/schema_bilibili.sql
+-- encoding: utf-8
+CREATE TABLE IF NOT EXISTS bili_inline_results
+(
+    uid     INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    text    TEXT    NOT NULL DEFAULT '',
+    chat_id INTEGER NOT NULL DEFAULT 0,
+    msg_id  INTEGER NOT NULL DEFAULT 0
+);
+-- sql/schema_chat.sql
+CREATE TABLE IF NOT EXISTS chat_cfg
+(
+    id               INTEGER PRIMARY KEY NOT NULL,
+    web_id           INTEGER, -- Nullable, group web id 可能没有配置
+    auto_cvt_bili    INT_BOOL            NOT NULL CHECK ( auto_cvt_bili in (0, 1)),
+    auto_ocr         INT_BOOL            NOT NULL CHECK ( auto_ocr in (0, 1)),
+    auto_calculate   INT_BOOL            NOT NULL CHECK ( auto_calculate in (0, 1)),
+    auto_exchange    INT_BOOL            NOT NULL CHECK ( auto_exchange in (0, 1)),
+    auto_check_adult INT_BOOL            NOT NULL CHECK ( auto_check_adult in (0, 1)),
+    save_messages    INT_BOOL            NOT NULL CHECK ( save_messages in (0, 1)),
+    enable_coc       INT_BOOL            NOT NULL CHECK ( enable_coc in (0, 1)),
+    resp_nsfw_msg    INT_BOOL            NOT NULL CHECK ( resp_nsfw_msg in (0, 1)),
+    timezone         INTEGER             NOT NULL CHECK ( timezone < 86400 AND timezone > -86400)
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_cfg
+    ON chat_cfg (web_id);
+
+
+CREATE TABLE chat_stat_daily
+(
+    chat_id              INTEGER              NOT NULL,
+    stat_date            INTEGER              NOT NULL, -- 从Unix纪元开始的日期数量
+
+    message_count        INTEGER              NOT NULL DEFAULT 0,
+    photo_count          INTEGER              NOT NULL DEFAULT 0,
+    video_count          INTEGER              NOT NULL DEFAULT 0,
+    sticker_count        INTEGER              NOT NULL DEFAULT 0,
+    forward_count        INTEGER              NOT NULL DEFAULT 0,
+
+    mars_count           INTEGER              NOT NULL DEFAULT 0,
+    max_mars_count       INTEGER              NOT NULL DEFAULT 0,
+
+    racy_count           INTEGER              NOT NULL DEFAULT 0,
+    adult_count          INTEGER              NOT NULL DEFAULT 0,
+
+    download_video_count INTEGER              NOT NULL DEFAULT 0,
+    download_audio_count INTEGER              NOT NULL DEFAULT 0,
+
+    dio_add_user_count   INTEGER              NOT NULL DEFAULT 0,
+    dio_ban_user_count   INTEGER              NOT NULL DEFAULT 0,
+
+    -- serialized MessagePack
+    user_msg_stat        BLOB_USER_TO_CNT     NOT NULL DEFAULT x'',
+    msg_count_by_time    BLOB_TEN_MINUTE_STAT NOT NULL DEFAULT x'',
+    msg_id_at_time_start BLOB_TEN_MINUTE_STAT NOT NULL DEFAULT x'',
+
+    PRIMARY KEY (chat_id, stat_date)
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS chat_attr
+(
+    id         INTEGER  NOT NULL PRIMARY KEY,
+    type       TEXT     NOT NULL,
+    title      TEXT,
+    username   TEXT,
+    first_name TEXT,
+    last_name  TEXT,
+    is_forum   INT_BOOL NOT NULL
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS chat_topics
+(
+    chat_id   INTEGER NOT NULL,
+    thread_id INTEGER NOT NULL,
+    name      TEXT    NOT NULL,
+    PRIMARY KEY (chat_id, thread_id)
+) WITHOUT ROWID ;
+-- sql/schema_coc.sql
+-- encoding: utf-8
+
+CREATE TABLE IF NOT EXISTS character_attrs
+(
+    user_id    INTEGER NOT NULL,
+    attr_name  TEXT    NOT NULL,
+    attr_value TEXT    NOT NULL,
+    PRIMARY KEY (user_id, attr_name)
+) WITHOUT ROWID , STRICT;
+-- sql/schema_gemini.sql
+-- Sessions（会话表）
+CREATE TABLE gemini_sessions
+(
+    id                  INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id             INTEGER  NOT NULL,
+    chat_name           TEXT     NOT NULL,
+    chat_type           TEXT     NOT NULL,
+    frozen              INT_BOOL NOT NULL DEFAULT FALSE,
+    total_input_tokens  INTEGER  NOT NULL DEFAULT 0,
+    total_output_tokens INTEGER  NOT NULL DEFAULT 0
+);
+
+-- Contents（消息内容表）
+CREATE TABLE gemini_contents
+(
+    session_id        INTEGER      NOT NULL,
+    chat_id           INTEGER      NOT NULL,
+    msg_id            INTEGER      NOT NULL, -- 对应 MsgId
+    role              TEXT         NOT NULL,
+    sent_time         INT_UNIX_SEC NOT NULL, -- yyyy-mm-dd HH:MM:SS
+    username          TEXT         NOT NULL,
+    msg_type          TEXT         NOT NULL, -- 使用英语标识类型，包括 text, photo, sticker，将来可能有更多类型（或许）
+    reply_to_msg_id   INTEGER,               -- 若有，代表该消息为回复消息
+    text              TEXT,                  -- 可以与blob共存，若同时存在，则使用两个part，但两个至少应该有一个
+    blob              BLOB,
+    mime_type         TEXT,                  -- 若blob存在，mime_type必须存在
+    quote_part        TEXT,                  -- 回复消息时，被回复的消息被引用的部分。
+    thought_signature TEXT,                  -- 模型的思考签名
+    atable_username   TEXT,
+    user_id           INTEGER      NOT NULL,
+    -- 一个消息唯一由 SessionId + MsgId 组成
+    PRIMARY KEY (session_id, msg_id),
+
+    -- 外键指向 gemini_sessions
+    FOREIGN KEY (session_id)
+        REFERENCES gemini_sessions (id)
+        ON DELETE CASCADE,
+    UNIQUE (chat_id, msg_id),
+    CHECK ( text IS NOT NULL OR blob IS NOT NULL ),
+    CHECK (
+        (blob IS NULL AND mime_type IS NULL)
+            OR
+        (blob IS NOT NULL AND mime_type IS NOT NULL)
+        )
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS gemini_system_prompt
+(
+    chat_id   INTEGER NOT NULL,
+    thread_id INTEGER NOT NULL,
+    prompt    TEXT    NOT NULL,
+    PRIMARY KEY (chat_id, thread_id)
+) WITHOUT ROWID;
+
+CREATE TABLE gemini_memories
+(
+    id       INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id  INTEGER NOT NULL,
+    topic_id INTEGER NOT NULL,
+    content  TEXT    NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_gemini_memories ON gemini_memories (chat_id, topic_id);
+-- sql/schema_pics.sql
+-- encoding: utf-8
+
+CREATE TABLE saved_pics
+(
+    file_uid        TEXT    NOT NULL,
+    file_id         TEXT    NOT NULL, -- 插入时，若 file_uid 相同，则更新 file_id
+    bot_rate        INTEGER NOT NULL, -- 目前为 [-1,7] 的整数，-1 时相当于删除
+    rand_key        INTEGER NOT NULL,
+    -- user_rate 为生成列：有评分时为平均分；否则回退到 bot_rate
+    user_rate       INTEGER NOT NULL GENERATED ALWAYS AS (
+        CASE
+            WHEN rate_user_count > 0
+                THEN CAST(ROUND(user_rating_sum * 1.0 / rate_user_count) AS INTEGER)
+            ELSE bot_rate
+        END
+    ) STORED,
+    user_rating_sum INTEGER NOT NULL DEFAULT 0,
+    rate_user_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (file_uid),
+    UNIQUE (user_rate, rand_key),
+    UNIQUE (rand_key)                 -- 确保 rand_key 自身唯一
+) WITHOUT ROWID, STRICT;
+
+
+CREATE TABLE IF NOT EXISTS saved_pics_rating
+(
+    file_uid TEXT    NOT NULL,
+    user_id  INTEGER NOT NULL,
+    rating   INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (file_uid, user_id),
+    FOREIGN KEY (file_uid) REFERENCES saved_pics (file_uid)
+) WITHOUT ROWID, STRICT;
+
+
+CREATE TRIGGER IF NOT EXISTS saved_pics_rating_insert_trigger
+    AFTER INSERT
+    ON saved_pics_rating
+BEGIN
+    UPDATE saved_pics
+    SET user_rating_sum = user_rating_sum + new.rating,
+        rate_user_count = rate_user_count + 1
+    WHERE file_uid = new.file_uid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS saved_pics_rating_update_trigger
+    AFTER UPDATE
+    ON saved_pics_rating
+BEGIN
+    UPDATE saved_pics
+    SET user_rating_sum = user_rating_sum - old.rating + new.rating
+    WHERE file_uid = old.file_uid;
+END;
+
+CREATE TRIGGER IF NOT EXISTS saved_pics_rating_delete_trigger
+    AFTER DELETE
+    ON saved_pics_rating
+BEGIN
+    UPDATE saved_pics
+    SET user_rating_sum = user_rating_sum - old.rating,
+        rate_user_count = rate_user_count - 1
+    WHERE file_uid = old.file_uid;
+END;
+
+
+CREATE TABLE IF NOT EXISTS pic_rate_counter
+(
+    rate  INTEGER NOT NULL,
+    count INTEGER NOT NULL,
+    PRIMARY KEY (rate)
+) WITHOUT ROWID, STRICT;
+
+
+CREATE TRIGGER IF NOT EXISTS saved_pics_update_trigger
+    AFTER UPDATE
+    ON saved_pics
+BEGIN
+    UPDATE pic_rate_counter
+    SET count = count + 1
+    WHERE rate = new.user_rate;
+    UPDATE pic_rate_counter
+    SET count = count - 1
+    WHERE rate = old.user_rate;
+END;
+
+
+CREATE TRIGGER IF NOT EXISTS saved_pics_insert_trigger
+    AFTER INSERT
+    ON saved_pics
+BEGIN
+    -- 新图片插入时，增加其 user_rate 对应的计数
+    INSERT INTO pic_rate_counter (rate, count)
+    VALUES (new.user_rate, 1)
+    ON CONFLICT (rate) DO UPDATE SET count = count + 1;
+END;
+
+
+CREATE TRIGGER IF NOT EXISTS saved_pics_delete_trigger
+    AFTER DELETE
+    ON saved_pics
+BEGIN
+    -- 旧图片删除时，减少其 user_rate 对应的计数
+    UPDATE pic_rate_counter
+    SET count = count - 1
+    WHERE rate = old.user_rate;
+END;
+
+-- sql/schema_user.sql
+-- encoding: utf-8
+
+CREATE TABLE IF NOT EXISTS users
+(
+    id                INTEGER PRIMARY KEY AUTOINCREMENT,
+    updated_at        INT_UNIX_SEC NOT NULL,
+    user_id           INTEGER      NOT NULL UNIQUE,
+    first_name        TEXT         NOT NULL,
+    last_name         TEXT,
+    username          TEXT,
+    profile_update_at INT_UNIX_SEC NOT NULL,
+    profile_photo     TEXT,
+    timezone          INTEGER      NOT NULL DEFAULT 480 -- 8:00，+8小时
+);
+
+CREATE TABLE IF NOT EXISTS prpr_caches
+(
+    profile_photo_uid TEXT NOT NULL PRIMARY KEY,
+    prpr_file_id      TEXT NOT NULL
+) WITHOUT ROWID;
+-- sql/schema_ytdl.sql
+-- encoding: utf-8
+
+CREATE TABLE IF NOT EXISTS yt_dl_results
+(
+    url          TEXT     NOT NULL,
+    audio_only   INT_BOOL NOT NULL CHECK (audio_only IN (0, 1)),
+    resolution   INTEGER  NOT NULL,
+    file_id      TEXT     NOT NULL, -- 其实有可能为NULL，但是golang的NULL很不爽，所以改用了空字符串作为NULL
+    title        TEXT     NOT NULL,
+    description  TEXT     NOT NULL,
+    uploader     TEXT     NOT NULL,
+    upload_count INTEGER  NOT NULL DEFAULT 0,
+    PRIMARY KEY (url, audio_only, resolution)
+) WITHOUT ROWID;
+
@@ -17,7 +17,7 @@ import (
 
 var ErrNoImage = errors.New("no image or image too small")
 
-var ocrCache = lrusf.NewStringKeyCache[*azure.OcrResult](500, nil)
+var ocrCache = lrusf.NewStringKeyCache[*azure.OcrResult](500, nil).Named("ocr")
 var ocrRateLimiter = rate.NewLimiter(5, 1)
 
 func ocrMsg(bot *gotgbot.Bot, file *gotgbot.PhotoSize) (string, error) {
@@ -42,7 +42,7 @@ func ocrMsg(bot *gotgbot.Bot, file *gotgbot.PhotoSize) (string, error) {
 	return res.Text(), nil
 }
 
-var moderatorMsgCache = lrusf.NewStringKeyCache[*azure.ModeratorV2Result](500, nil)
+var moderatorMsgCache = lrusf.NewStringKeyCache[*azure.ModeratorV2Result](500, nil).Named("moderator")
 var moderatorRateLimiter = rate.NewLimiter(5, 1)
 
 func moderatorMsg(bot *gotgbot.Bot, file *gotgbot.PhotoSize) (*azure.ModeratorV2Result, error) {
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	g "main/globalcfg"
+	"main/globalcfg/q"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
@@ -21,18 +22,19 @@ func StatMessage(bot *gotgbot.Bot, ctx *ext.Context) error {
 		return nil
 	}
 	txtLen := int64(uniseg.GraphemeClusterCount(msg.Text))
-	chatStat.IncMessage(user.Id, txtLen, msg.Date, int64(msg.MessageId))
+	var media q.MsgMedia
 	if msg.Photo != nil {
-		chatStat.IncPhotoCount()
+		media |= q.MediaPhoto
 	}
 	if msg.Video != nil {
-		chatStat.IncVideoCount()
+		media |= q.MediaVideo
 	}
 	if msg.Sticker != nil {
-		chatStat.IncStickerCount()
+		media |= q.MediaSticker
 	}
 	if msg.ForwardOrigin != nil {
-		chatStat.IncForwardCount()
+		media |= q.MediaForward
 	}
+	chatStat.IncMessage(user.Id, txtLen, msg.Date, int64(msg.MessageId), media)
 	return nil
 }
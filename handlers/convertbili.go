@@ -9,6 +9,7 @@ import (
 	"log/slog"
 	g "main/globalcfg"
 	"main/globalcfg/q"
+	"main/handlers/genbot"
 	"main/helpers/bili"
 	"strconv"
 	"strings"
@@ -99,6 +100,11 @@ type BiliInlineResult struct {
 
 const biliCallbackData = "download:bilibili"
 
+// IsBiliInlineQuery 翻译请求由 genbot.TranslateInline 处理
+func IsBiliInlineQuery(iq *gotgbot.InlineQuery) bool {
+	return !genbot.IsTranslateInline(iq)
+}
+
 func BiliMsgConverterInline(bot *gotgbot.Bot, ctx *ext.Context) (err error) {
 	if ctx.InlineQuery.Query == "" {
 		_, err := ctx.InlineQuery.Answer(bot, []gotgbot.InlineQueryResult{
@@ -0,0 +1,51 @@
+package genbot
+
+import (
+	"context"
+	"database/sql"
+	g "main/globalcfg"
+	"main/helpers/lrusf"
+	"time"
+
+	"github.com/go-co-op/gocron"
+)
+
+// 相同的贴纸、图片在会话中反复出现时只从数据库读取一次
+var blobCache = lrusf.NewStringKeyCache[[]byte](128, nil).Named("blob")
+
+const blobGcKeep = 24 * time.Hour
+
+func putBlob(ctx context.Context, data []byte) (sql.NullString, error) {
+	hash, err := g.Q.PutGeminiBlob(ctx, data)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	blobCache.Add(hash, data)
+	return sql.NullString{String: hash, Valid: true}, nil
+}
+
+func getBlob(ctx context.Context, hash string) ([]byte, error) {
+	return blobCache.Get(hash, func() ([]byte, error) {
+		return g.Q.GetGeminiBlobData(ctx, hash)
+	})
+}
+
+func gcBlobs() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+	contents, blobs, err := g.Q.GcGeminiBlobs(ctx, blobGcKeep)
+	if err != nil {
+		log.Warn("gc gemini blobs", "err", err)
+		return
+	}
+	log.Info("gc gemini blobs", "orphan_contents", contents, "blobs", blobs)
+}
+
+func StartBlobGcScheduler() {
+	scheduler := gocron.NewScheduler(time.Local)
+	if _, err := scheduler.Every(1).Day().At("04:00").Do(gcBlobs); err != nil {
+		log.Warn("start gemini blob gc scheduler failed", "err", err)
+		return
+	}
+	scheduler.StartAsync()
+}
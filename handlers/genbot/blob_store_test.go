@@ -0,0 +1,101 @@
+package genbot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"testing"
+	"time"
+)
+
+func TestBlobDedupAndGc(t *testing.T) {
+	ctx := context.Background()
+	const chatId = -100999
+	sess, err := g.Q.CreateNewGeminiSession(ctx, chatId, "test", "supergroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deleted, err := g.Q.CreateNewGeminiSession(ctx, chatId, "deleted", "supergroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	used := []byte("sticker sent many times")
+	h1, err := putBlob(ctx, used)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h2, err := putBlob(ctx, used)
+	if err != nil || h1 != h2 {
+		t.Fatalf("same data should have same hash, %v %v %v", h1, h2, err)
+	}
+	unused, err := putBlob(ctx, []byte("discarded before persist"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orphan, err := putBlob(ctx, []byte("content of deleted session"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newContent := func(sessionId, msgId int64, hash sql.NullString) q.GeminiContent {
+		return q.GeminiContent{
+			SessionID: sessionId,
+			ChatID:    chatId,
+			MsgID:     msgId,
+			Role:      "user",
+			SentTime:  q.UnixTime{Time: time.Now()},
+			MsgType:   "sticker",
+			BlobHash:  hash,
+			MimeType:  sql.NullString{String: "image/webp", Valid: true},
+		}
+	}
+	for i, c := range []q.GeminiContent{
+		newContent(sess.ID, 1, h1),
+		newContent(sess.ID, 2, h1),
+		newContent(deleted.ID, 3, orphan),
+	} {
+		if err := c.Save(ctx, g.Q); err != nil {
+			t.Fatalf("save content %d: %v", i, err)
+		}
+	}
+
+	// 外键约束开启时会级联删除消息，否则由 GC 清理
+	if _, err = g.RawMainDb().ExecContext(ctx, "DELETE FROM gemini_sessions WHERE id = ?", deleted.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// 刚存入的媒体在保留期内不会被删除
+	_, blobs, err := g.Q.GcGeminiBlobs(ctx, time.Hour)
+	if err != nil || blobs != 0 {
+		t.Fatalf("expected no blob deleted, got %d %v", blobs, err)
+	}
+	var left int
+	err = g.RawMainDb().QueryRowContext(ctx, "SELECT COUNT(*) FROM gemini_contents WHERE session_id = ?", deleted.ID).Scan(&left)
+	if err != nil || left != 0 {
+		t.Fatalf("contents of deleted session should be removed, got %d %v", left, err)
+	}
+
+	// 再次存入已经过期的媒体会刷新存入时间
+	if _, err = g.RawMainDb().ExecContext(ctx, "UPDATE gemini_blobs SET created_at = ? WHERE hash = ?",
+		time.Now().Add(-48*time.Hour).Unix(), unused.String); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = putBlob(ctx, []byte("discarded before persist")); err != nil {
+		t.Fatal(err)
+	}
+	if _, blobs, err = g.Q.GcGeminiBlobs(ctx, time.Hour); err != nil || blobs != 0 {
+		t.Fatalf("blob put again should be kept, got %d %v", blobs, err)
+	}
+	if _, blobs, err = g.Q.GcGeminiBlobs(ctx, -time.Hour); err != nil || blobs < 2 {
+		t.Fatalf("expected unreferenced blobs deleted, got %d %v", blobs, err)
+	}
+	if _, err := g.Q.GetGeminiBlobData(ctx, h1.String); err != nil {
+		t.Fatalf("referenced blob should be kept: %v", err)
+	}
+	for _, hash := range []sql.NullString{unused, orphan} {
+		if _, err := g.Q.GetGeminiBlobData(ctx, hash.String); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("unreferenced blob should be deleted, err=%v", err)
+		}
+	}
+}
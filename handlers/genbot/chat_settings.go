@@ -0,0 +1,173 @@
+package genbot
+
+import (
+	"context"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"google.golang.org/genai"
+)
+
+const GeminiSettingsPrefix = "gset:"
+
+var (
+	geminiModels          = []string{q.DefaultGeminiModel, "gemini-3.1-flash-lite-preview", "gemini-2.5-flash", geminiImageModel}
+	geminiTemperatures    = []float64{0.2, 0.5, 0.7, 1.0, 1.3, 1.6, 2.0}
+	geminiThinkingBudgets = []int64{-1, 0, 1024, 4096, 8192}
+	geminiMaxHistories    = []int64{30, 60, 100, q.DefaultGeminiMaxHistory, 300}
+)
+
+// nextOf 返回 list 中 cur 的下一个值，cur 不在列表中时返回第一个值。
+func nextOf[T comparable](list []T, cur T) T {
+	idx := slices.Index(list, cur)
+	return list[(idx+1)%len(list)]
+}
+
+func getChatSettings(ctx context.Context, topic geminiTopic) q.GeminiChatSetting {
+	setting, err := g.Q.GetGeminiChatSettingOrDefault(ctx, topic.chatId, topic.topicId)
+	if err != nil {
+		log.Warn("get gemini chat settings", "chat_id", topic.chatId, "topic_id", topic.topicId, "err", err)
+		return q.DefaultGeminiChatSetting(topic.chatId, topic.topicId)
+	}
+	return setting
+}
+
+func thinkingBudgetText(budget int64) string {
+	switch {
+	case budget < 0:
+		return "自动"
+	case budget == 0:
+		return "关闭"
+	default:
+		return strconv.FormatInt(budget, 10)
+	}
+}
+
+func buildGenerateConfig(setting *q.GeminiChatSetting, sysPrompt string, allowCodeExecution bool) *genai.GenerateContentConfig {
+	config := &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(sysPrompt, genai.RoleModel),
+		Temperature:       genai.Ptr(float32(setting.Temperature)),
+	}
+	if isImageModel(setting.Model) {
+		config.ResponseModalities = []string{string(genai.ModalityText), string(genai.ModalityImage)}
+		return config
+	}
+	if setting.ThinkingBudget >= 0 {
+		config.ThinkingConfig = &genai.ThinkingConfig{ThinkingBudget: genai.Ptr(int32(setting.ThinkingBudget))}
+	}
+	tool := &genai.Tool{}
+	if setting.EnableSearch {
+		tool.GoogleSearch = &genai.GoogleSearch{}
+	}
+	// 视频等内容与代码执行不兼容，即使配置开启也需要由会话内容决定
+	if setting.EnableCodeExecution && allowCodeExecution {
+		tool.CodeExecution = &genai.ToolCodeExecution{}
+	}
+	if tool.GoogleSearch != nil || tool.CodeExecution != nil {
+		config.Tools = []*genai.Tool{tool}
+	}
+	return config
+}
+
+func generateSettingsReplyMarkup(setting *q.GeminiChatSetting) gotgbot.InlineKeyboardMarkup {
+	btn := func(text, field string) gotgbot.InlineKeyboardButton {
+		return gotgbot.InlineKeyboardButton{Text: text, CallbackData: GeminiSettingsPrefix + field}
+	}
+	return gotgbot.InlineKeyboardMarkup{InlineKeyboard: [][]gotgbot.InlineKeyboardButton{
+		{btn("模型: "+setting.Model, "model")},
+		{
+			btn(fmt.Sprintf("温度: %.1f", setting.Temperature), "temperature"),
+			btn("思考预算: "+thinkingBudgetText(setting.ThinkingBudget), "thinking"),
+		},
+		{
+			btn(boolToEmoji(setting.EnableSearch)+" Google搜索", "search"),
+			btn(boolToEmoji(setting.EnableCodeExecution)+" 代码执行", "code"),
+		},
+		{btn(fmt.Sprintf("最大历史消息: %d", setting.MaxHistory), "history")},
+	}}
+}
+
+func boolToEmoji(b bool) string {
+	if b {
+		return "✅"
+	}
+	return "❌"
+}
+
+func modifySetting(setting *q.GeminiChatSetting, field string) error {
+	switch field {
+	case "model":
+		setting.Model = nextOf(geminiModels, setting.Model)
+	case "temperature":
+		setting.Temperature = nextOf(geminiTemperatures, setting.Temperature)
+	case "thinking":
+		setting.ThinkingBudget = nextOf(geminiThinkingBudgets, setting.ThinkingBudget)
+	case "search":
+		setting.EnableSearch = !setting.EnableSearch
+	case "code":
+		setting.EnableCodeExecution = !setting.EnableCodeExecution
+	case "history":
+		setting.MaxHistory = nextOf(geminiMaxHistories, setting.MaxHistory)
+	default:
+		return fmt.Errorf("unknown gemini setting field: %s", field)
+	}
+	return nil
+}
+
+func ShowGeminiSettings(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	setting := getChatSettings(context.Background(), newTopic(msg))
+	_, err := msg.Reply(bot, "当前聊天的AI配置如下，点击按钮切换", &gotgbot.SendMessageOpts{
+		ReplyMarkup: generateSettingsReplyMarkup(&setting),
+	})
+	return err
+}
+
+func ModifyGeminiSettingsByButton(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if msg == nil {
+		return fmt.Errorf("ModifyGeminiSettingsByButton: message should not be nil")
+	}
+	if !isChatGeminiAdmin(bot, &msg.Chat, ctx.CallbackQuery.From.Id) {
+		_, err := ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "只有管理员可以修改AI配置", ShowAlert: true})
+		return err
+	}
+	field := strings.TrimPrefix(ctx.CallbackQuery.Data, GeminiSettingsPrefix)
+	setting := getChatSettings(context.Background(), newTopic(msg))
+	if err := modifySetting(&setting, field); err != nil {
+		_, _ = ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: err.Error(), ShowAlert: true})
+		return err
+	}
+	if err := setting.Save(context.Background(), g.Q); err != nil {
+		_, _ = ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "保存失败: " + err.Error(), ShowAlert: true})
+		return err
+	}
+	_, _, err := msg.EditReplyMarkup(bot, &gotgbot.EditMessageReplyMarkupOpts{
+		ReplyMarkup: generateSettingsReplyMarkup(&setting),
+	})
+	_, _ = ctx.CallbackQuery.Answer(bot, &gotgbot.AnswerCallbackQueryOpts{Text: "已更新"})
+	return err
+}
+
+func ChangeGeminiModel(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !isGeminiAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以切换模型", nil)
+		return err
+	}
+	setting := getChatSettings(context.Background(), newTopic(msg))
+	oldModel := setting.Model
+	setting.Model = nextOf(geminiModels, setting.Model)
+	if err := setting.Save(context.Background(), g.Q); err != nil {
+		_, _ = msg.Reply(bot, "保存失败: "+err.Error(), nil)
+		return err
+	}
+	_, err := msg.Reply(bot, fmt.Sprintf("model: %s => %s", oldModel, setting.Model), nil)
+	return err
+}
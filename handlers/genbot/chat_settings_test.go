@@ -0,0 +1,59 @@
+package genbot
+
+import (
+	"main/globalcfg/q"
+	"testing"
+)
+
+func TestModifySettingCycles(t *testing.T) {
+	setting := q.DefaultGeminiChatSetting(1, 0)
+	for range geminiModels {
+		if err := modifySetting(&setting, "model"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if setting.Model != q.DefaultGeminiModel {
+		t.Fatalf("model should cycle back to default, got %s", setting.Model)
+	}
+	if err := modifySetting(&setting, "search"); err != nil || setting.EnableSearch {
+		t.Fatalf("search should be disabled, err=%v", err)
+	}
+	if err := modifySetting(&setting, "unknown"); err == nil {
+		t.Fatal("unknown field should return error")
+	}
+}
+
+func TestBuildGenerateConfig(t *testing.T) {
+	setting := q.DefaultGeminiChatSetting(1, 0)
+	config := buildGenerateConfig(&setting, "sys", false)
+	if config.ThinkingConfig != nil {
+		t.Fatal("negative thinking budget should leave ThinkingConfig unset")
+	}
+	if len(config.Tools) != 1 || config.Tools[0].GoogleSearch == nil || config.Tools[0].CodeExecution != nil {
+		t.Fatalf("unexpected tools: %+v", config.Tools)
+	}
+
+	setting.EnableSearch = false
+	setting.ThinkingBudget = 0
+	config = buildGenerateConfig(&setting, "sys", true)
+	if config.ThinkingConfig == nil || *config.ThinkingConfig.ThinkingBudget != 0 {
+		t.Fatal("thinking budget 0 should be passed to model")
+	}
+	if len(config.Tools) != 1 || config.Tools[0].CodeExecution == nil || config.Tools[0].GoogleSearch != nil {
+		t.Fatalf("unexpected tools: %+v", config.Tools)
+	}
+
+	setting.EnableCodeExecution = false
+	if config = buildGenerateConfig(&setting, "sys", true); config.Tools != nil {
+		t.Fatalf("tools should be empty, got %+v", config.Tools)
+	}
+}
+
+func TestBuildGenerateConfigImageModel(t *testing.T) {
+	setting := q.DefaultGeminiChatSetting(1, 0)
+	setting.Model = geminiImageModel
+	config := buildGenerateConfig(&setting, "sys", true)
+	if len(config.ResponseModalities) != 2 || config.Tools != nil || config.ThinkingConfig != nil {
+		t.Fatalf("image model should request images without tools, got %+v", config)
+	}
+}
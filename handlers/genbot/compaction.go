@@ -0,0 +1,152 @@
+package genbot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"math"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// 摘要作为一条特殊消息存入 gemini_contents，msg_id 为被总结的最后一条消息 id 的相反数，
+// 这样同一聊天中摘要的 msg_id 不会冲突，且 msg_id 越小代表覆盖的消息越新。
+const summaryMsgType = "summary"
+
+const summaryPrompt = `你是一个对话记录整理助手。接下来会给你一段群聊中与AI助手的对话记录（可能以一份更早的摘要开头）。
+请用中文将其整理为一份简洁但信息完整的摘要，供AI助手在后续对话中回顾上下文使用。要求：
+1. 保留参与者的名字以及各自的关键观点、请求、约定与未解决的问题；
+2. 保留AI助手已经给出的重要结论，避免重复回答；
+3. 对图片、视频等媒体内容仅用一句话描述；
+4. 直接输出摘要正文，不要添加额外说明。`
+
+func isSummary(content *q.GeminiContent) bool {
+	return content.MsgType == summaryMsgType
+}
+
+// coveredMsgId 返回摘要覆盖到的最后一条消息id，没有摘要时返回0
+func coveredMsgId(summary *q.GeminiContent) int64 {
+	if summary == nil {
+		return 0
+	}
+	return -summary.MsgID
+}
+
+func summaryToGenaiContent(summary *q.GeminiContent) *genai.Content {
+	return &genai.Content{
+		Role: genai.RoleUser,
+		Parts: []*genai.Part{
+			{Text: fmt.Sprintf("-start-summary-\n以下是本会话截至 %s 的较早消息摘要，更早的原始消息已不可见：\n-end-summary-\n",
+				summary.SentTime.Format("2006-01-02 15:04:05"))},
+			{Text: summary.Text.String},
+		},
+	}
+}
+
+// compactionCount 返回需要被总结的最早消息数量，为0时表示不需要压缩
+func compactionCount(contentLen, keepRecent int) int {
+	if contentLen <= keepRecent {
+		return 0
+	}
+	return contentLen - keepRecent
+}
+
+func (s *GeminiSession) loadSummaryFromDatabase(ctx context.Context) error {
+	summary, err := g.Q.GetLatestGeminiSummary(ctx, s.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.Summary = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	s.Summary = &summary
+	return nil
+}
+
+// sessionTokenEstimate 用一次回复的用量估计会话的token数：输入包含了之前的整个会话，输出也会加入会话。
+// 没有用量时返回最大值，交给 CountTokens 计算
+func sessionTokenEstimate(usage *genai.GenerateContentResponseUsageMetadata) int32 {
+	if usage == nil {
+		return math.MaxInt32
+	}
+	return usage.PromptTokenCount + usage.CandidatesTokenCount
+}
+
+// CompactIfNeeded 在会话token数超过阈值时，将最早的消息交给模型总结为摘要并存入数据库。
+// estimate 低于阈值时不调用 CountTokens；总结的用量计入 userId，额度用完时暂不压缩。
+// 调用方需要持有 s.mu。
+func (s *GeminiSession) CompactIfNeeded(ctx context.Context, model string, userId int64, estimate int32) error {
+	cfg := g.GetConfig().GeminiCompaction
+	n := compactionCount(len(s.Contents), cfg.KeepRecent)
+	if n == 0 || estimate < cfg.TokenThreshold {
+		return nil
+	}
+	if quotaMsg, err := checkQuota(ctx, s.ChatID, userId, time.Now()); err != nil || quotaMsg != "" {
+		return err
+	}
+	tokens, err := llm.CountTokens(ctx, model, s.ToGenaiContents(), nil)
+	if err != nil {
+		return err
+	}
+	if tokens.TotalTokens < cfg.TokenThreshold {
+		return nil
+	}
+	old := s.Contents[:n]
+	contents := make([]*genai.Content, 0, n+2)
+	if s.Summary != nil {
+		contents = append(contents, summaryToGenaiContent(s.Summary))
+	}
+	for i := range old {
+		contents = append(contents, databaseContentToGenaiPart(&old[i]))
+	}
+	contents = append(contents, genai.NewContentFromText("请总结以上对话。", genai.RoleUser))
+	res, err := llm.GenerateContent(ctx, model, contents, &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(summaryPrompt, genai.RoleModel),
+	})
+	if err != nil {
+		return err
+	}
+	if err := recordUsage(ctx, s.ChatID, userId, model, res.UsageMetadata); err != nil {
+		log.Warn("record gemini usage", "chat_id", s.ChatID, "user_id", userId, "err", err)
+	}
+	text := res.Text()
+	if text == "" {
+		return errors.New("模型没有返回摘要")
+	}
+	last := old[n-1]
+	summary := q.GeminiContent{
+		SessionID: s.ID,
+		ChatID:    last.ChatID,
+		MsgID:     -last.MsgID,
+		Role:      genai.RoleUser,
+		SentTime:  last.SentTime,
+		Username:  summaryMsgType,
+		MsgType:   summaryMsgType,
+		Text:      sql.NullString{String: text, Valid: true},
+	}
+	if err = summary.Save(ctx, g.Q); err != nil {
+		return err
+	}
+	log.Info("gemini session compacted", "session_id", s.ID, "tokens", tokens.TotalTokens, "summarized", n)
+	s.Summary = &summary
+	s.Contents = append([]q.GeminiContent(nil), s.Contents[n:]...)
+	return nil
+}
+
+// compactSessionAsync 在后台压缩会话，避免阻塞本次回复
+func compactSessionAsync(session *GeminiSession, model string, userId int64, estimate int32) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		session.mu.Lock()
+		defer session.mu.Unlock()
+		if err := session.CompactIfNeeded(ctx, model, userId, estimate); err != nil {
+			log.Warn("compact gemini session", "session_id", session.ID, "err", err)
+		}
+	}()
+}
@@ -0,0 +1,145 @@
+package genbot
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+func TestCompactionCount(t *testing.T) {
+	if n := compactionCount(10, 40); n != 0 {
+		t.Fatalf("short session should not be compacted, got %d", n)
+	}
+	if n := compactionCount(100, 40); n != 60 {
+		t.Fatalf("expected 60 contents to be summarized, got %d", n)
+	}
+}
+
+func TestLoadContentWithSummary(t *testing.T) {
+	ctx := context.Background()
+	const chatId = -100888
+	sess, err := g.Q.CreateNewGeminiSession(ctx, chatId, "test", "supergroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	for i := int64(1); i <= 5; i++ {
+		c := q.GeminiContent{
+			SessionID: sess.ID,
+			ChatID:    chatId,
+			MsgID:     i,
+			Role:      genai.RoleUser,
+			SentTime:  q.UnixTime{Time: now},
+			Username:  "user",
+			MsgType:   "text",
+			Text:      sql.NullString{String: "hello", Valid: true},
+			UserID:    1,
+		}
+		if err := c.Save(ctx, g.Q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	summary := q.GeminiContent{
+		SessionID: sess.ID,
+		ChatID:    chatId,
+		MsgID:     -3,
+		Role:      genai.RoleUser,
+		SentTime:  q.UnixTime{Time: now},
+		Username:  summaryMsgType,
+		MsgType:   summaryMsgType,
+		Text:      sql.NullString{String: "summary of 1..3", Valid: true},
+	}
+	if err := summary.Save(ctx, g.Q); err != nil {
+		t.Fatal(err)
+	}
+
+	s := &GeminiSession{GeminiSession: sess}
+	if err := s.loadContentFromDatabase(ctx, 150); err != nil {
+		t.Fatal(err)
+	}
+	if s.Summary == nil || coveredMsgId(s.Summary) != 3 {
+		t.Fatalf("summary should be loaded, got %+v", s.Summary)
+	}
+	if len(s.Contents) != 2 || s.Contents[0].MsgID != 4 || s.Contents[1].MsgID != 5 {
+		t.Fatalf("only contents after summary should be loaded, got %d", len(s.Contents))
+	}
+	contents := s.ToGenaiContents()
+	if len(contents) != 3 || !strings.Contains(contents[0].Parts[1].Text, "summary of 1..3") {
+		t.Fatalf("summary should be prepended, got %d contents", len(contents))
+	}
+}
+
+// countingProvider 返回固定的摘要和用量，记录 CountTokens 的调用次数
+type countingProvider struct {
+	tokens int32
+	counts int
+	models []string
+}
+
+func (p *countingProvider) GenerateContent(_ context.Context, model string, _ []*genai.Content, _ *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	p.models = append(p.models, model)
+	return &genai.GenerateContentResponse{
+		Candidates:    []*genai.Candidate{{Content: genai.NewContentFromText("摘要", genai.RoleModel)}},
+		UsageMetadata: &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 100, CandidatesTokenCount: 10},
+	}, nil
+}
+
+func (p *countingProvider) CountTokens(context.Context, string, []*genai.Content, *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
+	p.counts++
+	return &genai.CountTokensResponse{TotalTokens: p.tokens}, nil
+}
+
+func TestCompactIfNeeded(t *testing.T) {
+	ctx := context.Background()
+	const chatId, userId = -100889, 880001
+	cfg := g.GetConfig().GeminiCompaction
+	mock := &countingProvider{tokens: cfg.TokenThreshold}
+	old, oldLog := llm, log
+	llm, log = mock, slog.New(slog.DiscardHandler)
+	t.Cleanup(func() { llm, log = old, oldLog })
+
+	sess, err := g.Q.CreateNewGeminiSession(ctx, chatId, "test", "supergroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &GeminiSession{GeminiSession: sess}
+	for i := range int64(cfg.KeepRecent + 5) {
+		s.Contents = append(s.Contents, q.GeminiContent{
+			SessionID: sess.ID, ChatID: chatId, MsgID: i + 1, Role: genai.RoleUser,
+			SentTime: q.UnixTime{Time: time.Now()}, Username: "user", MsgType: "text",
+			Text: sql.NullString{String: "hello", Valid: true}, UserID: userId,
+		})
+	}
+
+	// 估计值低于阈值时不计算token
+	if err = s.CompactIfNeeded(ctx, "text-model", userId, cfg.TokenThreshold-1); err != nil {
+		t.Fatal(err)
+	}
+	if mock.counts != 0 || s.Summary != nil {
+		t.Fatalf("should not count tokens below the estimate threshold, counts=%d", mock.counts)
+	}
+
+	if err = s.CompactIfNeeded(ctx, "text-model", userId, cfg.TokenThreshold); err != nil {
+		t.Fatal(err)
+	}
+	if mock.counts != 1 || s.Summary == nil || len(s.Contents) != cfg.KeepRecent {
+		t.Fatalf("session should be compacted, counts=%d contents=%d", mock.counts, len(s.Contents))
+	}
+	if len(mock.models) != 1 || mock.models[0] != "text-model" {
+		t.Fatalf("unexpected models %v", mock.models)
+	}
+	used, err := g.Q.GetUserGeminiUsageSince(ctx, userId, usageDate(time.Now(), usageLocation(ctx, s.ChatID)))
+	if err != nil || used != 110 {
+		t.Fatalf("compaction usage should be recorded, got %d %v", used, err)
+	}
+	if textModel(geminiImageModel) != q.DefaultGeminiModel || textModel("gemini-2.5-flash") != "gemini-2.5-flash" {
+		t.Fatal("image models should fall back to the default model")
+	}
+}
@@ -0,0 +1,253 @@
+package genbot
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/helpers/mdnormalizer"
+	"main/helpers/meilisearch"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"google.golang.org/genai"
+)
+
+const (
+	digestPageSize     = 1000
+	digestMaxMessages  = 20000
+	digestChunkRunes   = 30000
+	digestSysPrompt    = "你是群聊记录的整理助手，只根据给出的聊天记录进行总结，不要编造记录中不存在的内容。"
+	digestMapPrompt    = "下面是群聊在%s的部分聊天记录（第%d/%d部分），每行格式为 [时间 #消息ID] 发言人: 内容。\n请按话题整理这部分记录，每个话题写出标题、主要参与者和两三句要点，并在要点后用 [[消息ID]] 标注最关键的一到两条消息。只输出整理结果。\n\n"
+	digestReducePrompt = "下面是群聊在%s按时间分段整理的话题摘要。\n请合并重复或相关的话题，按热度从高到低输出不超过8个话题的每日摘要，使用Markdown，每个话题一个加粗标题，保留 [[消息ID]] 标注，总长度不超过1500字。只输出摘要。\n\n"
+	digestFinalPrompt  = "下面是群聊在%s的聊天记录，每行格式为 [时间 #消息ID] 发言人: 内容。\n请按话题整理，按热度从高到低输出不超过8个话题的每日摘要，使用Markdown，每个话题一个加粗标题，写出主要参与者和两三句要点，并在要点后用 [[消息ID]] 标注最关键的一到两条消息，总长度不超过1500字。只输出摘要。\n\n"
+)
+
+var reDigestMsgRef = regexp.MustCompile(`\[\[#?(\d+)]]`)
+
+var ErrNoArchivedMessages = errors.New("没有找到当天的存档消息")
+
+// archivedMsg 消息存档中的一条消息，与 Meilisearch 索引中的文档结构一致
+type archivedMsg struct {
+	PeerID    int64   `json:"peer_id"`
+	FromID    int64   `json:"from_id"`
+	MsgID     int64   `json:"msg_id"`
+	Date      float64 `json:"date"`
+	Message   string  `json:"message"`
+	ImageText string  `json:"image_text"`
+}
+
+// fetchArchivedMessages 获取 [from, to) 内的存档消息，索引需要将 peer_id 与 date 设置为可过滤字段
+func fetchArchivedMessages(chatId int64, from, to time.Time) ([]archivedMsg, error) {
+	query := meilisearch.DocumentsQuery{
+		Filter: fmt.Sprintf("peer_id = %d AND date >= %d AND date < %d", chatId, from.Unix(), to.Unix()),
+		Fields: []string{"peer_id", "from_id", "msg_id", "date", "message", "image_text"},
+		Limit:  digestPageSize,
+	}
+	var msgs []archivedMsg
+	for len(msgs) < digestMaxMessages {
+		var res meilisearch.DocumentsResult[archivedMsg]
+		if err := g.Meili().FetchDocuments(query, &res); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, res.Results...)
+		if len(res.Results) < digestPageSize {
+			break
+		}
+		query.Offset += digestPageSize
+	}
+	slices.SortFunc(msgs, func(a, b archivedMsg) int {
+		return cmp.Or(cmp.Compare(a.Date, b.Date), cmp.Compare(a.MsgID, b.MsgID))
+	})
+	return msgs, nil
+}
+
+func formatArchiveLines(msgs []archivedMsg, loc *time.Location, nameOf func(int64) string) []string {
+	lines := make([]string, 0, len(msgs))
+	for _, m := range msgs {
+		text := strings.TrimSpace(m.Message)
+		if m.ImageText != "" {
+			text += " [图片文字: " + strings.TrimSpace(m.ImageText) + "]"
+		}
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		sent := time.Unix(int64(m.Date), 0).In(loc)
+		lines = append(lines, fmt.Sprintf("[%s #%d] %s: %s",
+			sent.Format("15:04"), m.MsgID, nameOf(m.FromID), strings.ReplaceAll(text, "\n", " ")))
+	}
+	return lines
+}
+
+// chunkLines 将聊天记录按字数切分，使每一段都能放进一次请求中
+func chunkLines(lines []string, maxRunes int) [][]string {
+	var chunks [][]string
+	var cur []string
+	size := 0
+	for _, line := range lines {
+		n := utf8.RuneCountInString(line) + 1
+		if size+n > maxRunes && len(cur) > 0 {
+			chunks = append(chunks, cur)
+			cur, size = nil, 0
+		}
+		cur = append(cur, line)
+		size += n
+	}
+	if len(cur) > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// linkDigestRefs 将模型输出的 [[消息ID]] 替换为消息链接，不在存档中的ID视为模型编造并删除，
+// 不是超级群组时没有消息链接，也删除
+func linkDigestRefs(text string, chatId int64, known map[int64]bool) string {
+	return reDigestMsgRef.ReplaceAllStringFunc(text, func(s string) string {
+		id, _ := strconv.ParseInt(reDigestMsgRef.FindStringSubmatch(s)[1], 10, 64)
+		link, ok := h.MsgLink(chatId, id)
+		if !known[id] || !ok {
+			return ""
+		}
+		return fmt.Sprintf("[↗](%s)", link)
+	})
+}
+
+func digestGenerate(ctx context.Context, chatId int64, model string, prompt string) (string, error) {
+	res, err := llm.GenerateContent(ctx, model, genai.Text(prompt), &genai.GenerateContentConfig{
+		SystemInstruction: genai.NewContentFromText(digestSysPrompt, genai.RoleModel),
+	})
+	if err != nil {
+		return "", err
+	}
+	if err := recordUsage(ctx, chatId, mainBot.Id, model, res.UsageMetadata); err != nil {
+		log.Warn("record gemini usage", "chat_id", chatId, "err", err)
+	}
+	text := strings.TrimSpace(res.Text())
+	if text == "" {
+		return "", errors.New("模型没有返回任何信息")
+	}
+	return text, nil
+}
+
+// GenerateDailyDigest 将 day 当天（按 day 的时区）的存档消息分段总结后再合并，返回Markdown格式的摘要
+func GenerateDailyDigest(ctx context.Context, chatId int64, day time.Time) (string, error) {
+	from := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, day.Location())
+	msgs, err := fetchArchivedMessages(chatId, from, from.AddDate(0, 0, 1))
+	if err != nil {
+		return "", err
+	}
+	names := map[int64]string{}
+	nameOf := func(userId int64) string {
+		if name, ok := names[userId]; ok {
+			return name
+		}
+		name := "用户" + strconv.FormatInt(userId, 10)
+		if user, err := g.Q.GetUserById(ctx, userId); err == nil {
+			name = user.Name()
+		}
+		names[userId] = name
+		return name
+	}
+	chunks := chunkLines(formatArchiveLines(msgs, day.Location(), nameOf), digestChunkRunes)
+	if len(chunks) == 0 {
+		return "", ErrNoArchivedMessages
+	}
+	model := textModel(getChatSettings(ctx, geminiTopic{chatId: chatId}).Model)
+	date := from.Format("2006年01月02日")
+	var digest string
+	if len(chunks) == 1 {
+		digest, err = digestGenerate(ctx, chatId, model, fmt.Sprintf(digestFinalPrompt, date)+strings.Join(chunks[0], "\n"))
+	} else {
+		partials := make([]string, 0, len(chunks))
+		for i, chunk := range chunks {
+			partial, err := digestGenerate(ctx, chatId, model, fmt.Sprintf(digestMapPrompt, date, i+1, len(chunks))+strings.Join(chunk, "\n"))
+			if err != nil {
+				return "", err
+			}
+			partials = append(partials, partial)
+		}
+		digest, err = digestGenerate(ctx, chatId, model, fmt.Sprintf(digestReducePrompt, date)+strings.Join(partials, "\n\n---\n\n"))
+	}
+	if err != nil {
+		return "", err
+	}
+	known := make(map[int64]bool, len(msgs))
+	for _, m := range msgs {
+		known[m.MsgID] = true
+	}
+	return fmt.Sprintf("**%s 群聊摘要**\n\n%s", date, linkDigestRefs(digest, chatId, known)), nil
+}
+
+// SendDailyDigest 生成并发送 day 当天的群聊摘要
+func SendDailyDigest(bot *gotgbot.Bot, chatId int64, threadId int64, day time.Time) error {
+	if !slices.Contains(g.GetConfig().AIChats, chatId) {
+		return fmt.Errorf("chat %d is not in ai chats", chatId)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	if quotaMsg, err := checkQuota(ctx, chatId, bot.Id, time.Now()); err != nil {
+		return err
+	} else if quotaMsg != "" {
+		return errors.New(quotaMsg)
+	}
+	digest, err := GenerateDailyDigest(ctx, chatId, day)
+	if err != nil {
+		return err
+	}
+	opts := &gotgbot.SendMessageOpts{
+		MessageThreadId:    threadId,
+		LinkPreviewOptions: &gotgbot.LinkPreviewOptions{IsDisabled: true},
+	}
+	if normTxt, err := mdnormalizer.Normalize(digest); err != nil {
+		log.Warn("parse markdown failed", "err", err)
+	} else {
+		digest = normTxt.Text
+		opts.Entities = normTxt.Entities
+	}
+	_, err = bot.SendMessage(chatId, digest, opts)
+	return err
+}
+
+// DailyDigest 手动生成昨天的群聊摘要，参数为 today 时生成今天到目前为止的摘要（仅管理员）
+func DailyDigest(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !isGeminiAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以生成群聊摘要", nil)
+		return err
+	}
+	if !slices.Contains(g.GetConfig().AIChats, msg.Chat.Id) {
+		_, err := msg.Reply(bot, "当前聊天未开启AI功能", nil)
+		return err
+	}
+	cfg := g.Q.GetChatCfgByIdOrDefault(msg.Chat.Id)
+	day := time.Now().In(cfg.Location())
+	if strings.TrimSpace(h.TrimCmd(msg.GetText())) != "today" {
+		day = day.AddDate(0, 0, -1)
+	}
+	setReaction(bot, msg, "👀")
+	actionCancel := h.WithChatAction(bot, "typing", msg.Chat.Id, msg.MessageThreadId, msg.IsTopicMessage)
+	defer actionCancel()
+	threadId := int64(0)
+	if msg.IsTopicMessage {
+		threadId = msg.MessageThreadId
+	}
+	err := SendDailyDigest(bot, msg.Chat.Id, threadId, day)
+	if errors.Is(err, ErrNoArchivedMessages) {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	} else if err != nil {
+		setReaction(bot, msg, "😭")
+		_, _ = msg.Reply(bot, "生成摘要失败: "+err.Error(), nil)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package genbot
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatArchiveLines(t *testing.T) {
+	loc := time.FixedZone("chat_tz", 8*3600)
+	msgs := []archivedMsg{
+		{FromID: 1, MsgID: 10, Date: 1710400000, Message: "早上好\n大家"},
+		{FromID: 2, MsgID: 11, Date: 1710400060},
+		{FromID: 2, MsgID: 12, Date: 1710400120, ImageText: "菜单"},
+	}
+	lines := formatArchiveLines(msgs, loc, func(id int64) string {
+		return map[int64]string{1: "Alice", 2: "Bob"}[id]
+	})
+	want := []string{
+		"[15:06 #10] Alice: 早上好 大家",
+		"[15:08 #12] Bob: [图片文字: 菜单]",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("unexpected lines:\n%s", strings.Join(lines, "\n"))
+	}
+}
+
+func TestChunkLines(t *testing.T) {
+	lines := []string{"一二三", "四五六", "七八九", strings.Repeat("长", 20)}
+	chunks := chunkLines(lines, 8)
+	if len(chunks) != 3 || len(chunks[0]) != 2 || len(chunks[2]) != 1 {
+		t.Fatalf("unexpected chunks: %v", chunks)
+	}
+	if chunkLines(nil, 8) != nil {
+		t.Fatal("empty lines should have no chunk")
+	}
+}
+
+func TestLinkDigestRefs(t *testing.T) {
+	text := linkDigestRefs("**话题** 讨论了晚饭 [[10]] [[#11]] [[999]]", -1001234567890, map[int64]bool{10: true, 11: true})
+	want := "**话题** 讨论了晚饭 [↗](https://t.me/c/1234567890/10) [↗](https://t.me/c/1234567890/11) "
+	if text != want {
+		t.Fatalf("unexpected text %q", text)
+	}
+	// 普通群组的消息没有链接
+	if text = linkDigestRefs("晚饭 [[10]]", -4001234567, map[int64]bool{10: true}); text != "晚饭 " {
+		t.Fatalf("unexpected text %q", text)
+	}
+}
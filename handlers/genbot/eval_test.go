@@ -0,0 +1,288 @@
+package genbot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"google.golang.org/genai"
+)
+
+// 修改系统提示词或消息标注格式后，使用 go test ./handlers/genbot -run TestEvalReplay -update 更新golden文件，
+// 再通过 git diff 检查实际发给模型的请求有什么变化
+var updateGolden = flag.Bool("update", false, "update golden files in testdata/eval")
+
+const evalDir = "testdata/eval"
+
+// evalFixture 与 /session_export 导出的json格式相同，解压导出的zip即可作为测试用例，
+// 可以额外指定 sys_prompt 测试自定义的系统提示词
+type evalFixture struct {
+	exportedSession
+	SysPrompt string `json:"sys_prompt,omitempty"`
+}
+
+type recordedBlob struct {
+	MIMEType string `json:"mime_type"`
+	Size     int    `json:"size"`
+	SHA256   string `json:"sha256"`
+}
+
+type recordedPart struct {
+	Text       string        `json:"text,omitempty"`
+	InlineData *recordedBlob `json:"inline_data,omitempty"`
+}
+
+type recordedContent struct {
+	Role  string         `json:"role"`
+	Parts []recordedPart `json:"parts"`
+}
+
+type recordedRequest struct {
+	Model             string            `json:"model"`
+	SystemInstruction string            `json:"system_instruction"`
+	Temperature       float32           `json:"temperature"`
+	Tools             []string          `json:"tools,omitempty"`
+	Contents          []recordedContent `json:"contents"`
+}
+
+func recordContent(c *genai.Content) recordedContent {
+	out := recordedContent{Role: c.Role}
+	for _, p := range c.Parts {
+		part := recordedPart{Text: p.Text}
+		if p.InlineData != nil {
+			sum := sha256.Sum256(p.InlineData.Data)
+			part.InlineData = &recordedBlob{
+				MIMEType: p.InlineData.MIMEType,
+				Size:     len(p.InlineData.Data),
+				SHA256:   hex.EncodeToString(sum[:]),
+			}
+		}
+		out.Parts = append(out.Parts, part)
+	}
+	return out
+}
+
+// mockProvider 记录请求，并按顺序返回会话中已有的模型回复
+type mockProvider struct {
+	replies  []string
+	requests []recordedRequest
+}
+
+func (m *mockProvider) GenerateContent(_ context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	req := recordedRequest{Model: model}
+	if config != nil {
+		if config.SystemInstruction != nil {
+			for _, p := range config.SystemInstruction.Parts {
+				req.SystemInstruction += p.Text
+			}
+		}
+		if config.Temperature != nil {
+			req.Temperature = *config.Temperature
+		}
+		for _, tool := range config.Tools {
+			if tool.GoogleSearch != nil {
+				req.Tools = append(req.Tools, "google_search")
+			}
+			if tool.CodeExecution != nil {
+				req.Tools = append(req.Tools, "code_execution")
+			}
+		}
+	}
+	for _, c := range contents {
+		req.Contents = append(req.Contents, recordContent(c))
+	}
+	m.requests = append(m.requests, req)
+	reply := "(empty)"
+	if len(m.replies) > 0 {
+		reply, m.replies = m.replies[0], m.replies[1:]
+	}
+	return &genai.GenerateContentResponse{
+		Candidates: []*genai.Candidate{{Content: genai.NewContentFromText(reply, genai.RoleModel)}},
+	}, nil
+}
+
+func (m *mockProvider) CountTokens(context.Context, string, []*genai.Content, *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
+	return &genai.CountTokensResponse{}, nil
+}
+
+// importFixture 将导出的会话写入数据库，chatId 使用独立的值避免与其他测试冲突
+func importFixture(t *testing.T, dir string, fx *evalFixture, chatId int64) *GeminiSession {
+	ctx := context.Background()
+	dbSess, err := g.Q.CreateNewGeminiSession(ctx, chatId, fx.ChatName, fx.ChatType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parseTime := func(s string) q.UnixTime {
+		tm, err := time.ParseInLocation("2006-01-02 15:04:05", s, time.Local)
+		if err != nil {
+			t.Fatalf("parse time %q: %v", s, err)
+		}
+		return q.UnixTime{Time: tm}
+	}
+	nullStr := func(s string) sql.NullString {
+		return sql.NullString{String: s, Valid: s != ""}
+	}
+	if fx.Summary != "" && len(fx.Messages) > 0 {
+		first := fx.Messages[0]
+		summary := q.GeminiContent{
+			SessionID: dbSess.ID,
+			ChatID:    chatId,
+			MsgID:     -(first.MsgID - 1),
+			Role:      genai.RoleUser,
+			SentTime:  parseTime(first.Time),
+			Username:  summaryMsgType,
+			MsgType:   summaryMsgType,
+			Text:      nullStr(fx.Summary),
+		}
+		if err := summary.Save(ctx, g.Q); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, m := range fx.Messages {
+		c := q.GeminiContent{
+			SessionID:      dbSess.ID,
+			ChatID:         chatId,
+			MsgID:          m.MsgID,
+			Role:           m.Role,
+			SentTime:       parseTime(m.Time),
+			Username:       m.Name,
+			MsgType:        m.Type,
+			ReplyToMsgID:   sql.NullInt64{Int64: m.ReplyTo, Valid: m.ReplyTo != 0},
+			Text:           nullStr(m.Text),
+			QuotePart:      nullStr(m.Quote),
+			AtableUsername: nullStr(m.Username),
+		}
+		if m.Attachment != "" {
+			data, err := os.ReadFile(filepath.Join(dir, m.Attachment))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if c.BlobHash, err = putBlob(ctx, data); err != nil {
+				t.Fatal(err)
+			}
+			mimeType := "application/octet-stream"
+			for mt, ext := range mimeExt {
+				if filepath.Ext(m.Attachment) == ext {
+					mimeType = mt
+				}
+			}
+			c.MimeType = nullStr(mimeType)
+		}
+		if err := c.Save(ctx, g.Q); err != nil {
+			t.Fatalf("save message %d: %v", m.MsgID, err)
+		}
+	}
+	sess := &GeminiSession{GeminiSession: dbSess}
+	if err := sess.loadContentFromDatabase(ctx, 10000); err != nil {
+		t.Fatal(err)
+	}
+	return sess
+}
+
+// replaySession 对会话中的每一条模型回复，用它之前的消息重新构造一次请求
+func replaySession(t *testing.T, fx *evalFixture, sess *GeminiSession) []recordedRequest {
+	ctx := context.Background()
+	all := sess.Contents
+	mock := &mockProvider{}
+	old := llm
+	llm = mock
+	t.Cleanup(func() { llm = old })
+
+	replacer := &geminiSysPromptReplacer
+	if fx.SysPrompt != "" {
+		r, err := ParseReplacer(fx.SysPrompt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		replacer = &r
+	}
+	bot := &gotgbot.Bot{User: gotgbot.User{Id: 1, FirstName: "EvalBot", Username: "eval_bot", IsBot: true}}
+	setting := getChatSettings(ctx, geminiTopic{chatId: sess.ChatID})
+	for i := range all {
+		if all[i].Role != genai.RoleModel || i == 0 {
+			continue
+		}
+		trigger := &all[i-1]
+		msg := &gotgbot.Message{
+			MessageId: trigger.MsgID,
+			Chat:      gotgbot.Chat{Id: sess.ChatID, Title: fx.ChatName, FirstName: fx.ChatName, Type: fx.ChatType},
+			From:      &gotgbot.User{Id: trigger.UserID, FirstName: trigger.Username},
+		}
+		sysPrompt := replacer.Replace(&ReplaceCtx{Bot: bot, Msg: msg, Now: trigger.SentTime.Time})
+		sess.Contents = all[:i]
+		mock.replies = []string{all[i].Text.String}
+		config := buildGenerateConfig(&setting, sysPrompt, sess.AllowCodeExecution)
+		if _, err := generate(ctx, setting.Model, sess, config); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sess.Contents = all
+	return mock.requests
+}
+
+func TestEvalReplay(t *testing.T) {
+	// 固定时区，使消息标注中的时间与运行测试的机器无关
+	oldLocal := time.Local
+	time.Local = time.FixedZone("CST", 8*3600)
+	t.Cleanup(func() { time.Local = oldLocal })
+
+	cases, err := os.ReadDir(evalDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, c := range cases {
+		if !c.IsDir() {
+			continue
+		}
+		t.Run(c.Name(), func(t *testing.T) {
+			dir := filepath.Join(evalDir, c.Name())
+			data, err := os.ReadFile(filepath.Join(dir, "session.json"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var fx evalFixture
+			if err := json.Unmarshal(data, &fx); err != nil {
+				t.Fatal(err)
+			}
+			sess := importFixture(t, dir, &fx, -1009000000-int64(i))
+			requests := replaySession(t, &fx, sess)
+			if len(requests) == 0 {
+				t.Fatal("session has no model reply to replay")
+			}
+			buf := bytes.Buffer{}
+			enc := json.NewEncoder(&buf)
+			enc.SetEscapeHTML(false)
+			enc.SetIndent("", "  ")
+			if err := enc.Encode(requests); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join(dir, "requests.golden.json")
+			if *updateGolden {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v, run with -update to create it", err)
+			}
+			if !bytes.Equal(want, buf.Bytes()) {
+				got := golden + ".got"
+				_ = os.WriteFile(got, buf.Bytes(), 0o644)
+				t.Fatalf("request payload changed, diff %s %s, run with -update if the change is expected", golden, got)
+			}
+		})
+	}
+}
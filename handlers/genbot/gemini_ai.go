@@ -10,7 +10,6 @@ import (
 	"main/helpers/mdnormalizer"
 	"math/rand/v2"
 	"regexp"
-	"slices"
 	"strconv"
 	"strings"
 	"sync"
@@ -46,12 +45,9 @@ func getGenAiClient() *genai.Client {
 }
 
 const (
-	geminiSessionContentLimit = 150
-	geminiMemoriesLimit       = 60
+	geminiMemoriesLimit = 60
 )
 
-var geminiModel = "gemini-3-flash-preview"
-
 type geminiTopic struct {
 	chatId  int64
 	topicId int64
@@ -72,6 +68,9 @@ func IsGeminiReq(msg *gotgbot.Message) bool {
 	if strings.HasPrefix(text, "/") {
 		return false
 	}
+	if isPrivateChat(msg) {
+		return g.GetConfig().AIPrivateMode
+	}
 	if strings.Contains(text, "@"+mainBot.Username) {
 		return true
 	}
@@ -107,13 +106,21 @@ func getSysPrompt(msg *gotgbot.Message) *Replacer {
 }
 
 func GeminiReply(bot *gotgbot.Bot, ctx *ext.Context) error {
-	if !slices.Contains(g.GetConfig().AIChats, ctx.EffectiveChat.Id) {
-		return nil
-	}
+	return geminiReply(bot, ctx, "")
+}
+
+// geminiReply modelOverride 不为空时忽略聊天配置中的模型
+func geminiReply(bot *gotgbot.Bot, ctx *ext.Context, modelOverride string) error {
 	msg := ctx.EffectiveMessage
 	topic := newTopic(msg)
 	genCtx, cancel := context.WithTimeout(context.Background(), time.Minute*15)
 	defer cancel()
+	if !aiEnabled(genCtx, msg.Chat.Id) {
+		if isPrivateChat(msg) && g.GetConfig().AIPrivateMode {
+			return replyPrivateAIDisabled(bot, msg)
+		}
+		return nil
+	}
 	text := msg.GetText()
 	ignoreSessionTimeout := false
 	replySessionId := int64(0)
@@ -122,10 +129,26 @@ func GeminiReply(bot *gotgbot.Bot, ctx *ext.Context) error {
 	} else if found := reReplyToSession.FindString(text); found != "" {
 		replySessionId, _ = strconv.ParseInt(found[1:], 10, 64)
 	}
+	userId := msg.GetSender().Id()
+	if quotaMsg, err := checkQuota(genCtx, msg.Chat.Id, userId, time.Now()); err != nil {
+		log.Warn("check gemini quota", "chat_id", msg.Chat.Id, "user_id", userId, "err", err)
+	} else if quotaMsg != "" {
+		_, err = msg.Reply(bot, quotaMsg, nil)
+		return err
+	}
+	release, ok, err := waitReplyTurn(genCtx, bot, msg)
+	if !ok {
+		return err
+	}
+	defer release()
 	session := GeminiGetSession(genCtx, msg, false, ignoreSessionTimeout, replySessionId)
 	if session == nil {
 		return nil
 	}
+	if session.Frozen {
+		_, err := msg.Reply(bot, fmt.Sprintf("会话 #%d 已被管理员锁定，请使用 /new_session 开启新会话", session.ID), nil)
+		return err
+	}
 	if len(session.Memories) == 0 {
 		memories, err := g.Q.ListGeminiMemory(genCtx, topic.chatId, topic.topicId, 30)
 		if err != nil {
@@ -146,11 +169,11 @@ func GeminiReply(bot *gotgbot.Bot, ctx *ext.Context) error {
 		sysPromptCtx.Memories = append(sysPromptCtx.Memories, mem.Content)
 	}
 	sysPrompt := getSysPrompt(msg).Replace(&sysPromptCtx)
-	config := &genai.GenerateContentConfig{
-		SystemInstruction: genai.NewContentFromText(sysPrompt, genai.RoleModel),
-		Tools: []*genai.Tool{
-			{GoogleSearch: &genai.GoogleSearch{}},
-		},
+	setting := getChatSettings(genCtx, topic)
+	// 会话压缩使用聊天设置的模型，不使用 /imagine 等命令指定的模型
+	compactModel := textModel(setting.Model)
+	if modelOverride != "" {
+		setting.Model = modelOverride
 	}
 	if err := session.AddTgMessage(bot, ctx.EffectiveMessage.ReplyToMessage); err != nil {
 		return err
@@ -158,14 +181,12 @@ func GeminiReply(bot *gotgbot.Bot, ctx *ext.Context) error {
 	if err := session.AddTgMessage(bot, ctx.EffectiveMessage); err != nil {
 		return err
 	}
-	if session.AllowCodeExecution {
-		config.Tools[0].CodeExecution = &genai.ToolCodeExecution{}
-	}
+	config := buildGenerateConfig(&setting, sysPrompt, session.AllowCodeExecution)
 	defer session.DiscardTmpUpdates()
 
 	actionCancel := h.WithChatAction(bot, "typing", msg.Chat.Id, msg.MessageThreadId, msg.IsTopicMessage)
 	defer actionCancel()
-	res, err := generate(genCtx, session, config)
+	res, err := generate(genCtx, setting.Model, session, config)
 	actionCancel()
 	if err != nil {
 		setReaction(bot, msg, "😭")
@@ -178,8 +199,12 @@ func GeminiReply(bot *gotgbot.Bot, ctx *ext.Context) error {
 		int64(res.UsageMetadata.CandidatesTokenCount+res.UsageMetadata.ThoughtsTokenCount),
 		session.ID,
 	)
+	if err := recordUsage(genCtx, msg.Chat.Id, userId, setting.Model, res.UsageMetadata); err != nil {
+		log.Warn("record gemini usage", "chat_id", msg.Chat.Id, "user_id", userId, "err", err)
+	}
 	aiText := res.Text()
-	if aiText == "" {
+	images := responseImages(res)
+	if aiText == "" && len(images) == 0 {
 		aiText = "模型没有返回任何信息"
 		if res.PromptFeedback != nil {
 			aiText += "，原因: " + string(res.PromptFeedback.BlockReason) + res.PromptFeedback.BlockReasonMessage
@@ -188,28 +213,44 @@ func GeminiReply(bot *gotgbot.Bot, ctx *ext.Context) error {
 		session.DiscardTmpUpdates()
 	}
 	aiText = reLabelHeader.ReplaceAllString(aiText, "")
-	normTxt, err := mdnormalizer.Normalize(aiText)
-	var respMsg *gotgbot.Message
-	if err != nil {
-		respMsg, err = ctx.EffectiveMessage.Reply(bot, aiText, nil)
-		log.Warn("parse markdown failed", "err", err)
-	} else {
-		respMsg, err = ctx.EffectiveMessage.Reply(bot, normTxt.Text, &gotgbot.SendMessageOpts{Entities: normTxt.Entities})
+	if strings.TrimSpace(aiText) != "" {
+		normTxt, err := mdnormalizer.Normalize(aiText)
+		var respMsg *gotgbot.Message
+		if err != nil {
+			respMsg, err = ctx.EffectiveMessage.Reply(bot, aiText, nil)
+			log.Warn("parse markdown failed", "err", err)
+		} else {
+			respMsg, err = ctx.EffectiveMessage.Reply(bot, normTxt.Text, &gotgbot.SendMessageOpts{Entities: normTxt.Entities})
+		}
+		if err != nil {
+			j, _ := res.MarshalJSON()
+			log.Warn("gemini response", "resp", string(j), "err", err)
+			return err
+		}
+		err = session.AddTgMessage(bot, respMsg)
+		if err != nil {
+			return err
+		}
 	}
-	if err != nil {
-		j, _ := res.MarshalJSON()
-		log.Warn("gemini response", "resp", string(j), "err", err)
-		return err
+	asSticker := replyAsSticker(msg)
+	for _, img := range images {
+		imgMsg, err := sendGeneratedImage(bot, msg, img, asSticker)
+		if err != nil {
+			log.Warn("send generated image", "err", err)
+			return err
+		}
+		if err = session.AddGeneratedImage(genCtx, imgMsg, img); err != nil {
+			return err
+		}
 	}
-	err = session.AddTgMessage(bot, respMsg)
-	if err != nil {
+	if err = session.PersistTmpUpdates(genCtx); err != nil {
 		return err
 	}
-	return session.PersistTmpUpdates(genCtx)
+	compactSessionAsync(session, compactModel, userId, sessionTokenEstimate(res.UsageMetadata))
+	return nil
 }
 
-func generate(ctx context.Context, session *GeminiSession, config *genai.GenerateContentConfig) (res *genai.GenerateContentResponse, err error) {
-	client := getGenAiClient()
+func generate(ctx context.Context, model string, session *GeminiSession, config *genai.GenerateContentConfig) (res *genai.GenerateContentResponse, err error) {
 	base := 3.0
 	jitter := 0.1
 	multiplier := 1.5
@@ -245,7 +286,7 @@ func generate(ctx context.Context, session *GeminiSession, config *genai.Generat
 			err = ctx.Err()
 			break
 		}
-		res, err = client.Models.GenerateContent(ctx, geminiModel, session.ToGenaiContents(), config)
+		res, err = llm.GenerateContent(ctx, model, session.ToGenaiContents(), config)
 		if err != nil {
 			wait()
 			continue
@@ -253,7 +294,7 @@ func generate(ctx context.Context, session *GeminiSession, config *genai.Generat
 		if res.PromptFeedback != nil {
 			return
 		}
-		if res.Text() == "" {
+		if res.Text() == "" && len(responseImages(res)) == 0 {
 			wait()
 			continue
 		}
@@ -267,16 +308,3 @@ func Init(bot *gotgbot.Bot, logger *slog.Logger) {
 	mainBot = bot
 	log = logger
 }
-
-func ChangeGeminiModel(bot *gotgbot.Bot, ctx *ext.Context) error {
-	const flashLite = "gemini-3.1-flash-lite-preview"
-	const flash = "gemini-3-flash-preview"
-	oldModel := geminiModel
-	if geminiModel == flashLite {
-		geminiModel = flash
-	} else {
-		geminiModel = flashLite
-	}
-	_, err := ctx.EffectiveMessage.Reply(bot, fmt.Sprintf("model: %s => %s", oldModel, geminiModel), nil)
-	return err
-}
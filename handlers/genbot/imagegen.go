@@ -0,0 +1,80 @@
+package genbot
+
+import (
+	"bytes"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"main/helpers/imgproc"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"google.golang.org/genai"
+)
+
+const geminiImageModel = "gemini-2.5-flash-image"
+
+// isImageModel 图片模型可以输出图片，但不支持搜索、代码执行等工具
+func isImageModel(model string) bool {
+	return strings.Contains(model, "-image")
+}
+
+// textModel 只需要输出文字的任务（翻译、摘要、会话压缩）不使用图片模型，换成默认模型
+func textModel(model string) string {
+	if isImageModel(model) {
+		return q.DefaultGeminiModel
+	}
+	return model
+}
+
+// responseImages 返回模型回复中的所有图片
+func responseImages(res *genai.GenerateContentResponse) []*genai.Blob {
+	if res == nil || len(res.Candidates) == 0 || res.Candidates[0].Content == nil {
+		return nil
+	}
+	var images []*genai.Blob
+	for _, part := range res.Candidates[0].Content.Parts {
+		if part.InlineData != nil && strings.HasPrefix(part.InlineData.MIMEType, "image/") {
+			images = append(images, part.InlineData)
+		}
+	}
+	return images
+}
+
+// replyAsSticker 用户要求编辑贴纸时，以贴纸的形式返回结果
+func replyAsSticker(msg *gotgbot.Message) bool {
+	return msg.ReplyToMessage != nil && msg.ReplyToMessage.Sticker != nil &&
+		!msg.ReplyToMessage.Sticker.IsAnimated && !msg.ReplyToMessage.Sticker.IsVideo
+}
+
+func sendGeneratedImage(bot *gotgbot.Bot, msg *gotgbot.Message, img *genai.Blob, asSticker bool) (*gotgbot.Message, error) {
+	reply := &gotgbot.ReplyParameters{MessageId: msg.MessageId}
+	if asSticker {
+		data, err := imgproc.ToStickerWebp(img.Data)
+		if err == nil {
+			return bot.SendSticker(msg.Chat.Id, gotgbot.InputFileByReader("sticker.webp", bytes.NewReader(data)), &gotgbot.SendStickerOpts{
+				MessageThreadId: msg.MessageThreadId,
+				ReplyParameters: reply,
+			})
+		}
+		log.Warn("convert generated image to sticker", "err", err)
+	}
+	ext := ".png"
+	if img.MIMEType == "image/jpeg" {
+		ext = ".jpg"
+	}
+	return bot.SendPhoto(msg.Chat.Id, gotgbot.InputFileByReader("image"+ext, bytes.NewReader(img.Data)), &gotgbot.SendPhotoOpts{
+		MessageThreadId: msg.MessageThreadId,
+		ReplyParameters: reply,
+	})
+}
+
+// Imagine 使用图片模型回复，回复图片或贴纸时会将其作为原图进行编辑
+func Imagine(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if h.TrimCmd(msg.GetText()) == "" && msg.ReplyToMessage == nil && msg.Photo == nil {
+		_, err := msg.Reply(bot, "用法: /imagine <描述>\n回复一张图片或贴纸可以对其进行编辑", nil)
+		return err
+	}
+	return geminiReply(bot, ctx, geminiImageModel)
+}
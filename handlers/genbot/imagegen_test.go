@@ -0,0 +1,37 @@
+package genbot
+
+import (
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"google.golang.org/genai"
+)
+
+func TestResponseImages(t *testing.T) {
+	res := &genai.GenerateContentResponse{Candidates: []*genai.Candidate{{Content: &genai.Content{Parts: []*genai.Part{
+		{Text: "here you are"},
+		{InlineData: &genai.Blob{MIMEType: "image/png", Data: []byte{1}}},
+		{InlineData: &genai.Blob{MIMEType: "audio/wav", Data: []byte{2}}},
+	}}}}}
+	images := responseImages(res)
+	if len(images) != 1 || images[0].MIMEType != "image/png" {
+		t.Fatalf("unexpected images: %+v", images)
+	}
+	if responseImages(&genai.GenerateContentResponse{}) != nil {
+		t.Fatal("empty response should have no images")
+	}
+}
+
+func TestReplyAsSticker(t *testing.T) {
+	msg := &gotgbot.Message{ReplyToMessage: &gotgbot.Message{Sticker: &gotgbot.Sticker{}}}
+	if !replyAsSticker(msg) {
+		t.Fatal("editing a static sticker should reply with a sticker")
+	}
+	msg.ReplyToMessage.Sticker.IsVideo = true
+	if replyAsSticker(msg) {
+		t.Fatal("video sticker cannot be regenerated as sticker")
+	}
+	if replyAsSticker(&gotgbot.Message{}) {
+		t.Fatal("plain message should reply with photo")
+	}
+}
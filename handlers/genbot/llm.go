@@ -0,0 +1,56 @@
+package genbot
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/genai"
+)
+
+// LLMProvider 对模型接口的抽象，所有生成请求都经由 llm 发出，测试时可以替换为离线实现
+type LLMProvider interface {
+	GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error)
+	CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error)
+}
+
+var (
+	geminiRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_requests_total", Help: "Gemini 接口调用次数"}, []string{"method", "model"})
+	geminiErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "gemini_request_errors_total", Help: "Gemini 接口调用失败次数"}, []string{"method", "model"})
+	geminiDurations = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "gemini_request_duration_seconds", Help: "Gemini 接口调用耗时",
+		Buckets: append(prometheus.DefBuckets, 30, 60, 120)}, []string{"method", "model"})
+)
+
+// observeGemini 记录一次调用，返回的函数在调用结束时传入错误
+func observeGemini(method, model string) func(error) {
+	start := time.Now()
+	geminiRequests.WithLabelValues(method, model).Inc()
+	return func(err error) {
+		geminiDurations.WithLabelValues(method, model).Observe(time.Since(start).Seconds())
+		if err != nil {
+			geminiErrors.WithLabelValues(method, model).Inc()
+		}
+	}
+}
+
+type genaiProvider struct{}
+
+func (genaiProvider) GenerateContent(ctx context.Context, model string, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	done := observeGemini("generate_content", model)
+	res, err := getGenAiClient().Models.GenerateContent(ctx, model, contents, config)
+	done(err)
+	return res, err
+}
+
+func (genaiProvider) CountTokens(ctx context.Context, model string, contents []*genai.Content, config *genai.CountTokensConfig) (*genai.CountTokensResponse, error) {
+	done := observeGemini("count_tokens", model)
+	res, err := getGenAiClient().Models.CountTokens(ctx, model, contents, config)
+	done(err)
+	return res, err
+}
+
+var llm LLMProvider = genaiProvider{}
@@ -0,0 +1,123 @@
+package genbot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+const (
+	maxVideoSize    = 15 * 1024 * 1024
+	maxVideoSeconds = 240
+	maxAudioSize    = 20 * 1024 * 1024
+	maxAudioSeconds = 10 * 60
+	maxDocumentSize = 20 * 1024 * 1024
+)
+
+// tgMedia 描述一条Telegram消息中可以交给模型理解的媒体
+type tgMedia struct {
+	msgType  string
+	fileId   string
+	mimeType string
+}
+
+// 模型可以直接理解的文档类型，其余文档只保留文件名
+var supportedDocumentMime = []string{
+	"application/pdf",
+	"application/json",
+	"text/",
+	"image/png",
+	"image/jpeg",
+	"image/webp",
+	"audio/",
+	"video/",
+}
+
+func isSupportedDocument(mimeType string) bool {
+	for _, m := range supportedDocumentMime {
+		if mimeType == m || strings.HasSuffix(m, "/") && strings.HasPrefix(mimeType, m) {
+			return true
+		}
+	}
+	return false
+}
+
+// normalizeDocumentMime 将文本类文档统一为text/plain，避免模型不认识text/x-go等类型
+func normalizeDocumentMime(mimeType string) string {
+	if strings.HasPrefix(mimeType, "text/") || mimeType == "application/json" {
+		return "text/plain"
+	}
+	return mimeType
+}
+
+// tgMsgMedia 从消息中提取媒体。note 为需要附加到消息文本中的说明，
+// 无法上传的媒体返回nil，并在 note 中说明原因。
+func tgMsgMedia(msg *gotgbot.Message) (media *tgMedia, note string) {
+	switch {
+	case msg.Photo != nil:
+		return &tgMedia{msgType: "photo", fileId: msg.Photo[len(msg.Photo)-1].FileId, mimeType: "image/jpeg"}, ""
+	case msg.Sticker != nil:
+		sticker := msg.Sticker
+		if sticker.IsAnimated {
+			return nil, fmt.Sprintf("(用户发送了一个%s的动画sticker，但无法渲染)", sticker.Emoji)
+		}
+		if sticker.IsVideo {
+			return &tgMedia{msgType: "sticker", fileId: sticker.FileId, mimeType: "video/webm"}, ""
+		}
+		return &tgMedia{msgType: "sticker", fileId: sticker.FileId, mimeType: "image/webp"}, ""
+	case msg.Video != nil:
+		video := msg.Video
+		if video.Duration > maxVideoSeconds || video.FileSize > maxVideoSize {
+			return nil, "(用户发送了一个视频，但由于不满足 size<15MB且时长<=240s，无法上传)"
+		}
+		return &tgMedia{msgType: "video", fileId: video.FileId, mimeType: "video/mp4"}, ""
+	case msg.Animation != nil:
+		ani := msg.Animation
+		if ani.Duration > maxVideoSeconds || ani.FileSize > maxVideoSize {
+			return nil, "(用户发送了一个GIF动图，但由于不满足 size<15MB且时长<=240s，无法上传)"
+		}
+		return &tgMedia{msgType: "video", fileId: ani.FileId, mimeType: "video/mp4"}, ""
+	case msg.VideoNote != nil:
+		note := msg.VideoNote
+		if note.Duration > maxVideoSeconds || note.FileSize > maxVideoSize {
+			return nil, "(用户发送了一个圆形视频，但由于不满足 size<15MB且时长<=240s，无法上传)"
+		}
+		return &tgMedia{msgType: "video_note", fileId: note.FileId, mimeType: "video/mp4"}, ""
+	case msg.Voice != nil:
+		voice := msg.Voice
+		if voice.Duration > maxAudioSeconds || voice.FileSize > maxAudioSize {
+			return nil, fmt.Sprintf("(用户发送了一条%d秒的语音，但由于不满足 size<20MB且时长<=10分钟，无法上传)", voice.Duration)
+		}
+		mimeType := voice.MimeType
+		if mimeType == "" {
+			mimeType = "audio/ogg"
+		}
+		return &tgMedia{msgType: "voice", fileId: voice.FileId, mimeType: mimeType}, ""
+	case msg.Audio != nil:
+		audio := msg.Audio
+		desc := strings.TrimSpace(audio.Performer + " - " + audio.Title)
+		if desc == "-" {
+			desc = audio.FileName
+		}
+		if audio.Duration > maxAudioSeconds || audio.FileSize > maxAudioSize {
+			return nil, fmt.Sprintf("(用户发送了音频《%s》，但由于不满足 size<20MB且时长<=10分钟，无法上传)", desc)
+		}
+		mimeType := audio.MimeType
+		if mimeType == "" {
+			mimeType = "audio/mpeg"
+		}
+		return &tgMedia{msgType: "audio", fileId: audio.FileId, mimeType: mimeType}, fmt.Sprintf("(音频: %s)", desc)
+	case msg.Document != nil:
+		doc := msg.Document
+		if !isSupportedDocument(doc.MimeType) {
+			return nil, fmt.Sprintf("(用户发送了文件 %s，类型 %s 暂不支持阅读)", doc.FileName, doc.MimeType)
+		}
+		if doc.FileSize > maxDocumentSize {
+			return nil, fmt.Sprintf("(用户发送了文件 %s，但文件超过20MB，无法上传)", doc.FileName)
+		}
+		return &tgMedia{msgType: "document", fileId: doc.FileId, mimeType: normalizeDocumentMime(doc.MimeType)},
+			fmt.Sprintf("(文件: %s)", doc.FileName)
+	}
+	return nil, ""
+}
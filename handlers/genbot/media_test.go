@@ -0,0 +1,40 @@
+package genbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestTgMsgMedia(t *testing.T) {
+	cases := []struct {
+		name     string
+		msg      gotgbot.Message
+		mimeType string // 为空时表示不应上传
+		note     string
+	}{
+		{"voice", gotgbot.Message{Voice: &gotgbot.Voice{FileId: "v", Duration: 30}}, "audio/ogg", ""},
+		{"long voice", gotgbot.Message{Voice: &gotgbot.Voice{FileId: "v", Duration: 3600}}, "", "3600秒的语音"},
+		{"audio", gotgbot.Message{Audio: &gotgbot.Audio{FileId: "a", Duration: 200, MimeType: "audio/flac", Title: "song", Performer: "singer"}}, "audio/flac", "singer - song"},
+		{"video note", gotgbot.Message{VideoNote: &gotgbot.VideoNote{FileId: "n", Duration: 20}}, "video/mp4", ""},
+		{"pdf", gotgbot.Message{Document: &gotgbot.Document{FileId: "d", FileName: "a.pdf", MimeType: "application/pdf"}}, "application/pdf", "a.pdf"},
+		{"source code", gotgbot.Message{Document: &gotgbot.Document{FileId: "d", FileName: "a.go", MimeType: "text/x-go"}}, "text/plain", "a.go"},
+		{"zip", gotgbot.Message{Document: &gotgbot.Document{FileId: "d", FileName: "a.zip", MimeType: "application/zip"}}, "", "暂不支持"},
+		{"huge pdf", gotgbot.Message{Document: &gotgbot.Document{FileId: "d", FileName: "b.pdf", MimeType: "application/pdf", FileSize: 50 << 20}}, "", "超过20MB"},
+		{"animated sticker", gotgbot.Message{Sticker: &gotgbot.Sticker{FileId: "s", IsAnimated: true, Emoji: "😀"}}, "", "😀"},
+		{"text only", gotgbot.Message{Text: "hello"}, "", ""},
+	}
+	for _, c := range cases {
+		media, note := tgMsgMedia(&c.msg)
+		if c.mimeType == "" && media != nil {
+			t.Errorf("%s: should not upload media, got %+v", c.name, media)
+		}
+		if c.mimeType != "" && (media == nil || media.mimeType != c.mimeType) {
+			t.Errorf("%s: expected mime %s, got %+v", c.name, c.mimeType, media)
+		}
+		if !strings.Contains(note, c.note) || (c.note == "" && note != "") {
+			t.Errorf("%s: unexpected note %q", c.name, note)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package genbot
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"main/helpers/lrusf"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	defaultInviteUses = 1
+	defaultInviteDays = 7
+)
+
+var errInvalidInviteCode = errors.New("邀请码无效、已过期或已被用完")
+
+// privateAIAllowed 用户是否可以私聊使用AI，白名单来自配置文件和邀请码
+func privateAIAllowed(ctx context.Context, userId int64) bool {
+	cfg := g.GetConfig()
+	if userId == cfg.God || slices.Contains(cfg.AIPrivateUsers, userId) {
+		return true
+	}
+	_, err := g.Q.GetGeminiPrivateUser(ctx, userId)
+	return err == nil
+}
+
+// aiEnabled 群聊需要在 AIChats 中，私聊需要开启私聊模式并且用户在白名单中。
+// 私聊的 chat_id 就是用户ID，所以会话、系统提示词和记忆天然按用户隔离
+func aiEnabled(ctx context.Context, chatId int64) bool {
+	if chatId > 0 {
+		return g.GetConfig().AIPrivateMode && privateAIAllowed(ctx, chatId)
+	}
+	return slices.Contains(g.GetConfig().AIChats, chatId)
+}
+
+func isPrivateChat(msg *gotgbot.Message) bool {
+	return msg.Chat.Type == gotgbot.ChatTypePrivate
+}
+
+// isGeminiAdmin 群组中需要是管理员，私聊中开通了私聊AI的用户是自己会话的管理员
+func isGeminiAdmin(bot *gotgbot.Bot, msg *gotgbot.Message) bool {
+	return isChatGeminiAdmin(bot, &msg.Chat, msg.GetSender().Id())
+}
+
+// isChatGeminiAdmin 与 isGeminiAdmin 相同。按钮回调中消息的发送者是机器人，需要传入点击按钮的用户
+func isChatGeminiAdmin(bot *gotgbot.Bot, chat *gotgbot.Chat, userId int64) bool {
+	if userId == g.GetConfig().God {
+		return true
+	}
+	if chat.Type == gotgbot.ChatTypePrivate {
+		return aiEnabled(context.Background(), chat.Id)
+	}
+	return h.IsChatAdmin(bot, chat, userId)
+}
+
+func newInviteCode() string {
+	buf := make([]byte, 6)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// redeemInviteCode 使用邀请码加入私聊AI白名单，已经在白名单中的用户不消耗邀请码
+func redeemInviteCode(ctx context.Context, code string, userId int64, now time.Time) (err error) {
+	if privateAIAllowed(ctx, userId) {
+		return nil
+	}
+	tx, err := g.RawMainDb().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	qtx := g.Q.WithTx(tx)
+	n, err := qtx.UseGeminiInviteCode(ctx, code, q.UnixTime{Time: now})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		err = errInvalidInviteCode
+		return err
+	}
+	if err = qtx.AddGeminiPrivateUser(ctx, userId, code, 0, q.UnixTime{Time: now}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// 未开通私聊AI的用户只提示一次，之后的消息直接忽略
+var privateDisabledNoticed = lrusf.NewCache[int64, bool](1024, id2str, nil).Named("private_ai_noticed")
+
+// replyPrivateAIDisabled 先经过频率限制，再对每个用户最多提示一次如何开通
+func replyPrivateAIDisabled(bot *gotgbot.Bot, msg *gotgbot.Message) error {
+	userId := msg.GetSender().Id()
+	if delay, _ := reserveGeminiRequest(msg.Chat.Id, userId, time.Now()); delay > 0 {
+		return nil
+	}
+	if !markPrivateDisabledNoticed(userId) {
+		return nil
+	}
+	_, err := msg.Reply(bot, "你还没有开通私聊AI，请向管理员索要邀请码后使用 /ai_join 邀请码 开通", nil)
+	return err
+}
+
+// markPrivateDisabledNoticed 第一次调用时返回 true
+func markPrivateDisabledNoticed(userId int64) bool {
+	rateMu.Lock()
+	defer rateMu.Unlock()
+	if _, ok := privateDisabledNoticed.TryGet(userId); ok {
+		return false
+	}
+	privateDisabledNoticed.Add(userId, true)
+	return true
+}
+
+// CreateGeminiInvite 生成私聊AI邀请码，参数为可使用次数和有效天数（仅God）
+func CreateGeminiInvite(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	userId := msg.GetSender().Id()
+	if userId != g.GetConfig().God {
+		return nil
+	}
+	args := strings.Fields(h.TrimCmd(msg.GetText()))
+	uses, days := int64(defaultInviteUses), int64(defaultInviteDays)
+	var err error
+	if len(args) > 0 {
+		uses, err = strconv.ParseInt(args[0], 10, 64)
+	}
+	if err == nil && len(args) > 1 {
+		days, err = strconv.ParseInt(args[1], 10, 64)
+	}
+	if err != nil || uses <= 0 || days <= 0 {
+		_, err = msg.Reply(bot, fmt.Sprintf("用法: /ai_invite [可使用次数，默认%d] [有效天数，默认%d]", defaultInviteUses, defaultInviteDays), nil)
+		return err
+	}
+	now := time.Now()
+	code := newInviteCode()
+	err = g.Q.CreateGeminiInviteCode(context.Background(), q.CreateGeminiInviteCodeParams{
+		Code:      code,
+		CreatedBy: userId,
+		MaxUses:   uses,
+		CreatedAt: q.UnixTime{Time: now},
+		ExpiresAt: q.UnixTime{Time: now.AddDate(0, 0, int(days))},
+	})
+	if err != nil {
+		return err
+	}
+	_, err = msg.Reply(bot, fmt.Sprintf("邀请码: %s\n可使用%d次，%d天内有效。\n私聊 @%s 发送 /ai_join %s 即可开通私聊AI",
+		code, uses, days, bot.Username, code), nil)
+	return err
+}
+
+// JoinGeminiPrivate 在私聊中使用邀请码开通私聊AI
+func JoinGeminiPrivate(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !isPrivateChat(msg) {
+		_, err := msg.Reply(bot, "请私聊bot使用邀请码", nil)
+		return err
+	}
+	if !g.GetConfig().AIPrivateMode {
+		_, err := msg.Reply(bot, "私聊AI模式未开启", nil)
+		return err
+	}
+	code := strings.TrimSpace(h.TrimCmd(msg.GetText()))
+	if code == "" {
+		_, err := msg.Reply(bot, "用法: /ai_join 邀请码", nil)
+		return err
+	}
+	err := redeemInviteCode(context.Background(), code, msg.GetSender().Id(), time.Now())
+	if errors.Is(err, errInvalidInviteCode) {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	} else if err != nil {
+		return err
+	}
+	_, err = msg.Reply(bot, "已开通私聊AI，直接发送消息即可开始对话。\n/sysprompt 与记忆只对你自己的私聊生效，不会出现在群聊中。", nil)
+	return err
+}
+
+// ManageGeminiPrivateUsers 管理私聊AI白名单（仅God）
+// /ai_allow 列出白名单，/ai_allow 用户ID 或回复用户的消息添加，/ai_revoke 同理移除
+func ManageGeminiPrivateUsers(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if msg.GetSender().Id() != g.GetConfig().God {
+		return nil
+	}
+	c := context.Background()
+	revoke := strings.HasPrefix(msg.GetText(), "/ai_revoke")
+	var userId int64
+	if arg := strings.TrimSpace(h.TrimCmd(msg.GetText())); arg != "" {
+		var err error
+		if userId, err = strconv.ParseInt(arg, 10, 64); err != nil || userId <= 0 {
+			_, err = msg.Reply(bot, "用户ID格式错误", nil)
+			return err
+		}
+	} else if msg.ReplyToMessage != nil {
+		userId = msg.ReplyToMessage.GetSender().Id()
+	}
+	if userId == 0 {
+		if revoke {
+			_, err := msg.Reply(bot, "用法: /ai_revoke 用户ID，或回复用户的消息", nil)
+			return err
+		}
+		users, err := g.Q.ListGeminiPrivateUsers(c)
+		if err != nil {
+			return err
+		}
+		var sb strings.Builder
+		sb.WriteString("私聊AI白名单：\n")
+		for _, id := range g.GetConfig().AIPrivateUsers {
+			sb.WriteString(fmt.Sprintf("%s (%d) [配置文件]\n", authorName(c, id), id))
+		}
+		for _, u := range users {
+			source := "邀请码 " + u.InviteCode
+			if u.InviteCode == "" {
+				source = "管理员添加"
+			}
+			sb.WriteString(fmt.Sprintf("%s (%d) [%s]\n", authorName(c, u.UserID), u.UserID, source))
+		}
+		_, err = msg.Reply(bot, sb.String(), nil)
+		return err
+	}
+	if revoke {
+		n, err := g.Q.DeleteGeminiPrivateUser(c, userId)
+		if err != nil {
+			return err
+		}
+		text := fmt.Sprintf("已移除 %d 的私聊AI权限", userId)
+		if n == 0 {
+			text = fmt.Sprintf("%d 不在数据库白名单中", userId)
+		}
+		_, err = msg.Reply(bot, text, nil)
+		return err
+	}
+	err := g.Q.AddGeminiPrivateUser(c, userId, "", msg.GetSender().Id(), q.UnixTime{Time: time.Now()})
+	if err != nil {
+		return err
+	}
+	_, err = msg.Reply(bot, fmt.Sprintf("已允许 %d 私聊使用AI", userId), nil)
+	return err
+}
@@ -0,0 +1,83 @@
+package genbot
+
+import (
+	"context"
+	"errors"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestRedeemInviteCode(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	const first, second = 20001, 20002
+	if !privateAIAllowed(ctx, 10001) {
+		t.Fatal("user in config allowlist should be allowed")
+	}
+	if privateAIAllowed(ctx, first) {
+		t.Fatal("unknown user should not be allowed")
+	}
+	for _, c := range []q.CreateGeminiInviteCodeParams{
+		{Code: "once", MaxUses: 1, CreatedAt: q.UnixTime{Time: now}, ExpiresAt: q.UnixTime{Time: now.Add(time.Hour)}},
+		{Code: "expired", MaxUses: 5, CreatedAt: q.UnixTime{Time: now}, ExpiresAt: q.UnixTime{Time: now.Add(-time.Hour)}},
+	} {
+		if err := g.Q.CreateGeminiInviteCode(ctx, c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := redeemInviteCode(ctx, "expired", first, now); !errors.Is(err, errInvalidInviteCode) {
+		t.Fatalf("expired code should be rejected, err=%v", err)
+	}
+	if err := redeemInviteCode(ctx, "once", first, now); err != nil {
+		t.Fatal(err)
+	}
+	if !privateAIAllowed(ctx, first) {
+		t.Fatal("user should be allowed after redeeming")
+	}
+	// 已经开通的用户不会再消耗邀请码
+	if err := redeemInviteCode(ctx, "once", first, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := redeemInviteCode(ctx, "once", second, now); !errors.Is(err, errInvalidInviteCode) {
+		t.Fatalf("used up code should be rejected, err=%v", err)
+	}
+	if privateAIAllowed(ctx, second) {
+		t.Fatal("failed redeem should not add user")
+	}
+	if n, err := g.Q.DeleteGeminiPrivateUser(ctx, first); err != nil || n != 1 || privateAIAllowed(ctx, first) {
+		t.Fatalf("revoke failed: %d %v", n, err)
+	}
+}
+
+func TestSessionIsolation(t *testing.T) {
+	ctx := context.Background()
+	const userId, groupId = 20003, -100666
+	private, err := g.Q.CreateNewGeminiSession(ctx, userId, "private", gotgbot.ChatTypePrivate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := &gotgbot.Message{Chat: gotgbot.Chat{Id: groupId, Type: gotgbot.ChatTypeSupergroup}, MessageId: 1}
+	sess := GeminiGetSession(ctx, msg, false, false, private.ID)
+	if sess == nil || sess.ID == private.ID || sess.ChatID != groupId {
+		t.Fatalf("group should not load private session, got %+v", sess)
+	}
+	msg.Chat = gotgbot.Chat{Id: userId, Type: gotgbot.ChatTypePrivate}
+	if sess = GeminiGetSession(ctx, msg, false, false, private.ID); sess == nil || sess.ID != private.ID {
+		t.Fatalf("private chat should load its own session, got %+v", sess)
+	}
+}
+
+func TestPrivateBlockedUser(t *testing.T) {
+	const blocked = 20004
+	msg := &gotgbot.Message{Chat: gotgbot.Chat{Id: blocked, Type: gotgbot.ChatTypePrivate}, From: &gotgbot.User{Id: blocked}}
+	if isGeminiAdmin(nil, msg) {
+		t.Fatal("user without private AI should not manage the private chat")
+	}
+	if !markPrivateDisabledNoticed(blocked) || markPrivateDisabledNoticed(blocked) {
+		t.Fatal("blocked user should be noticed only once")
+	}
+}
@@ -0,0 +1,172 @@
+package genbot
+
+import (
+	"errors"
+	"fmt"
+	"main/helpers/safetmpl"
+	"regexp"
+	"slices"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+const (
+	memoryListVar        = "MEMORY_LIST"
+	maxPromptOutputBytes = 64 << 10
+	promptRenderTimeout  = time.Second
+)
+
+var errPromptTooLong = fmt.Errorf("系统提示词渲染结果超过%dKB", maxPromptOutputBytes>>10)
+
+// 过大的宽度或精度会让 printf 分配大量内存
+var reWideVerb = regexp.MustCompile(`%[-+# 0]*(\d{4,}|\*|(\d*|\*)\.(\d{4,}|\*))`)
+
+var templateFuncs = template.FuncMap{
+	"contains":  strings.Contains,
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"lower":     strings.ToLower,
+	"upper":     strings.ToUpper,
+	"join":      strings.Join,
+	"add": func(a, b int) int {
+		return a + b
+	},
+	"printf": func(format string, args ...any) (string, error) {
+		if reWideVerb.MatchString(format) {
+			return "", errors.New("printf 的宽度和精度不能超过3位")
+		}
+		return fmt.Sprintf(format, args...), nil
+	},
+	"call": func(...any) (string, error) {
+		return "", errors.New("call is not allowed")
+	},
+}
+
+// 模板中以数字提供的变量，可以直接用 gt、lt 等比较
+var templateIntVars = map[string]func(ctx *ReplaceCtx) int64{
+	"MEMBER_COUNT": func(ctx *ReplaceCtx) int64 {
+		return getMemberCount(ctx.Bot, ctx.Msg.Chat.Id)
+	},
+	"TOPIC_ID": func(ctx *ReplaceCtx) int64 {
+		return topicIdOf(ctx.Msg)
+	},
+	"CHAT_ID": func(ctx *ReplaceCtx) int64 {
+		return ctx.Msg.Chat.Id
+	},
+	"MSG_ID": func(ctx *ReplaceCtx) int64 {
+		return ctx.Msg.MessageId
+	},
+	"SENDER_ID": func(ctx *ReplaceCtx) int64 {
+		return ctx.Msg.GetSender().Id()
+	},
+}
+
+func isTemplateVar(name string) bool {
+	_, ok := replaceMetaVar[name]
+	return ok || name == memoryListVar
+}
+
+func templateVar(name string, ctx *ReplaceCtx) any {
+	if name == memoryListVar {
+		if ctx.Memories == nil {
+			return []string{}
+		}
+		return ctx.Memories
+	}
+	if fn, ok := templateIntVars[name]; ok {
+		return fn(ctx)
+	}
+	return replaceMetaVar[name](ctx)
+}
+
+// collectTemplateVars 找出模板中用到的变量，只在渲染时计算用到的变量，避免多余的数据库和API请求
+func collectTemplateVars(node parse.Node, vars map[string]bool) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, c := range n.Nodes {
+			collectTemplateVars(c, vars)
+		}
+	case *parse.ActionNode:
+		collectTemplateVars(n.Pipe, vars)
+	case *parse.IfNode:
+		collectBranchVars(&n.BranchNode, vars)
+	case *parse.RangeNode:
+		collectBranchVars(&n.BranchNode, vars)
+	case *parse.WithNode:
+		collectBranchVars(&n.BranchNode, vars)
+	case *parse.TemplateNode:
+		collectTemplateVars(n.Pipe, vars)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			collectTemplateVars(cmd, vars)
+		}
+	case *parse.CommandNode:
+		for _, arg := range n.Args {
+			collectTemplateVars(arg, vars)
+		}
+	case *parse.ChainNode:
+		collectTemplateVars(n.Node, vars)
+	case *parse.FieldNode:
+		vars[n.Ident[0]] = true
+	case *parse.VariableNode:
+		// $.VAR 总是指向顶层数据
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			vars[n.Ident[1]] = true
+		}
+	}
+}
+
+func collectBranchVars(n *parse.BranchNode, vars map[string]bool) {
+	collectTemplateVars(n.Pipe, vars)
+	collectTemplateVars(n.List, vars)
+	collectTemplateVars(n.ElseList, vars)
+}
+
+// ParseReplacer 解析提示词，包含 {{ }} 时按模板解析并检查语法和变量名
+func ParseReplacer(tpl string) (Replacer, error) {
+	if !strings.Contains(tpl, "{{") {
+		return newFlatReplacer(tpl), nil
+	}
+	tmpl, err := template.New("sysprompt").Option("missingkey=error").Funcs(templateFuncs).Parse(tpl)
+	if err != nil {
+		return Replacer{}, err
+	}
+	if err = safetmpl.Check(tmpl, memoryListVar); err != nil {
+		return Replacer{}, err
+	}
+	used := map[string]bool{}
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			collectTemplateVars(t.Tree.Root, used)
+		}
+	}
+	vars := make([]string, 0, len(used))
+	for name := range used {
+		if !isTemplateVar(name) {
+			return Replacer{}, fmt.Errorf("未知变量 .%s", name)
+		}
+		vars = append(vars, name)
+	}
+	slices.Sort(vars)
+	return Replacer{tmpl: tmpl, tmplVars: vars}, nil
+}
+
+func (r *Replacer) executeTemplate(ctx *ReplaceCtx) (string, error) {
+	data := make(map[string]any, len(r.tmplVars))
+	for _, name := range r.tmplVars {
+		data[name] = templateVar(name, ctx)
+	}
+	out, err := safetmpl.Execute(r.tmpl, data, maxPromptOutputBytes, promptRenderTimeout)
+	if errors.Is(err, safetmpl.ErrOutputTooLong) {
+		err = errPromptTooLong
+	}
+	return out, err
+}
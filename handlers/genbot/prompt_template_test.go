@@ -0,0 +1,58 @@
+package genbot
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestTemplateConditionalsAndLoops(t *testing.T) {
+	r, err := ParseReplacer(`{{if eq .CHAT_TYPE "private"}}私聊{{else}}群聊{{.CHAT_NAME}}{{end}}|` +
+		`{{range $i, $m := .MEMORY_LIST}}{{add $i 1}}.{{$m}};{{else}}无记忆{{end}}|{{if gt .CHAT_ID 0}}正{{else}}负{{end}}|100%`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(r.tmplVars, ",") != "CHAT_ID,CHAT_NAME,CHAT_TYPE,MEMORY_LIST" {
+		t.Fatalf("unexpected used vars: %v", r.tmplVars)
+	}
+	ctx := testCtx(gotgbot.Chat{Id: -100, Title: "Test Group", Type: "supergroup"})
+	ctx.Memories = []string{"a", "b"}
+	if got := r.Replace(ctx); got != "群聊Test Group|1.a;2.b;|负|100%" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+	ctx = testCtx(gotgbot.Chat{Id: 1, Type: "private"})
+	if got := r.Replace(ctx); got != "私聊|无记忆|正|100%" {
+		t.Fatalf("unexpected result: %q", got)
+	}
+}
+
+func TestParseReplacerErrors(t *testing.T) {
+	for _, tpl := range []string{
+		"{{if .CHAT_TYPE}}未闭合",
+		"{{.UNKNOWN_VAR}}",
+		"{{$.NOPE}}",
+		"{{nofunc .CHAT_NAME}}",
+		"{{range 100000}}{{range 100000}}{{end}}{{end}}",
+		"{{range .MEMBER_COUNT}}{{end}}",
+		`{{define "x"}}{{.CHAT_NAME}}{{end}}{{template "x" .}}`,
+	} {
+		if _, err := ParseReplacer(tpl); err == nil {
+			t.Fatalf("%q should be rejected", tpl)
+		}
+	}
+	r, err := ParseReplacer(`{{printf "%0999999d" .CHAT_ID}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = r.Execute(testCtx(gotgbot.Chat{})); err == nil {
+		t.Fatal("wide printf should fail")
+	}
+}
+
+func TestNewReplacerFallsBackToFlat(t *testing.T) {
+	r := NewReplacer("{{broken %TIME%")
+	if got := r.Replace(testCtx(gotgbot.Chat{})); got != "{{broken 15:09:26" {
+		t.Fatalf("invalid template should be treated as flat text, got %q", got)
+	}
+}
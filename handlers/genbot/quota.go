@@ -0,0 +1,192 @@
+package genbot
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"google.golang.org/genai"
+)
+
+// usageLocation 用量按聊天的时区划分日期，私聊使用用户自己设置的时区
+func usageLocation(ctx context.Context, chatId int64) *time.Location {
+	if chatId > 0 {
+		if user, err := g.Q.GetUserById(ctx, chatId); err == nil {
+			return user.Location()
+		}
+	}
+	return g.Q.GetChatCfgByIdOrDefault(chatId).Location()
+}
+
+// usageDate 返回 t 在 loc 中的日期，与每日统计的 stat_date 相同
+func usageDate(t time.Time, loc *time.Location) int64 {
+	return q.StatDayOf(t.Unix(), loc)
+}
+
+func monthStart(t time.Time, loc *time.Location) time.Time {
+	t = t.In(loc)
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+}
+
+// checkQuota 检查聊天与用户的token预算，超出时返回给用户的提示，否则返回空字符串。
+// 只检查已经记录的用量，同时进行的请求都能通过检查，用量可能略微超出预算
+func checkQuota(ctx context.Context, chatId, userId int64, now time.Time) (string, error) {
+	quota := g.GetConfig().GeminiQuota
+	loc := usageLocation(ctx, chatId)
+	today := usageDate(now, loc)
+	month := usageDate(monthStart(now, loc), loc)
+	checks := []struct {
+		limit int64
+		since int64
+		get   func(ctx context.Context, id int64, usageDate int64) (int64, error)
+		id    int64
+		msg   string
+	}{
+		{quota.ChatDaily, today, g.Q.GetChatGeminiUsageSince, chatId, "本群今天的AI额度已经用完啦，明天再来吧~"},
+		{quota.ChatMonthly, month, g.Q.GetChatGeminiUsageSince, chatId, "本群这个月的AI额度已经用完啦，下个月再来吧~"},
+		{quota.UserDaily, today, g.Q.GetUserGeminiUsageSince, userId, "你今天的AI额度已经用完啦，休息一下明天再来吧~"},
+		{quota.UserMonthly, month, g.Q.GetUserGeminiUsageSince, userId, "你这个月的AI额度已经用完啦，下个月再来吧~"},
+	}
+	for _, c := range checks {
+		if c.limit <= 0 {
+			continue
+		}
+		used, err := c.get(ctx, c.id, c.since)
+		if err != nil {
+			return "", err
+		}
+		if used >= c.limit {
+			return c.msg, nil
+		}
+	}
+	return "", nil
+}
+
+func recordUsage(ctx context.Context, chatId, userId int64, model string, usage *genai.GenerateContentResponseUsageMetadata) error {
+	if usage == nil {
+		return nil
+	}
+	return g.Q.AddGeminiUsage(ctx, q.AddGeminiUsageParams{
+		ChatID:       chatId,
+		UserID:       userId,
+		Model:        model,
+		UsageDate:    usageDate(time.Now(), usageLocation(ctx, chatId)),
+		InputTokens:  int64(usage.PromptTokenCount),
+		OutputTokens: int64(usage.CandidatesTokenCount + usage.ThoughtsTokenCount),
+	})
+}
+
+// estimateCost 按配置中的价格表估算费用，未配置价格的模型返回false
+func estimateCost(model string, input, output int64) (float64, bool) {
+	quota := g.GetConfig().GeminiQuota
+	price, ok := quota.PriceOf(model)
+	if !ok {
+		return 0, false
+	}
+	return (float64(input)*price.Input + float64(output)*price.Output) / 1e6, true
+}
+
+type usageSum struct {
+	name   string
+	input  int64
+	output int64
+	cost   float64
+	priced bool // 是否所有用量都有对应的价格
+}
+
+func (u *usageSum) add(row q.ListChatGeminiUsageSinceRow) {
+	u.input += row.InputTokens
+	u.output += row.OutputTokens
+	cost, ok := estimateCost(row.Model, row.InputTokens, row.OutputTokens)
+	u.cost += cost
+	if !ok {
+		u.priced = false
+	}
+}
+
+func (u *usageSum) String() string {
+	costTxt := fmt.Sprintf("$%.4f", u.cost)
+	if !u.priced {
+		costTxt += "+"
+	}
+	return fmt.Sprintf("%s: 输入 %d / 输出 %d tokens，约 %s", u.name, u.input, u.output, costTxt)
+}
+
+// sortedUsage 按token总量从多到少排序
+func sortedUsage[K comparable](m map[K]*usageSum) []*usageSum {
+	res := make([]*usageSum, 0, len(m))
+	for _, v := range m {
+		res = append(res, v)
+	}
+	slices.SortFunc(res, func(a, b *usageSum) int {
+		return cmp.Compare(b.input+b.output, a.input+a.output)
+	})
+	return res
+}
+
+func formatUsageReport(ctx context.Context, title string, rows []q.ListChatGeminiUsageSinceRow) string {
+	total := &usageSum{name: "合计", priced: true}
+	byModel := make(map[string]*usageSum)
+	byUser := make(map[int64]*usageSum)
+	for _, row := range rows {
+		total.add(row)
+		if _, ok := byModel[row.Model]; !ok {
+			byModel[row.Model] = &usageSum{name: row.Model, priced: true}
+		}
+		byModel[row.Model].add(row)
+		if _, ok := byUser[row.UserID]; !ok {
+			user, _ := g.Q.GetUserById(ctx, row.UserID)
+			byUser[row.UserID] = &usageSum{name: fmt.Sprintf("%s(%d)", user.Name(), row.UserID), priced: true}
+		}
+		byUser[row.UserID].add(row)
+	}
+
+	buf := strings.Builder{}
+	buf.WriteString(title + "\n")
+	buf.WriteString(total.String() + "\n")
+	if len(rows) == 0 {
+		return buf.String()
+	}
+	buf.WriteString("按模型：\n")
+	for _, m := range sortedUsage(byModel) {
+		buf.WriteString("  " + m.String() + "\n")
+	}
+	buf.WriteString("按用户：\n")
+	for i, u := range sortedUsage(byUser) {
+		if i >= 10 {
+			buf.WriteString(fmt.Sprintf("  ……等共%d人\n", len(byUser)))
+			break
+		}
+		buf.WriteString("  " + u.String() + "\n")
+	}
+	return buf.String()
+}
+
+func GeminiUsage(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	c := context.Background()
+	now := time.Now()
+	loc := usageLocation(c, msg.Chat.Id)
+	today, err := g.Q.ListChatGeminiUsageSince(c, msg.Chat.Id, usageDate(now, loc))
+	if err != nil {
+		return err
+	}
+	month, err := g.Q.ListChatGeminiUsageSince(c, msg.Chat.Id, usageDate(monthStart(now, loc), loc))
+	if err != nil {
+		return err
+	}
+	text := formatUsageReport(c, "今日AI用量", today) + "\n" + formatUsageReport(c, "本月AI用量", month)
+	quota := g.GetConfig().GeminiQuota
+	text += fmt.Sprintf("\n预算(0为不限)：群 %d/日 %d/月，个人 %d/日 %d/月，日期按 %s 划分\n"+
+		"预算只在请求开始前检查，同时进行的请求可能略微超出预算\n费用带+表示部分模型未配置价格",
+		quota.ChatDaily, quota.ChatMonthly, quota.UserDaily, quota.UserMonthly, q.FormatTimezone(loc))
+	_, err = msg.Reply(bot, text, nil)
+	return err
+}
@@ -0,0 +1,76 @@
+package genbot
+
+import (
+	"context"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+func TestCheckQuota(t *testing.T) {
+	ctx := context.Background()
+	const chatId, userId = -100777, 777
+	now := time.Now()
+	if msg, err := checkQuota(ctx, chatId, userId, now); err != nil || msg != "" {
+		t.Fatalf("empty usage should pass, msg=%q err=%v", msg, err)
+	}
+	// 配置示例中用户每日预算为 500000
+	usage := &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 300000, CandidatesTokenCount: 100000}
+	if err := recordUsage(ctx, chatId, userId, "gemini-3-flash-preview", usage); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := checkQuota(ctx, chatId, userId, now); err != nil || msg != "" {
+		t.Fatalf("usage under budget should pass, msg=%q err=%v", msg, err)
+	}
+	if err := recordUsage(ctx, chatId, userId, "unknown-model", usage); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := checkQuota(ctx, chatId, userId, now)
+	if err != nil || !strings.Contains(msg, "你今天") {
+		t.Fatalf("user daily budget should be exhausted, msg=%q err=%v", msg, err)
+	}
+	if msg, err := checkQuota(ctx, chatId, userId+1, now); err != nil || msg != "" {
+		t.Fatalf("other user should not be affected, msg=%q err=%v", msg, err)
+	}
+}
+
+func TestUsageDateInChatTimezone(t *testing.T) {
+	ctx := context.Background()
+	const chatId, userId = -100778, 778
+	cfg := g.Q.GetChatCfgByIdOrDefault(chatId)
+	cfg.Timezone, cfg.TimezoneName = -10*3600, "Pacific/Honolulu"
+	if err := cfg.Save(ctx, g.Q); err != nil {
+		t.Fatal(err)
+	}
+	loc := usageLocation(ctx, chatId)
+	// UTC 已经是3月1日，檀香山还是2月29日
+	at := time.Date(2024, 3, 1, 5, 0, 0, 0, time.UTC)
+	if got := monthStart(at, loc); got.Month() != time.February || got.Day() != 1 {
+		t.Fatalf("month start should be in chat timezone, got %s", got)
+	}
+	usage := &genai.GenerateContentResponseUsageMetadata{PromptTokenCount: 1}
+	if err := recordUsage(ctx, chatId, userId, "gemini-3-flash-preview", usage); err != nil {
+		t.Fatal(err)
+	}
+	var day int64
+	if err := g.RawMainDb().QueryRowContext(ctx, "SELECT usage_date FROM gemini_usage WHERE chat_id = ?", chatId).Scan(&day); err != nil {
+		t.Fatal(err)
+	}
+	if want := q.StatDayOf(time.Now().Unix(), loc); day != want {
+		t.Fatalf("usage date %d, want %d", day, want)
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	cost, ok := estimateCost("gemini-3-flash-preview", 1_000_000, 1_000_000)
+	if !ok || cost != 3.5 {
+		t.Fatalf("unexpected cost %v %v", cost, ok)
+	}
+	if _, ok := estimateCost("unknown-model", 1, 1); ok {
+		t.Fatal("unknown model should not have price")
+	}
+}
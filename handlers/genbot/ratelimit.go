@@ -0,0 +1,155 @@
+package genbot
+
+import (
+	"context"
+	"fmt"
+	g "main/globalcfg"
+	"main/helpers/lrusf"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"golang.org/x/time/rate"
+)
+
+type rateEntry struct {
+	limiter *rate.Limiter
+	// 冷却期间只提示一次，避免刷屏的人把bot也带着刷屏
+	noticeUntil time.Time
+}
+
+func id2str(id int64) string {
+	return strconv.FormatInt(id, 10)
+}
+
+var (
+	userLimiters = lrusf.NewCache[int64, *rateEntry](2048, id2str, nil).Named("user_rate_limiter")
+	chatLimiters = lrusf.NewCache[int64, *rateEntry](256, id2str, nil).Named("chat_rate_limiter")
+	rateMu       sync.Mutex
+)
+
+func getRateEntry(cache *lrusf.Cache[int64, *rateEntry], id int64, perMinute float64, burst int) *rateEntry {
+	e, _ := cache.Get(id, func() (*rateEntry, error) {
+		return &rateEntry{limiter: rate.NewLimiter(rate.Limit(perMinute/60), burst)}, nil
+	})
+	return e
+}
+
+// reserveGeminiRequest 同时从用户和聊天的令牌桶取出一个令牌，任何一个不足时都不消耗令牌，
+// 返回需要等待的时间，以及本次冷却是否需要回复提示
+func reserveGeminiRequest(chatId, userId int64, now time.Time) (time.Duration, bool) {
+	cfg := g.GetConfig().GeminiRateLimit
+	rateMu.Lock()
+	defer rateMu.Unlock()
+	entries := []*rateEntry{
+		getRateEntry(userLimiters, userId, cfg.UserPerMinute, cfg.UserBurst),
+		getRateEntry(chatLimiters, chatId, cfg.ChatPerMinute, cfg.ChatBurst),
+	}
+	reservations := make([]*rate.Reservation, 0, len(entries))
+	for i, e := range entries {
+		r := e.limiter.ReserveN(now, 1)
+		reservations = append(reservations, r)
+		delay := r.DelayFrom(now)
+		if !r.OK() {
+			delay = time.Minute
+		}
+		if delay == 0 {
+			continue
+		}
+		for _, r := range reservations {
+			r.CancelAt(now)
+		}
+		notice := now.After(entries[i].noticeUntil)
+		if notice {
+			entries[i].noticeUntil = now.Add(delay)
+		}
+		return delay, notice
+	}
+	return 0, false
+}
+
+type replyQueue struct {
+	sem     chan struct{}
+	pending int
+}
+
+var replyQueues = struct {
+	mu sync.Mutex
+	m  map[geminiTopic]*replyQueue
+}{m: make(map[geminiTopic]*replyQueue)}
+
+// enterReplyQueue 加入话题的回复队列，返回排在前面的请求数，队列已满时返回 -1
+func enterReplyQueue(topic geminiTopic) (*replyQueue, int) {
+	replyQueues.mu.Lock()
+	defer replyQueues.mu.Unlock()
+	q, ok := replyQueues.m[topic]
+	if !ok {
+		q = &replyQueue{sem: make(chan struct{}, 1)}
+		replyQueues.m[topic] = q
+	}
+	ahead := q.pending
+	if ahead > g.GetConfig().GeminiRateLimit.MaxQueue {
+		return q, -1
+	}
+	q.pending++
+	return q, ahead
+}
+
+func leaveReplyQueue(topic geminiTopic, q *replyQueue, acquired bool) {
+	if acquired {
+		<-q.sem
+	}
+	replyQueues.mu.Lock()
+	defer replyQueues.mu.Unlock()
+	q.pending--
+	if q.pending == 0 {
+		delete(replyQueues.m, topic)
+	}
+}
+
+// checkRateLimit 检查频率限制，被限制时回复冷却提示并返回 ok=false
+func checkRateLimit(bot *gotgbot.Bot, msg *gotgbot.Message) (ok bool, err error) {
+	delay, notice := reserveGeminiRequest(msg.Chat.Id, msg.GetSender().Id(), time.Now())
+	if delay == 0 {
+		return true, nil
+	}
+	if !notice {
+		setReaction(bot, msg, "🥱")
+		return false, nil
+	}
+	_, err = msg.Reply(bot, fmt.Sprintf("说话太快啦，请 %d 秒后再试~", int(math.Ceil(delay.Seconds()))), nil)
+	return false, err
+}
+
+// waitReplyTurn 限制频率并按话题排队处理请求，返回的 release 需要在回复结束后调用。
+// 被限制或排队已满时会直接回复用户并返回 ok=false
+func waitReplyTurn(ctx context.Context, bot *gotgbot.Bot, msg *gotgbot.Message) (release func(), ok bool, err error) {
+	if ok, err = checkRateLimit(bot, msg); !ok {
+		return nil, false, err
+	}
+	topic := newTopic(msg)
+	q, ahead := enterReplyQueue(topic)
+	if ahead < 0 {
+		_, err = msg.Reply(bot, "排队的请求太多啦，请稍后再试~", nil)
+		return nil, false, err
+	}
+	var queueMsg *gotgbot.Message
+	if ahead > 0 {
+		queueMsg, err = msg.Reply(bot, fmt.Sprintf("排队中 #%d", ahead), nil)
+		if err != nil {
+			log.Warn("send queue position", "err", err)
+		}
+	}
+	select {
+	case q.sem <- struct{}{}:
+	case <-ctx.Done():
+		leaveReplyQueue(topic, q, false)
+		return nil, false, ctx.Err()
+	}
+	if queueMsg != nil {
+		_, _ = queueMsg.Delete(bot, nil)
+	}
+	return func() { leaveReplyQueue(topic, q, true) }, true, nil
+}
@@ -0,0 +1,59 @@
+package genbot
+
+import (
+	g "main/globalcfg"
+	"testing"
+	"time"
+)
+
+func TestReserveGeminiRequest(t *testing.T) {
+	cfg := g.GetConfig().GeminiRateLimit
+	now := time.Now()
+	const chatId, userId, other = -100888, 1001, 1002
+	for i := 0; i < cfg.UserBurst; i++ {
+		if delay, _ := reserveGeminiRequest(chatId, userId, now); delay != 0 {
+			t.Fatalf("request %d should be allowed, delay %v", i, delay)
+		}
+	}
+	delay, notice := reserveGeminiRequest(chatId, userId, now)
+	if delay <= 0 || !notice {
+		t.Fatalf("expected cooldown with notice, got %v %v", delay, notice)
+	}
+	if delay, notice = reserveGeminiRequest(chatId, userId, now); delay <= 0 || notice {
+		t.Fatalf("cooldown notice should only be sent once, got %v %v", delay, notice)
+	}
+	// 被用户限制的请求不应消耗聊天的令牌
+	for i := cfg.UserBurst; i < cfg.ChatBurst; i++ {
+		if delay, _ := reserveGeminiRequest(chatId, other+int64(i), now); delay != 0 {
+			t.Fatalf("chat request %d should be allowed, delay %v", i, delay)
+		}
+	}
+	if delay, _ := reserveGeminiRequest(chatId, other, now); delay <= 0 {
+		t.Fatal("chat bucket should be exhausted")
+	}
+	if delay, _ := reserveGeminiRequest(chatId, userId, now.Add(time.Hour)); delay != 0 {
+		t.Fatalf("bucket should be refilled, delay %v", delay)
+	}
+}
+
+func TestReplyQueue(t *testing.T) {
+	topic := geminiTopic{chatId: -100888, topicId: 3}
+	maxQueue := g.GetConfig().GeminiRateLimit.MaxQueue
+	queues := make([]*replyQueue, 0, maxQueue+1)
+	for i := 0; i <= maxQueue; i++ {
+		q, ahead := enterReplyQueue(topic)
+		if ahead != i {
+			t.Fatalf("expected position %d, got %d", i, ahead)
+		}
+		queues = append(queues, q)
+	}
+	if _, ahead := enterReplyQueue(topic); ahead != -1 {
+		t.Fatalf("queue should be full, got %d", ahead)
+	}
+	for _, q := range queues {
+		leaveReplyQueue(topic, q, false)
+	}
+	if _, ok := replyQueues.m[topic]; ok {
+		t.Fatal("empty queue should be removed")
+	}
+}
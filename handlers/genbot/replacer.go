@@ -2,8 +2,13 @@ package genbot
 
 import (
 	"bytes"
+	"context"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"main/helpers/lrusf"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 	"unicode"
 
@@ -18,6 +23,44 @@ type ReplaceCtx struct {
 	Memories []string
 }
 
+const memberCountTTL = time.Hour
+
+type memberCount struct {
+	count int64
+	at    time.Time
+}
+
+var memberCountCache = lrusf.NewCache[int64, memberCount](256, func(id int64) string {
+	return strconv.FormatInt(id, 10)
+}, nil).Named("member_count")
+
+func topicIdOf(msg *gotgbot.Message) int64 {
+	if msg.IsTopicMessage {
+		return msg.MessageThreadId
+	}
+	return 0
+}
+
+func getMemberCount(bot *gotgbot.Bot, chatId int64) int64 {
+	if c, ok := memberCountCache.TryGet(chatId); ok && time.Since(c.at) < memberCountTTL {
+		return c.count
+	}
+	count, err := bot.GetChatMemberCount(chatId, nil)
+	if err != nil {
+		return 0
+	}
+	memberCountCache.Add(chatId, memberCount{count: count, at: time.Now()})
+	return count
+}
+
+// senderLocation 发送者在 users 表中设置的时区，未知用户使用默认的东八区
+func senderLocation(msg *gotgbot.Message) *time.Location {
+	if user, err := g.Q.GetUserById(context.Background(), msg.GetSender().Id()); err == nil {
+		return user.Location()
+	}
+	return q.LoadTimezone("", q.DefaultTimezone)
+}
+
 func getChatName(chat gotgbot.Chat) string {
 	if chat.Title != "" {
 		return chat.Title
@@ -92,6 +135,26 @@ var replaceMetaVar = map[string]func(ctx *ReplaceCtx) string{
 		}
 		return ctx.Msg.Quote.Text
 	},
+	"TOPIC_ID": func(ctx *ReplaceCtx) string {
+		return strconv.FormatInt(topicIdOf(ctx.Msg), 10)
+	},
+	"TOPIC_NAME": func(ctx *ReplaceCtx) string {
+		topicId := topicIdOf(ctx.Msg)
+		if topicId == 0 {
+			return ""
+		}
+		name, _ := g.Q.GetChatTopicName(context.Background(), ctx.Msg.Chat.Id, topicId)
+		return name
+	},
+	"MEMBER_COUNT": func(ctx *ReplaceCtx) string {
+		return strconv.FormatInt(getMemberCount(ctx.Bot, ctx.Msg.Chat.Id), 10)
+	},
+	"SENDER_TIMEZONE": func(ctx *ReplaceCtx) string {
+		return ctx.Now.In(senderLocation(ctx.Msg)).Format("-07:00")
+	},
+	"SENDER_DATETIME": func(ctx *ReplaceCtx) string {
+		return ctx.Now.In(senderLocation(ctx.Msg)).Format("2006-01-02 15:04:05")
+	},
 	"MEMORIES": func(ctx *ReplaceCtx) string {
 		if len(ctx.Memories) == 0 {
 			return "当前没有记忆"
@@ -108,17 +171,29 @@ var replaceMetaVar = map[string]func(ctx *ReplaceCtx) string{
 
 type Replacer struct {
 	replaceFunc []func(ctx *ReplaceCtx) string
+	// 模板模式，包含 {{ }} 的提示词使用 text/template 渲染，此时不再处理 %VAR%
+	tmpl     *template.Template
+	tmplVars []string
 }
 
+// Replace 渲染提示词，模板执行出错时返回出错前已渲染的部分
 func (r *Replacer) Replace(ctx *ReplaceCtx) string {
+	out, _ := r.Execute(ctx)
+	return out
+}
+
+func (r *Replacer) Execute(ctx *ReplaceCtx) (string, error) {
 	if ctx == nil || ctx.Bot == nil || ctx.Msg == nil {
-		return ""
+		return "", nil
+	}
+	if r.tmpl != nil {
+		return r.executeTemplate(ctx)
 	}
 	buf := make([]string, 0, len(r.replaceFunc))
 	for _, fn := range r.replaceFunc {
 		buf = append(buf, fn(ctx))
 	}
-	return strings.Join(buf, "")
+	return strings.Join(buf, ""), nil
 }
 func isValidVarName(s string) bool {
 	// 强约束：全大写 + 数字 + 下划线
@@ -142,7 +217,16 @@ func isValidVarName(s string) bool {
 	return true
 }
 
+// NewReplacer 解析提示词，模板语法错误时按普通文本处理，只替换 %VAR%
 func NewReplacer(tpl string) Replacer {
+	r, err := ParseReplacer(tpl)
+	if err != nil {
+		return newFlatReplacer(tpl)
+	}
+	return r
+}
+
+func newFlatReplacer(tpl string) Replacer {
 	if tpl == "" {
 		return Replacer{}
 	}
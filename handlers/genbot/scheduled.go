@@ -0,0 +1,398 @@
+package genbot
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"main/helpers/mdnormalizer"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"github.com/go-co-op/gocron"
+	"github.com/robfig/cron/v3"
+	"google.golang.org/genai"
+)
+
+const (
+	maxSchedulesPerChat  = 10
+	minScheduleInterval  = 30 * time.Minute
+	scheduleCheckRuns    = 200 // 检查运行间隔时看接下来的多少次运行
+	scheduledPromptName  = "定时任务"
+	scheduledPromptUsage = `用法：
+/ai_schedule <分 时 日 月 周> <提示词> 在当前话题添加定时任务，也可以使用 @daily、@weekly 等写法
+/ai_schedule_del <id> 删除定时任务
+/ai_schedule_run <id> 立即运行一次定时任务
+时间按服务器时区计算，例：/ai_schedule 0 9 * * * 总结一下今天的科技新闻`
+)
+
+// promptScheduler 与每日统计共用的调度器，由 StartScheduledPromptScheduler 设置
+var promptScheduler *gocron.Scheduler
+
+func scheduleTag(id int64) string {
+	return "gemini_prompt:" + strconv.FormatInt(id, 10)
+}
+
+// parseScheduleArgs 解析 "<cron> <prompt>"，cron 为5段标准格式或 @ 开头的简写
+func parseScheduleArgs(args string) (spec string, prompt string, err error) {
+	args = strings.TrimSpace(args)
+	fieldCount := 5
+	if strings.HasPrefix(args, "@") {
+		fieldCount = 1
+	}
+	rest := args
+	fields := make([]string, 0, fieldCount)
+	for range fieldCount {
+		rest = strings.TrimLeftFunc(rest, unicode.IsSpace)
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end < 0 {
+			return "", "", errors.New("缺少提示词")
+		}
+		fields = append(fields, rest[:end])
+		rest = rest[end:]
+	}
+	spec = strings.Join(fields, " ")
+	prompt = strings.TrimSpace(rest)
+	if prompt == "" {
+		return "", "", errors.New("缺少提示词")
+	}
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return "", "", fmt.Errorf("无效的时间表达式 %q: %w", spec, err)
+	}
+	if minRunInterval(schedule, time.Now()) < minScheduleInterval {
+		return "", "", fmt.Errorf("运行间隔不能小于%s", minScheduleInterval)
+	}
+	return spec, prompt, nil
+}
+
+// minRunInterval 返回 from 之后 scheduleCheckRuns 次运行之间的最小间隔，
+// 例如 "5,50 0,23 * * *" 只有 23:50 到次日 00:05 的间隔过短
+func minRunInterval(schedule cron.Schedule, from time.Time) time.Duration {
+	prev := schedule.Next(from)
+	gap := time.Duration(math.MaxInt64)
+	for range scheduleCheckRuns {
+		next := schedule.Next(prev)
+		if next.IsZero() {
+			break
+		}
+		gap = min(gap, next.Sub(prev))
+		prev = next
+	}
+	return gap
+}
+
+func nextRunText(spec string) string {
+	schedule, err := cron.ParseStandard(spec)
+	if err != nil {
+		return "无效"
+	}
+	return schedule.Next(time.Now()).Format("2006-01-02 15:04")
+}
+
+func addScheduledJob(sp *q.GeminiScheduledPrompt) error {
+	if promptScheduler == nil {
+		return errors.New("定时任务调度器未启动")
+	}
+	_, err := promptScheduler.Cron(sp.Cron).Tag(scheduleTag(sp.ID)).Do(runScheduledPrompt, sp.ID)
+	return err
+}
+
+func runScheduledPrompt(id int64) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	sp, err := g.Q.GetGeminiScheduledPrompt(ctx, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		_ = promptScheduler.RemoveByTag(scheduleTag(id))
+		return
+	} else if err != nil {
+		log.Warn("get gemini scheduled prompt", "id", id, "err", err)
+		return
+	}
+	if err = execScheduledPrompt(ctx, mainBot, &sp); err != nil {
+		log.Warn("run gemini scheduled prompt", "id", id, "chat_id", sp.ChatID, "err", err)
+	}
+}
+
+// scheduledPromptSession 获取定时任务的独立会话，不会替换话题中正在进行的会话，
+// 但回复定时任务的消息时可以继续该会话
+func scheduledPromptSession(ctx context.Context, sp *q.GeminiScheduledPrompt, chat *gotgbot.Chat) (*GeminiSession, error) {
+	geminiSessions.mu.Lock()
+	defer geminiSessions.mu.Unlock()
+	if sess, ok := geminiSessions.sidToSess[sp.SessionID]; ok {
+		return sess, nil
+	}
+	historyLimit := getChatSettings(ctx, geminiTopic{chatId: sp.ChatID, topicId: sp.ThreadID}).MaxHistory
+	session := &GeminiSession{}
+	var err error
+	if sp.SessionID != 0 {
+		session.GeminiSession, err = g.Q.GetSessionById(ctx, sp.SessionID)
+	}
+	if sp.SessionID == 0 || errors.Is(err, sql.ErrNoRows) {
+		session.GeminiSession, err = g.Q.CreateNewGeminiSession(ctx, sp.ChatID, getChatName(*chat), chat.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = session.loadContentFromDatabase(ctx, historyLimit); err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	geminiSessions.sidToSess[session.ID] = session
+	return session, nil
+}
+
+func execScheduledPrompt(ctx context.Context, bot *gotgbot.Bot, sp *q.GeminiScheduledPrompt) error {
+	if !aiEnabled(ctx, sp.ChatID) {
+		return fmt.Errorf("chat %d is not in ai chats", sp.ChatID)
+	}
+	now := time.Now()
+	if quotaMsg, err := checkQuota(ctx, sp.ChatID, sp.CreatedBy, now); err != nil {
+		return err
+	} else if quotaMsg != "" {
+		return errors.New(quotaMsg)
+	}
+	chatInfo, err := bot.GetChat(sp.ChatID, nil)
+	if err != nil {
+		return err
+	}
+	// 系统提示词的变量需要一条消息，使用 bot 自己发出的虚拟消息代替
+	msg := &gotgbot.Message{
+		Chat:            chatInfo.ToChat(),
+		MessageThreadId: sp.ThreadID,
+		IsTopicMessage:  sp.ThreadID != 0,
+		Date:            now.Unix(),
+		From:            &bot.User,
+		Text:            sp.Prompt,
+	}
+	session, err := scheduledPromptSession(ctx, sp, &msg.Chat)
+	if err != nil {
+		return err
+	}
+	if session.Frozen {
+		return fmt.Errorf("session %d is frozen", session.ID)
+	}
+	session.mu.Lock()
+	defer session.mu.Unlock()
+	defer session.DiscardTmpUpdates()
+
+	// 提示词作为一条消息发到话题中，模型的回复会回复这条消息，两者都以真实的消息id保存到会话
+	promptMsg, err := bot.SendMessage(sp.ChatID, fmt.Sprintf("%s #%d：%s", scheduledPromptName, sp.ID, sp.Prompt),
+		&gotgbot.SendMessageOpts{MessageThreadId: sp.ThreadID})
+	if err != nil {
+		return err
+	}
+	answered := false
+	defer func() {
+		if !answered {
+			_, _ = promptMsg.Delete(bot, nil)
+		}
+	}()
+	promptContent := session.newContentFromTgMsg(promptMsg)
+	promptContent.Role = genai.RoleUser
+	promptContent.Username = scheduledPromptName
+	promptContent.AtableUsername = sql.NullString{}
+	promptContent.UserID = sp.CreatedBy
+	promptContent.MsgType = "text"
+	promptContent.Text = sql.NullString{String: sp.Prompt, Valid: true}
+	session.TmpContents = append(session.TmpContents, promptContent)
+
+	topic := newTopic(msg)
+	memories, err := g.Q.ListGeminiMemory(ctx, topic.chatId, topic.topicId, 30)
+	if err != nil {
+		return err
+	}
+	sysPromptCtx := ReplaceCtx{Bot: bot, Msg: msg, Now: now}
+	for _, mem := range memories {
+		sysPromptCtx.Memories = append(sysPromptCtx.Memories, mem.Content)
+	}
+	sysPrompt := getSysPrompt(msg).Replace(&sysPromptCtx)
+	setting := getChatSettings(ctx, topic)
+	config := buildGenerateConfig(&setting, sysPrompt, session.AllowCodeExecution)
+	res, err := generate(ctx, setting.Model, session, config)
+	if err != nil {
+		return err
+	}
+	_ = g.Q.IncrementSessionTokenCounters(
+		ctx,
+		int64(res.UsageMetadata.PromptTokenCount),
+		int64(res.UsageMetadata.CandidatesTokenCount+res.UsageMetadata.ThoughtsTokenCount),
+		session.ID,
+	)
+	if err := recordUsage(ctx, sp.ChatID, sp.CreatedBy, setting.Model, res.UsageMetadata); err != nil {
+		log.Warn("record gemini usage", "chat_id", sp.ChatID, "user_id", sp.CreatedBy, "err", err)
+	}
+	aiText := strings.TrimSpace(reLabelHeader.ReplaceAllString(res.Text(), ""))
+	if aiText == "" {
+		return errors.New("模型没有返回任何信息")
+	}
+	opts := &gotgbot.SendMessageOpts{
+		MessageThreadId: sp.ThreadID,
+		ReplyParameters: &gotgbot.ReplyParameters{MessageId: promptMsg.MessageId},
+	}
+	if normTxt, err := mdnormalizer.Normalize(aiText); err != nil {
+		log.Warn("parse markdown failed", "err", err)
+	} else {
+		aiText = normTxt.Text
+		opts.Entities = normTxt.Entities
+	}
+	respMsg, err := bot.SendMessage(sp.ChatID, aiText, opts)
+	if err != nil {
+		return err
+	}
+	answered = true
+	if err = session.AddTgMessage(bot, respMsg); err != nil {
+		return err
+	}
+	if err = session.PersistTmpUpdates(ctx); err != nil {
+		return err
+	}
+	if err = g.Q.UpdateGeminiScheduledPromptRun(ctx, session.ID, q.UnixTime{Time: now}, sp.ID); err != nil {
+		return err
+	}
+	sp.SessionID = session.ID
+	compactSessionAsync(session, textModel(setting.Model), sp.CreatedBy, sessionTokenEstimate(res.UsageMetadata))
+	return nil
+}
+
+func formatSchedules(schedules []q.GeminiScheduledPrompt) string {
+	if len(schedules) == 0 {
+		return "当前聊天没有定时任务\n\n" + scheduledPromptUsage
+	}
+	buf := strings.Builder{}
+	buf.WriteString("当前聊天的定时任务：\n")
+	for _, sp := range schedules {
+		lastRun := "从未运行"
+		if sp.LastRunAt.Unix() > 0 {
+			lastRun = "上次运行 " + sp.LastRunAt.Format("01-02 15:04")
+		}
+		buf.WriteString(fmt.Sprintf("#%d [%s] 话题%d 下次运行 %s，%s\n  %s\n",
+			sp.ID, sp.Cron, sp.ThreadID, nextRunText(sp.Cron), lastRun, truncateText(sp.Prompt, 40)))
+	}
+	return buf.String()
+}
+
+// ScheduleGeminiPrompt 没有参数时列出定时任务，否则添加定时任务（仅管理员）
+func ScheduleGeminiPrompt(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	c := context.Background()
+	args := h.TrimCmd(msg.GetText())
+	schedules, err := g.Q.ListChatGeminiScheduledPrompts(c, msg.Chat.Id)
+	if err != nil {
+		return err
+	}
+	if args == "" {
+		_, err = msg.Reply(bot, formatSchedules(schedules), nil)
+		return err
+	}
+	if !isGeminiAdmin(bot, msg) {
+		_, err = msg.Reply(bot, "只有管理员可以添加定时任务", nil)
+		return err
+	}
+	if !aiEnabled(context.Background(), msg.Chat.Id) {
+		_, err = msg.Reply(bot, "当前聊天未开启AI功能", nil)
+		return err
+	}
+	if len(schedules) >= maxSchedulesPerChat {
+		_, err = msg.Reply(bot, fmt.Sprintf("每个聊天最多只能有%d个定时任务", maxSchedulesPerChat), nil)
+		return err
+	}
+	spec, prompt, err := parseScheduleArgs(args)
+	if err != nil {
+		_, err = msg.Reply(bot, err.Error()+"\n\n"+scheduledPromptUsage, nil)
+		return err
+	}
+	sp, err := g.Q.CreateGeminiScheduledPrompt(c, q.CreateGeminiScheduledPromptParams{
+		ChatID:    msg.Chat.Id,
+		ThreadID:  newTopic(msg).topicId,
+		Cron:      spec,
+		Prompt:    prompt,
+		CreatedBy: msg.GetSender().Id(),
+		CreatedAt: q.UnixTime{Time: time.Now()},
+	})
+	if err != nil {
+		_, _ = msg.Reply(bot, "保存失败: "+err.Error(), nil)
+		return err
+	}
+	if err = addScheduledJob(&sp); err != nil {
+		_, _ = g.Q.DeleteGeminiScheduledPrompt(c, sp.ID, sp.ChatID)
+		_, _ = msg.Reply(bot, "添加定时任务失败: "+err.Error(), nil)
+		return err
+	}
+	_, err = msg.Reply(bot, fmt.Sprintf("已添加定时任务 #%d，下次运行时间 %s", sp.ID, nextRunText(sp.Cron)), nil)
+	return err
+}
+
+func getChatSchedule(bot *gotgbot.Bot, msg *gotgbot.Message) (*q.GeminiScheduledPrompt, error) {
+	if !isGeminiAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以管理定时任务", nil)
+		return nil, err
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(h.TrimCmd(msg.GetText()), "#"), 10, 64)
+	if err != nil {
+		_, err = msg.Reply(bot, scheduledPromptUsage, nil)
+		return nil, err
+	}
+	sp, err := g.Q.GetGeminiScheduledPrompt(context.Background(), id)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && sp.ChatID != msg.Chat.Id) {
+		_, err = msg.Reply(bot, fmt.Sprintf("当前聊天没有定时任务 #%d", id), nil)
+		return nil, err
+	} else if err != nil {
+		return nil, err
+	}
+	return &sp, nil
+}
+
+func DeleteGeminiSchedule(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	sp, err := getChatSchedule(bot, msg)
+	if sp == nil {
+		return err
+	}
+	if _, err = g.Q.DeleteGeminiScheduledPrompt(context.Background(), sp.ID, sp.ChatID); err != nil {
+		_, _ = msg.Reply(bot, "删除失败: "+err.Error(), nil)
+		return err
+	}
+	if promptScheduler != nil {
+		_ = promptScheduler.RemoveByTag(scheduleTag(sp.ID))
+	}
+	_, err = msg.Reply(bot, fmt.Sprintf("已删除定时任务 #%d", sp.ID), nil)
+	return err
+}
+
+func RunGeminiSchedule(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	sp, err := getChatSchedule(bot, msg)
+	if sp == nil {
+		return err
+	}
+	c, cancel := context.WithTimeout(context.Background(), 15*time.Minute)
+	defer cancel()
+	if err = execScheduledPrompt(c, bot, sp); err != nil {
+		_, _ = msg.Reply(bot, fmt.Sprintf("运行定时任务 #%d 失败: %s", sp.ID, err), nil)
+		return err
+	}
+	return nil
+}
+
+// StartScheduledPromptScheduler 把所有定时任务加入 scheduler，scheduler 为每日统计使用的调度器
+func StartScheduledPromptScheduler(scheduler *gocron.Scheduler) {
+	promptScheduler = scheduler
+	schedules, err := g.Q.ListAllGeminiScheduledPrompts(context.Background())
+	if err != nil {
+		log.Warn("list gemini scheduled prompts", "err", err)
+		return
+	}
+	for i := range schedules {
+		if err := addScheduledJob(&schedules[i]); err != nil {
+			log.Warn("add gemini scheduled prompt", "id", schedules[i].ID, "err", err)
+		}
+	}
+}
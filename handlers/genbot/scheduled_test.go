@@ -0,0 +1,47 @@
+package genbot
+
+import (
+	"main/globalcfg/q"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseScheduleArgs(t *testing.T) {
+	spec, prompt, err := parseScheduleArgs("0 9 * * 1-5  总结一下\n今天的新闻")
+	if err != nil || spec != "0 9 * * 1-5" || prompt != "总结一下\n今天的新闻" {
+		t.Fatalf("unexpected result %q %q %v", spec, prompt, err)
+	}
+	spec, prompt, err = parseScheduleArgs("@weekly 本周回顾")
+	if err != nil || spec != "@weekly" || prompt != "本周回顾" {
+		t.Fatalf("unexpected result %q %q %v", spec, prompt, err)
+	}
+	for _, args := range []string{
+		"0 9 * * *",
+		"0 9 * *",
+		"61 9 * * * 提示词",
+		"*/5 * * * * 太频繁",
+		"@every 1m 太频繁",
+		"5,50 0,23 * * * 跨天的间隔太短",
+		"0,10 9 * * * 同一天的间隔太短",
+	} {
+		if _, _, err := parseScheduleArgs(args); err == nil {
+			t.Fatalf("%q should be rejected", args)
+		}
+	}
+}
+
+func TestFormatSchedules(t *testing.T) {
+	if text := formatSchedules(nil); !strings.Contains(text, "/ai_schedule_del") {
+		t.Fatalf("empty list should show usage:\n%s", text)
+	}
+	text := formatSchedules([]q.GeminiScheduledPrompt{
+		{ID: 3, ThreadID: 7, Cron: "0 9 * * *", Prompt: "早报"},
+		{ID: 4, Cron: "@daily", Prompt: "日报", LastRunAt: q.UnixTime{Time: time.Now()}},
+	})
+	for _, want := range []string{"#3 [0 9 * * *] 话题7", "从未运行", "#4 [@daily]", "上次运行"} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("list should contain %q:\n%s", want, text)
+		}
+	}
+}
@@ -72,7 +72,17 @@ func SessionHelp(bot *gotgbot.Bot, ctx *ext.Context) error {
 	text := `会话相关帮助：
 /new_session 停止当前会话，创建新会话
 /session_id 获取当前会话ID，若回复特定消息，则获取该消息的会话ID
-/get_memories 获取Bot记忆`
+/get_memories 获取Bot记忆
+/imagine <描述> 生成图片，回复图片或贴纸时对其进行编辑
+/sessions 列出当前聊天最近的会话
+/session_export <id> [md|json] 导出会话，媒体文件会一起打包
+/session_freeze <id> 锁定会话，锁定后AI不再回复该会话（仅管理员）
+/session_unfreeze <id> 解锁会话（仅管理员）
+/ai_schedule 查看定时任务，管理员可添加定时运行的提示词，结果保存在独立会话中
+/digest [today] 根据消息存档生成昨天（或今天）的群聊摘要（仅管理员），可在 /chat_config 中开启每日自动发送
+/ai_join <邀请码> 开通私聊AI，私聊中的提示词、记忆和会话只属于你自己
+/tr [语言] 翻译回复的消息，默认翻译为 /tr_lang 设置的语言，可在 /chat_config 中开启自动翻译
+内联模式: @bot tr ja 文本 翻译为指定语言`
 	_, err := ctx.EffectiveMessage.Reply(bot, text, nil)
 	return err
 }
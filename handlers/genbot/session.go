@@ -20,6 +20,7 @@ import (
 type GeminiSession struct {
 	q.GeminiSession
 	mu          sync.Mutex
+	Summary     *q.GeminiContent // 较早消息的摘要，为nil时表示会话未被压缩过
 	Contents    []q.GeminiContent
 	TmpContents []q.GeminiContent
 	UpdateTime  time.Time
@@ -63,9 +64,15 @@ type:%s
 	if content.Text.Valid {
 		out.Parts = append(out.Parts, &genai.Part{Text: content.Text.String})
 	}
-	if len(content.Blob) > 0 && content.MimeType.Valid {
+	if content.BlobHash.Valid && content.MimeType.Valid {
+		data, err := getBlob(context.Background(), content.BlobHash.String)
+		if err != nil {
+			log.Warn("load gemini blob", "hash", content.BlobHash.String, "err", err)
+			out.Parts = append(out.Parts, &genai.Part{Text: "(该媒体文件已丢失)"})
+			return
+		}
 		out.Parts = append(out.Parts, &genai.Part{InlineData: &genai.Blob{
-			Data:     content.Blob,
+			Data:     data,
 			MIMEType: content.MimeType.String,
 		}})
 	}
@@ -73,7 +80,10 @@ type:%s
 }
 
 func (s *GeminiSession) ToGenaiContents() []*genai.Content {
-	contents := make([]*genai.Content, 0, len(s.Contents)+1)
+	contents := make([]*genai.Content, 0, len(s.Contents)+len(s.TmpContents)+1)
+	if s.Summary != nil {
+		contents = append(contents, summaryToGenaiContent(s.Summary))
+	}
 	for i := range s.Contents {
 		contents = append(contents, databaseContentToGenaiPart(&s.Contents[i]))
 	}
@@ -83,26 +93,13 @@ func (s *GeminiSession) ToGenaiContents() []*genai.Content {
 	return contents
 }
 
-func (s *GeminiSession) AddTgMessage(bot *gotgbot.Bot, msg *gotgbot.Message) (err error) {
-	if msg == nil {
-		return nil
-	}
-	for i := range s.Contents {
-		if msg.MessageId == s.Contents[i].MsgID {
-			return nil
-		}
-	}
-	for i := range s.TmpContents {
-		if msg.MessageId == s.TmpContents[i].MsgID {
-			return nil
-		}
-	}
+func (s *GeminiSession) newContentFromTgMsg(msg *gotgbot.Message) q.GeminiContent {
 	role := genai.RoleUser
 	if msg.GetSender().Id() == mainBot.Id {
 		role = genai.RoleModel
 	}
 	username := msg.GetSender().Username()
-	content := q.GeminiContent{
+	return q.GeminiContent{
 		SessionID:      s.ID,
 		ChatID:         msg.Chat.Id,
 		MsgID:          msg.MessageId,
@@ -112,6 +109,40 @@ func (s *GeminiSession) AddTgMessage(bot *gotgbot.Bot, msg *gotgbot.Message) (er
 		AtableUsername: sql.NullString{String: username, Valid: username != ""},
 		UserID:         msg.GetSender().Id(),
 	}
+}
+
+// AddGeneratedImage 将模型生成的图片以原始数据存入会话，避免再从Telegram下载被压缩过的图片
+func (s *GeminiSession) AddGeneratedImage(ctx context.Context, msg *gotgbot.Message, img *genai.Blob) (err error) {
+	content := s.newContentFromTgMsg(msg)
+	content.Role = genai.RoleModel
+	content.MsgType = "photo"
+	if msg.Sticker != nil {
+		content.MsgType = "sticker"
+	}
+	content.BlobHash, err = putBlob(ctx, img.Data)
+	if err != nil {
+		return err
+	}
+	content.MimeType = sql.NullString{String: img.MIMEType, Valid: true}
+	s.TmpContents = append(s.TmpContents, content)
+	return nil
+}
+
+func (s *GeminiSession) AddTgMessage(bot *gotgbot.Bot, msg *gotgbot.Message) (err error) {
+	if msg == nil {
+		return nil
+	}
+	for i := range s.Contents {
+		if msg.MessageId == s.Contents[i].MsgID {
+			return nil
+		}
+	}
+	for i := range s.TmpContents {
+		if msg.MessageId == s.TmpContents[i].MsgID {
+			return nil
+		}
+	}
+	content := s.newContentFromTgMsg(msg)
 	if msg.ReplyToMessage != nil {
 		content.ReplyToMsgID.Valid = true
 		content.ReplyToMsgID.Int64 = msg.ReplyToMessage.MessageId
@@ -125,65 +156,40 @@ func (s *GeminiSession) AddTgMessage(bot *gotgbot.Bot, msg *gotgbot.Message) (er
 		content.Text.String = mdTxt
 		content.MsgType = "text"
 	}
-	var data []byte
-	if msg.Photo != nil {
-		data, err = h.DownloadToMemoryCached(bot, msg.Photo[len(msg.Photo)-1].FileId)
+	media, note := tgMsgMedia(msg)
+	if note != "" {
+		if content.Text.String != "" {
+			content.Text.String += "\n"
+		}
+		content.Text.String += note
+		content.Text.Valid = true
+		content.MsgType = "text"
+	}
+	if media != nil {
+		var data []byte
+		data, err = h.DownloadToMemoryCached(bot, media.fileId)
 		if err != nil {
 			return err
 		}
-		content.MsgType = "photo"
-		content.Blob = data
-		content.MimeType.Valid = true
-		content.MimeType.String = "image/jpeg"
-	} else if msg.Sticker != nil {
-		if msg.Sticker.IsAnimated {
-			return errors.New("不支持的动画类型")
-		}
-		data, err = h.DownloadToMemoryCached(bot, msg.Sticker.FileId)
+		content.BlobHash, err = putBlob(context.Background(), data)
 		if err != nil {
 			return err
 		}
-		content.Blob = data
-		content.MsgType = "sticker"
-		content.MimeType.Valid = true
-		if msg.Sticker.IsVideo {
+		content.MsgType = media.msgType
+		content.MimeType = sql.NullString{String: media.mimeType, Valid: true}
+		if strings.HasPrefix(media.mimeType, "video/") {
 			s.AllowCodeExecution = false
-			content.MimeType.String = "video/webm"
-		} else {
-			content.MimeType.String = "image/webp"
-		}
-	} else if msg.Video != nil {
-		if msg.Video.Duration <= 240 && msg.Video.FileSize <= 15*1024*1024 {
-			s.AllowCodeExecution = false
-			data, err = h.DownloadToMemoryCached(bot, msg.Video.FileId)
-			if err != nil {
-				return err
-			}
-			content.Blob = data
-			content.MsgType = "video"
-			content.MimeType.Valid = true
-			content.MimeType.String = "video/mp4"
-		} else {
-			content.Text.Valid = true
-			content.Text.String += "(用户发送了一个视频，但由于不满足 size<15MB且时长<=240s，无法上传)"
-		}
-	} else if msg.Animation != nil {
-		s.AllowCodeExecution = false
-		data, err = h.DownloadToMemoryCached(bot, msg.Animation.FileId)
-		if err != nil {
-			return err
 		}
-		content.Blob = data
-		content.MsgType = "video"
-		content.MimeType.Valid = true
-		content.MimeType.String = "video/mp4"
 	}
 	s.TmpContents = append(s.TmpContents, content)
 	return
 }
 
-func (s *GeminiSession) loadContentFromDatabase(ctx context.Context) error {
-	content, err := g.Q.GetAllMsgInSession(ctx, s.ID, geminiSessionContentLimit)
+func (s *GeminiSession) loadContentFromDatabase(ctx context.Context, limit int64) error {
+	if err := s.loadSummaryFromDatabase(ctx); err != nil {
+		return err
+	}
+	content, err := g.Q.GetAllMsgInSession(ctx, s.ID, coveredMsgId(s.Summary), limit)
 	if err != nil {
 		return err
 	}
@@ -232,6 +238,7 @@ func GeminiGetSession(ctx context.Context, msg *gotgbot.Message, createNewSessio
 	defer geminiSessions.mu.Unlock()
 	session := &GeminiSession{}
 	topic := newTopic(msg)
+	historyLimit := getChatSettings(ctx, topic).MaxHistory
 	if (mentionSessionId != 0 || msg.ReplyToMessage != nil) && !createNewSession {
 		var sessionId int64
 		var err error
@@ -241,7 +248,8 @@ func GeminiGetSession(ctx context.Context, msg *gotgbot.Message, createNewSessio
 			sessionId = mentionSessionId
 		}
 		if err == nil {
-			if sess, ok := geminiSessions.sidToSess[sessionId]; ok {
+			// 只能引用当前聊天的会话，避免私聊的内容被带到群聊中，反之亦然
+			if sess, ok := geminiSessions.sidToSess[sessionId]; ok && sess.ChatID == msg.Chat.Id {
 				return sess
 			}
 		}
@@ -253,7 +261,11 @@ func GeminiGetSession(ctx context.Context, msg *gotgbot.Message, createNewSessio
 			}
 			return nil
 		}
-		err = session.loadContentFromDatabase(ctx)
+		if session.ChatID != msg.Chat.Id {
+			session = &GeminiSession{}
+			goto create
+		}
+		err = session.loadContentFromDatabase(ctx, historyLimit)
 		if err != nil {
 			return nil
 		}
@@ -275,7 +287,7 @@ create:
 	if err != nil {
 		return nil
 	}
-	err = session.loadContentFromDatabase(ctx)
+	err = session.loadContentFromDatabase(ctx, historyLimit)
 	if err != nil && !errors.Is(err, sql.ErrNoRows) {
 		return nil
 	}
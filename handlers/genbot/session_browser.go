@@ -0,0 +1,338 @@
+package genbot
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"math"
+	"mime"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const recentSessionsLimit = 10
+
+func truncateText(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n]) + "…"
+}
+
+func ListGeminiSessions(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	c := context.Background()
+	sessions, err := g.Q.ListRecentGeminiSessions(c, msg.Chat.Id, recentSessionsLimit)
+	if err != nil {
+		return err
+	}
+	if len(sessions) == 0 {
+		_, err = msg.Reply(bot, "当前聊天没有任何会话", nil)
+		return err
+	}
+	buf := strings.Builder{}
+	buf.WriteString("最近的会话：\n")
+	for _, sess := range sessions {
+		first, err := g.Q.GetFirstGeminiContent(c, sess.ID)
+		summary := "(空会话)"
+		if err == nil {
+			summary = fmt.Sprintf("%s %s: %s", first.SentTime.Format("01-02 15:04"), first.Username,
+				truncateText(first.Text.String, 30))
+		} else if !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		frozen := ""
+		if sess.Frozen {
+			frozen = " 🔒"
+		}
+		buf.WriteString(fmt.Sprintf("#%d%s 输入%d/输出%d tokens\n  %s\n",
+			sess.ID, frozen, sess.TotalInputTokens, sess.TotalOutputTokens, summary))
+	}
+	buf.WriteString("\n使用 /session_export <id> [md|json] 导出会话")
+	_, err = msg.Reply(bot, buf.String(), nil)
+	return err
+}
+
+type exportedMessage struct {
+	MsgID      int64  `json:"msg_id"`
+	Role       string `json:"role"`
+	Time       string `json:"time"`
+	Name       string `json:"name"`
+	Username   string `json:"username,omitempty"`
+	Type       string `json:"type"`
+	ReplyTo    int64  `json:"reply_to,omitempty"`
+	Quote      string `json:"quote,omitempty"`
+	Text       string `json:"text,omitempty"`
+	Attachment string `json:"attachment,omitempty"`
+}
+
+type exportedSession struct {
+	ID                int64             `json:"id"`
+	ChatID            int64             `json:"chat_id"`
+	ChatName          string            `json:"chat_name"`
+	ChatType          string            `json:"chat_type"`
+	Frozen            bool              `json:"frozen"`
+	TotalInputTokens  int64             `json:"total_input_tokens"`
+	TotalOutputTokens int64             `json:"total_output_tokens"`
+	Summary           string            `json:"summary,omitempty"`
+	Messages          []exportedMessage `json:"messages"`
+}
+
+var mimeExt = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/webp": ".webp",
+	"video/mp4":  ".mp4",
+	"video/webm": ".webm",
+}
+
+func attachmentName(content *q.GeminiContent) string {
+	ext, ok := mimeExt[content.MimeType.String]
+	if !ok {
+		if exts, _ := mime.ExtensionsByType(content.MimeType.String); len(exts) > 0 {
+			ext = exts[0]
+		} else {
+			ext = ".bin"
+		}
+	}
+	return fmt.Sprintf("media/%d%s", content.MsgID, ext)
+}
+
+func buildExportedSession(ctx context.Context, sess *q.GeminiSession, contents []q.GeminiContent) (*exportedSession, map[string][]byte) {
+	out := &exportedSession{
+		ID:                sess.ID,
+		ChatID:            sess.ChatID,
+		ChatName:          sess.ChatName,
+		ChatType:          sess.ChatType,
+		Frozen:            sess.Frozen,
+		TotalInputTokens:  sess.TotalInputTokens,
+		TotalOutputTokens: sess.TotalOutputTokens,
+	}
+	media := make(map[string][]byte)
+	for i := range contents {
+		c := &contents[i]
+		// 摘要的msg_id为负数且越小越新，只保留最新的一份
+		if isSummary(c) {
+			if out.Summary == "" {
+				out.Summary = c.Text.String
+			}
+			continue
+		}
+		m := exportedMessage{
+			MsgID:    c.MsgID,
+			Role:     c.Role,
+			Time:     c.SentTime.Format("2006-01-02 15:04:05"),
+			Name:     c.Username,
+			Username: c.AtableUsername.String,
+			Type:     c.MsgType,
+			ReplyTo:  c.ReplyToMsgID.Int64,
+			Quote:    c.QuotePart.String,
+			Text:     c.Text.String,
+		}
+		if c.BlobHash.Valid {
+			if data, err := getBlob(ctx, c.BlobHash.String); err == nil {
+				m.Attachment = attachmentName(c)
+				media[m.Attachment] = data
+			}
+		}
+		out.Messages = append(out.Messages, m)
+	}
+	return out, media
+}
+
+func (s *exportedSession) Markdown() string {
+	buf := strings.Builder{}
+	buf.WriteString(fmt.Sprintf("# 会话 #%d\n\n", s.ID))
+	buf.WriteString(fmt.Sprintf("- 聊天: %s (%s, %d)\n", s.ChatName, s.ChatType, s.ChatID))
+	buf.WriteString(fmt.Sprintf("- Token: 输入 %d / 输出 %d\n", s.TotalInputTokens, s.TotalOutputTokens))
+	if s.Frozen {
+		buf.WriteString("- 状态: 已锁定\n")
+	}
+	if s.Summary != "" {
+		buf.WriteString("\n## 早期消息摘要\n\n")
+		buf.WriteString(s.Summary)
+		buf.WriteString("\n")
+	}
+	buf.WriteString("\n## 消息\n")
+	for _, m := range s.Messages {
+		name := m.Name
+		if m.Username != "" {
+			name += " (@" + m.Username + ")"
+		}
+		buf.WriteString(fmt.Sprintf("\n### %s · %s · #%d\n\n", name, m.Time, m.MsgID))
+		if m.ReplyTo != 0 {
+			buf.WriteString(fmt.Sprintf("> 回复 #%d", m.ReplyTo))
+			if m.Quote != "" {
+				buf.WriteString(": " + m.Quote)
+			}
+			buf.WriteString("\n\n")
+		}
+		if m.Text != "" {
+			buf.WriteString(m.Text)
+			buf.WriteString("\n")
+		}
+		if m.Attachment != "" {
+			buf.WriteString(fmt.Sprintf("\n[%s](%s)\n", m.Type, m.Attachment))
+		}
+	}
+	return buf.String()
+}
+
+// encodeExport 将会话编码为指定格式，存在媒体时与媒体文件一起打包为zip
+func encodeExport(sess *exportedSession, media map[string][]byte, format string) (filename string, data []byte, err error) {
+	var body []byte
+	switch format {
+	case "json":
+		body, err = json.MarshalIndent(sess, "", "  ")
+		if err != nil {
+			return "", nil, err
+		}
+	default:
+		format = "md"
+		body = []byte(sess.Markdown())
+	}
+	name := fmt.Sprintf("session_%d.%s", sess.ID, format)
+	if len(media) == 0 {
+		return name, body, nil
+	}
+	buf := &bytes.Buffer{}
+	zw := zip.NewWriter(buf)
+	files := map[string][]byte{name: body}
+	for k, v := range media {
+		files[k] = v
+	}
+	for k, v := range files {
+		w, err := zw.Create(k)
+		if err != nil {
+			return "", nil, err
+		}
+		if _, err = w.Write(v); err != nil {
+			return "", nil, err
+		}
+	}
+	if err = zw.Close(); err != nil {
+		return "", nil, err
+	}
+	return fmt.Sprintf("session_%d.zip", sess.ID), buf.Bytes(), nil
+}
+
+// parseSessionArg 解析命令参数中的会话id，未提供时使用回复的消息所在的会话
+func parseSessionArg(ctx context.Context, msg *gotgbot.Message, arg string) (int64, error) {
+	if arg != "" {
+		return strconv.ParseInt(strings.TrimPrefix(arg, "#"), 10, 64)
+	}
+	if msg.ReplyToMessage != nil {
+		sessionId, err := g.Q.GetSessionIdByMessage(ctx, msg.Chat.Id, msg.ReplyToMessage.MessageId)
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, errors.New("您回复的消息不在会话中")
+		}
+		return sessionId, err
+	}
+	return 0, errors.New("需要提供会话id，或回复会话中的消息")
+}
+
+// getChatSession 获取会话，并确保会话属于当前聊天
+func getChatSession(ctx context.Context, msg *gotgbot.Message, arg string) (*q.GeminiSession, error) {
+	sessionId, err := parseSessionArg(ctx, msg, arg)
+	if err != nil {
+		return nil, err
+	}
+	sess, err := g.Q.GetSessionById(ctx, sessionId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && sess.ChatID != msg.Chat.Id) {
+		return nil, fmt.Errorf("当前聊天中没有会话 #%d", sessionId)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &sess, nil
+}
+
+func ExportGeminiSession(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	c := context.Background()
+	args := strings.Fields(h.TrimCmd(msg.GetText()))
+	idArg, format := "", "md"
+	for _, arg := range args {
+		switch strings.ToLower(arg) {
+		case "md", "markdown":
+			format = "md"
+		case "json":
+			format = "json"
+		default:
+			idArg = arg
+		}
+	}
+	sess, err := getChatSession(c, msg, idArg)
+	if err != nil {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	}
+	contents, err := g.Q.GetAllMsgInSession(c, sess.ID, math.MinInt64, math.MaxInt32)
+	if err != nil {
+		return err
+	}
+	exported, media := buildExportedSession(c, sess, contents)
+	filename, data, err := encodeExport(exported, media, format)
+	if err != nil {
+		return err
+	}
+	_, err = bot.SendDocument(msg.Chat.Id, gotgbot.InputFileByReader(filename, bytes.NewReader(data)), &gotgbot.SendDocumentOpts{
+		MessageThreadId: msg.MessageThreadId,
+		ReplyParameters: &gotgbot.ReplyParameters{MessageId: msg.MessageId},
+	})
+	return err
+}
+
+func setGeminiSessionFrozen(bot *gotgbot.Bot, ctx *ext.Context, frozen bool) error {
+	msg := ctx.EffectiveMessage
+	if !isGeminiAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以锁定或解锁会话", nil)
+		return err
+	}
+	c := context.Background()
+	sess, err := getChatSession(c, msg, h.TrimCmd(msg.GetText()))
+	if err != nil {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	}
+	if err = g.Q.SetGeminiSessionFrozen(c, frozen, sess.ID); err != nil {
+		return err
+	}
+	// 从缓存中移除，下次使用时重新从数据库加载
+	geminiSessions.mu.Lock()
+	if cached, ok := geminiSessions.sidToSess[sess.ID]; ok {
+		delete(geminiSessions.sidToSess, sess.ID)
+		for topic, s := range geminiSessions.chatIdToSess {
+			if s == cached {
+				delete(geminiSessions.chatIdToSess, topic)
+			}
+		}
+	}
+	geminiSessions.mu.Unlock()
+	text := fmt.Sprintf("会话 #%d 已解锁", sess.ID)
+	if frozen {
+		text = fmt.Sprintf("会话 #%d 已锁定，AI不会再回复该会话中的消息", sess.ID)
+	}
+	_, err = msg.Reply(bot, text, nil)
+	return err
+}
+
+func FreezeGeminiSession(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return setGeminiSessionFrozen(bot, ctx, true)
+}
+
+func UnfreezeGeminiSession(bot *gotgbot.Bot, ctx *ext.Context) error {
+	return setGeminiSessionFrozen(bot, ctx, false)
+}
@@ -0,0 +1,79 @@
+package genbot
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"main/globalcfg/q"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testExportContents(t *testing.T) (context.Context, *q.GeminiSession, []q.GeminiContent) {
+	ctx := context.Background()
+	hash, err := putBlob(ctx, []byte{0xff, 0xd8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sess := &q.GeminiSession{ID: 42, ChatID: -100, ChatName: "test", ChatType: "supergroup"}
+	now := q.UnixTime{Time: time.Date(2024, 3, 14, 15, 9, 26, 0, time.Local)}
+	return ctx, sess, []q.GeminiContent{
+		{SessionID: 42, MsgID: -2, MsgType: summaryMsgType, SentTime: now, Text: sql.NullString{String: "newer summary", Valid: true}},
+		{SessionID: 42, MsgID: -1, MsgType: summaryMsgType, SentTime: now, Text: sql.NullString{String: "older summary", Valid: true}},
+		{SessionID: 42, MsgID: 3, Role: "user", Username: "Alice", MsgType: "text", SentTime: now,
+			Text: sql.NullString{String: "hello", Valid: true}},
+		{SessionID: 42, MsgID: 4, Role: "user", Username: "Alice", MsgType: "photo", SentTime: now,
+			BlobHash: hash, MimeType: sql.NullString{String: "image/jpeg", Valid: true},
+			ReplyToMsgID: sql.NullInt64{Int64: 3, Valid: true}},
+	}
+}
+
+func TestBuildExportedSession(t *testing.T) {
+	exported, media := buildExportedSession(testExportContents(t))
+	if exported.Summary != "newer summary" {
+		t.Fatalf("latest summary should be kept, got %q", exported.Summary)
+	}
+	if len(exported.Messages) != 2 || exported.Messages[1].Attachment != "media/4.jpg" {
+		t.Fatalf("unexpected messages: %+v", exported.Messages)
+	}
+	if len(media) != 1 || !bytes.Equal(media["media/4.jpg"], []byte{0xff, 0xd8}) {
+		t.Fatalf("unexpected media: %v", media)
+	}
+	md := exported.Markdown()
+	for _, want := range []string{"# 会话 #42", "newer summary", "> 回复 #3", "[photo](media/4.jpg)"} {
+		if !strings.Contains(md, want) {
+			t.Fatalf("markdown should contain %q:\n%s", want, md)
+		}
+	}
+}
+
+func TestEncodeExport(t *testing.T) {
+	exported, media := buildExportedSession(testExportContents(t))
+	name, data, err := encodeExport(exported, nil, "json")
+	if err != nil || name != "session_42.json" {
+		t.Fatalf("unexpected export %s %v", name, err)
+	}
+	var decoded exportedSession
+	if err := json.Unmarshal(data, &decoded); err != nil || len(decoded.Messages) != 2 {
+		t.Fatalf("json export should round trip, err=%v", err)
+	}
+
+	name, data, err = encodeExport(exported, media, "md")
+	if err != nil || name != "session_42.zip" {
+		t.Fatalf("export with media should be zipped, got %s %v", name, err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]bool{}
+	for _, f := range zr.File {
+		files[f.Name] = true
+	}
+	if !files["session_42.md"] || !files["media/4.jpg"] {
+		t.Fatalf("unexpected zip content: %v", files)
+	}
+}
@@ -2,15 +2,104 @@ package genbot
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	g "main/globalcfg"
 	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 )
 
+const sysPromptHistoryLimit = 10
+
+var rePresetName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+
+func invalidateSysPrompt(topic geminiTopic) {
+	gMu.Lock()
+	defer gMu.Unlock()
+	delete(sysPromptReplacerCache, topic)
+}
+
+// setSysPrompt 设置话题的系统提示词并记录一个新版本，prompt 为空时恢复默认提示词，返回新版本号
+func setSysPrompt(ctx context.Context, topic geminiTopic, prompt string, authorId int64) (version int64, err error) {
+	tx, err := g.RawMainDb().BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	qtx := g.Q.WithTx(tx)
+	now := q.UnixTime{Time: time.Now()}
+	version, err = qtx.GetGeminiSystemPromptLatestVersion(ctx, topic.chatId, topic.topicId)
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 {
+		// 开始记录历史前已经设置的提示词作为第一个版本
+		old, oldErr := qtx.GetGeminiSystemPrompt(ctx, topic.chatId, topic.topicId)
+		if oldErr == nil {
+			version = 1
+			err = qtx.AddGeminiSystemPromptHistory(ctx, q.AddGeminiSystemPromptHistoryParams{
+				ChatID:    topic.chatId,
+				ThreadID:  topic.topicId,
+				Version:   version,
+				Prompt:    old,
+				CreatedAt: now,
+			})
+			if err != nil {
+				return 0, err
+			}
+		}
+	}
+	if prompt == "" {
+		err = qtx.ResetGeminiSystemPrompt(ctx, topic.chatId, topic.topicId)
+	} else {
+		err = qtx.CreateOrUpdateGeminiSystemPrompt(ctx, topic.chatId, topic.topicId, prompt)
+	}
+	if err != nil {
+		return 0, err
+	}
+	version++
+	err = qtx.AddGeminiSystemPromptHistory(ctx, q.AddGeminiSystemPromptHistoryParams{
+		ChatID:    topic.chatId,
+		ThreadID:  topic.topicId,
+		Version:   version,
+		Prompt:    prompt,
+		AuthorID:  authorId,
+		CreatedAt: now,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	invalidateSysPrompt(topic)
+	return version, nil
+}
+
+// validateSysPrompt 检查模板语法并试渲染一次，避免保存无法使用的提示词
+func validateSysPrompt(bot *gotgbot.Bot, msg *gotgbot.Message, prompt string) error {
+	r, err := ParseReplacer(prompt)
+	if err != nil {
+		return err
+	}
+	_, err = r.Execute(&ReplaceCtx{Bot: bot, Msg: msg, Now: time.Now(), Memories: []string{"示例记忆"}})
+	return err
+}
+
 func UpdateGeminiSysPrompt(bot *gotgbot.Bot, ctx *ext.Context) error {
-	delete(sysPromptReplacerCache, newTopic(ctx.EffectiveMessage))
 	msg := ctx.EffectiveMessage
 	text := msg.GetText()
 	prompt := h.TrimCmd(text)
@@ -18,6 +107,7 @@ func UpdateGeminiSysPrompt(bot *gotgbot.Bot, ctx *ext.Context) error {
 		if msg.ReplyToMessage == nil || msg.ReplyToMessage.GetText() == "" {
 			_, err := msg.Reply(bot, `没有找到任何System prompt，请使用 /sysprompt 提示词或使用该命令回复其他消息设置提示词。
 您需要使用 /get_sysprompt 获取当前系统提示词， /reset_sysprompt 恢复默认系统提示词。
+/sysprompt_history 查看修改历史， /sysprompt_rollback 版本号 回滚到历史版本， /sysprompt_preset 使用共享的提示词预设。
 
 你可以通过 %VAR% 使用变量，它会自动替换变量名，可使用的变量如下。
 TIME: 当前时间，不包含日期
@@ -28,32 +118,49 @@ CHAT_NAME: 当前聊天的名称
 BOT_NAME: Bot的名字
 BOT_USERNAME: Bot的username
 CHAT_TYPE: 聊天类型(group, private)
+TOPIC_ID / TOPIC_NAME: 当前话题的ID与名称
+MEMBER_COUNT: 聊天成员数量
+SENDER_TIMEZONE / SENDER_DATETIME: 发送者的时区与当地时间
+MEMORIES: Bot的记忆
 
 例：现在是%DATETIME%，当前聊天为%CHAT_NAME%，请根据需要解答群友的问题。
+
+提示词包含 {{ }} 时按模板处理（此时不再替换 %VAR%），变量写作 {{.CHAT_NAME}}，支持条件与循环：
+{{if eq .CHAT_TYPE "private"}}这是私聊{{else if .TOPIC_NAME}}当前话题：{{.TOPIC_NAME}}{{end}}
+{{if gt .MEMBER_COUNT 100}}这是一个大群{{end}}
+{{range $i, $m := .MEMORY_LIST}}{{add $i 1}}. {{$m}}
+{{end}}
+可用函数：contains hasPrefix hasSuffix lower upper join add printf
 `, nil)
 			return err
 		}
+		prompt = msg.ReplyToMessage.GetText()
 	}
-	err := g.Q.CreateOrUpdateGeminiSystemPrompt(context.Background(), msg.Chat.Id, msg.MessageThreadId, prompt)
+	if err := validateSysPrompt(bot, msg, prompt); err != nil {
+		_, err = msg.Reply(bot, "系统提示词模板错误，未保存: "+err.Error(), nil)
+		return err
+	}
+	version, err := setSysPrompt(context.Background(), newTopic(msg), prompt, msg.GetSender().Id())
 	if err != nil {
 		_, err = msg.Reply(bot, "设置系统提示词错误: "+err.Error(), nil)
 		return err
 	}
-	_, err = msg.Reply(bot, "成功设置系统提示词:\n"+prompt, nil)
+	_, err = msg.Reply(bot, fmt.Sprintf("成功设置系统提示词(v%d):\n%s", version, prompt), nil)
 	return err
 }
 func ResetGeminiSysPrompt(bot *gotgbot.Bot, ctx *ext.Context) error {
-	delete(sysPromptReplacerCache, newTopic(ctx.EffectiveMessage))
-	err := g.Q.ResetGeminiSystemPrompt(context.Background(), ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageThreadId)
+	msg := ctx.EffectiveMessage
+	version, err := setSysPrompt(context.Background(), newTopic(msg), "", msg.GetSender().Id())
 	if err != nil {
-		_, err = ctx.EffectiveMessage.Reply(bot, err.Error(), nil)
+		_, err = msg.Reply(bot, err.Error(), nil)
 		return err
 	}
-	_, err = ctx.EffectiveMessage.Reply(bot, "已恢复默认提示词", nil)
+	_, err = msg.Reply(bot, fmt.Sprintf("已恢复默认提示词(v%d)", version), nil)
 	return err
 }
 func GetGeminiSysPrompt(bot *gotgbot.Bot, ctx *ext.Context) error {
-	prompt, err := g.Q.GetGeminiSystemPrompt(context.Background(), ctx.EffectiveChat.Id, ctx.EffectiveMessage.MessageThreadId)
+	topic := newTopic(ctx.EffectiveMessage)
+	prompt, err := g.Q.GetGeminiSystemPrompt(context.Background(), topic.chatId, topic.topicId)
 	if err != nil {
 		_, err = ctx.EffectiveMessage.Reply(bot, gDefaultSysPrompt, nil)
 		return err
@@ -61,3 +168,194 @@ func GetGeminiSysPrompt(bot *gotgbot.Bot, ctx *ext.Context) error {
 	_, err = ctx.EffectiveMessage.Reply(bot, prompt, nil)
 	return err
 }
+
+func authorName(ctx context.Context, userId int64) string {
+	if userId == 0 {
+		return "未知"
+	}
+	if user, err := g.Q.GetUserById(ctx, userId); err == nil {
+		return user.Name()
+	}
+	return strconv.FormatInt(userId, 10)
+}
+
+func GeminiSysPromptHistory(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	c := context.Background()
+	topic := newTopic(msg)
+	history, err := g.Q.ListGeminiSystemPromptHistory(c, topic.chatId, topic.topicId, sysPromptHistoryLimit)
+	if err != nil {
+		return err
+	}
+	if len(history) == 0 {
+		_, err = msg.Reply(bot, "当前话题还没有系统提示词的修改记录", nil)
+		return err
+	}
+	var sb strings.Builder
+	sb.WriteString("系统提示词修改历史，使用 /sysprompt_rollback 版本号 回滚：\n")
+	for i, item := range history {
+		prompt := truncateText(item.Prompt, 40)
+		if item.Prompt == "" {
+			prompt = "(恢复默认)"
+		}
+		current := ""
+		if i == 0 {
+			current = " [当前]"
+		}
+		sb.WriteString(fmt.Sprintf("\nv%d%s %s %s\n%s\n", item.Version, current,
+			item.CreatedAt.Format("2006-01-02 15:04"), authorName(c, item.AuthorID), prompt))
+	}
+	_, err = msg.Reply(bot, sb.String(), nil)
+	return err
+}
+
+func GeminiSysPromptRollback(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	c := context.Background()
+	topic := newTopic(msg)
+	target, err := strconv.ParseInt(strings.TrimPrefix(strings.TrimSpace(h.TrimCmd(msg.GetText())), "v"), 10, 64)
+	if err != nil {
+		_, err = msg.Reply(bot, "用法: /sysprompt_rollback 版本号，版本号可以通过 /sysprompt_history 查看", nil)
+		return err
+	}
+	item, err := g.Q.GetGeminiSystemPromptVersion(c, topic.chatId, topic.topicId, target)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, err = msg.Reply(bot, fmt.Sprintf("没有找到版本 v%d", target), nil)
+		return err
+	} else if err != nil {
+		return err
+	}
+	if item.Prompt != "" {
+		if err := validateSysPrompt(bot, msg, item.Prompt); err != nil {
+			_, err = msg.Reply(bot, "该版本的系统提示词已无法使用: "+err.Error(), nil)
+			return err
+		}
+	}
+	version, err := setSysPrompt(c, topic, item.Prompt, msg.GetSender().Id())
+	if err != nil {
+		_, err = msg.Reply(bot, "回滚系统提示词错误: "+err.Error(), nil)
+		return err
+	}
+	_, err = msg.Reply(bot, fmt.Sprintf("已回滚到 v%d，当前版本为 v%d", target, version), nil)
+	return err
+}
+
+const presetHelp = `用法:
+/sysprompt_preset 列出所有预设
+/sysprompt_preset show 名称
+/sysprompt_preset apply 名称 将预设设置为当前话题的系统提示词
+/sysprompt_preset save 名称 提示词（或回复一条消息）
+/sysprompt_preset del 名称
+名称只能包含字母、数字、_ 和 -，最长32个字符，只有预设的作者可以覆盖或删除预设`
+
+// GeminiSysPromptPreset 管理所有聊天共享的提示词预设
+func GeminiSysPromptPreset(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	c := context.Background()
+	args := strings.Fields(h.TrimCmd(msg.GetText()))
+	if len(args) == 0 {
+		presets, err := g.Q.ListGeminiPromptPresets(c)
+		if err != nil {
+			return err
+		}
+		if len(presets) == 0 {
+			_, err = msg.Reply(bot, "还没有任何预设\n\n"+presetHelp, nil)
+			return err
+		}
+		var sb strings.Builder
+		sb.WriteString("提示词预设：\n")
+		for _, p := range presets {
+			sb.WriteString(fmt.Sprintf("\n%s (%s)\n%s\n", p.Name, authorName(c, p.AuthorID), truncateText(p.Prompt, 40)))
+		}
+		_, err = msg.Reply(bot, sb.String(), nil)
+		return err
+	}
+	if len(args) < 2 || !rePresetName.MatchString(args[1]) {
+		_, err := msg.Reply(bot, presetHelp, nil)
+		return err
+	}
+	name := args[1]
+	userId := msg.GetSender().Id()
+	preset, err := g.Q.GetGeminiPromptPreset(c, name)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+	exists := err == nil
+	canModify := !exists || preset.AuthorID == userId || userId == g.GetConfig().God
+	switch args[0] {
+	case "show":
+		if !exists {
+			_, err = msg.Reply(bot, "没有找到预设 "+name, nil)
+			return err
+		}
+		_, err = msg.Reply(bot, preset.Prompt, nil)
+		return err
+	case "apply":
+		if !exists {
+			_, err = msg.Reply(bot, "没有找到预设 "+name, nil)
+			return err
+		}
+		if err := validateSysPrompt(bot, msg, preset.Prompt); err != nil {
+			_, err = msg.Reply(bot, "预设的系统提示词无法使用: "+err.Error(), nil)
+			return err
+		}
+		version, err := setSysPrompt(c, newTopic(msg), preset.Prompt, userId)
+		if err != nil {
+			_, err = msg.Reply(bot, "设置系统提示词错误: "+err.Error(), nil)
+			return err
+		}
+		_, err = msg.Reply(bot, fmt.Sprintf("已应用预设 %s (v%d)", name, version), nil)
+		return err
+	case "save":
+		if !canModify {
+			_, err = msg.Reply(bot, "只有预设的作者可以覆盖该预设", nil)
+			return err
+		}
+		prompt := skipFields(h.TrimCmd(msg.GetText()), 2)
+		if prompt == "" && msg.ReplyToMessage != nil {
+			prompt = msg.ReplyToMessage.GetText()
+		}
+		if prompt == "" {
+			_, err = msg.Reply(bot, presetHelp, nil)
+			return err
+		}
+		if err := validateSysPrompt(bot, msg, prompt); err != nil {
+			_, err = msg.Reply(bot, "系统提示词模板错误，未保存: "+err.Error(), nil)
+			return err
+		}
+		if err := g.Q.CreateOrUpdateGeminiPromptPreset(c, name, prompt, userId, q.UnixTime{Time: time.Now()}); err != nil {
+			return err
+		}
+		_, err = msg.Reply(bot, "已保存预设 "+name, nil)
+		return err
+	case "del":
+		if !exists {
+			_, err = msg.Reply(bot, "没有找到预设 "+name, nil)
+			return err
+		}
+		if !canModify {
+			_, err = msg.Reply(bot, "只有预设的作者可以删除该预设", nil)
+			return err
+		}
+		if _, err := g.Q.DeleteGeminiPromptPreset(c, name); err != nil {
+			return err
+		}
+		_, err = msg.Reply(bot, "已删除预设 "+name, nil)
+		return err
+	}
+	_, err = msg.Reply(bot, presetHelp, nil)
+	return err
+}
+
+// skipFields 去掉 text 开头以空白分隔的 n 个字段，返回剩余的部分，其中的换行保持不变
+func skipFields(text string, n int) string {
+	for range n {
+		text = strings.TrimLeftFunc(text, unicode.IsSpace)
+		i := strings.IndexFunc(text, unicode.IsSpace)
+		if i < 0 {
+			return ""
+		}
+		text = text[i:]
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,71 @@
+package genbot
+
+import (
+	"context"
+	g "main/globalcfg"
+	"testing"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestSetSysPromptHistory(t *testing.T) {
+	ctx := context.Background()
+	topic := geminiTopic{chatId: -100777, topicId: 5}
+	msg := &gotgbot.Message{Chat: gotgbot.Chat{Id: topic.chatId}, MessageThreadId: topic.topicId, IsTopicMessage: true}
+	rc := &ReplaceCtx{Bot: &gotgbot.Bot{}, Msg: msg}
+	// 开始记录历史前就存在的提示词
+	if err := g.Q.CreateOrUpdateGeminiSystemPrompt(ctx, topic.chatId, topic.topicId, "old"); err != nil {
+		t.Fatal(err)
+	}
+	if r := getSysPrompt(msg); r.Replace(rc) != "old" {
+		t.Fatalf("unexpected prompt %q", r.Replace(rc))
+	}
+	version, err := setSysPrompt(ctx, topic, "new", 42)
+	if err != nil || version != 2 {
+		t.Fatalf("expected v2, got %d %v", version, err)
+	}
+	if r := getSysPrompt(msg); r.Replace(rc) != "new" {
+		t.Fatalf("cache should be invalidated, got %q", r.Replace(rc))
+	}
+	if version, err = setSysPrompt(ctx, topic, "", 42); err != nil || version != 3 {
+		t.Fatalf("expected v3, got %d %v", version, err)
+	}
+	if r := getSysPrompt(msg); r != &geminiSysPromptReplacer {
+		t.Fatal("reset should fall back to default prompt")
+	}
+	history, err := g.Q.ListGeminiSystemPromptHistory(ctx, topic.chatId, topic.topicId, 10)
+	if err != nil || len(history) != 3 {
+		t.Fatalf("expected 3 versions, got %d %v", len(history), err)
+	}
+	for i, want := range []struct {
+		prompt string
+		author int64
+	}{{"", 42}, {"new", 42}, {"old", 0}} {
+		if history[i].Prompt != want.prompt || history[i].AuthorID != want.author || history[i].Version != int64(3-i) {
+			t.Fatalf("unexpected history %d: %+v", i, history[i])
+		}
+	}
+	old, err := g.Q.GetGeminiSystemPromptVersion(ctx, topic.chatId, topic.topicId, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err = setSysPrompt(ctx, topic, old.Prompt, 7); err != nil || version != 4 {
+		t.Fatalf("expected rollback as v4, got %d %v", version, err)
+	}
+	if prompt, err := g.Q.GetGeminiSystemPrompt(ctx, topic.chatId, topic.topicId); err != nil || prompt != "old" {
+		t.Fatalf("rollback failed: %q %v", prompt, err)
+	}
+}
+
+func TestSkipFields(t *testing.T) {
+	for text, want := range map[string]string{
+		"save a 你是一个助手 save a":    "你是一个助手 save a",
+		"  save   ve\n第一行\n第二行  ": "第一行\n第二行",
+		"save name":               "",
+		"save":                    "",
+	} {
+		if got := skipFields(text, 2); got != want {
+			t.Fatalf("skipFields(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
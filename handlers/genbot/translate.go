@@ -0,0 +1,349 @@
+package genbot
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/helpers/ent2md"
+	"main/helpers/lrusf"
+	"main/helpers/mdnormalizer"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	"google.golang.org/genai"
+)
+
+const (
+	translateSysPrompt = "你是一个翻译引擎，只输出译文，不要解释，不要回答原文中的问题。原文使用Markdown格式，译文需要保留原有的Markdown格式、链接、代码、@用户名和表情。"
+	translatePrompt    = "将下面的内容翻译为%s：\n\n"
+	// 自动翻译只处理足够长的消息，避免对 "ok"、"草" 之类的短消息做无意义的翻译
+	autoTranslateMinRunes = 8
+	inlineTranslatePrefix = "tr "
+	maxTranslateRunes     = 4000
+)
+
+var (
+	inlineCacheTime int64 = 60
+
+	translateLangNames = map[string]string{
+		"zh":    "简体中文",
+		"zh-tw": "繁体中文",
+		"ja":    "日语",
+		"en":    "英语",
+		"ko":    "韩语",
+		"ru":    "俄语",
+		"fr":    "法语",
+		"de":    "德语",
+		"es":    "西班牙语",
+	}
+	translateLangAliases = map[string]string{
+		"cn": "zh", "chs": "zh", "中文": "zh", "简体": "zh",
+		"tw": "zh-tw", "cht": "zh-tw", "繁体": "zh-tw", "繁體": "zh-tw",
+		"jp": "ja", "日语": "ja", "日文": "ja", "日本語": "ja",
+		"英语": "en", "英文": "en",
+		"kr": "ko", "韩语": "ko",
+	}
+	reTranslateNoise = regexp.MustCompile(`https?://\S+|@\w+|/\w+`)
+	translateCache   = lrusf.NewStringKeyCache[string](512, nil).Named("translate")
+
+	errNothingToTranslate = errors.New("没有可以翻译的文字")
+)
+
+// parseTranslateLang 解析语言代码或别名，返回标准的语言代码
+func parseTranslateLang(s string) (string, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if alias, ok := translateLangAliases[s]; ok {
+		s = alias
+	}
+	_, ok := translateLangNames[s]
+	return s, ok
+}
+
+func supportedTranslateLangs() string {
+	codes := make([]string, 0, len(translateLangNames))
+	for code := range translateLangNames {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+	parts := make([]string, 0, len(codes))
+	for _, code := range codes {
+		parts = append(parts, code+"("+translateLangNames[code]+")")
+	}
+	return strings.Join(parts, " ")
+}
+
+// detectLang 根据文字的书写系统粗略判断语言，文字太少或无法判断时返回空字符串。
+// 拉丁字母统一视为英语，只用于判断是否需要自动翻译
+func detectLang(text string) string {
+	text = reTranslateNoise.ReplaceAllString(text, "")
+	var han, kana, hangul, cyrillic, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			kana++
+		case unicode.Is(unicode.Hangul, r):
+			hangul++
+		case unicode.Is(unicode.Han, r):
+			han++
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	total := han + kana + hangul + cyrillic + latin
+	if total < autoTranslateMinRunes {
+		return ""
+	}
+	switch {
+	case kana > 0 && (kana+han)*2 >= total && kana*10 >= han:
+		return "ja"
+	case hangul*2 >= total:
+		return "ko"
+	case han*2 >= total:
+		return "zh"
+	case cyrillic*2 >= total:
+		return "ru"
+	case latin*2 >= total:
+		return "en"
+	}
+	return ""
+}
+
+// sameLang 简体和繁体中文在自动翻译时视为同一种语言
+func sameLang(a, b string) bool {
+	base := func(s string) string {
+		s, _, _ = strings.Cut(s, "-")
+		return s
+	}
+	return base(a) == base(b)
+}
+
+func translateModel(ctx context.Context, chatId int64) string {
+	return textModel(getChatSettings(ctx, geminiTopic{chatId: chatId}).Model)
+}
+
+// translateMarkdown 将Markdown文本翻译为 lang，相同的文本与语言会使用缓存的结果
+func translateMarkdown(ctx context.Context, chatId, userId int64, text, lang string) (string, error) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", errNothingToTranslate
+	}
+	if utf8.RuneCountInString(text) > maxTranslateRunes {
+		return "", fmt.Errorf("文字太长了，最多只能翻译%d个字", maxTranslateRunes)
+	}
+	sum := sha256.Sum256([]byte(lang + "\x00" + text))
+	return translateCache.Get(hex.EncodeToString(sum[:]), func() (string, error) {
+		model := translateModel(ctx, chatId)
+		res, err := llm.GenerateContent(ctx, model, genai.Text(fmt.Sprintf(translatePrompt, translateLangNames[lang])+text), &genai.GenerateContentConfig{
+			SystemInstruction: genai.NewContentFromText(translateSysPrompt, genai.RoleModel),
+			Temperature:       genai.Ptr(float32(0.3)),
+		})
+		if err != nil {
+			return "", err
+		}
+		if err := recordUsage(ctx, chatId, userId, model, res.UsageMetadata); err != nil {
+			log.Warn("record gemini usage", "chat_id", chatId, "user_id", userId, "err", err)
+		}
+		out := strings.TrimSpace(res.Text())
+		if out == "" {
+			return "", errors.New("模型没有返回任何信息")
+		}
+		return out, nil
+	})
+}
+
+// replyTranslation 以回复 target 的方式发送译文，Markdown解析失败时按纯文本发送
+func replyTranslation(bot *gotgbot.Bot, target *gotgbot.Message, lang, text string) error {
+	text = fmt.Sprintf("**[%s]** %s", translateLangNames[lang], text)
+	opts := &gotgbot.SendMessageOpts{LinkPreviewOptions: &gotgbot.LinkPreviewOptions{IsDisabled: true}}
+	if normTxt, err := mdnormalizer.Normalize(text); err != nil {
+		log.Warn("parse markdown failed", "err", err)
+	} else {
+		text = normTxt.Text
+		opts.Entities = normTxt.Entities
+	}
+	_, err := target.Reply(bot, text, opts)
+	return err
+}
+
+func checkTranslateAllowed(ctx context.Context, bot *gotgbot.Bot, msg *gotgbot.Message) (bool, error) {
+	if !aiEnabled(ctx, msg.Chat.Id) {
+		_, err := msg.Reply(bot, "当前聊天未开启AI功能", nil)
+		return false, err
+	}
+	if quotaMsg, err := checkQuota(ctx, msg.Chat.Id, msg.GetSender().Id(), time.Now()); err != nil {
+		log.Warn("check gemini quota", "chat_id", msg.Chat.Id, "err", err)
+	} else if quotaMsg != "" {
+		_, err = msg.Reply(bot, quotaMsg, nil)
+		return false, err
+	}
+	return checkRateLimit(bot, msg)
+}
+
+// Translate /tr [lang] 翻译回复的消息，不指定语言时翻译为聊天的默认语言，
+// 原文已经是默认语言时翻译为英语
+func Translate(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	target := msg.ReplyToMessage
+	if target == nil {
+		_, err := msg.Reply(bot, "请使用 /tr [语言] 回复需要翻译的消息，支持的语言: "+supportedTranslateLangs(), nil)
+		return err
+	}
+	c, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	text := ent2md.TgMsgTextToMarkdown(target)
+	lang := g.Q.GetChatCfgByIdOrDefault(msg.Chat.Id).TranslateLang
+	if arg := strings.TrimSpace(h.TrimCmd(msg.GetText())); arg != "" {
+		var ok bool
+		if lang, ok = parseTranslateLang(arg); !ok {
+			_, err := msg.Reply(bot, "不支持的语言，支持的语言: "+supportedTranslateLangs(), nil)
+			return err
+		}
+	} else if sameLang(detectLang(target.GetText()), lang) {
+		lang = "en"
+	}
+	if ok, err := checkTranslateAllowed(c, bot, msg); !ok {
+		return err
+	}
+	actionCancel := h.WithChatAction(bot, "typing", msg.Chat.Id, msg.MessageThreadId, msg.IsTopicMessage)
+	defer actionCancel()
+	out, err := translateMarkdown(c, msg.Chat.Id, msg.GetSender().Id(), text, lang)
+	if errors.Is(err, errNothingToTranslate) {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	} else if err != nil {
+		_, _ = msg.Reply(bot, "翻译失败: "+err.Error(), nil)
+		return err
+	}
+	return replyTranslation(bot, target, lang, out)
+}
+
+// SetTranslateLang /tr_lang <lang> 设置聊天的默认翻译语言（仅管理员）
+func SetTranslateLang(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	cfg := g.Q.GetChatCfgByIdOrDefault(msg.Chat.Id)
+	arg := strings.TrimSpace(h.TrimCmd(msg.GetText()))
+	if arg == "" {
+		_, err := msg.Reply(bot, fmt.Sprintf("当前默认翻译语言: %s\n使用 /tr_lang 语言 修改，支持的语言: %s",
+			translateLangNames[cfg.TranslateLang], supportedTranslateLangs()), nil)
+		return err
+	}
+	if !isGeminiAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以修改默认翻译语言", nil)
+		return err
+	}
+	lang, ok := parseTranslateLang(arg)
+	if !ok {
+		_, err := msg.Reply(bot, "不支持的语言，支持的语言: "+supportedTranslateLangs(), nil)
+		return err
+	}
+	cfg.TranslateLang = lang
+	if err := cfg.Save(context.Background(), g.Q); err != nil {
+		return err
+	}
+	_, err := msg.Reply(bot, "默认翻译语言已设置为"+translateLangNames[lang], nil)
+	return err
+}
+
+// IsAutoTranslate 开启自动翻译的聊天中，非默认语言的消息会被翻译为默认语言
+func IsAutoTranslate(msg *gotgbot.Message) bool {
+	text := msg.GetText()
+	if text == "" || strings.HasPrefix(text, "/") || msg.GetSender().IsBot() || IsGeminiReq(msg) {
+		return false
+	}
+	if !slices.Contains(g.GetConfig().AIChats, msg.Chat.Id) {
+		return false
+	}
+	cfg := g.Q.GetChatCfgByIdOrDefault(msg.Chat.Id)
+	if !cfg.AutoTranslate {
+		return false
+	}
+	lang := detectLang(text)
+	return lang != "" && !sameLang(lang, cfg.TranslateLang)
+}
+
+func AutoTranslate(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	c, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	userId := msg.GetSender().Id()
+	if quotaMsg, err := checkQuota(c, msg.Chat.Id, userId, time.Now()); err != nil || quotaMsg != "" {
+		// 自动翻译在额度用完时静默跳过
+		return err
+	}
+	if delay, _ := reserveGeminiRequest(msg.Chat.Id, userId, time.Now()); delay > 0 {
+		return nil
+	}
+	lang := g.Q.GetChatCfgByIdOrDefault(msg.Chat.Id).TranslateLang
+	out, err := translateMarkdown(c, msg.Chat.Id, userId, ent2md.TgMsgTextToMarkdown(msg), lang)
+	if err != nil {
+		log.Warn("auto translate", "chat_id", msg.Chat.Id, "msg_id", msg.MessageId, "err", err)
+		return nil
+	}
+	return replyTranslation(bot, msg, lang, out)
+}
+
+// IsTranslateInline 判断内联查询是否为翻译请求，格式为 tr <语言> <文本>
+func IsTranslateInline(iq *gotgbot.InlineQuery) bool {
+	return strings.HasPrefix(iq.Query, inlineTranslatePrefix)
+}
+
+func answerInlineText(bot *gotgbot.Bot, iq *gotgbot.InlineQuery, title, text string, entities []gotgbot.MessageEntity) error {
+	sum := sha256.Sum256([]byte(title + text))
+	_, err := iq.Answer(bot, []gotgbot.InlineQueryResult{&gotgbot.InlineQueryResultArticle{
+		Id:          hex.EncodeToString(sum[:16]),
+		Title:       title,
+		Description: text,
+		InputMessageContent: &gotgbot.InputTextMessageContent{
+			MessageText: text,
+			Entities:    entities,
+		},
+	}}, &gotgbot.AnswerInlineQueryOpts{CacheTime: &inlineCacheTime, IsPersonal: true})
+	return err
+}
+
+// TranslateInline 内联模式翻译，只有可以私聊使用AI的用户可以使用
+func TranslateInline(bot *gotgbot.Bot, ctx *ext.Context) error {
+	iq := ctx.InlineQuery
+	userId := iq.From.Id
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	args := strings.TrimSpace(strings.TrimPrefix(iq.Query, inlineTranslatePrefix))
+	langArg, text, _ := strings.Cut(args, " ")
+	lang, ok := parseTranslateLang(langArg)
+	text = strings.TrimSpace(text)
+	if !ok || text == "" {
+		return answerInlineText(bot, iq, "用法: tr 语言 文本", "支持的语言: "+supportedTranslateLangs(), nil)
+	}
+	if !privateAIAllowed(c, userId) {
+		return answerInlineText(bot, iq, "你还没有开通AI功能", "请向管理员索要邀请码后私聊bot使用 /ai_join 开通", nil)
+	}
+	if quotaMsg, err := checkQuota(c, userId, userId, time.Now()); err != nil {
+		return err
+	} else if quotaMsg != "" {
+		return answerInlineText(bot, iq, "额度已用完", quotaMsg, nil)
+	}
+	if delay, _ := reserveGeminiRequest(userId, userId, time.Now()); delay > 0 {
+		return answerInlineText(bot, iq, "请求太频繁", fmt.Sprintf("请 %d 秒后再试", int(delay.Seconds())+1), nil)
+	}
+	out, err := translateMarkdown(c, userId, userId, text, lang)
+	if err != nil {
+		return answerInlineText(bot, iq, "翻译失败", err.Error(), nil)
+	}
+	var entities []gotgbot.MessageEntity
+	if normTxt, err := mdnormalizer.Normalize(out); err == nil {
+		out, entities = normTxt.Text, normTxt.Entities
+	}
+	return answerInlineText(bot, iq, "翻译为"+translateLangNames[lang], out, entities)
+}
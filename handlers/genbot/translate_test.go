@@ -0,0 +1,70 @@
+package genbot
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestDetectLang(t *testing.T) {
+	cases := map[string]string{
+		"今天天气真不错，我们出去玩吧":                          "zh",
+		"今日はとても良い天気ですね、散歩に行きましょう":                 "ja",
+		"오늘 날씨가 정말 좋네요 산책하러 가요":                   "ko",
+		"Сегодня очень хорошая погода":            "ru",
+		"The weather is really nice today":        "en",
+		"ok":                                      "",
+		"草":                                       "",
+		"看看这个 https://example.com/some/long/path": "",
+		"@someone_with_long_name 好的":              "",
+	}
+	for text, want := range cases {
+		if got := detectLang(text); got != want {
+			t.Errorf("detectLang(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func TestParseTranslateLang(t *testing.T) {
+	for in, want := range map[string]string{"ja": "ja", "JP": "ja", "日文": "ja", "cn": "zh", "繁体": "zh-tw", "en": "en"} {
+		if got, ok := parseTranslateLang(in); !ok || got != want {
+			t.Errorf("parseTranslateLang(%q) = %q %v, want %q", in, got, ok, want)
+		}
+	}
+	if _, ok := parseTranslateLang("xx"); ok {
+		t.Fatal("unknown language should be rejected")
+	}
+	if !sameLang("zh", "zh-tw") || sameLang("zh", "ja") {
+		t.Fatal("sameLang should only compare base language")
+	}
+}
+
+func TestTranslateMarkdown(t *testing.T) {
+	ctx := context.Background()
+	mock := &mockProvider{replies: []string{"**你好**，世界"}}
+	old := llm
+	llm = mock
+	t.Cleanup(func() { llm = old })
+
+	const chatId = -1009100000
+	for range 2 {
+		out, err := translateMarkdown(ctx, chatId, 1, "**Hello**, world", "zh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != "**你好**，世界" {
+			t.Fatalf("unexpected translation %q", out)
+		}
+	}
+	// 第二次使用缓存，不会再请求模型
+	if len(mock.requests) != 1 {
+		t.Fatalf("expected 1 request, got %d", len(mock.requests))
+	}
+	req := mock.requests[0]
+	if !strings.Contains(req.Contents[0].Parts[0].Text, "简体中文") || !strings.HasSuffix(req.Contents[0].Parts[0].Text, "**Hello**, world") {
+		t.Fatalf("unexpected prompt %q", req.Contents[0].Parts[0].Text)
+	}
+	if _, err := translateMarkdown(ctx, chatId, 1, "  ", "zh"); err != errNothingToTranslate {
+		t.Fatalf("empty text should be rejected, err=%v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"main/helpers/imgproc"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	chartTopUsers  = 10
+	chartTrendDays = 30
+)
+
+func topUserChartItems(stats q.UserMsgStatMap, n int) []imgproc.ChartItem {
+	items := make([]imgproc.ChartItem, 0, len(stats))
+	ids := make([]int64, 0, len(stats))
+	for u, c := range stats {
+		if c == nil || c.MsgCount == 0 {
+			continue
+		}
+		ids = append(ids, u)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return stats[ids[i]].MsgCount > stats[ids[j]].MsgCount
+	})
+	for _, u := range ids[:min(n, len(ids))] {
+		items = append(items, imgproc.ChartItem{Label: statUserName(u), Value: stats[u].MsgCount})
+	}
+	return items
+}
+
+// trendChartItems 将 [from, to] 内的每日消息数转换为折线图数据，没有记录的日期为0
+func trendChartItems(days []q.ChatStatDaily, from, to int64) []imgproc.ChartItem {
+	counts := make(map[int64]int64, len(days))
+	for _, d := range days {
+		counts[d.StatDate] = d.MessageCount
+	}
+	items := make([]imgproc.ChartItem, 0, to-from+1)
+	for day := from; day <= to; day++ {
+		items = append(items, imgproc.ChartItem{Label: statDayToDate(day).Format("01-02"), Value: counts[day]})
+	}
+	return items
+}
+
+// renderStatCharts 生成活跃时段、发言排行和截止到 r.To 的30天趋势图，没有数据的图会被跳过
+func renderStatCharts(ctx context.Context, chatId int64, r statRange, stat *q.ChatStatDaily) ([][]byte, error) {
+	trendFrom := r.To - chartTrendDays + 1
+	days, err := g.Q.ListChatStatRange(ctx, chatId, trendFrom, r.To)
+	if err != nil {
+		return nil, err
+	}
+	renders := []func() ([]byte, error){
+		func() ([]byte, error) {
+			return imgproc.RenderActivityHistogram(r.Label+"活跃时段", stat.MsgCountByTime[:])
+		},
+		func() ([]byte, error) {
+			return imgproc.RenderTopBarChart(r.Label+"发言排行", topUserChartItems(stat.UserMsgStat, chartTopUsers))
+		},
+		func() ([]byte, error) {
+			return imgproc.RenderTrendChart(fmt.Sprintf("最近%d天消息数", chartTrendDays), trendChartItems(days, trendFrom, r.To))
+		},
+	}
+	charts := make([][]byte, 0, len(renders))
+	for _, render := range renders {
+		data, err := render()
+		if errors.Is(err, imgproc.ErrEmptyChart) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		charts = append(charts, data)
+	}
+	return charts, nil
+}
+
+func sendStatCharts(bot *gotgbot.Bot, chatId int64, r statRange, stat *q.ChatStatDaily) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	charts, err := renderStatCharts(ctx, chatId, r, stat)
+	if err != nil {
+		return err
+	}
+	switch len(charts) {
+	case 0:
+		return nil
+	case 1:
+		_, err = bot.SendPhoto(chatId, gotgbot.InputFileByReader("stat.png", bytes.NewReader(charts[0])), nil)
+		return err
+	}
+	media := make([]gotgbot.InputMedia, 0, len(charts))
+	for i, data := range charts {
+		media = append(media, &gotgbot.InputMediaPhoto{
+			Media: gotgbot.InputFileByReader(fmt.Sprintf("stat_%d.png", i), bytes.NewReader(data)),
+		})
+	}
+	_, err = bot.SendMediaGroup(chatId, media, nil)
+	return err
+}
+
+// sendDayStatCharts 发送 target 所在那一天的统计图表，用于每天早上的统计消息
+func sendDayStatCharts(bot *gotgbot.Bot, chatId int64, target time.Time) error {
+	stat, loc, err := g.Q.ChatStatOfDay(context.Background(), chatId, target.Unix())
+	if err != nil {
+		return err
+	}
+	day := q.StatDayOf(target.Unix(), loc)
+	r := statRange{From: day, To: day, Label: statDayToDate(day).Format("01月02日")}
+	return sendStatCharts(bot, chatId, r, &stat)
+}
+
+// StatChart /stat_chart [week|month|YYYY-MM-DD..YYYY-MM-DD] 以图表形式发送统计，不带参数时为今天
+func StatChart(bot *gotgbot.Bot, ctx *ext.Context) error {
+	chatId := ctx.EffectiveChat.Id
+	loc := g.Q.GetChatCfgByIdOrDefault(chatId).Location()
+	now := time.Now()
+	today := q.StatDayOf(now.Unix(), loc)
+	r := statRange{From: today, To: today, Label: "今天"}
+	if arg := strings.TrimSpace(h.TrimCmd(ctx.EffectiveMessage.GetText())); arg != "" {
+		var err error
+		if r, err = parseStatRange("stat_chart", arg, now, loc); err != nil {
+			_, err = ctx.EffectiveMessage.Reply(bot, err.Error(), nil)
+			return err
+		}
+	}
+	days, err := g.Q.ListChatStatRange(context.Background(), chatId, r.From, r.To)
+	if err != nil {
+		return err
+	}
+	stat := q.MergeChatStats(days)
+	if stat.MessageCount == 0 {
+		_, err = ctx.EffectiveMessage.Reply(bot, "没有数据", nil)
+		return err
+	}
+	return sendStatCharts(bot, chatId, r, &stat)
+}
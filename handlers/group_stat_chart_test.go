@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"main/globalcfg/q"
+	"testing"
+)
+
+func TestTrendChartItems(t *testing.T) {
+	const from int64 = 19800
+	days := []q.ChatStatDaily{{StatDate: from + 1, MessageCount: 5}, {StatDate: from + 3, MessageCount: 7}}
+	items := trendChartItems(days, from, from+3)
+	if len(items) != 4 {
+		t.Fatalf("expected 4 points, got %d", len(items))
+	}
+	want := []int64{0, 5, 0, 7}
+	for i, it := range items {
+		if it.Value != want[i] {
+			t.Fatalf("point %d: got %d, want %d", i, it.Value, want[i])
+		}
+	}
+	if items[0].Label != statDayToDate(from).Format("01-02") {
+		t.Fatalf("unexpected label %q", items[0].Label)
+	}
+
+	stats := q.UserMsgStatMap{1: {MsgCount: 3}, 2: {MsgCount: 9}, 3: {MsgCount: 0}, 4: nil}
+	top := topUserChartItems(stats, 10)
+	if len(top) != 2 || top[0].Value != 9 || top[1].Value != 3 {
+		t.Fatalf("unexpected top users %+v", top)
+	}
+}
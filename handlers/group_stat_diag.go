@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
 	"sort"
 	"strings"
 	"time"
@@ -12,18 +14,13 @@ import (
 	"github.com/PaulSonOfLars/gotgbot/v2/ext"
 )
 
-func GetRank(bot *gotgbot.Bot, ctx *ext.Context) error {
-	stat := g.Q.ChatStatAt(ctx.EffectiveChat.Id, time.Now().Unix())
-	if stat == nil || len(stat.UserMsgStat) == 0 {
-		_, err := bot.SendMessage(ctx.EffectiveChat.Id, "没有数据", nil)
-		return err
-	}
+func formatRank(stats q.UserMsgStatMap) string {
 	type userCount struct {
 		user  int64
 		count int64
 	}
-	tmp := make([]userCount, 0, len(stat.UserMsgStat))
-	for u, c := range stat.UserMsgStat {
+	tmp := make([]userCount, 0, len(stats))
+	for u, c := range stats {
 		if c == nil {
 			continue
 		}
@@ -37,12 +34,7 @@ func GetRank(bot *gotgbot.Bot, ctx *ext.Context) error {
 		if i >= 10 {
 			break
 		}
-		user, err := g.Q.GetUserById(context.Background(), v.user)
-		if err != nil {
-			res = append(res, "不知道是谁")
-			continue
-		}
-		res = append(res, fmt.Sprintf("%s: %d", user.Name(), v.count))
+		res = append(res, fmt.Sprintf("%s: %d", statUserName(v.user), v.count))
 	}
 	if len(tmp) > 10 {
 		sum := int64(0)
@@ -51,18 +43,52 @@ func GetRank(bot *gotgbot.Bot, ctx *ext.Context) error {
 		}
 		res = append(res, fmt.Sprintf("其他人: %d", sum))
 	}
-	text := strings.Join(res, "\n")
+	return strings.Join(res, "\n")
+}
+
+// GetRank 今天的发言排行，/rank week|month 查看多天的排行
+func GetRank(bot *gotgbot.Bot, ctx *ext.Context) error {
+	chatId := ctx.EffectiveChat.Id
+	var stats q.UserMsgStatMap
+	if arg := strings.TrimSpace(h.TrimCmd(ctx.EffectiveMessage.GetText())); arg != "" {
+		r, err := parseStatRange("rank", arg, time.Now(), g.Q.GetChatCfgByIdOrDefault(chatId).Location())
+		if err != nil {
+			_, err = ctx.EffectiveMessage.Reply(bot, err.Error(), nil)
+			return err
+		}
+		days, err := g.Q.ListChatStatRange(context.Background(), chatId, r.From, r.To)
+		if err != nil {
+			return err
+		}
+		stats = q.MergeChatStats(days).UserMsgStat
+	} else if stat := g.Q.ChatStatAt(chatId, time.Now().Unix()); stat != nil {
+		stats = stat.Snapshot().UserMsgStat
+	}
+	text := formatRank(stats)
 	if text == "" {
 		text = "没有数据"
 	}
-	_, err := bot.SendMessage(ctx.EffectiveChat.Id, text, nil)
+	_, err := bot.SendMessage(chatId, text, nil)
 	return err
 }
 
+// SendGroupStat 预览昨天和今天的每日统计，/diag_sendstat <模板> 使用未保存的模板预览（仅管理员）
 func SendGroupStat(bot *gotgbot.Bot, ctx *ext.Context) error {
 	chatId := ctx.EffectiveChat.Id
-	if err := sendChatStat(bot, chatId, time.Now().Add(-24*time.Hour)); err != nil {
+	var tmpl *string
+	if text := strings.TrimSpace(h.TrimCmd(ctx.EffectiveMessage.GetText())); text != "" {
+		if !h.IsSenderAdmin(bot, ctx.EffectiveMessage) {
+			_, err := ctx.EffectiveMessage.Reply(bot, "只有管理员可以预览自定义模板", nil)
+			return err
+		}
+		if err := validateStatTemplate(text); err != nil {
+			_, err = ctx.EffectiveMessage.Reply(bot, "模板有误: "+err.Error(), nil)
+			return err
+		}
+		tmpl = &text
+	}
+	if err := sendChatStatWithTemplate(bot, chatId, time.Now().Add(-24*time.Hour), tmpl); err != nil {
 		return err
 	}
-	return sendChatStat(bot, chatId, time.Now())
+	return sendChatStatWithTemplate(bot, chatId, time.Now(), tmpl)
 }
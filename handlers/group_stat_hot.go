@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"main/helpers/imgproc"
+	"main/helpers/wordseg"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	hotCaptionWords = 10
+	hotCloudWords   = 100
+	hotKeepPerDay   = 300
+	// 消息写入存档有延迟，最近这段时间的消息留到下次统计
+	hotArchiveDelay = 5 * time.Minute
+)
+
+var errHotUsage = errors.New("用法: /hot [day|week]")
+
+// hotUpdateLocks 每个聊天一把锁（*sync.Mutex），避免同一段消息被并发的统计重复计数。
+// 读取存档在锁外进行，写入前在锁内重新检查这一天统计到的时间
+var hotUpdateLocks sync.Map
+
+func hotUpdateLock(chatId int64) *sync.Mutex {
+	mu, _ := hotUpdateLocks.LoadOrStore(chatId, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
+
+// countKeywords 统计消息中的热词，一条消息中重复出现的词只计一次
+func countKeywords(msgs []archiveStatMsg) map[string]int64 {
+	seg := wordseg.Default()
+	counts := make(map[string]int64)
+	for _, m := range msgs {
+		for _, w := range seg.Keywords(m.Message) {
+			counts[w]++
+		}
+	}
+	return counts
+}
+
+// saveDayKeywords 累加一天的热词并记录统计到的时间，complete 为 true 时这一天已经统计完，只保留次数最多的词
+func saveDayKeywords(ctx context.Context, chatId, day int64, counts map[string]int64, scannedUntil int64, complete bool) (err error) {
+	tx, err := g.RawMainDb().BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+	qtx := g.Q.WithTx(tx)
+	for w, c := range counts {
+		if err = qtx.AddChatKeywordCount(ctx, chatId, day, w, c); err != nil {
+			return err
+		}
+	}
+	if complete {
+		err = qtx.PruneChatKeywords(ctx, q.PruneChatKeywordsParams{
+			ChatID:     chatId,
+			StatDate:   day,
+			ChatID_2:   chatId,
+			StatDate_2: day,
+			Limit:      hotKeepPerDay,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err = qtx.SetChatKeywordScan(ctx, chatId, day, scannedUntil); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// updateChatKeywords 增量统计 r 内每天的热词，只读取每天已经统计到的时间之后的存档消息
+func updateChatKeywords(ctx context.Context, chatId int64, r statRange, loc *time.Location, now time.Time) error {
+	scans, err := g.Q.ListChatKeywordScans(ctx, chatId, r.From, r.To)
+	if err != nil {
+		return err
+	}
+	scanned := make(map[int64]int64, len(scans))
+	for _, s := range scans {
+		scanned[s.StatDate] = s.ScannedUntil
+	}
+	limit := now.Add(-hotArchiveDelay).Unix()
+	for day := r.From; day <= r.To; day++ {
+		start, dayEnd := q.StatDayStart(day, loc), q.StatDayStart(day+1, loc)
+		end := min(dayEnd, limit)
+		from := max(start, scanned[day])
+		if from >= end {
+			continue
+		}
+		msgs, err := fetchArchiveStatMsgs(chatId, from, end)
+		if err != nil {
+			return err
+		}
+		if err = saveFetchedKeywords(ctx, chatId, day, msgs, end, end == dayEnd); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveFetchedKeywords 在聊天的锁内保存读取到的 [from, end) 内的消息，
+// 读取期间其他统计已经计入的消息会被去掉
+func saveFetchedKeywords(ctx context.Context, chatId, day int64, msgs []archiveStatMsg, end int64, complete bool) error {
+	mu := hotUpdateLock(chatId)
+	mu.Lock()
+	defer mu.Unlock()
+	scans, err := g.Q.ListChatKeywordScans(ctx, chatId, day, day)
+	if err != nil {
+		return err
+	}
+	if len(scans) > 0 {
+		scanned := scans[0].ScannedUntil
+		if scanned >= end {
+			return nil
+		}
+		msgs = slices.DeleteFunc(msgs, func(m archiveStatMsg) bool { return int64(m.Date) < scanned })
+	}
+	return saveDayKeywords(ctx, chatId, day, countKeywords(msgs), end, complete)
+}
+
+// chatHotKeywords 更新并返回 r 内提到次数最多的 n 个词
+func chatHotKeywords(ctx context.Context, chatId int64, r statRange, loc *time.Location, n int) ([]imgproc.ChartItem, error) {
+	if err := updateChatKeywords(ctx, chatId, r, loc, time.Now()); err != nil {
+		return nil, err
+	}
+	rows, err := g.Q.ListTopChatKeywords(ctx, chatId, r.From, r.To, int64(n))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]imgproc.ChartItem, 0, len(rows))
+	for _, row := range rows {
+		items = append(items, imgproc.ChartItem{Label: row.Word, Value: row.Total})
+	}
+	return items, nil
+}
+
+func formatHotKeywords(label string, items []imgproc.ChartItem) string {
+	var sb strings.Builder
+	sb.WriteString(label + "的热词：")
+	for i, it := range items[:min(len(items), hotCaptionWords)] {
+		_, _ = fmt.Fprintf(&sb, "\n%d. %s（%d）", i+1, it.Label, it.Value)
+	}
+	return sb.String()
+}
+
+// sendHotKeywords 发送热词词云，没有热词时返回 imgproc.ErrEmptyChart
+func sendHotKeywords(bot *gotgbot.Bot, chatId int64, r statRange, loc *time.Location, opts *gotgbot.SendPhotoOpts) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	items, err := chatHotKeywords(ctx, chatId, r, loc, hotCloudWords)
+	if err != nil {
+		return err
+	}
+	data, err := imgproc.RenderWordCloud(r.Label+"热词", items)
+	if err != nil {
+		return err
+	}
+	if opts == nil {
+		opts = &gotgbot.SendPhotoOpts{}
+	}
+	opts.Caption = formatHotKeywords(r.Label, items)
+	_, err = bot.SendPhoto(chatId, gotgbot.InputFileByReader("hot.png", bytes.NewReader(data)), opts)
+	return err
+}
+
+// sendDayHotKeywords 发送 target 所在那一天的热词，用于每天早上的统计消息
+func sendDayHotKeywords(bot *gotgbot.Bot, chatId int64, target time.Time, loc *time.Location) error {
+	day := q.StatDayOf(target.Unix(), loc)
+	r := statRange{From: day, To: day, Label: statDayToDate(day).Format("01月02日")}
+	err := sendHotKeywords(bot, chatId, r, loc, nil)
+	if errors.Is(err, imgproc.ErrEmptyChart) {
+		return nil
+	}
+	return err
+}
+
+func parseHotRange(arg string, now time.Time, loc *time.Location) (statRange, error) {
+	today := q.StatDayOf(now.Unix(), loc)
+	switch strings.ToLower(strings.TrimSpace(arg)) {
+	case "", "day", "today", "今天", "日":
+		return statRange{From: today, To: today, Label: "今天"}, nil
+	case "week", "周":
+		return statRange{From: today - 6, To: today, Label: "最近7天"}, nil
+	}
+	return statRange{}, errHotUsage
+}
+
+// HotKeywords /hot [day|week] 根据消息存档发送今天或最近7天的热词和词云
+func HotKeywords(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	chatId := msg.Chat.Id
+	loc := g.Q.GetChatCfgByIdOrDefault(chatId).Location()
+	r, err := parseHotRange(h.TrimCmd(msg.GetText()), time.Now(), loc)
+	if err != nil {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	}
+	err = sendHotKeywords(bot, chatId, r, loc, &gotgbot.SendPhotoOpts{
+		ReplyParameters: MakeReplyToMsgID(msg.MessageId),
+	})
+	if errors.Is(err, imgproc.ErrEmptyChart) {
+		_, err = msg.Reply(bot, "没有数据，热词根据消息存档统计", nil)
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"testing"
+	"time"
+)
+
+func TestUpdateChatKeywordsIncremental(t *testing.T) {
+	const chatId = -1009990049
+	ctx := context.Background()
+	loc := g.Q.GetChatCfgByIdOrDefault(chatId).Location()
+	today := dateToStatDay(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC))
+	todayStart := q.StatDayStart(today, loc)
+	pastStart := todayStart - 2*statDaySeconds
+	msgs := []archiveStatMsg{
+		{FromID: 1, MsgID: 1, Date: float64(pastStart + 60), Message: "晚上去吃火锅吧，显卡好贵"},
+		{FromID: 2, MsgID: 2, Date: float64(pastStart + 120), Message: "火锅火锅！显卡又涨价了"},
+		{FromID: 1, MsgID: 3, Date: float64(todayStart + 60), Message: "今天也想吃火锅"},
+	}
+	for i := range hotKeepPerDay + 10 {
+		msgs = append(msgs, archiveStatMsg{FromID: 3, MsgID: int64(10 + i), Date: float64(pastStart + 600), Message: fmt.Sprintf("kw%03d", i)})
+	}
+	stubArchive(t, msgs)
+	fetch := fetchArchiveStatMsgs
+	var calls [][2]int64
+	fetchArchiveStatMsgs = func(chatId, from, to int64) ([]archiveStatMsg, error) {
+		calls = append(calls, [2]int64{from, to})
+		return fetch(chatId, from, to)
+	}
+
+	r := statRange{From: today - 2, To: today}
+	now := time.Unix(todayStart+3600, 0)
+	if err := updateChatKeywords(ctx, chatId, r, loc, now); err != nil {
+		t.Fatal(err)
+	}
+	top := func(from, to int64) map[string]int64 {
+		rows, err := g.Q.ListTopChatKeywords(ctx, chatId, from, to, 1000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res := make(map[string]int64, len(rows))
+		for _, row := range rows {
+			res[row.Word] = row.Total
+		}
+		return res
+	}
+	past := top(today-2, today-2)
+	if past["火锅"] != 2 || past["显卡"] != 2 || len(past) != hotKeepPerDay {
+		t.Fatalf("unexpected keywords of past day: 火锅=%d 显卡=%d len=%d", past["火锅"], past["显卡"], len(past))
+	}
+	if got := top(today, today)["火锅"]; got != 1 {
+		t.Fatalf("火锅 today = %d", got)
+	}
+	if len(calls) != 3 || calls[2] != [2]int64{todayStart, now.Add(-hotArchiveDelay).Unix()} {
+		t.Fatalf("unexpected fetches %v", calls)
+	}
+
+	// 再次统计时只读取今天上次统计之后的消息
+	stubArchive(t, append(msgs, archiveStatMsg{FromID: 2, MsgID: 1000, Date: float64(todayStart + 3600), Message: "火锅"}))
+	fetch = fetchArchiveStatMsgs
+	calls = nil
+	fetchArchiveStatMsgs = func(chatId, from, to int64) ([]archiveStatMsg, error) {
+		calls = append(calls, [2]int64{from, to})
+		return fetch(chatId, from, to)
+	}
+	later := now.Add(time.Hour)
+	if err := updateChatKeywords(ctx, chatId, r, loc, later); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0] != [2]int64{now.Add(-hotArchiveDelay).Unix(), later.Add(-hotArchiveDelay).Unix()} {
+		t.Fatalf("unexpected fetches %v", calls)
+	}
+	if got := top(today-2, today)["火锅"]; got != 4 {
+		t.Fatalf("火锅 in range = %d", got)
+	}
+}
+
+func TestParseHotRange(t *testing.T) {
+	now := time.Date(2024, 5, 6, 12, 0, 0, 0, time.UTC)
+	today := dateToStatDay(now)
+	if r, err := parseHotRange(" ", now, time.UTC); err != nil || r.From != today || r.To != today {
+		t.Fatalf("unexpected range %+v %v", r, err)
+	}
+	if r, err := parseHotRange("week", now, time.UTC); err != nil || r.From != today-6 || r.To != today {
+		t.Fatalf("unexpected range %+v %v", r, err)
+	}
+	if _, err := parseHotRange("month", now, time.UTC); err == nil {
+		t.Fatalf("month should be rejected")
+	}
+	text := formatHotKeywords("今天", nil)
+	if text != "今天的热词：" {
+		t.Fatalf("unexpected text %q", text)
+	}
+}
+
+func TestUpdateChatKeywordsConcurrent(t *testing.T) {
+	const chatId = -1009990050
+	ctx := context.Background()
+	loc := g.Q.GetChatCfgByIdOrDefault(chatId).Location()
+	day := dateToStatDay(time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC))
+	start := q.StatDayStart(day, loc)
+	stubArchive(t, []archiveStatMsg{
+		{FromID: 1, MsgID: 1, Date: float64(start + 60), Message: "火锅"},
+		{FromID: 1, MsgID: 2, Date: float64(start + 7200), Message: "火锅"},
+	})
+	fetch := fetchArchiveStatMsgs
+	r := statRange{From: day, To: day}
+	first, later := time.Unix(start+3600, 0), time.Unix(start+3*3600, 0)
+	nested := false
+	fetchArchiveStatMsgs = func(chatId, from, to int64) ([]archiveStatMsg, error) {
+		if !nested {
+			// 读取存档期间另一次统计已经完成，读取不再持有锁
+			nested = true
+			if err := updateChatKeywords(ctx, chatId, r, loc, later); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return fetch(chatId, from, to)
+	}
+	if err := updateChatKeywords(ctx, chatId, r, loc, first); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := g.Q.ListTopChatKeywords(ctx, chatId, day, day, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Word != "火锅" || rows[0].Total != 2 {
+		t.Fatalf("unexpected keywords %+v", rows)
+	}
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	statDaySeconds   = 24 * 60 * 60
+	statDateLayout   = "2006-01-02"
+	maxStatRangeDays = 366
+)
+
+// statRange 是闭区间 [From, To]，单位为 stat_date
+type statRange struct {
+	From, To int64
+	Label    string
+}
+
+func statDayToDate(day int64) time.Time {
+	return time.Unix(day*statDaySeconds, 0).UTC()
+}
+
+func dateToStatDay(t time.Time) int64 {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC).Unix() / statDaySeconds
+}
+
+func statRangeUsage(cmd string) error {
+	return fmt.Errorf("用法: /%s week|month|YYYY-MM-DD..YYYY-MM-DD", cmd)
+}
+
+// parseStatRange 解析命令 cmd 的统计范围参数，week 和 month 分别为包含今天在内的最近7天和30天
+func parseStatRange(cmd, arg string, now time.Time, loc *time.Location) (statRange, error) {
+	today := q.StatDayOf(now.Unix(), loc)
+	switch strings.ToLower(strings.TrimSpace(arg)) {
+	case "", "week", "周":
+		return statRange{From: today - 6, To: today, Label: "最近7天"}, nil
+	case "month", "月":
+		return statRange{From: today - 29, To: today, Label: "最近30天"}, nil
+	}
+	fromStr, toStr, ok := strings.Cut(arg, "..")
+	if !ok {
+		return statRange{}, statRangeUsage(cmd)
+	}
+	from, err1 := time.Parse(statDateLayout, strings.TrimSpace(fromStr))
+	to, err2 := time.Parse(statDateLayout, strings.TrimSpace(toStr))
+	if err1 != nil || err2 != nil {
+		return statRange{}, statRangeUsage(cmd)
+	}
+	r := statRange{From: dateToStatDay(from), To: dateToStatDay(to)}
+	if r.From > r.To {
+		return statRange{}, errors.New("开始日期不能晚于结束日期")
+	}
+	if r.To-r.From >= maxStatRangeDays {
+		return statRange{}, fmt.Errorf("统计范围最多%d天", maxStatRangeDays)
+	}
+	r.Label = from.Format(statDateLayout) + " 至 " + to.Format(statDateLayout)
+	return r, nil
+}
+
+// lastWeekRange 上周一到上周日
+func lastWeekRange(now time.Time, loc *time.Location) statRange {
+	today := q.StatDayOf(now.Unix(), loc)
+	weekday := int64(statDayToDate(today).Weekday()+6) % 7
+	monday := today - weekday - 7
+	return statRange{From: monday, To: monday + 6, Label: "上周"}
+}
+
+// lastMonthRange 上个月的第一天到最后一天
+func lastMonthRange(now time.Time, loc *time.Location) statRange {
+	today := statDayToDate(q.StatDayOf(now.Unix(), loc))
+	first := time.Date(today.Year(), today.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return statRange{
+		From:  dateToStatDay(first.AddDate(0, -1, 0)),
+		To:    dateToStatDay(first) - 1,
+		Label: first.AddDate(0, -1, 0).Format("2006年01月"),
+	}
+}
+
+func statUserName(userId int64) string {
+	user, err := g.Q.GetUserById(context.Background(), userId)
+	if err != nil {
+		return "不知道是谁"
+	}
+	return user.Name()
+}
+
+func formatRangeStatMessage(r statRange, days []q.ChatStatDaily) string {
+	if len(days) == 0 {
+		return r.Label + "没有数据"
+	}
+	stat := q.MergeChatStats(days)
+	busiest := days[0]
+	for _, d := range days[1:] {
+		if d.MessageCount > busiest.MessageCount {
+			busiest = d
+		}
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "<b>%s</b>（%s ~ %s）的发言统计：\n", html.EscapeString(r.Label),
+		statDayToDate(r.From).Format("01月02日"), statDayToDate(r.To).Format("01月02日"))
+	_, _ = fmt.Fprintf(&sb, "一共发了%d条消息，平均每天%d条，最热闹的是%s，发了%d条。\n",
+		stat.MessageCount, stat.MessageCount/(r.To-r.From+1),
+		statDayToDate(busiest.StatDate).Format("01月02日"), busiest.MessageCount)
+	users, counts := mostActiveUsers(&stat)
+	if len(users) > 0 {
+		names := make([]string, 0, len(users))
+		for i, u := range users {
+			names = append(names, fmt.Sprintf("%s(%d)", html.EscapeString(statUserName(u)), counts[i]))
+		}
+		sb.WriteString("最能吹水的是" + strings.Join(names, "、") + "。\n")
+	}
+	_, _ = fmt.Fprintf(&sb, "图片%d张，视频%d个，表情%d个，转发%d条。\n",
+		stat.PhotoCount, stat.VideoCount, stat.StickerCount, stat.ForwardCount)
+	_, _ = fmt.Fprintf(&sb, "火星图%d张，最多的一张火星了%d次；色图%d张，其中R18有%d张。\n",
+		stat.MarsCount, stat.MaxMarsCount, stat.AdultCount+stat.RacyCount, stat.AdultCount)
+	_, _ = fmt.Fprintf(&sb, "智乃酱下载了%d个视频，%d个音频。\n", stat.DownloadVideoCount, stat.DownloadAudioCount)
+	if _, seg, cnt := mostActiveTimeSeg(&stat); cnt > 0 {
+		_, _ = fmt.Fprintf(&sb, "每天最热闹的时段是%s，这十分钟累计发了%d条。", seg, cnt)
+	}
+	return strings.TrimSpace(sb.String())
+}
+
+func sendRangeStat(bot *gotgbot.Bot, chatId int64, r statRange) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	days, err := g.Q.ListChatStatRange(ctx, chatId, r.From, r.To)
+	if err != nil {
+		return err
+	}
+	_, err = bot.SendMessage(chatId, formatRangeStatMessage(r, days), &gotgbot.SendMessageOpts{ParseMode: "HTML"})
+	return err
+}
+
+// ChatStatRange /stat week|month|YYYY-MM-DD..YYYY-MM-DD 多天的汇总统计
+func ChatStatRange(bot *gotgbot.Bot, ctx *ext.Context) error {
+	chatId := ctx.EffectiveChat.Id
+	loc := g.Q.GetChatCfgByIdOrDefault(chatId).Location()
+	r, err := parseStatRange("stat", h.TrimCmd(ctx.EffectiveMessage.GetText()), time.Now(), loc)
+	if err != nil {
+		_, err = ctx.EffectiveMessage.Reply(bot, err.Error(), nil)
+		return err
+	}
+	return sendRangeStat(bot, chatId, r)
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"main/globalcfg/q"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseStatRange(t *testing.T) {
+	tz := q.LoadTimezone("", 8*3600)
+	// 2024-03-04 是星期一，北京时间 01:00 时UTC仍是前一天
+	now := time.Date(2024, 3, 4, 1, 0, 0, 0, tz)
+	date := func(day int64) string { return statDayToDate(day).Format(statDateLayout) }
+
+	r, err := parseStatRange("stat", "week", now, tz)
+	if err != nil || date(r.From) != "2024-02-27" || date(r.To) != "2024-03-04" {
+		t.Fatalf("week: %s..%s %v", date(r.From), date(r.To), err)
+	}
+	r, err = parseStatRange("stat", "month", now, tz)
+	if err != nil || date(r.From) != "2024-02-04" || date(r.To) != "2024-03-04" {
+		t.Fatalf("month: %s..%s %v", date(r.From), date(r.To), err)
+	}
+	r, err = parseStatRange("stat", "2024-02-01..2024-02-29", now, tz)
+	if err != nil || r.To-r.From != 28 || date(r.From) != "2024-02-01" {
+		t.Fatalf("custom: %s..%s %v", date(r.From), date(r.To), err)
+	}
+	for _, bad := range []string{"2024-03-01..2024-02-01", "2022-01-01..2024-01-01", "yesterday", "2024-02-01..x"} {
+		if _, err := parseStatRange("stat", bad, now, tz); err == nil {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+	if _, err = parseStatRange("rank", "yesterday", now, tz); err == nil || !strings.HasPrefix(err.Error(), "用法: /rank ") {
+		t.Fatalf("usage: %v", err)
+	}
+
+	r = lastWeekRange(now, tz)
+	if date(r.From) != "2024-02-26" || date(r.To) != "2024-03-03" {
+		t.Fatalf("last week: %s..%s", date(r.From), date(r.To))
+	}
+	r = lastMonthRange(now, tz)
+	if date(r.From) != "2024-02-01" || date(r.To) != "2024-02-29" || r.Label != "2024年02月" {
+		t.Fatalf("last month: %s..%s %s", date(r.From), date(r.To), r.Label)
+	}
+}
@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"main/helpers/meilisearch"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+	json "github.com/json-iterator/go"
+	"github.com/rivo/uniseg"
+)
+
+const (
+	rebuildPageSize     = 1000
+	rebuildMaxDiffLines = 40
+)
+
+var errStatRebuildUsage = errors.New("用法: /stat_rebuild YYYY-MM-DD YYYY-MM-DD [confirm]，不带 confirm 时只显示差异")
+
+// archiveStatMsg 重新计算统计用到的存档消息字段
+type archiveStatMsg struct {
+	FromID  int64   `json:"from_id"`
+	MsgID   int64   `json:"msg_id"`
+	Date    float64 `json:"date"`
+	Message string  `json:"message"`
+}
+
+// fetchArchiveStatMsgs 获取 [from, to) 内的全部存档消息，测试时可以替换
+var fetchArchiveStatMsgs = func(chatId, from, to int64) ([]archiveStatMsg, error) {
+	query := meilisearch.DocumentsQuery{
+		Filter: fmt.Sprintf("peer_id = %d AND date >= %d AND date < %d", chatId, from, to),
+		Fields: []string{"from_id", "msg_id", "date", "message"},
+		Limit:  rebuildPageSize,
+	}
+	var msgs []archiveStatMsg
+	for {
+		var res meilisearch.DocumentsResult[archiveStatMsg]
+		if err := g.Meili().FetchDocuments(query, &res); err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, res.Results...)
+		if len(res.Results) < rebuildPageSize {
+			return msgs, nil
+		}
+		query.Offset += rebuildPageSize
+	}
+}
+
+// statRebuildDay 一天的重新计算结果，Old 为数据库中原有的统计，没有记录时为 nil
+type statRebuildDay struct {
+	Old *q.ChatStatDaily
+	New q.ChatStatDaily
+}
+
+func (d *statRebuildDay) changed() bool {
+	if d.Old == nil {
+		return d.New.MessageCount > 0
+	}
+	if d.Old.MessageCount != d.New.MessageCount || d.Old.MsgCountByTime != d.New.MsgCountByTime ||
+		len(d.Old.UserMsgStat) != len(d.New.UserMsgStat) {
+		return true
+	}
+	for u, s := range d.New.UserMsgStat {
+		if o := d.Old.UserMsgStat[u]; o == nil || *o != *s {
+			return true
+		}
+	}
+	return false
+}
+
+// recomputeChatStat 根据一天的存档消息重新计算统计。存档中没有媒体类型、火星图和下载等信息，
+// 这些字段保留 old 中的值。存档里也没有不带文字的媒体消息，所以重新计算只会补上缺少的消息：
+// 每个用户的消息数、字数和每个时段的消息数都取 old 和存档中较大的值，不会减少已有的统计
+func recomputeChatStat(old *q.ChatStatDaily, chatId, day int64, loc *time.Location, msgs []archiveStatMsg) q.ChatStatDaily {
+	slices.SortFunc(msgs, func(a, b archiveStatMsg) int {
+		return cmp.Or(cmp.Compare(a.Date, b.Date), cmp.Compare(a.MsgID, b.MsgID))
+	})
+	stat := q.NewChatStat(chatId, day, loc)
+	for _, m := range msgs {
+		stat.IncMessage(m.FromID, int64(uniseg.GraphemeClusterCount(m.Message)), int64(m.Date), m.MsgID, 0)
+	}
+	res := stat.Snapshot()
+	if old == nil {
+		return res
+	}
+	merged := *old
+	merged.UserMsgStat = make(q.UserMsgStatMap, max(len(old.UserMsgStat), len(res.UserMsgStat)))
+	for u, o := range old.UserMsgStat {
+		if o != nil {
+			kept := *o
+			merged.UserMsgStat[u] = &kept
+		}
+	}
+	for u, s := range res.UserMsgStat {
+		m := merged.UserMsgStat[u]
+		if m == nil {
+			m = &q.UserMsgStat{}
+			merged.UserMsgStat[u] = m
+		}
+		m.MsgCount = max(m.MsgCount, s.MsgCount)
+		m.MsgLen = max(m.MsgLen, s.MsgLen)
+		for h := range m.MsgCountByHour {
+			m.MsgCountByHour[h] = max(m.MsgCountByHour[h], s.MsgCountByHour[h])
+		}
+	}
+	var userTotal int64
+	for _, m := range merged.UserMsgStat {
+		userTotal += m.MsgCount
+	}
+	merged.MessageCount = max(old.MessageCount, userTotal)
+	for i := range merged.MsgCountByTime {
+		merged.MsgCountByTime[i] = max(old.MsgCountByTime[i], res.MsgCountByTime[i])
+		// 时段的第一条消息取两者中较早的一条
+		if id := res.MsgIDAtTimeStart[i]; id != 0 && (merged.MsgIDAtTimeStart[i] == 0 || id < merged.MsgIDAtTimeStart[i]) {
+			merged.MsgIDAtTimeStart[i] = id
+		}
+	}
+	return merged
+}
+
+// planStatRebuild 计算 r 内每天的新统计，存档中没有消息的日期会被跳过并计入 skipped，避免清空没有存档的数据
+func planStatRebuild(ctx context.Context, chatId int64, r statRange, loc *time.Location) (days []statRebuildDay, skipped int, err error) {
+	existing, err := g.Q.ListChatStatRange(ctx, chatId, r.From, r.To)
+	if err != nil {
+		return nil, 0, err
+	}
+	oldByDay := make(map[int64]*q.ChatStatDaily, len(existing))
+	for i := range existing {
+		oldByDay[existing[i].StatDate] = &existing[i]
+	}
+	for day := r.From; day <= r.To; day++ {
+		msgs, err := fetchArchiveStatMsgs(chatId, q.StatDayStart(day, loc), q.StatDayStart(day+1, loc))
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(msgs) == 0 {
+			skipped++
+			continue
+		}
+		old := oldByDay[day]
+		days = append(days, statRebuildDay{Old: old, New: recomputeChatStat(old, chatId, day, loc, msgs)})
+	}
+	return days, skipped, nil
+}
+
+func applyStatRebuild(ctx context.Context, days []statRebuildDay, loc *time.Location) (int, error) {
+	applied := 0
+	for i := range days {
+		if !days[i].changed() {
+			continue
+		}
+		if err := g.Q.ReplaceChatStat(ctx, days[i].New, loc); err != nil {
+			return applied, err
+		}
+		applied++
+	}
+	return applied, nil
+}
+
+func formatStatRebuildDiff(r statRange, days []statRebuildDay, skipped int) string {
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "%s 至 %s 的统计重新计算结果：\n",
+		statDayToDate(r.From).Format(statDateLayout), statDayToDate(r.To).Format(statDateLayout))
+	changed, lines := 0, 0
+	for i := range days {
+		d := &days[i]
+		if !d.changed() {
+			continue
+		}
+		changed++
+		if lines >= rebuildMaxDiffLines {
+			continue
+		}
+		lines++
+		var oldCount, oldUsers int64
+		if d.Old != nil {
+			oldCount, oldUsers = d.Old.MessageCount, int64(len(d.Old.UserMsgStat))
+		}
+		_, _ = fmt.Fprintf(&sb, "%s 消息 %d → %d，发言人数 %d → %d\n", statDayToDate(d.New.StatDate).Format(statDateLayout),
+			oldCount, d.New.MessageCount, oldUsers, len(d.New.UserMsgStat))
+	}
+	if changed > lines {
+		_, _ = fmt.Fprintf(&sb, "……还有%d天\n", changed-lines)
+	}
+	_, _ = fmt.Fprintf(&sb, "共%d天有变化，%d天没有变化", changed, len(days)-changed)
+	if skipped > 0 {
+		_, _ = fmt.Fprintf(&sb, "，%d天存档中没有消息，保持不变", skipped)
+	}
+	sb.WriteString("\n存档中没有不带文字的媒体消息，重新计算只会增加统计，不会减少已有的数量")
+	return sb.String()
+}
+
+// parseRebuildRange 解析重建的日期范围，只能重建今天之前的统计
+func parseRebuildRange(fromStr, toStr string, today int64) (statRange, error) {
+	from, err1 := time.Parse(statDateLayout, fromStr)
+	to, err2 := time.Parse(statDateLayout, toStr)
+	if err1 != nil || err2 != nil {
+		return statRange{}, errStatRebuildUsage
+	}
+	r := statRange{From: dateToStatDay(from), To: dateToStatDay(to)}
+	switch {
+	case r.From > r.To:
+		return statRange{}, errors.New("开始日期不能晚于结束日期")
+	case r.To >= today:
+		return statRange{}, errors.New("只能重新计算今天之前的统计")
+	case r.To-r.From >= maxStatRangeDays:
+		return statRange{}, fmt.Errorf("统计范围最多%d天", maxStatRangeDays)
+	}
+	return r, nil
+}
+
+// StatRebuild /stat_rebuild <from> <to> [confirm] 根据消息存档重新计算统计，不带 confirm 时只显示差异（仅管理员）
+func StatRebuild(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	if !h.IsSenderAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以重新计算统计", nil)
+		return err
+	}
+	args := strings.Fields(h.TrimCmd(msg.GetText()))
+	if len(args) < 2 || len(args) > 3 || len(args) == 3 && args[2] != "confirm" {
+		_, err := msg.Reply(bot, errStatRebuildUsage.Error(), nil)
+		return err
+	}
+	chatId := msg.Chat.Id
+	loc := g.Q.GetChatCfgByIdOrDefault(chatId).Location()
+	r, err := parseRebuildRange(args[0], args[1], q.StatDayOf(time.Now().Unix(), loc))
+	if err != nil {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	}
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	days, skipped, err := planStatRebuild(c, chatId, r, loc)
+	if err != nil {
+		_, err = msg.Reply(bot, "读取消息存档失败: "+err.Error(), nil)
+		return err
+	}
+	text := formatStatRebuildDiff(r, days, skipped)
+	if len(args) == 3 {
+		applied, err := applyStatRebuild(c, days, loc)
+		if err != nil {
+			_, err = msg.Reply(bot, fmt.Sprintf("%s\n\n写入了%d天后出错: %s", text, applied, err), nil)
+			return err
+		}
+		text += fmt.Sprintf("\n\n已写入%d天", applied)
+	} else {
+		text += fmt.Sprintf("\n\n确认无误后使用 /stat_rebuild %s %s confirm 写入", args[0], args[1])
+	}
+	_, err = msg.Reply(bot, text, nil)
+	return err
+}
+
+type statRebuildRequest struct {
+	ChatID int64  `json:"chat_id"`
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Apply  bool   `json:"apply"`
+}
+
+type statRebuildDiff struct {
+	Date            string `json:"date"`
+	OldMessageCount int64  `json:"old_message_count"`
+	NewMessageCount int64  `json:"new_message_count"`
+	OldUserCount    int    `json:"old_user_count"`
+	NewUserCount    int    `json:"new_user_count"`
+	Changed         bool   `json:"changed"`
+}
+
+type statRebuildResponse struct {
+	Days    []statRebuildDiff `json:"days"`
+	Skipped int               `json:"skipped"`
+	Applied int               `json:"applied"`
+}
+
+// statRebuildHandler POST /stat-rebuild，apply 为 false 时只返回差异
+func statRebuildHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.NotFound(w, r)
+		return
+	}
+	var req statRebuildRequest
+	if err := decodeJSONBody(w, r, &req); err != nil || req.ChatID == 0 {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return
+	}
+	loc := g.Q.GetChatCfgByIdOrDefault(req.ChatID).Location()
+	sr, err := parseRebuildRange(req.From, req.To, q.StatDayOf(time.Now().Unix(), loc))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	days, skipped, err := planStatRebuild(r.Context(), req.ChatID, sr, loc)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	resp := statRebuildResponse{Days: make([]statRebuildDiff, 0, len(days)), Skipped: skipped}
+	for i := range days {
+		d := &days[i]
+		diff := statRebuildDiff{
+			Date:            statDayToDate(d.New.StatDate).Format(statDateLayout),
+			NewMessageCount: d.New.MessageCount,
+			NewUserCount:    len(d.New.UserMsgStat),
+			Changed:         d.changed(),
+		}
+		if d.Old != nil {
+			diff.OldMessageCount, diff.OldUserCount = d.Old.MessageCount, len(d.Old.UserMsgStat)
+		}
+		resp.Days = append(resp.Days, diff)
+	}
+	if req.Apply {
+		if resp.Applied, err = applyStatRebuild(r.Context(), days, loc); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// stubArchive 用固定的消息代替存档，按 [from, to) 过滤
+func stubArchive(t *testing.T, msgs []archiveStatMsg) {
+	orig := fetchArchiveStatMsgs
+	t.Cleanup(func() { fetchArchiveStatMsgs = orig })
+	fetchArchiveStatMsgs = func(_, from, to int64) ([]archiveStatMsg, error) {
+		var res []archiveStatMsg
+		for _, m := range msgs {
+			if int64(m.Date) >= from && int64(m.Date) < to {
+				res = append(res, m)
+			}
+		}
+		return res, nil
+	}
+}
+
+func TestRecomputeChatStatKeepsMedia(t *testing.T) {
+	loc := q.LoadTimezone("", 8*3600)
+	day := dateToStatDay(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC))
+	start := q.StatDayStart(day, loc)
+	old := &q.ChatStatDaily{ChatID: -100, StatDate: day, MessageCount: 1, PhotoCount: 2, MarsCount: 3,
+		UserMsgStat: q.UserMsgStatMap{1: {MsgCount: 1, PhotoCount: 2}, 3: {MsgCount: 4, StickerCount: 4}}}
+	msgs := []archiveStatMsg{
+		{FromID: 2, MsgID: 12, Date: float64(start + 610), Message: "你好"},
+		{FromID: 1, MsgID: 11, Date: float64(start + 600), Message: "hello"},
+		{FromID: 1, MsgID: 13, Date: float64(start + 3600), Message: ""},
+	}
+	res := recomputeChatStat(old, -100, day, loc, msgs)
+	// 用户3只发了贴纸，存档中没有他的消息
+	if res.MessageCount != 7 || res.PhotoCount != 2 || res.MarsCount != 3 {
+		t.Fatalf("unexpected counts %+v", res)
+	}
+	if u := res.UserMsgStat[3]; u == nil || u.MsgCount != 4 || u.StickerCount != 4 || u == old.UserMsgStat[3] {
+		t.Fatalf("media-only user should be kept: %+v", u)
+	}
+	if u := res.UserMsgStat[1]; u.MsgCount != 2 || u.MsgLen != 5 || u.PhotoCount != 2 || u.MsgCountByHour[0] != 1 || u.MsgCountByHour[1] != 1 {
+		t.Fatalf("unexpected user stat %+v", *u)
+	}
+	if res.MsgCountByTime[1] != 2 || res.MsgIDAtTimeStart[1] != 11 || res.MsgCountByTime[6] != 1 {
+		t.Fatalf("unexpected time stats %v %v", res.MsgCountByTime[:8], res.MsgIDAtTimeStart[:8])
+	}
+	if old.UserMsgStat[1].MsgCount != 1 {
+		t.Fatalf("old stat must not be modified")
+	}
+}
+
+func TestRecomputeChatStatNeverLowers(t *testing.T) {
+	loc := q.LoadTimezone("", 8*3600)
+	day := dateToStatDay(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC))
+	start := q.StatDayStart(day, loc)
+	// 用户1发了一条文字和两张不带文字的图片，存档中只有那条文字
+	old := &q.ChatStatDaily{ChatID: -100, StatDate: day, MessageCount: 3, PhotoCount: 2,
+		UserMsgStat: q.UserMsgStatMap{1: {MsgCount: 3, MsgLen: 5, PhotoCount: 2}}}
+	old.UserMsgStat[1].MsgCountByHour[0] = 3
+	old.MsgCountByTime[1] = 3
+	old.MsgIDAtTimeStart[1] = 10
+	msgs := []archiveStatMsg{{FromID: 1, MsgID: 11, Date: float64(start + 600), Message: "hello"}}
+	res := recomputeChatStat(old, -100, day, loc, msgs)
+	if res.MessageCount != 3 || res.MsgCountByTime[1] != 3 || res.MsgIDAtTimeStart[1] != 10 {
+		t.Fatalf("rebuild must not lower counts: %d %d %d", res.MessageCount, res.MsgCountByTime[1], res.MsgIDAtTimeStart[1])
+	}
+	if u := res.UserMsgStat[1]; u.MsgCount != 3 || u.MsgLen != 5 || u.PhotoCount != 2 || u.MsgCountByHour[0] != 3 {
+		t.Fatalf("media-only messages should be kept: %+v", *u)
+	}
+	d := statRebuildDay{Old: old, New: res}
+	if d.changed() {
+		t.Fatal("correct stats should not be reported as changed")
+	}
+}
+
+func TestParseRebuildRange(t *testing.T) {
+	today := dateToStatDay(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC))
+	r, err := parseRebuildRange("2024-03-01", "2024-03-03", today)
+	if err != nil || r.To != today-1 || r.From != today-3 {
+		t.Fatalf("unexpected range %+v %v", r, err)
+	}
+	for _, bad := range [][2]string{{"2024-03-01", "2024-03-04"}, {"2024-03-03", "2024-03-01"}, {"2022-01-01", "2024-01-01"}, {"x", "2024-03-01"}} {
+		if _, err := parseRebuildRange(bad[0], bad[1], today); err == nil {
+			t.Fatalf("%v should be rejected", bad)
+		}
+	}
+}
+
+func TestStatRebuildDryRunAndApply(t *testing.T) {
+	const chatId = -1009990048
+	ctx := context.Background()
+	loc := g.Q.GetChatCfgByIdOrDefault(chatId).Location()
+	today := q.StatDayOf(time.Now().Unix(), loc)
+	day := today - 2
+	start := q.StatDayStart(day, loc)
+
+	// 数据库中的统计少了一条消息，前一天存档中没有消息
+	stale := q.NewChatStat(chatId, day, loc)
+	stale.IncMessage(1, 2, start+60, 1, q.MediaPhoto)
+	if err := g.Q.ReplaceChatStat(ctx, stale.Snapshot(), loc); err != nil {
+		t.Fatalf("seed: %v", err)
+	}
+	stubArchive(t, []archiveStatMsg{
+		{FromID: 1, MsgID: 1, Date: float64(start + 60), Message: "hi"},
+		{FromID: 2, MsgID: 2, Date: float64(start + 120), Message: "yo"},
+	})
+
+	body, _ := json.Marshal(statRebuildRequest{ChatID: chatId, From: statDayToDate(day - 1).Format(statDateLayout),
+		To: statDayToDate(day).Format(statDateLayout)})
+	rec := httptest.NewRecorder()
+	statRebuildHandler(rec, httptest.NewRequest(http.MethodPost, "/stat-rebuild", bytes.NewReader(body)))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("dry run status %d: %s", rec.Code, rec.Body.String())
+	}
+	var resp statRebuildResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if resp.Skipped != 1 || resp.Applied != 0 || len(resp.Days) != 1 || !resp.Days[0].Changed ||
+		resp.Days[0].OldMessageCount != 1 || resp.Days[0].NewMessageCount != 2 || resp.Days[0].NewUserCount != 2 {
+		t.Fatalf("unexpected dry run %+v", resp)
+	}
+	days, err := g.Q.ListChatStatRange(ctx, chatId, day, day)
+	if err != nil || days[0].MessageCount != 1 {
+		t.Fatalf("dry run must not write: %+v %v", days, err)
+	}
+
+	r := statRange{From: day - 1, To: day}
+	plan, skipped, err := planStatRebuild(ctx, chatId, r, loc)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	if applied, err := applyStatRebuild(ctx, plan, loc); err != nil || applied != 1 {
+		t.Fatalf("apply: %d %v", applied, err)
+	}
+	days, err = g.Q.ListChatStatRange(ctx, chatId, day, day)
+	if err != nil || days[0].MessageCount != 2 || days[0].PhotoCount != 1 || days[0].UserMsgStat[1].PhotoCount != 1 {
+		t.Fatalf("unexpected rebuilt stat %+v %v", days, err)
+	}
+	plan, _, _ = planStatRebuild(ctx, chatId, r, loc)
+	if text := formatStatRebuildDiff(r, plan, skipped); text == "" || plan[0].changed() {
+		t.Fatalf("rebuild should be idempotent: %s", text)
+	}
+}
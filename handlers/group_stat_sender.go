@@ -2,12 +2,14 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"html"
 	g "main/globalcfg"
 	"main/globalcfg/q"
+	"main/handlers/genbot"
+	"slices"
 	"sort"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/PaulSonOfLars/gotgbot/v2"
@@ -60,71 +62,12 @@ func mostActiveTimeSeg(stat *q.ChatStatDaily) (timeId int, timeSeg string, count
 	return
 }
 
-func statDateString(timezone int64) string {
-	loc := time.FixedZone("chat_tz", int(timezone))
-	return time.Now().In(loc).Format("2006年01月02日")
-}
-
-func formatStatMessage(chatId int64, stat *q.ChatStatDaily, timezone int64) string {
-	if stat == nil {
-		return "没有数据"
-	}
-	today := statDateString(timezone)
-	actUser, count := mostActiveUsers(stat)
-	timeId, actTime, actTimeCnt := mostActiveTimeSeg(stat)
-	act3Users := make([]string, 0, 3)
-	mostActUser := ""
-	act3UsersName := ""
-	var actMaxCnt int64
-	if len(actUser) > 0 {
-		actMaxCnt = count[0]
-	}
-	for i := 0; i < 3 && i < len(actUser); i++ {
-		user, err := g.Q.GetUserById(context.Background(), actUser[i])
-		if err != nil {
-			continue
-		}
-		act3Users = append(act3Users, user.Name())
-	}
-	if len(act3Users) == 0 {
-		act3UsersName = "没有人"
-		mostActUser = "没有人"
-	} else if len(act3Users) == 1 {
-		act3UsersName = act3Users[0]
-	} else {
-		act3UsersName = strings.Join(act3Users[:len(act3Users)-1], "、") + "和" + act3Users[len(act3Users)-1]
-	}
-	if actMaxCnt > 0 {
-		mostActUser = act3Users[0]
-	}
-	// 转换HTML，避免被tg解析
-	act3UsersName = html.EscapeString(act3UsersName)
-	mostActUser = html.EscapeString(mostActUser)
-
-	link := actTime
-	msgId := stat.MsgIDAtTimeStart[timeId]
-	if msgId != 0 {
-		groupLinkId := -chatId - 1000000000000
-		link = fmt.Sprintf(`<a href="https://t.me/c/%d/%d">%s</a>`, groupLinkId, msgId, actTime)
-	}
-	tmp := fmt.Sprintf(`早上好！吹水群！
-今天是%s，昨天的发言统计，最后的结果是满打满算的整整%d条，你们这些家伙都不用上班的吗？
-多亏了%s没完没了的摸鱼吹水，光%s一个人就发了%d条。但有一个晶哥也发话了，我看你们全都得喝茶，因为平子肯定咽不下这口气。
-群里一共发了%d张图片，还有%d个表情，又是只发表情的社恐干的好事。与此同时，毅力号还在火星上替火星人找到了%d张图，火星次数最多的图让你们火星了%d次，真是一群火星人。
-群里发了%d张色图，里面还有%d张R18，你们今天发色图，明天FBI就来敲你家门了。
-智乃酱帮你们下了%d个视频，%d个音频，今日份的娱乐就到这里吧。
-而群里最热闹的%s，这十分钟居然发了%d条，好吧，吹水群还是那个吹水群。
-我是你们的铁哥们智乃酱，和我一起开启完蛋操的新一天吧！`,
-		today, stat.MessageCount,
-		act3UsersName, mostActUser, actMaxCnt,
-		stat.PhotoCount, stat.StickerCount, stat.MarsCount, stat.MaxMarsCount,
-		stat.AdultCount+stat.RacyCount, stat.AdultCount,
-		stat.DownloadVideoCount, stat.DownloadAudioCount,
-		link, actTimeCnt)
-	return tmp
+func sendChatStat(bot *gotgbot.Bot, chatId int64, target time.Time) error {
+	return sendChatStatWithTemplate(bot, chatId, target, nil)
 }
 
-func sendChatStat(bot *gotgbot.Bot, chatId int64, target time.Time) error {
+// sendChatStatWithTemplate tmpl 不为nil时使用它代替聊天保存的模板，用于预览
+func sendChatStatWithTemplate(bot *gotgbot.Bot, chatId int64, target time.Time, tmpl *string) error {
 	if bot == nil {
 		return fmt.Errorf("main bot is nil")
 	}
@@ -134,35 +77,155 @@ func sendChatStat(bot *gotgbot.Bot, chatId int64, target time.Time) error {
 	if stat := g.Q.ChatStatAt(chatId, time.Now().Unix()); stat != nil {
 		_ = stat.Save(ctx, g.Q)
 	}
-	stat, timezone, err := g.Q.ChatStatOfDay(ctx, chatId, target.Unix())
+	stat, _, err := g.Q.ChatStatOfDay(ctx, chatId, target.Unix())
 	if err != nil {
 		return err
 	}
-	text := formatStatMessage(chatId, &stat, timezone)
+	cfg := *g.Q.GetChatCfgByIdOrDefault(chatId)
+	if tmpl != nil {
+		cfg.StatTemplate = *tmpl
+	}
+	text := formatStatMessage(&cfg, &stat, time.Now())
 	_, err = bot.SendMessage(chatId, text, &gotgbot.SendMessageOpts{ParseMode: "HTML"})
+	if err != nil && cfg.StatTemplate != "" {
+		// 自定义模板的HTML可能无法被解析，退回默认模板
+		log.Warn("send stat with custom template failed", "chat_id", chatId, "err", err)
+		cfg.StatTemplate = ""
+		_, err = bot.SendMessage(chatId, formatStatMessage(&cfg, &stat, time.Now()), &gotgbot.SendMessageOpts{ParseMode: "HTML"})
+	}
 	return err
 }
 
-func sendMyChatsStat() {
-	bot := GetMainBot()
-	for _, chatId := range g.GetConfig().MyChats {
-		if err := sendChatStat(bot, chatId, time.Now().Add(-24*time.Hour)); err != nil {
+// sendDailyReport 发送昨天的统计、图表、热词和AI摘要，每周一和每月1日额外发送上周和上个月的汇总。
+// 不在 AIChats 中的聊天无法生成摘要，即使开启了只发送摘要也发送普通统计
+func sendDailyReport(bot *gotgbot.Bot, cfg *q.ChatCfg, now time.Time) {
+	chatId := cfg.ID
+	loc := cfg.Location()
+	local := now.In(loc)
+	digest := cfg.DailyDigest && slices.Contains(g.GetConfig().AIChats, chatId)
+	if !digest || !cfg.DigestOnly {
+		// 夏令时切换的日子不是24小时，按日历减一天
+		yesterday := local.AddDate(0, 0, -1)
+		if err := sendChatStat(bot, chatId, yesterday); err != nil {
 			log.Warn("send stat of yesterday failed", "chat_id", chatId, "err", err)
+		} else if err = sendDayStatCharts(bot, chatId, yesterday); err != nil {
+			log.Warn("send stat charts of yesterday failed", "chat_id", chatId, "err", err)
+		}
+		if err := sendDayHotKeywords(bot, chatId, yesterday, loc); err != nil {
+			log.Warn("send hot keywords of yesterday failed", "chat_id", chatId, "err", err)
+		}
+		var recaps []statRange
+		if local.Weekday() == time.Monday {
+			recaps = append(recaps, lastWeekRange(now, loc))
+		}
+		if local.Day() == 1 {
+			recaps = append(recaps, lastMonthRange(now, loc))
+		}
+		for _, r := range recaps {
+			if err := sendRangeStat(bot, chatId, r); err != nil {
+				log.Warn("send stat recap failed", "chat_id", chatId, "err", err)
+			}
+		}
+	}
+	if digest {
+		err := genbot.SendDailyDigest(bot, chatId, 0, local.AddDate(0, 0, -1))
+		if err != nil && !errors.Is(err, genbot.ErrNoArchivedMessages) {
+			log.Warn("send daily digest failed", "chat_id", chatId, "err", err)
 		}
 	}
 }
 
-func StartChatStatScheduler() {
-	cfg := g.GetConfig()
-	if cfg == nil || len(cfg.MyChats) == 0 {
-		return
+// dailyStatChats Config.MyChats 中的聊天总是发送每日统计，其他聊天需要在 /chat_config 中开启
+func dailyStatChats(ctx context.Context) []int64 {
+	chats := slices.Clone(g.GetConfig().MyChats)
+	enabled, err := g.Q.ListDailyStatChats(ctx)
+	if err != nil {
+		log.Warn("list daily stat chats failed", "err", err)
+	}
+	for _, id := range enabled {
+		if !slices.Contains(chats, id) {
+			chats = append(chats, id)
+		}
+	}
+	return chats
+}
+
+// statSent 缓存已经发送过的日期，避免每分钟都写数据库。是否已发送以 chat_stat_sent 为准
+var statSent = struct {
+	sync.Mutex
+	// chat_id -> 最后一次发送每日统计的 stat_date
+	days map[int64]int64
+}{days: make(map[int64]int64)}
+
+// dueChatStats 返回需要发送每日统计的聊天：聊天时区的当前时间已到 StatTime，且今天还没有发送过。
+// 错过的分钟（重启、夏令时跳过的时间）之后仍会补发，发送前在 chat_stat_sent 中登记，重启后不会重复发送
+func dueChatStats(ctx context.Context, chats []int64, now time.Time) []*q.ChatCfg {
+	statSent.Lock()
+	defer statSent.Unlock()
+	var due []*q.ChatCfg
+	for _, id := range chats {
+		cfg := g.Q.GetChatCfgByIdOrDefault(id)
+		loc := cfg.Location()
+		local := now.In(loc)
+		if int64(local.Hour()*60+local.Minute()) < cfg.StatTime {
+			continue
+		}
+		day := q.StatDayOf(now.Unix(), loc)
+		if statSent.days[id] >= day {
+			continue
+		}
+		marked, err := g.Q.MarkChatStatSent(ctx, id, day)
+		if err != nil {
+			log.Warn("mark chat stat sent failed", "chat_id", id, "err", err)
+			continue
+		}
+		statSent.days[id] = day
+		if marked > 0 {
+			due = append(due, cfg)
+		}
+	}
+	return due
+}
+
+func sendDueChatStats() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	bot := GetMainBot()
+	now := time.Now()
+	// 摘要需要多次调用模型，每个聊天单独发送，避免互相等待
+	for _, cfg := range dueChatStats(ctx, dailyStatChats(ctx), now) {
+		go sendDailyReport(bot, cfg, now)
 	}
+}
+
+// ChatStatScheduler 返回每日统计使用的调度器，AI 定时任务也运行在它上面
+func ChatStatScheduler() *gocron.Scheduler {
+	return statScheduler
+}
+
+func StartChatStatScheduler() {
 	statScheduler = gocron.NewScheduler(time.Local)
 	var err error
-	statJob, err = statScheduler.Every(1).Day().At("08:00").Do(sendMyChatsStat)
+	statJob, err = statScheduler.Cron("* * * * *").Do(sendDueChatStats)
 	if err != nil {
 		log.Warn("start chat stat scheduler failed", "err", err)
 		return
 	}
+	interval := g.GetConfig().StatFlushInterval
+	if _, err = statScheduler.Every(interval).WaitForSchedule().SingletonMode().Do(flushChatStats); err != nil {
+		log.Warn("start chat stat flusher failed", "err", err)
+	}
 	statScheduler.StartAsync()
 }
+
+// flushChatStats 定期保存有修改的统计，进程被杀死时最多丢失一个周期的数据
+func flushChatStats() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	saved, err := g.Q.FlushChatStats(ctx)
+	if err != nil {
+		log.Warn("flush chat stats failed", "saved", saved, "err", err)
+		return
+	}
+	log.Debug("flush chat stats", "saved", saved)
+}
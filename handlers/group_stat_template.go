@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"main/helpers/safetmpl"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const (
+	defaultStatTemplate = `早上好！吹水群！
+今天是{{.Today}}，昨天的发言统计，最后的结果是满打满算的整整{{.MessageCount}}条，你们这些家伙都不用上班的吗？
+多亏了{{.TopUsersText}}没完没了的摸鱼吹水，光{{.MostActiveUser}}一个人就发了{{.MostActiveCount}}条。但有一个晶哥也发话了，我看你们全都得喝茶，因为平子肯定咽不下这口气。
+群里一共发了{{.PhotoCount}}张图片，还有{{.StickerCount}}个表情，又是只发表情的社恐干的好事。与此同时，毅力号还在火星上替火星人找到了{{.MarsCount}}张图，火星次数最多的图让你们火星了{{.MaxMarsCount}}次，真是一群火星人。
+群里发了{{.NsfwCount}}张色图，里面还有{{.AdultCount}}张R18，你们今天发色图，明天FBI就来敲你家门了。
+智乃酱帮你们下了{{.DownloadVideoCount}}个视频，{{.DownloadAudioCount}}个音频，今日份的娱乐就到这里吧。
+而群里最热闹的{{.ActiveTimeLink}}，这十分钟居然发了{{.ActiveTimeCount}}条，好吧，吹水群还是那个吹水群。
+我是你们的铁哥们智乃酱，和我一起开启完蛋操的新一天吧！`
+	// Telegram 单条消息的长度限制
+	maxStatMessageLen = 4096
+	statRenderTimeout = time.Second
+)
+
+var statTemplateHelp = `模板使用 Go text/template 语法，输出按HTML解析，数据中的名字已经转义。可用的字段：
+{{.Today}} 今天的日期  {{.Date}} 统计的日期
+{{.MessageCount}} {{.PhotoCount}} {{.VideoCount}} {{.StickerCount}} {{.ForwardCount}}
+{{.MarsCount}} {{.MaxMarsCount}} {{.NsfwCount}} {{.RacyCount}} {{.AdultCount}}
+{{.DownloadVideoCount}} {{.DownloadAudioCount}} {{.DioAddUserCount}} {{.DioBanUserCount}}
+{{.TopUsersText}} 前三名  {{.MostActiveUser}} {{.MostActiveCount}}
+{{range .TopUsers}}{{.Name}} {{.Count}}{{end}}
+{{.ActiveTime}} {{.ActiveTimeLink}} {{.ActiveTimeCount}} 最热闹的十分钟`
+
+type statTemplateUser struct {
+	Name  string
+	Count int64
+}
+
+// statTemplateData 每日统计模板可以使用的数据，字符串均已经过HTML转义
+type statTemplateData struct {
+	q.ChatStatDaily
+	Today           string
+	Date            string
+	TopUsers        []statTemplateUser
+	TopUsersText    string
+	MostActiveUser  string
+	MostActiveCount int64
+	ActiveTime      string
+	ActiveTimeLink  string
+	ActiveTimeCount int64
+	NsfwCount       int64
+}
+
+func newStatTemplateData(chatId int64, stat *q.ChatStatDaily, loc *time.Location, now time.Time) *statTemplateData {
+	data := &statTemplateData{
+		ChatStatDaily: *stat,
+		Today:         now.In(loc).Format("2006年01月02日"),
+		Date:          statDayToDate(stat.StatDate).Format("2006年01月02日"),
+		NsfwCount:     stat.AdultCount + stat.RacyCount,
+	}
+	users, counts := mostActiveUsers(stat)
+	names := make([]string, 0, len(users))
+	for i, u := range users {
+		user, err := g.Q.GetUserById(context.Background(), u)
+		if err != nil {
+			continue
+		}
+		name := html.EscapeString(user.Name())
+		names = append(names, name)
+		data.TopUsers = append(data.TopUsers, statTemplateUser{Name: name, Count: counts[i]})
+	}
+	switch len(names) {
+	case 0:
+		data.TopUsersText = "没有人"
+		data.MostActiveUser = "没有人"
+	case 1:
+		data.TopUsersText = names[0]
+	default:
+		data.TopUsersText = strings.Join(names[:len(names)-1], "、") + "和" + names[len(names)-1]
+	}
+	if len(data.TopUsers) > 0 {
+		data.MostActiveUser = data.TopUsers[0].Name
+		data.MostActiveCount = data.TopUsers[0].Count
+	}
+
+	timeId, actTime, actTimeCnt := mostActiveTimeSeg(stat)
+	data.ActiveTime, data.ActiveTimeLink, data.ActiveTimeCount = actTime, actTime, actTimeCnt
+	if msgId := stat.MsgIDAtTimeStart[timeId]; msgId != 0 {
+		if link, ok := h.MsgLink(chatId, msgId); ok {
+			data.ActiveTimeLink = fmt.Sprintf(`<a href="%s">%s</a>`, link, actTime)
+		}
+	}
+	return data
+}
+
+func parseStatTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		text = defaultStatTemplate
+	}
+	tmpl, err := template.New("stat").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err = safetmpl.Check(tmpl, "TopUsers"); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+func executeStatTemplate(text string, data *statTemplateData) (string, error) {
+	tmpl, err := parseStatTemplate(text)
+	if err != nil {
+		return "", err
+	}
+	// 首尾的空白会被去掉，多留一些余量
+	out, err := safetmpl.Execute(tmpl, data, 2*maxStatMessageLen*utf8.UTFMax, statRenderTimeout)
+	if errors.Is(err, safetmpl.ErrOutputTooLong) {
+		return "", fmt.Errorf("模板的输出超过了%d字", maxStatMessageLen)
+	}
+	if err != nil {
+		return "", err
+	}
+	out = strings.TrimSpace(out)
+	if out == "" {
+		return "", errors.New("模板的输出为空")
+	}
+	if utf8.RuneCountInString(out) > maxStatMessageLen {
+		return "", fmt.Errorf("模板的输出超过了%d字", maxStatMessageLen)
+	}
+	return out, nil
+}
+
+// sampleStatTemplateData 用于保存模板前的校验，覆盖所有字段
+func sampleStatTemplateData() *statTemplateData {
+	stat := q.ChatStatDaily{ChatID: -1001000000000, StatDate: 20000, MessageCount: 100, PhotoCount: 3, StickerCount: 5}
+	stat.MsgCountByTime[48] = 30
+	stat.MsgIDAtTimeStart[48] = 1
+	data := newStatTemplateData(stat.ChatID, &stat, q.LoadTimezone("", q.DefaultTimezone), time.Now())
+	data.TopUsers = []statTemplateUser{{"张三", 50}, {"李四", 30}, {"王五", 20}}
+	data.TopUsersText, data.MostActiveUser, data.MostActiveCount = "张三、李四和王五", "张三", 50
+	return data
+}
+
+func validateStatTemplate(text string) error {
+	_, err := executeStatTemplate(text, sampleStatTemplateData())
+	return err
+}
+
+// formatStatMessage 使用聊天的模板生成统计消息，自定义模板出错时使用默认模板
+func formatStatMessage(cfg *q.ChatCfg, stat *q.ChatStatDaily, now time.Time) string {
+	data := newStatTemplateData(cfg.ID, stat, cfg.Location(), now)
+	if cfg.StatTemplate != "" {
+		text, err := executeStatTemplate(cfg.StatTemplate, data)
+		if err == nil {
+			return text
+		}
+		log.Warn("execute stat template failed", "chat_id", cfg.ID, "err", err)
+	}
+	text, _ := executeStatTemplate("", data)
+	return text
+}
+
+func formatStatTime(minutes int64) string {
+	return fmt.Sprintf("%02d:%02d", minutes/60, minutes%60)
+}
+
+func parseStatTime(s string) (int64, error) {
+	hour, minute, ok := strings.Cut(strings.TrimSpace(s), ":")
+	hh, err1 := strconv.ParseInt(hour, 10, 64)
+	mm, err2 := strconv.ParseInt(minute, 10, 64)
+	if !ok || err1 != nil || err2 != nil || hh < 0 || hh > 23 || mm < 0 || mm > 59 {
+		return 0, errors.New("时间格式应为 HH:MM，例如 08:30")
+	}
+	return hh*60 + mm, nil
+}
+
+// SetStatTime /stat_time HH:MM 设置每日统计的发送时间（聊天时区，仅管理员）
+func SetStatTime(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	cfg := g.Q.GetChatCfgByIdOrDefault(msg.Chat.Id)
+	arg := h.TrimCmd(msg.GetText())
+	if strings.TrimSpace(arg) == "" {
+		_, err := msg.Reply(bot, fmt.Sprintf("每日统计的发送时间为 %s，使用 /stat_time HH:MM 修改，需要在 /chat_config 中开启每日统计",
+			formatStatTime(cfg.StatTime)), nil)
+		return err
+	}
+	if !h.IsSenderAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以修改每日统计的发送时间", nil)
+		return err
+	}
+	minutes, err := parseStatTime(arg)
+	if err != nil {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	}
+	cfg.StatTime = minutes
+	if err = cfg.Save(context.Background(), g.Q); err != nil {
+		return err
+	}
+	_, err = msg.Reply(bot, "每日统计的发送时间已设置为 "+formatStatTime(minutes), nil)
+	return err
+}
+
+// SetStatTemplate /stat_template <模板> 设置每日统计的模板，reset 恢复默认模板（仅管理员）
+func SetStatTemplate(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	cfg := g.Q.GetChatCfgByIdOrDefault(msg.Chat.Id)
+	text := strings.TrimSpace(h.TrimCmd(msg.GetText()))
+	if text == "" {
+		current := cfg.StatTemplate
+		if current == "" {
+			current = defaultStatTemplate
+		}
+		_, err := msg.Reply(bot, "当前模板：\n"+current+"\n\n"+statTemplateHelp+
+			"\n\n使用 /stat_template 模板 修改，/stat_template reset 恢复默认，/diag_sendstat 模板 预览", nil)
+		return err
+	}
+	if !h.IsSenderAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以修改每日统计的模板", nil)
+		return err
+	}
+	if text == "reset" {
+		text = ""
+	} else if err := validateStatTemplate(text); err != nil {
+		_, err = msg.Reply(bot, "模板有误: "+err.Error(), nil)
+		return err
+	}
+	cfg.StatTemplate = text
+	if err := cfg.Save(context.Background(), g.Q); err != nil {
+		return err
+	}
+	reply := "每日统计模板已更新，可以使用 /diag_sendstat 预览"
+	if text == "" {
+		reply = "已恢复默认的每日统计模板"
+	}
+	_, err := msg.Reply(bot, reply, nil)
+	return err
+}
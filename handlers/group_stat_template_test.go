@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"context"
+	"main/globalcfg/q"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatTemplate(t *testing.T) {
+	stat := q.ChatStatDaily{ChatID: -1001234567890, StatDate: 19800, MessageCount: 42, PhotoCount: 3, RacyCount: 1, AdultCount: 2}
+	stat.MsgCountByTime[50] = 9
+	stat.MsgIDAtTimeStart[50] = 777
+	cfg := &q.ChatCfg{ID: stat.ChatID, Timezone: 8 * 3600}
+	now := time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)
+
+	text := formatStatMessage(cfg, &stat, now)
+	for _, want := range []string{"今天是2024年03月05日", "整整42条", "多亏了没有人", "发了3张图片", "发了3张色图", "2张R18",
+		`<a href="https://t.me/c/1234567890/777">08:20</a>，这十分钟居然发了9条`} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("default template output missing %q:\n%s", want, text)
+		}
+	}
+
+	cfg.StatTemplate = "{{.Date}} {{.MessageCount}}条 {{.ActiveTime}}"
+	if text = formatStatMessage(cfg, &stat, now); text != "2024年03月18日 42条 08:20" {
+		t.Fatalf("custom template output %q", text)
+	}
+	// 模板执行出错时退回默认模板
+	cfg.StatTemplate = "{{.Nope}}"
+	if text = formatStatMessage(cfg, &stat, now); !strings.HasPrefix(text, "早上好") {
+		t.Fatalf("broken template should fall back to default, got %q", text)
+	}
+
+	if err := validateStatTemplate("{{range .TopUsers}}{{.Name}}:{{.Count}} {{end}}{{.TopUsersText}}"); err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"{{.Nope}}", "{{if}}", "   ", "{{range .TopUsers}}" + strings.Repeat("x", 2000) + "{{end}}",
+		"{{range 5000000}}xxxxxxxxxxxxxxxxxxxx{{end}}", "{{range .MessageCount}}{{end}}", `{{define "a"}}{{end}}{{template "a"}}`} {
+		if err := validateStatTemplate(bad); err == nil {
+			t.Fatalf("template %q should be rejected", bad)
+		}
+	}
+}
+
+func TestDueChatStats(t *testing.T) {
+	const chatId = -1009200000
+	// 没有配置的聊天使用默认的东八区 08:00
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 5, hour, minute, 30, 0, time.FixedZone("CST", 8*3600))
+	}
+	ctx := context.Background()
+	if due := dueChatStats(ctx, []int64{chatId}, at(7, 59)); len(due) != 0 {
+		t.Fatal("should not be due before report time")
+	}
+	if due := dueChatStats(ctx, []int64{chatId}, at(8, 0)); len(due) != 1 || due[0].ID != chatId {
+		t.Fatalf("should be due at report time, got %d", len(due))
+	}
+	if due := dueChatStats(ctx, []int64{chatId}, at(8, 1)); len(due) != 0 {
+		t.Fatal("should only be sent once a day")
+	}
+	// 重启后内存中的记录丢失，仍以数据库为准
+	clear(statSent.days)
+	if due := dueChatStats(ctx, []int64{chatId}, at(9, 0)); len(due) != 0 {
+		t.Fatal("should not be sent again after restart")
+	}
+	// 错过了发送时间的聊天之后补发
+	if due := dueChatStats(ctx, []int64{chatId}, at(8, 0).AddDate(0, 0, 1).Add(3*time.Hour)); len(due) != 1 {
+		t.Fatalf("missed report should be sent late, got %d", len(due))
+	}
+
+	for in, want := range map[string]int64{"08:30": 510, "0:00": 0, "23:59": 1439} {
+		if got, err := parseStatTime(in); err != nil || got != want {
+			t.Fatalf("parseStatTime(%q) = %d %v", in, got, err)
+		}
+	}
+	for _, bad := range []string{"24:00", "8", "08:60", "a:b"} {
+		if _, err := parseStatTime(bad); err == nil {
+			t.Fatalf("%q should be rejected", bad)
+		}
+	}
+}
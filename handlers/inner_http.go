@@ -22,6 +22,7 @@ import (
 	json "github.com/json-iterator/go"
 	"github.com/klauspost/compress/zstd"
 	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 const (
@@ -456,7 +457,7 @@ func listAllRoutes(w http.ResponseWriter, r *http.Request) {
 		http.NotFound(w, r)
 		return
 	}
-	_, _ = w.Write([]byte("GET /loggers\nPUT /loggers/<name>/<:level,int8>\nGET /backupdb\n"))
+	_, _ = w.Write([]byte("GET /loggers\nPUT /loggers/<name>/<:level,int8>\nGET /backupdb\nGET /metrics\nPOST /stat-rebuild\n"))
 }
 
 func withLoggingAndRecovery(logger *slog.Logger, next http.Handler) http.Handler {
@@ -503,6 +504,8 @@ func buildHandler(logger *slog.Logger) http.Handler {
 	mux.HandleFunc("/backupdb", backupDBHandler(logger))
 	mux.HandleFunc("/loggers", showLoggers)
 	mux.HandleFunc("/loggers/", setLoggerLevel)
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.HandleFunc("/stat-rebuild", statRebuildHandler)
 	mux.HandleFunc("/", listAllRoutes)
 	pprofHandlers(mux)
 	return withLoggingAndRecovery(logger, mux)
@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	g "main/globalcfg"
+	"main/helpers/lrusf"
+	"main/helpers/metrics"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// registerMetric 注册到默认的注册表，同名指标已经存在时只记录日志
+func registerMetric(c prometheus.Collector) {
+	if err := prometheus.Register(c); err != nil {
+		log.Warn("register metric failed", "err", err)
+	}
+}
+
+// 这些指标在 /metrics 被请求时才读取
+func init() {
+	registerMetric(metrics.NewCounterFunc("lrusf_cache_hits_total", "缓存命中次数", []string{"cache"}, func(emit func(float64, ...string)) {
+		for _, s := range lrusf.AllStats() {
+			emit(float64(s.Hits), s.Name)
+		}
+	}))
+	registerMetric(metrics.NewCounterFunc("lrusf_cache_misses_total", "缓存未命中次数", []string{"cache"}, func(emit func(float64, ...string)) {
+		for _, s := range lrusf.AllStats() {
+			emit(float64(s.Misses), s.Name)
+		}
+	}))
+	registerMetric(metrics.NewGaugeFunc("lrusf_cache_entries", "缓存中的条目数", []string{"cache"}, func(emit func(float64, ...string)) {
+		for _, s := range lrusf.AllStats() {
+			emit(float64(s.Len), s.Name)
+		}
+	}))
+
+	registerMetric(metrics.NewGaugeFunc("meili_wal_depth", "等待写入 MeiliSearch 的消息数", nil, func(emit func(float64, ...string)) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		var depth int64
+		if err := g.RawMeiliWalDb().QueryRowContext(ctx, "SELECT count(*) FROM meili_wal").Scan(&depth); err != nil {
+			log.Warn("query meili wal depth failed", "err", err)
+			return
+		}
+		emit(float64(depth))
+	}))
+
+	registerDBStats()
+}
+
+// sqliteDBs 导出连接池统计的数据库，测试时 msg 和 main 是同一个连接池
+var sqliteDBs = []struct {
+	name string
+	db   func() *sql.DB
+}{
+	{"main", g.RawMainDb},
+	{"msg", g.RawMsgsDb},
+	{"meili_wal", g.RawMeiliWalDb},
+}
+
+func emitDBStats(fn func(s sql.DBStats) float64) func(emit func(float64, ...string)) {
+	return func(emit func(float64, ...string)) {
+		for _, d := range sqliteDBs {
+			emit(fn(d.db().Stats()), d.name)
+		}
+	}
+}
+
+func registerDBStats() {
+	gauge := func(name, help string, fn func(s sql.DBStats) float64) {
+		registerMetric(metrics.NewGaugeFunc(name, help, []string{"db"}, emitDBStats(fn)))
+	}
+	counter := func(name, help string, fn func(s sql.DBStats) float64) {
+		registerMetric(metrics.NewCounterFunc(name, help, []string{"db"}, emitDBStats(fn)))
+	}
+	gauge("sqlite_max_open_connections", "最大连接数", func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) })
+	gauge("sqlite_open_connections", "当前打开的连接数", func(s sql.DBStats) float64 { return float64(s.OpenConnections) })
+	gauge("sqlite_in_use_connections", "正在使用的连接数", func(s sql.DBStats) float64 { return float64(s.InUse) })
+	gauge("sqlite_idle_connections", "空闲的连接数", func(s sql.DBStats) float64 { return float64(s.Idle) })
+	counter("sqlite_wait_count_total", "等待连接的次数", func(s sql.DBStats) float64 { return float64(s.WaitCount) })
+	counter("sqlite_wait_duration_seconds_total", "等待连接的总耗时", func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() })
+	counter("sqlite_max_idle_closed_total", "因空闲连接过多而关闭的连接数", func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) })
+	counter("sqlite_max_idle_time_closed_total", "因空闲超时而关闭的连接数", func(s sql.DBStats) float64 { return float64(s.MaxIdleTimeClosed) })
+	counter("sqlite_max_lifetime_closed_total", "因超过最长存活时间而关闭的连接数", func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) })
+}
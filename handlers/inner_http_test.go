@@ -334,3 +334,28 @@ func TestBackupDBToken(t *testing.T) {
 		t.Fatalf("expected 200 got %d", resp.StatusCode)
 	}
 }
+
+func TestMetricsEndpoint(t *testing.T) {
+	server := newTestServer()
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/metrics")
+	if err != nil {
+		t.Fatalf("get metrics: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 got %d", resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	for _, want := range []string{
+		`lrusf_cache_hits_total{cache="ocr"}`,
+		"meili_wal_depth 0\n",
+		`sqlite_open_connections{db="main"}`,
+		"# TYPE go_goroutines gauge",
+	} {
+		if !strings.Contains(string(body), want) {
+			t.Fatalf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/h"
+	"main/globalcfg/q"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+const timezoneUsage = "用法: /timezone [me] <IANA时区名|±hh:mm>，例如 /timezone Asia/Shanghai、/timezone -05:00。" +
+	"群组中修改的是群组的时区（仅管理员），加上 me 修改自己的时区"
+
+// SetTimezone /timezone [me] [时区] 查看或设置时区。私聊或带 me 时设置自己的时区，群组中设置群组的时区（仅管理员）。
+// 群组的时区决定每日统计的日期划分，修改后新的消息按新时区计入统计，已有的每日统计保持不变。
+// 往西修改时新时区的日期可能早于已有的统计，这时拒绝修改，避免统计的日期倒退
+func SetTimezone(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	args := strings.Fields(h.TrimCmd(msg.GetText()))
+	forUser := msg.Chat.Type == gotgbot.ChatTypePrivate
+	if len(args) > 0 && strings.EqualFold(args[0], "me") {
+		forUser, args = true, args[1:]
+	}
+	if len(args) > 1 {
+		_, err := msg.Reply(bot, timezoneUsage, nil)
+		return err
+	}
+	c, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if forUser {
+		return setUserTimezone(c, bot, msg, args)
+	}
+
+	cfg := g.Q.GetChatCfgByIdOrDefault(msg.Chat.Id)
+	if len(args) == 0 {
+		_, err := msg.Reply(bot, "群组的时区为 "+q.FormatTimezone(cfg.Location())+"\n"+timezoneUsage, nil)
+		return err
+	}
+	if !h.IsSenderAdmin(bot, msg) {
+		_, err := msg.Reply(bot, "只有管理员可以修改群组的时区", nil)
+		return err
+	}
+	name, offset, err := q.ParseTimezone(args[0])
+	if err != nil {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	}
+	// 先保存按旧时区统计的数据
+	if _, err = g.Q.FlushChatStats(c); err != nil {
+		return err
+	}
+	if reason, err := checkStatDayForward(c, msg.Chat.Id, q.LoadTimezone(name, offset), time.Now()); err != nil || reason != "" {
+		if err == nil {
+			_, err = msg.Reply(bot, reason, nil)
+		}
+		return err
+	}
+	cfg.Timezone, cfg.TimezoneName = offset, name
+	if err = cfg.Save(c, g.Q); err != nil {
+		return err
+	}
+	loc := cfg.Location()
+	today := statDayToDate(q.StatDayOf(time.Now().Unix(), loc)).Format(statDateLayout)
+	_, err = msg.Reply(bot, fmt.Sprintf("群组的时区已设置为 %s，当前是 %s，之后的消息按新时区计入统计",
+		q.FormatTimezone(loc), today), nil)
+	return err
+}
+
+// checkStatDayForward 新时区的当前日期早于已有的最后一天统计时返回不能修改的原因
+func checkStatDayForward(ctx context.Context, chatId int64, loc *time.Location, now time.Time) (string, error) {
+	last, err := g.Q.GetLastChatStatDate(ctx, chatId)
+	if err != nil {
+		return "", err
+	}
+	today := q.StatDayOf(now.Unix(), loc)
+	if today >= last {
+		return "", nil
+	}
+	lastDate := statDayToDate(last).Format(statDateLayout)
+	return fmt.Sprintf("新时区的当前日期 %s 早于已有统计的日期 %s，修改后统计日期会倒退。请等新时区到 %s 后再修改",
+		statDayToDate(today).Format(statDateLayout), lastDate, lastDate), nil
+}
+
+func setUserTimezone(c context.Context, bot *gotgbot.Bot, msg *gotgbot.Message, args []string) error {
+	if msg.From == nil {
+		_, err := msg.Reply(bot, "无法识别发送者", nil)
+		return err
+	}
+	user, err := g.Q.GetOrCreateUserByTg(c, msg.From)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		_, err = msg.Reply(bot, "你的时区为 "+q.FormatTimezone(user.Location())+"\n"+timezoneUsage, nil)
+		return err
+	}
+	name, offset, err := q.ParseTimezone(args[0])
+	if err != nil {
+		_, err = msg.Reply(bot, err.Error(), nil)
+		return err
+	}
+	if err = g.Q.UpdateUserTimeZone(c, user, name, offset); err != nil {
+		return err
+	}
+	_, err = msg.Reply(bot, "你的时区已设置为 "+q.FormatTimezone(user.Location()), nil)
+	return err
+}
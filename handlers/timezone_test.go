@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"testing"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+)
+
+func TestSaveTimezone(t *testing.T) {
+	ctx := context.Background()
+	user, err := g.Q.GetOrCreateUserByTg(ctx, &gotgbot.User{Id: 9990050, FirstName: "tz"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := q.FormatUtcOffset(user.Timezone); got != "UTC+08:00" {
+		t.Fatalf("default user timezone = %s", got)
+	}
+	name, offset, err := q.ParseTimezone("America/New_York")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = g.Q.UpdateUserTimeZone(ctx, user, name, offset); err != nil {
+		t.Fatal(err)
+	}
+	var savedName string
+	err = g.RawMainDb().QueryRowContext(ctx, "SELECT timezone_name FROM users WHERE id = ?", user.ID).Scan(&savedName)
+	if err != nil || savedName != "America/New_York" {
+		t.Fatalf("saved user timezone %q %v", savedName, err)
+	}
+	if user.Location().String() != "America/New_York" {
+		t.Fatalf("unexpected user location %s", user.Location())
+	}
+
+	const chatId = -1009990050
+	cfg := g.Q.GetChatCfgByIdOrDefault(chatId)
+	cfg.Timezone, cfg.TimezoneName = 5*3600+30*60, ""
+	if err = cfg.Save(ctx, g.Q); err != nil {
+		t.Fatal(err)
+	}
+	cfg.TimezoneName = "Asia/Tokyo"
+	if err = cfg.Save(ctx, g.Q); err != nil {
+		t.Fatal(err)
+	}
+	var tz int64
+	err = g.RawMainDb().QueryRowContext(ctx, "SELECT timezone, timezone_name FROM chat_cfg WHERE id = ?", chatId).Scan(&tz, &savedName)
+	if err != nil || tz != 5*3600+30*60 || savedName != "Asia/Tokyo" {
+		t.Fatalf("saved chat timezone %d %q %v", tz, savedName, err)
+	}
+}
+
+func TestCheckStatDayForward(t *testing.T) {
+	ctx := context.Background()
+	const chatId = -1009990051
+	// 上海已经是 3月4日，檀香山还是 3月3日
+	now := time.Date(2024, 3, 4, 2, 0, 0, 0, q.LoadTimezone("Asia/Shanghai", 8*3600))
+	day := dateToStatDay(time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC))
+	if _, err := g.RawMainDb().ExecContext(ctx, "INSERT INTO chat_stat_daily (chat_id, stat_date) VALUES (?, ?)", chatId, day); err != nil {
+		t.Fatal(err)
+	}
+	reason, err := checkStatDayForward(ctx, chatId, q.LoadTimezone("Pacific/Honolulu", -10*3600), now)
+	if err != nil || reason == "" {
+		t.Fatalf("westward change should be refused: %q %v", reason, err)
+	}
+	if reason, err = checkStatDayForward(ctx, chatId, q.LoadTimezone("Asia/Tokyo", 9*3600), now); err != nil || reason != "" {
+		t.Fatalf("eastward change should be allowed: %q %v", reason, err)
+	}
+	if reason, err = checkStatDayForward(ctx, chatId, q.LoadTimezone("Pacific/Honolulu", -10*3600), now.Add(24*time.Hour)); err != nil || reason != "" {
+		t.Fatalf("change should be allowed once the new date reaches the last stat date: %q %v", reason, err)
+	}
+	if reason, err = checkStatDayForward(ctx, -1009990052, q.LoadTimezone("Pacific/Honolulu", -10*3600), now); err != nil || reason != "" {
+		t.Fatalf("chat without stats should be allowed: %q %v", reason, err)
+	}
+}
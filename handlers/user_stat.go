@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"strings"
+	"time"
+
+	"github.com/PaulSonOfLars/gotgbot/v2"
+	"github.com/PaulSonOfLars/gotgbot/v2/ext"
+)
+
+// myStatDays /me 中连续发言和活跃时段统计的天数，每次都要解码这段时间内的每日统计，不能不加限制。
+// 累计的消息数和排名来自 chat_user_stat_total，不受这个限制
+const myStatDays = 365
+
+// periodStat 用户在一段时间内的消息数和排名，Rank 为0表示没有发言
+type periodStat struct {
+	Count int64
+	Rank  int
+}
+
+type personalStat struct {
+	Today, Week, All periodStat
+	// 累计的统计，没有按小时的数据
+	Total q.UserMsgStat
+	// 最近 myStatDays 天的活跃小时，没有按小时统计的数据时为 -1
+	ActiveHour    int
+	LongestStreak int64
+	CurrentStreak int64
+}
+
+func userRank(stats q.UserMsgStatMap, userId int64) periodStat {
+	mine, ok := stats[userId]
+	if !ok || mine == nil || mine.MsgCount == 0 {
+		return periodStat{}
+	}
+	rank := 1
+	for u, s := range stats {
+		if u != userId && s != nil && s.MsgCount > mine.MsgCount {
+			rank++
+		}
+	}
+	return periodStat{Count: mine.MsgCount, Rank: rank}
+}
+
+// summarizeUser 根据按日期排序的每日统计计算用户今天和最近7天的排名、连续发言天数和活跃时段，today 为聊天时区的今天。
+// 累计的统计由 allTimeStat 填充
+func summarizeUser(days []q.ChatStatDaily, userId, today int64) personalStat {
+	var res personalStat
+	var hours [24]int64
+	week := make(q.UserMsgStatMap)
+	var streak, lastDay int64
+	for _, d := range days {
+		if d.StatDate > today-7 {
+			week.Merge(d.UserMsgStat)
+		}
+		if d.StatDate == today {
+			res.Today = userRank(d.UserMsgStat, userId)
+		}
+		s, ok := d.UserMsgStat[userId]
+		if !ok || s == nil || s.MsgCount == 0 {
+			continue
+		}
+		for hour, c := range s.MsgCountByHour {
+			hours[hour] += c
+		}
+		if streak > 0 && d.StatDate == lastDay+1 {
+			streak++
+		} else {
+			streak = 1
+		}
+		lastDay = d.StatDate
+		res.LongestStreak = max(res.LongestStreak, streak)
+	}
+	// 今天还没有发言时，截止到昨天的连续天数仍然有效
+	if lastDay >= today-1 {
+		res.CurrentStreak = streak
+	}
+	res.Week = userRank(week, userId)
+	res.ActiveHour = -1
+	var best int64
+	for hour, c := range hours {
+		if c > best {
+			best, res.ActiveHour = c, hour
+		}
+	}
+	return res
+}
+
+// allTimeStat 用户在聊天中的累计消息数、排名和媒体统计，读取前需要先保存内存中的统计
+func allTimeStat(ctx context.Context, chatId, userId int64) (periodStat, q.UserMsgStat, error) {
+	total, err := g.Q.GetChatUserStatTotal(ctx, chatId, userId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && total.MsgCount == 0) {
+		return periodStat{}, q.UserMsgStat{}, nil
+	} else if err != nil {
+		return periodStat{}, q.UserMsgStat{}, err
+	}
+	rank, err := g.Q.GetChatUserStatRank(ctx, chatId, total.MsgCount)
+	if err != nil {
+		return periodStat{}, q.UserMsgStat{}, err
+	}
+	return periodStat{Count: total.MsgCount, Rank: int(rank)}, q.UserMsgStat{
+		MsgCount:     total.MsgCount,
+		MsgLen:       total.MsgLen,
+		PhotoCount:   total.PhotoCount,
+		VideoCount:   total.VideoCount,
+		StickerCount: total.StickerCount,
+		ForwardCount: total.ForwardCount,
+	}, nil
+}
+
+func (p periodStat) String() string {
+	if p.Rank == 0 {
+		return "0条"
+	}
+	return fmt.Sprintf("%d条（第%d名）", p.Count, p.Rank)
+}
+
+func formatPersonalStat(name string, s personalStat) string {
+	if s.All.Count == 0 {
+		return fmt.Sprintf("%s没有在这里说过话", name)
+	}
+	var sb strings.Builder
+	_, _ = fmt.Fprintf(&sb, "%s的发言统计：\n", name)
+	_, _ = fmt.Fprintf(&sb, "今天: %s\n最近7天: %s\n累计: %s\n", s.Today, s.Week, s.All)
+	if s.ActiveHour >= 0 {
+		_, _ = fmt.Fprintf(&sb, "最近%d天最活跃的时段: %02d:00-%02d:00\n", myStatDays, s.ActiveHour, s.ActiveHour+1)
+	}
+	_, _ = fmt.Fprintf(&sb, "平均每条%.1f字\n", float64(s.Total.MsgLen)/float64(s.Total.MsgCount))
+	_, _ = fmt.Fprintf(&sb, "最近%d天最长连续发言%d天，当前连续%d天\n", myStatDays, s.LongestStreak, s.CurrentStreak)
+	_, _ = fmt.Fprintf(&sb, "图片%d张，视频%d个，表情%d个，转发%d条",
+		s.Total.PhotoCount, s.Total.VideoCount, s.Total.StickerCount, s.Total.ForwardCount)
+	return sb.String()
+}
+
+// MyStat /me 查看自己在当前聊天的发言统计，回复别人的消息时查看对方的统计
+func MyStat(bot *gotgbot.Bot, ctx *ext.Context) error {
+	msg := ctx.EffectiveMessage
+	user := msg.GetSender()
+	if msg.ReplyToMessage != nil {
+		user = msg.ReplyToMessage.GetSender()
+	}
+	chatId := ctx.EffectiveChat.Id
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	today := q.StatDayOf(time.Now().Unix(), g.Q.GetChatCfgByIdOrDefault(chatId).Location())
+	// ListChatStatRange 会先保存内存中的统计，之后读到的累计统计包含今天的消息
+	days, err := g.Q.ListChatStatRange(c, chatId, today-myStatDays+1, today)
+	if err != nil {
+		return err
+	}
+	stat := summarizeUser(days, user.Id(), today)
+	if stat.All, stat.Total, err = allTimeStat(c, chatId, user.Id()); err != nil {
+		return err
+	}
+	_, err = msg.Reply(bot, formatPersonalStat(user.Name(), stat), nil)
+	return err
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"context"
+	g "main/globalcfg"
+	"main/globalcfg/q"
+	"testing"
+	"time"
+)
+
+func TestSummarizeUser(t *testing.T) {
+	const me, other, today = 1, 2, 100
+	day := func(date int64, mine, others int64) q.ChatStatDaily {
+		m := q.UserMsgStatMap{other: {MsgCount: others, MsgLen: others}}
+		if mine > 0 {
+			s := &q.UserMsgStat{MsgCount: mine, MsgLen: mine * 4, StickerCount: 1}
+			s.MsgCountByHour[21] = mine
+			m[me] = s
+		}
+		return q.ChatStatDaily{StatDate: date, UserMsgStat: m}
+	}
+	days := []q.ChatStatDaily{
+		day(80, 5, 1), day(81, 5, 1), day(82, 5, 1), day(83, 5, 1), // 连续4天
+		day(90, 1, 50),
+		day(98, 2, 1), day(99, 2, 1), day(today, 1, 3),
+	}
+	s := summarizeUser(days, me, today)
+	if s.Today != (periodStat{Count: 1, Rank: 2}) {
+		t.Fatalf("today: %+v", s.Today)
+	}
+	if s.Week != (periodStat{Count: 5, Rank: 1}) {
+		t.Fatalf("week: %+v", s.Week)
+	}
+	if s.LongestStreak != 4 || s.CurrentStreak != 3 {
+		t.Fatalf("streak: longest %d current %d", s.LongestStreak, s.CurrentStreak)
+	}
+	if s.ActiveHour != 21 {
+		t.Fatalf("active hour %d", s.ActiveHour)
+	}
+
+	// 昨天之前断掉的连续天数不算当前连续
+	s = summarizeUser(days[:5], me, today)
+	if s.CurrentStreak != 0 || s.Today.Rank != 0 {
+		t.Fatalf("stale streak %d, today %+v", s.CurrentStreak, s.Today)
+	}
+	if s = summarizeUser(days, 3, today); s.Week.Rank != 0 || s.ActiveHour != -1 {
+		t.Fatalf("unknown user: %+v", s)
+	}
+	if text := formatPersonalStat("张三", s); text != "张三没有在这里说过话" {
+		t.Fatalf("unexpected text %q", text)
+	}
+}
+
+func TestAllTimeStat(t *testing.T) {
+	ctx := context.Background()
+	const chatId = -1009990043
+	now := time.Now().Unix()
+	old := g.Q.ChatStatAt(chatId, now-400*86400)
+	old.IncMessage(1, 4, now-400*86400, 1, q.MediaSticker)
+	old.IncMessage(2, 1, now-400*86400, 2, 0)
+	g.Q.ChatStatAt(chatId, now).IncMessage(2, 1, now, 3, 0)
+	if _, err := g.Q.FlushChatStats(ctx); err != nil {
+		t.Fatal(err)
+	}
+	all, total, err := allTimeStat(ctx, chatId, 1)
+	if err != nil || all != (periodStat{Count: 1, Rank: 2}) || total.StickerCount != 1 || total.MsgLen != 4 {
+		t.Fatalf("user 1: %+v %+v %v", all, total, err)
+	}
+	if all, _, err = allTimeStat(ctx, chatId, 2); err != nil || all != (periodStat{Count: 2, Rank: 1}) {
+		t.Fatalf("user 2: %+v %v", all, err)
+	}
+	if all, _, err = allTimeStat(ctx, chatId, 3); err != nil || all != (periodStat{}) {
+		t.Fatalf("unknown user: %+v %v", all, err)
+	}
+}
@@ -8,8 +8,11 @@ import (
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 //goland:noinspection GoUnusedConst
@@ -25,6 +28,16 @@ type ResponseError struct {
 		Message string `json:"message,omitempty"`
 	} `json:"error,omitempty"`
 }
+
+var (
+	requestsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "azure_requests_total", Help: "Azure 接口调用次数"}, []string{"api"})
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "azure_request_errors_total", Help: "Azure 接口调用失败次数"}, []string{"api"})
+	requestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "azure_request_duration_seconds", Help: "Azure 接口调用耗时"}, []string{"api"})
+)
+
 type Client struct {
 	client   http.Client
 	endpoint string
@@ -47,6 +60,21 @@ func (c *Client) reqWithAuth(method, contentType string) *http.Request {
 	return request
 }
 
+// do 发送请求并解析响应，同时记录调用次数、失败次数和耗时
+func (c *Client) do(api string, req *http.Request, v any) error {
+	start := time.Now()
+	requestsTotal.WithLabelValues(api).Inc()
+	defer func() { requestDuration.WithLabelValues(api).Observe(time.Since(start).Seconds()) }()
+	resp, err := c.client.Do(req)
+	if err == nil {
+		err = unmarshalResponse(resp, v)
+	}
+	if err != nil {
+		requestErrors.WithLabelValues(api).Inc()
+	}
+	return err
+}
+
 func unmarshalResponse(resp *http.Response, v any) error {
 	defer resp.Body.Close()
 	body, err := io.ReadAll(resp.Body)
@@ -91,12 +119,8 @@ func (m *Moderator) EvalFile(path string) (*ModeratorResult, error) {
 	defer file.Close()
 	req := m.reqWithAuth(http.MethodPost, "image/jpeg")
 	req.Body = file
-	resp, err := m.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
 	res := &ModeratorResult{}
-	err = unmarshalResponse(resp, res)
+	err = m.do("moderator", req, res)
 	return res, err
 }
 
@@ -165,12 +189,8 @@ func (o *Ocr) ocr(body io.ReadCloser, contentLength int64) (*OcrResult, error) {
 		q.Add("language", o.Language)
 	}
 	req.URL.RawQuery = q.Encode()
-	resp, err := o.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
 	res := &OcrResult{}
-	err = unmarshalResponse(resp, res)
+	err := o.do("ocr", req, res)
 	return res, err
 }
 
@@ -261,12 +281,8 @@ func (m *ModeratorV2) EvalData(data []byte) (*ModeratorV2Result, error) {
 	}
 	req.Body = io.NopCloser(bytes.NewReader(body))
 	req.ContentLength = int64(len(body))
-	resp, err := m.client.Do(req)
-	if err != nil {
-		return nil, err
-	}
 	result := &ModeratorV2Result{}
-	err = unmarshalResponse(resp, result)
+	err = m.do("moderator_v2", req, result)
 	return result, err
 }
 
@@ -0,0 +1,299 @@
+package imgproc
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"sync"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// 文泉驿微米黑（Apache License 2.0，许可证和版权声明见 assets/NOTICE），从ttc中取出第一个字体并去掉了竖排和字形替换等用不到的表
+//
+//go:embed assets/wqy-microhei.ttf
+var wqyMicroHei []byte
+
+var getChartFont = sync.OnceValues(func() (*sfnt.Font, error) {
+	return sfnt.Parse(wqyMicroHei)
+})
+
+const (
+	chartWidth    = 960
+	chartHeight   = 540
+	chartPadding  = 48
+	chartTitleTop = 44
+	titleFontSize = 28
+	labelFontSize = 16
+)
+
+var (
+	chartBg    = color.NRGBA{R: 0xfa, G: 0xfa, B: 0xfa, A: 0xff}
+	chartFg    = color.NRGBA{R: 0x33, G: 0x33, B: 0x33, A: 0xff}
+	chartGrid  = color.NRGBA{R: 0xdd, G: 0xdd, B: 0xdd, A: 0xff}
+	chartBar   = color.NRGBA{R: 0x4a, G: 0x90, B: 0xe2, A: 0xff}
+	chartLine  = color.NRGBA{R: 0xe2, G: 0x6a, B: 0x4a, A: 0xff}
+	chartLabel = color.NRGBA{R: 0x77, G: 0x77, B: 0x77, A: 0xff}
+
+	ErrEmptyChart = errors.New("no data to draw")
+)
+
+// ChartItem 柱状图或折线图中的一项
+type ChartItem struct {
+	Label string
+	Value int64
+}
+
+// chartCanvas opentype.Face 不能并发使用，每张图单独创建
+type chartCanvas struct {
+	img         *image.NRGBA
+	title       font.Face
+	label       font.Face
+	left, right int
+	top, bottom int
+}
+
+func newChartCanvas(title string) (*chartCanvas, error) {
+	f, err := getChartFont()
+	if err != nil {
+		return nil, err
+	}
+	titleFace, err := opentype.NewFace(f, &opentype.FaceOptions{Size: titleFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	labelFace, err := opentype.NewFace(f, &opentype.FaceOptions{Size: labelFontSize, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, err
+	}
+	c := &chartCanvas{
+		img:    imaging.New(chartWidth, chartHeight, chartBg),
+		title:  titleFace,
+		label:  labelFace,
+		left:   chartPadding,
+		right:  chartWidth - chartPadding,
+		top:    chartTitleTop + chartPadding,
+		bottom: chartHeight - chartPadding,
+	}
+	c.text(c.title, title, chartWidth/2, chartTitleTop, chartFg, alignCenter)
+	return c, nil
+}
+
+type textAlign int
+
+const (
+	alignLeft textAlign = iota
+	alignCenter
+	alignRight
+)
+
+// text 在基线 y 处绘制文字，x 的含义由 align 决定
+func (c *chartCanvas) text(face font.Face, s string, x, y int, col color.Color, align textAlign) {
+	d := &font.Drawer{Dst: c.img, Src: image.NewUniform(col), Face: face}
+	w := d.MeasureString(s).Ceil()
+	switch align {
+	case alignCenter:
+		x -= w / 2
+	case alignRight:
+		x -= w
+	}
+	d.Dot = fixed.P(x, y)
+	d.DrawString(s)
+}
+
+func (c *chartCanvas) textWidth(face font.Face, s string) int {
+	return font.MeasureString(face, s).Ceil()
+}
+
+func (c *chartCanvas) rect(x0, y0, x1, y1 int, col color.Color) {
+	draw.Draw(c.img, image.Rect(x0, y0, x1, y1), image.NewUniform(col), image.Point{}, draw.Src)
+}
+
+// line 绘制宽度为 width 的线段
+func (c *chartCanvas) line(x0, y0, x1, y1, width int, col color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	half := width / 2
+	e := dx + dy
+	for {
+		c.rect(x0-half, y0-half, x0-half+width, y0-half+width, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+// niceMax 将纵轴最大值向上取整为 1、2、5 乘以10的幂，返回最大值和刻度间隔
+func niceMax(v int64) (int64, int64) {
+	if v <= 0 {
+		return 4, 1
+	}
+	step := int64(1)
+	for {
+		for _, m := range []int64{1, 2, 5} {
+			if step*m*4 >= v {
+				return step * m * 4, step * m
+			}
+		}
+		step *= 10
+	}
+}
+
+// yAxis 绘制横向网格线和刻度，返回绘图区左边界
+func (c *chartCanvas) yAxis(maxValue int64) (int64, int) {
+	top, step := niceMax(maxValue)
+	labelW := c.textWidth(c.label, fmt.Sprint(top))
+	left := c.left + labelW + 8
+	for v := int64(0); v <= top; v += step {
+		y := c.valueY(v, top)
+		c.rect(left, y, c.right, y+1, chartGrid)
+		c.text(c.label, fmt.Sprint(v), left-6, y+labelFontSize/3, chartLabel, alignRight)
+	}
+	return top, left
+}
+
+func (c *chartCanvas) valueY(v, top int64) int {
+	return c.bottom - int(int64(c.bottom-c.top)*v/top)
+}
+
+func (c *chartCanvas) encode() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := imaging.Encode(buf, c.img, imaging.PNG); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// RenderActivityHistogram 根据每10分钟的消息数绘制24小时活跃度直方图，counts 长度应为144
+func RenderActivityHistogram(title string, counts []int64) ([]byte, error) {
+	var maxValue int64
+	for _, v := range counts {
+		maxValue = max(maxValue, v)
+	}
+	if len(counts) == 0 || maxValue == 0 {
+		return nil, ErrEmptyChart
+	}
+	c, err := newChartCanvas(title)
+	if err != nil {
+		return nil, err
+	}
+	c.bottom -= labelFontSize + 8
+	top, left := c.yAxis(maxValue)
+	slot := float64(c.right-left) / float64(len(counts))
+	perHour := max(len(counts)/24, 1)
+	for i, v := range counts {
+		x0 := left + int(float64(i)*slot)
+		x1 := left + int(float64(i+1)*slot)
+		if x1-x0 > 2 {
+			x1--
+		}
+		if v > 0 {
+			c.rect(x0, c.valueY(v, top), x1, c.bottom, chartBar)
+		}
+		if i%(perHour*3) == 0 {
+			c.text(c.label, fmt.Sprintf("%02d:00", i/perHour), x0, c.bottom+labelFontSize+4, chartLabel, alignCenter)
+		}
+	}
+	return c.encode()
+}
+
+// RenderTopBarChart 绘制横向柱状图，items 按顺序从上到下排列
+func RenderTopBarChart(title string, items []ChartItem) ([]byte, error) {
+	if len(items) == 0 {
+		return nil, ErrEmptyChart
+	}
+	c, err := newChartCanvas(title)
+	if err != nil {
+		return nil, err
+	}
+	var maxValue int64
+	labelW := 0
+	for _, it := range items {
+		maxValue = max(maxValue, it.Value)
+		labelW = max(labelW, c.textWidth(c.label, it.Label))
+	}
+	labelW = min(labelW, chartWidth/3)
+	maxValue = max(maxValue, 1)
+	left := c.left + labelW + 12
+	valueW := c.textWidth(c.label, fmt.Sprint(maxValue)) + 8
+	rowH := (c.bottom - c.top) / len(items)
+	barH := max(rowH*2/3, 4)
+	for i, it := range items {
+		y := c.top + i*rowH + (rowH-barH)/2
+		w := int(int64(c.right-valueW-left) * it.Value / maxValue)
+		c.rect(left, y, left+w, y+barH, chartBar)
+		baseline := y + barH/2 + labelFontSize/3
+		label := it.Label
+		for c.textWidth(c.label, label) > labelW && len([]rune(label)) > 1 {
+			r := []rune(label)
+			label = string(r[:len(r)-2]) + "…"
+		}
+		c.text(c.label, label, left-8, baseline, chartFg, alignRight)
+		c.text(c.label, fmt.Sprint(it.Value), left+w+6, baseline, chartFg, alignLeft)
+	}
+	return c.encode()
+}
+
+// RenderTrendChart 绘制折线图，横轴标签过多时只显示一部分
+func RenderTrendChart(title string, points []ChartItem) ([]byte, error) {
+	if len(points) < 2 {
+		return nil, ErrEmptyChart
+	}
+	c, err := newChartCanvas(title)
+	if err != nil {
+		return nil, err
+	}
+	c.bottom -= labelFontSize + 8
+	var maxValue int64
+	for _, p := range points {
+		maxValue = max(maxValue, p.Value)
+	}
+	top, left := c.yAxis(maxValue)
+	left += 8
+	right := c.right - 8
+	labelEvery := max((len(points)+7)/8, 1)
+	x := func(i int) int { return left + (right-left)*i/(len(points)-1) }
+	for i, p := range points {
+		if i > 0 {
+			c.line(x(i-1), c.valueY(points[i-1].Value, top), x(i), c.valueY(p.Value, top), 3, chartLine)
+		}
+		if (len(points)-1-i)%labelEvery == 0 {
+			c.text(c.label, p.Label, x(i), c.bottom+labelFontSize+4, chartLabel, alignCenter)
+		}
+	}
+	for i, p := range points {
+		y := c.valueY(p.Value, top)
+		c.rect(x(i)-3, y-3, x(i)+4, y+4, chartLine)
+	}
+	return c.encode()
+}
@@ -0,0 +1,98 @@
+package imgproc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRenderCharts(t *testing.T) {
+	as := require.New(t)
+	counts := make([]int64, 24*6)
+	for i := range counts {
+		counts[i] = int64(i % 37)
+	}
+	hist, err := RenderActivityHistogram("24小时活跃度", counts)
+	as.NoError(err)
+	bars, err := RenderTopBarChart("发言排行", []ChartItem{
+		{"智乃酱", 120}, {"一个名字非常非常非常非常非常非常非常非常长的群友", 80}, {"bob", 3},
+	})
+	as.NoError(err)
+	points := make([]ChartItem, 30)
+	for i := range points {
+		points[i] = ChartItem{Label: "10-" + string(rune('0'+i%10)), Value: int64(i * i % 50)}
+	}
+	trend, err := RenderTrendChart("最近30天", points)
+	as.NoError(err)
+	for name, data := range map[string][]byte{"hist": hist, "bars": bars, "trend": trend} {
+		img, err := png.Decode(bytes.NewReader(data))
+		as.NoError(err, name)
+		as.Equal(chartWidth, img.Bounds().Dx())
+		as.Equal(chartHeight, img.Bounds().Dy())
+		if os.Getenv("SAVE_CHART") != "" {
+			as.NoError(os.WriteFile("/tmp/chart_"+name+".png", data, 0o644))
+		}
+	}
+
+	_, err = RenderActivityHistogram("empty", make([]int64, 144))
+	as.ErrorIs(err, ErrEmptyChart)
+	_, err = RenderTopBarChart("empty", nil)
+	as.ErrorIs(err, ErrEmptyChart)
+	_, err = RenderTrendChart("empty", points[:1])
+	as.ErrorIs(err, ErrEmptyChart)
+}
+
+func TestNiceMax(t *testing.T) {
+	as := require.New(t)
+	for v, want := range map[int64][2]int64{0: {4, 1}, 3: {4, 1}, 5: {8, 2}, 17: {20, 5}, 39: {40, 10}, 41: {80, 20}, 999: {2000, 500}} {
+		top, step := niceMax(v)
+		as.Equal(want, [2]int64{top, step}, "v=%d", v)
+	}
+}
+
+func TestRenderWordCloud(t *testing.T) {
+	as := require.New(t)
+	words := []string{"火锅", "显卡", "原神", "天气", "周末", "chatgpt", "考试", "加班", "猫猫", "电影", "奶茶", "地铁"}
+	items := make([]ChartItem, 0, 150)
+	for i := range 150 {
+		items = append(items, ChartItem{Label: fmt.Sprintf("%s%d", words[i%len(words)], i/len(words)), Value: int64(300 / (i + 1))})
+	}
+	data, err := RenderWordCloud("今日热词", items)
+	as.NoError(err)
+	img, err := png.Decode(bytes.NewReader(data))
+	as.NoError(err)
+	as.Equal(chartWidth, img.Bounds().Dx())
+	as.Equal(chartHeight, img.Bounds().Dy())
+	if os.Getenv("SAVE_CHART") != "" {
+		as.NoError(os.WriteFile("/tmp/chart_cloud.png", data, 0o644))
+	}
+
+	_, err = RenderWordCloud("empty", []ChartItem{{"零", 0}})
+	as.ErrorIs(err, ErrEmptyChart)
+	// 宽度超过画布的词放不下
+	_, err = RenderWordCloud("too long", []ChartItem{{strings.Repeat("长", 200), 1}})
+	as.ErrorIs(err, ErrEmptyChart)
+}
+
+func TestCloudFontSize(t *testing.T) {
+	as := require.New(t)
+	as.Equal(cloudMaxFontSize, cloudFontSize(100, 1, 100))
+	as.Equal(cloudMinFontSize, cloudFontSize(1, 1, 100))
+	as.Equal((cloudMinFontSize+cloudMaxFontSize)/2, cloudFontSize(5, 5, 5))
+
+	bounds := image.Rect(0, 0, 100, 50)
+	first, ok := findCloudPlace(bounds, nil, 20, 10)
+	as.True(ok)
+	as.Equal(image.Rect(40, 20, 60, 30), first)
+	second, ok := findCloudPlace(bounds, []image.Rectangle{first}, 20, 10)
+	as.True(ok)
+	as.False(second.Inset(-cloudWordPadding).Overlaps(first))
+	_, ok = findCloudPlace(bounds, nil, 120, 10)
+	as.False(ok)
+}
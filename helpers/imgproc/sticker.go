@@ -0,0 +1,33 @@
+package imgproc
+
+import (
+	"bytes"
+	"image"
+
+	"github.com/disintegration/imaging"
+)
+
+// StickerSize Telegram静态贴纸要求最长边为512像素
+const StickerSize = 512
+
+// ToStickerWebp 将png/jpeg图片缩放到贴纸尺寸并编码为webp
+func ToStickerWebp(data []byte) ([]byte, error) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img = imaging.Fit(img, StickerSize, StickerSize, imaging.Lanczos)
+	b := img.Bounds()
+	if b.Dx() < StickerSize && b.Dy() < StickerSize {
+		if b.Dx() >= b.Dy() {
+			img = imaging.Resize(img, StickerSize, 0, imaging.Lanczos)
+		} else {
+			img = imaging.Resize(img, 0, StickerSize, imaging.Lanczos)
+		}
+	}
+	buf := &bytes.Buffer{}
+	if err = encodeWebp(buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,26 @@
+package imgproc
+
+import (
+	"bytes"
+	"image"
+	"testing"
+
+	"github.com/disintegration/imaging"
+	"github.com/kolesa-team/go-webp/webp"
+	"github.com/stretchr/testify/require"
+)
+
+func TestToStickerWebp(t *testing.T) {
+	as := require.New(t)
+	buf := &bytes.Buffer{}
+	as.NoError(imaging.Encode(buf, imaging.New(200, 100, image.White), imaging.PNG))
+	data, err := ToStickerWebp(buf.Bytes())
+	as.NoError(err)
+	img, err := webp.Decode(bytes.NewReader(data), nil)
+	as.NoError(err)
+	as.Equal(StickerSize, img.Bounds().Dx())
+	as.Equal(StickerSize/2, img.Bounds().Dy())
+
+	_, err = ToStickerWebp([]byte("not an image"))
+	as.Error(err)
+}
@@ -5,25 +5,32 @@ package imgproc
 import (
 	"errors"
 	"image"
+	"io"
 	"os"
 
 	"github.com/kolesa-team/go-webp/encoder"
 	"github.com/kolesa-team/go-webp/webp"
 )
 
-func encodeToWebp(img image.Image, file string) error {
+func encodeWebp(w io.Writer, img image.Image) error {
 	if img == nil {
 		return errors.New("nil image")
 	}
-	f, err := os.Create(file)
+	opt, err := encoder.NewLossyEncoderOptions(encoder.PresetPicture, 80)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	return webp.Encode(w, img, opt)
+}
 
-	opt, err := encoder.NewLossyEncoderOptions(encoder.PresetPicture, 80)
+func encodeToWebp(img image.Image, file string) error {
+	if img == nil {
+		return errors.New("nil image")
+	}
+	f, err := os.Create(file)
 	if err != nil {
 		return err
 	}
-	return webp.Encode(f, img, opt)
+	defer f.Close()
+	return encodeWebp(f, img)
 }
@@ -5,8 +5,13 @@ package imgproc
 import (
 	"errors"
 	"image"
+	"io"
 )
 
+func encodeWebp(_ io.Writer, _ image.Image) error {
+	return errors.New("webp not support on windows")
+}
+
 func encodeToWebp(_ image.Image, _ string) error {
 	return errors.New("webp not support on windows")
 }
@@ -0,0 +1,115 @@
+package imgproc
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/opentype"
+)
+
+const (
+	cloudMaxWords    = 100
+	cloudMinFontSize = 14
+	cloudMaxFontSize = 72
+	cloudWordPadding = 3
+	cloudSpiralStep  = 1.5  // 螺线每弧度增加的半径（纵向，像素）
+	cloudSpiralDelta = 0.05 // 螺线每次前进的角度（弧度）
+)
+
+var cloudPalette = []color.NRGBA{
+	chartBar,
+	chartLine,
+	{R: 0x2e, G: 0x9e, B: 0x6a, A: 0xff},
+	{R: 0x8e, G: 0x5a, B: 0xc8, A: 0xff},
+	{R: 0xd4, G: 0x9a, B: 0x1c, A: 0xff},
+	{R: 0x1c, G: 0x9a, B: 0xb0, A: 0xff},
+	{R: 0xc8, G: 0x4a, B: 0x8a, A: 0xff},
+}
+
+// cloudFontSize 字号随权重的平方根增大，所有词权重相同时使用中间的字号
+func cloudFontSize(v, minValue, maxValue int64) int {
+	if maxValue == minValue {
+		return (cloudMinFontSize + cloudMaxFontSize) / 2
+	}
+	ratio := math.Sqrt(float64(v-minValue) / float64(maxValue-minValue))
+	return cloudMinFontSize + int(math.Round(ratio*(cloudMaxFontSize-cloudMinFontSize)))
+}
+
+// findCloudPlace 从中心沿横向拉伸的阿基米德螺线寻找一个不与已放置的词重叠的 w*h 矩形
+func findCloudPlace(bounds image.Rectangle, placed []image.Rectangle, w, h int) (image.Rectangle, bool) {
+	center := image.Pt((bounds.Min.X+bounds.Max.X)/2, (bounds.Min.Y+bounds.Max.Y)/2)
+	aspect := float64(bounds.Dx()) / float64(bounds.Dy())
+	for t := 0.0; ; t += cloudSpiralDelta {
+		r := cloudSpiralStep * t
+		if r*aspect > float64(bounds.Dx()/2+w) {
+			return image.Rectangle{}, false
+		}
+		x := center.X + int(r*aspect*math.Cos(t)) - w/2
+		y := center.Y + int(r*math.Sin(t)) - h/2
+		rect := image.Rect(x, y, x+w, y+h)
+		if !rect.In(bounds) {
+			continue
+		}
+		padded := rect.Inset(-cloudWordPadding)
+		if !slices.ContainsFunc(placed, padded.Overlaps) {
+			return rect, true
+		}
+	}
+}
+
+// RenderWordCloud 绘制词云，权重最高的 cloudMaxWords 个词从中心向外排列，放不下的词会被跳过
+func RenderWordCloud(title string, items []ChartItem) ([]byte, error) {
+	words := make([]ChartItem, 0, len(items))
+	for _, it := range items {
+		if it.Value > 0 && it.Label != "" {
+			words = append(words, it)
+		}
+	}
+	if len(words) == 0 {
+		return nil, ErrEmptyChart
+	}
+	slices.SortStableFunc(words, func(a, b ChartItem) int {
+		return cmp.Compare(b.Value, a.Value)
+	})
+	words = words[:min(len(words), cloudMaxWords)]
+
+	c, err := newChartCanvas(title)
+	if err != nil {
+		return nil, err
+	}
+	f, err := getChartFont()
+	if err != nil {
+		return nil, err
+	}
+	faces := make(map[int]font.Face)
+	bounds := image.Rect(c.left, c.top, c.right, c.bottom)
+	maxValue, minValue := words[0].Value, words[len(words)-1].Value
+	placed := make([]image.Rectangle, 0, len(words))
+	for i, it := range words {
+		size := cloudFontSize(it.Value, minValue, maxValue)
+		face, ok := faces[size]
+		if !ok {
+			face, err = opentype.NewFace(f, &opentype.FaceOptions{Size: float64(size), DPI: 72, Hinting: font.HintingFull})
+			if err != nil {
+				return nil, err
+			}
+			faces[size] = face
+		}
+		m := face.Metrics()
+		ascent := m.Ascent.Ceil()
+		rect, ok := findCloudPlace(bounds, placed, c.textWidth(face, it.Label), ascent+m.Descent.Ceil())
+		if !ok {
+			continue
+		}
+		placed = append(placed, rect)
+		c.text(face, it.Label, rect.Min.X, rect.Min.Y+ascent, cloudPalette[i%len(cloudPalette)], alignLeft)
+	}
+	if len(placed) == 0 {
+		return nil, ErrEmptyChart
+	}
+	return c.encode()
+}
@@ -4,6 +4,7 @@ import (
 	"container/list"
 	"iter"
 	"sync"
+	"sync/atomic"
 
 	"golang.org/x/sync/singleflight"
 )
@@ -16,8 +17,30 @@ type Cache[K comparable, V any] struct {
 	sf      singleflight.Group
 	keyFn   func(K) string
 	onEvict func(key K, value V) // NEW
+	name    string
+	hits    atomic.Int64
+	misses  atomic.Int64
+
+	// beforeEvict 在锁内、从缓存删除之前调用
+	beforeEvict func(key K, value V)
+}
+
+// Stats 缓存的命中统计
+type Stats struct {
+	Name   string
+	Len    int
+	Cap    int
+	Hits   int64
+	Misses int64
 }
 
+type statser interface{ Stats() Stats }
+
+var (
+	registryMu sync.Mutex
+	registry   []statser
+)
+
 type entry[K comparable, V any] struct {
 	key   K
 	value V
@@ -54,8 +77,10 @@ func NewStringKeyCache[V any](cap int, onEvict func(string, V)) *Cache[string, V
 // 3. 成功才写入缓存
 func (c *Cache[K, V]) Get(key K, fetch func() (V, error)) (V, error) {
 	if v, ok := c.get(key); ok {
+		c.hits.Add(1)
 		return v, nil
 	}
+	c.misses.Add(1)
 
 	vAny, err, _ := c.sf.Do(c.keyFn(key), func() (any, error) {
 		if v, ok := c.get(key); ok {
@@ -77,8 +102,48 @@ func (c *Cache[K, V]) Get(key K, fetch func() (V, error)) (V, error) {
 	return vAny.(V), nil
 }
 
-func (c *Cache[K, V]) TryGet(key K) (V, bool) { return c.get(key) }
-func (c *Cache[K, V]) Add(key K, value V)     { c.add(key, value) }
+func (c *Cache[K, V]) TryGet(key K) (V, bool) {
+	v, ok := c.get(key)
+	if ok {
+		c.hits.Add(1)
+	} else {
+		c.misses.Add(1)
+	}
+	return v, ok
+}
+
+func (c *Cache[K, V]) Add(key K, value V) { c.add(key, value) }
+
+// BeforeEvict 设置容量驱逐前的回调，在缓存的锁内、key 被删除之前调用，不能再访问缓存。
+// 用于在 onEvict 执行期间让其他读取者能找到被驱逐的值，返回 c 方便链式调用
+func (c *Cache[K, V]) BeforeEvict(fn func(K, V)) *Cache[K, V] {
+	c.beforeEvict = fn
+	return c
+}
+
+// Named 设置缓存名并登记到全局列表，用于导出命中率等指标，返回 c 方便链式调用
+func (c *Cache[K, V]) Named(name string) *Cache[K, V] {
+	c.name = name
+	registryMu.Lock()
+	registry = append(registry, c)
+	registryMu.Unlock()
+	return c
+}
+
+func (c *Cache[K, V]) Stats() Stats {
+	return Stats{Name: c.name, Len: c.Len(), Cap: c.cap, Hits: c.hits.Load(), Misses: c.misses.Load()}
+}
+
+// AllStats 返回所有通过 Named 登记的缓存的统计
+func AllStats() []Stats {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	res := make([]Stats, 0, len(registry))
+	for _, c := range registry {
+		res = append(res, c.Stats())
+	}
+	return res
+}
 
 // Remove 删除指定 key（默认不触发 onEvict）
 func (c *Cache[K, V]) Remove(key K) {
@@ -145,6 +210,9 @@ func (c *Cache[K, V]) add(key K, value V) {
 		back := c.ll.Back()
 		if back != nil {
 			ent := back.Value.(entry[K, V])
+			if c.beforeEvict != nil {
+				c.beforeEvict(ent.key, ent.value)
+			}
 			delete(c.items, ent.key)
 			c.ll.Remove(back)
 
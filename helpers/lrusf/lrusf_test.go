@@ -139,6 +139,26 @@ func TestCacheEvictionLRU(t *testing.T) {
 	}
 }
 
+func TestCacheBeforeEvict(t *testing.T) {
+	var order []string
+	var cache *Cache[int, string]
+	cache = NewCache[int, string](1, func(k int) string { return strconv.Itoa(k) }, func(k int, v string) {
+		order = append(order, "evict "+v)
+	}).BeforeEvict(func(k int, v string) {
+		// 锁内调用，直接检查 items
+		if _, ok := cache.items[k]; !ok {
+			t.Fatalf("key %d removed before BeforeEvict", k)
+		}
+		order = append(order, "before "+v)
+	})
+
+	cache.Add(1, "a")
+	cache.Add(2, "b")
+	if len(order) != 2 || order[0] != "before a" || order[1] != "evict a" {
+		t.Fatalf("order = %v", order)
+	}
+}
+
 func TestCacheRange(t *testing.T) {
 	cache := NewCache[int, string](3, func(k int) string { return strconv.Itoa(k) }, nil)
 	cache.Add(1, "a")
@@ -157,3 +177,24 @@ func TestCacheRange(t *testing.T) {
 		t.Fatalf("Range values = %#v, want all keys with correct values", got)
 	}
 }
+
+func TestCacheStats(t *testing.T) {
+	cache := NewStringKeyCache[int](2, nil).Named("test_stats")
+	cache.Add("a", 1)
+	_, _ = cache.TryGet("a")
+	_, _ = cache.TryGet("b")
+	_, _ = cache.Get("a", func() (int, error) { return 0, nil })
+	_, _ = cache.Get("c", func() (int, error) { return 3, nil })
+
+	s := cache.Stats()
+	if s.Name != "test_stats" || s.Hits != 2 || s.Misses != 2 || s.Len != 2 || s.Cap != 2 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	found := false
+	for _, st := range AllStats() {
+		found = found || st == s
+	}
+	if !found {
+		t.Fatalf("named cache not registered")
+	}
+}
@@ -100,3 +100,33 @@ func (c *Client) Search(q SearchQuery, result any) error {
 	}
 	return jsoniter.NewDecoder(bytes.NewReader(data)).Decode(result)
 }
+
+// DocumentsQuery 按过滤条件批量获取文档，不受搜索接口 maxTotalHits 的限制，
+// Filter 中使用的字段需要在索引中设置为 filterableAttributes
+type DocumentsQuery struct {
+	Filter string   `json:"filter,omitempty"`
+	Fields []string `json:"fields,omitempty"`
+	Limit  int      `json:"limit"`
+	Offset int      `json:"offset"`
+}
+
+type DocumentsResult[T any] struct {
+	Results []T `json:"results"`
+	Offset  int `json:"offset"`
+	Limit   int `json:"limit"`
+	Total   int `json:"total"`
+}
+
+func (c *Client) FetchDocuments(q DocumentsQuery, result any) error {
+	u := fmt.Sprintf("%s/indexes/%s/documents/fetch", c.BaseUrl, c.Index)
+	buf := bytes.NewBuffer(nil)
+	err := jsoniter.NewEncoder(buf).Encode(q)
+	if err != nil {
+		return err
+	}
+	data, err := c.postJsonData(u, buf, false)
+	if err != nil {
+		return err
+	}
+	return jsoniter.NewDecoder(bytes.NewReader(data)).Decode(result)
+}
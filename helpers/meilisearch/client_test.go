@@ -42,3 +42,28 @@ func TestAddDocumentsPostsJSONBatch(t *testing.T) {
 	assert.Equal(t, "first", gotBody[0]["message"])
 	assert.Equal(t, "second", gotBody[1]["message"])
 }
+
+func TestFetchDocumentsWithFilter(t *testing.T) {
+	var gotPath string
+	var gotQuery DocumentsQuery
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotPath = r.URL.Path
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&gotQuery))
+		_, _ = w.Write([]byte(`{"results":[{"msg_id":1},{"msg_id":2}],"offset":0,"limit":2,"total":5}`))
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewMeiliClient(server.URL, "tgmsgs", "", "mongo_id")
+	var result DocumentsResult[struct {
+		MsgID int64 `json:"msg_id"`
+	}]
+	err := client.FetchDocuments(DocumentsQuery{Filter: "peer_id = 1", Limit: 2}, &result)
+	require.NoError(t, err)
+
+	assert.Equal(t, "/indexes/tgmsgs/documents/fetch", gotPath)
+	assert.Equal(t, "peer_id = 1", gotQuery.Filter)
+	assert.Equal(t, 2, gotQuery.Limit)
+	assert.Equal(t, 5, result.Total)
+	require.Len(t, result.Results, 2)
+	assert.Equal(t, int64(2), result.Results[1].MsgID)
+}
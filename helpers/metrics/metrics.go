@@ -0,0 +1,38 @@
+// Package metrics 补充 client_golang 中没有的、在导出时才读取数值且标签值不固定的指标
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FuncCollector 在导出时调用 fn 读取数值，fn 通过 emit 输出每组标签的值
+type FuncCollector struct {
+	desc *prometheus.Desc
+	typ  prometheus.ValueType
+	fn   func(emit func(v float64, values ...string))
+}
+
+// NewGaugeFunc 创建 gauge 类型的 FuncCollector，需要再注册到 prometheus.Registerer
+func NewGaugeFunc(name, help string, labels []string, fn func(emit func(v float64, values ...string))) *FuncCollector {
+	return &FuncCollector{prometheus.NewDesc(name, help, labels, nil), prometheus.GaugeValue, fn}
+}
+
+// NewCounterFunc 与 NewGaugeFunc 相同，但 fn 输出的值必须单调递增
+func NewCounterFunc(name, help string, labels []string, fn func(emit func(v float64, values ...string))) *FuncCollector {
+	return &FuncCollector{prometheus.NewDesc(name, help, labels, nil), prometheus.CounterValue, fn}
+}
+
+func (f *FuncCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- f.desc
+}
+
+// Collect 标签数量不对时输出一个无效的指标，由 Gather 返回错误
+func (f *FuncCollector) Collect(ch chan<- prometheus.Metric) {
+	f.fn(func(v float64, values ...string) {
+		m, err := prometheus.NewConstMetric(f.desc, f.typ, v, values...)
+		if err != nil {
+			m = prometheus.NewInvalidMetric(f.desc, err)
+		}
+		ch <- m
+	})
+}
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFuncCollector(t *testing.T) {
+	r := prometheus.NewPedanticRegistry()
+	entries := NewGaugeFunc("cache_entries", "entries", []string{"cache"}, func(emit func(float64, ...string)) {
+		emit(3, "user")
+		emit(7, "chat")
+	})
+	hits := NewCounterFunc("cache_hits_total", "hits", nil, func(emit func(float64, ...string)) {
+		emit(5)
+	})
+	if err := r.Register(entries); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(hits); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP cache_entries entries
+# TYPE cache_entries gauge
+cache_entries{cache="chat"} 7
+cache_entries{cache="user"} 3
+# HELP cache_hits_total hits
+# TYPE cache_hits_total counter
+cache_hits_total 5
+`
+	if err := testutil.GatherAndCompare(r, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFuncCollectorErrors(t *testing.T) {
+	r := prometheus.NewRegistry()
+	if err := r.Register(NewGaugeFunc("dup", "dup", nil, func(func(float64, ...string)) {})); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(NewGaugeFunc("dup", "dup", nil, func(func(float64, ...string)) {})); err == nil {
+		t.Fatalf("expected error on duplicate metric")
+	}
+
+	r = prometheus.NewRegistry()
+	bad := NewGaugeFunc("bad", "bad", []string{"a"}, func(emit func(float64, ...string)) {
+		emit(1, "a", "b")
+	})
+	if err := r.Register(bad); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Gather(); err == nil {
+		t.Fatalf("expected error on label mismatch")
+	}
+}
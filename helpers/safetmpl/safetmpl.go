@@ -0,0 +1,131 @@
+// Package safetmpl 渲染用户提供的 text/template 模板，限制模板的结构、输出长度和渲染时间
+package safetmpl
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+)
+
+var (
+	ErrOutputTooLong = errors.New("模板的输出过长")
+	ErrTimeout       = errors.New("模板渲染超时")
+	errDefine        = errors.New("模板中不能使用 define、block 和 template")
+)
+
+// Check 检查模板的结构：不允许 define、block 和 template，range 只能遍历 lists 中的字段（写作 .X 或 $.X），
+// 避免 {{range 100000}} 这样对整数或其他表达式的循环
+func Check(t *template.Template, lists ...string) error {
+	if len(t.Templates()) > 1 {
+		return errDefine
+	}
+	if t.Tree == nil {
+		return nil
+	}
+	return checkNode(t.Tree.Root, lists)
+}
+
+func checkNode(node parse.Node, lists []string) error {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, c := range n.Nodes {
+			if err := checkNode(c, lists); err != nil {
+				return err
+			}
+		}
+	case *parse.TemplateNode:
+		return errDefine
+	case *parse.IfNode:
+		return checkBranch(&n.BranchNode, lists)
+	case *parse.WithNode:
+		return checkBranch(&n.BranchNode, lists)
+	case *parse.RangeNode:
+		if !isListField(n.Pipe, lists) {
+			if len(lists) == 0 {
+				return errors.New("模板中不能使用 range")
+			}
+			return fmt.Errorf("range 只能用于 .%s", strings.Join(lists, "、."))
+		}
+		return checkBranch(&n.BranchNode, lists)
+	}
+	return nil
+}
+
+func checkBranch(n *parse.BranchNode, lists []string) error {
+	if err := checkNode(n.List, lists); err != nil {
+		return err
+	}
+	return checkNode(n.ElseList, lists)
+}
+
+func isListField(pipe *parse.PipeNode, lists []string) bool {
+	if pipe == nil || len(pipe.Cmds) != 1 || len(pipe.Cmds[0].Args) != 1 {
+		return false
+	}
+	var ident []string
+	switch arg := pipe.Cmds[0].Args[0].(type) {
+	case *parse.FieldNode:
+		ident = arg.Ident
+	case *parse.VariableNode:
+		if len(arg.Ident) < 2 || arg.Ident[0] != "$" {
+			return false
+		}
+		ident = arg.Ident[1:]
+	default:
+		return false
+	}
+	if len(ident) != 1 {
+		return false
+	}
+	for _, name := range lists {
+		if ident[0] == name {
+			return true
+		}
+	}
+	return false
+}
+
+type limitedWriter struct {
+	strings.Builder
+	limit    int
+	deadline time.Time
+}
+
+func (w *limitedWriter) Write(p []byte) (int, error) {
+	if w.Len()+len(p) > w.limit {
+		return 0, ErrOutputTooLong
+	}
+	if time.Now().After(w.deadline) {
+		return 0, ErrTimeout
+	}
+	return w.Builder.Write(p)
+}
+
+// Execute 渲染模板，输出超过 limit 字节时中止，超过 timeout 时不再等待渲染结束。
+// 渲染出错时返回出错前已输出的部分，超时时返回空字符串
+func Execute(t *template.Template, data any, limit int, timeout time.Duration) (string, error) {
+	type result struct {
+		out string
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		w := &limitedWriter{limit: limit, deadline: time.Now().Add(timeout)}
+		err := t.Execute(w, data)
+		done <- result{w.String(), err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-done:
+		return r.out, r.err
+	case <-timer.C:
+		return "", ErrTimeout
+	}
+}
@@ -0,0 +1,59 @@
+package safetmpl
+
+import (
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	as := assert.New(t)
+	parse := func(text string) *template.Template {
+		tmpl, err := template.New("t").Parse(text)
+		as.NoError(err, text)
+		return tmpl
+	}
+	for _, text := range []string{
+		"{{range .Items}}{{.}}{{end}}",
+		"{{range $i, $v := $.Items}}{{$i}}{{$v}}{{else}}空{{end}}",
+		"{{if .A}}{{with .B}}{{range .Items}}{{end}}{{end}}{{end}}",
+		"没有动作",
+	} {
+		as.NoError(Check(parse(text), "Items"), text)
+	}
+	for _, text := range []string{
+		"{{range 5000000}}x{{end}}",
+		"{{range 100000}}{{range 100000}}{{end}}{{end}}",
+		"{{range .Count}}{{end}}",
+		"{{$n := 10}}{{range $n}}{{end}}",
+		"{{range .Items.Sub}}{{end}}",
+		"{{if .A}}{{range 10}}{{end}}{{end}}",
+		`{{define "x"}}a{{end}}{{template "x"}}`,
+		`{{block "x" .}}a{{end}}`,
+	} {
+		as.Error(Check(parse(text), "Items"), text)
+	}
+	as.Error(Check(parse("{{range .Items}}{{end}}")))
+}
+
+func TestExecuteLimits(t *testing.T) {
+	as := assert.New(t)
+	tmpl := template.Must(template.New("t").Parse(`{{range .}}{{.}}{{end}}`))
+	out, err := Execute(tmpl, []string{"ab", "cd"}, 10, time.Second)
+	as.NoError(err)
+	as.Equal("abcd", out)
+
+	out, err = Execute(tmpl, []string{"ab", "cd", strings.Repeat("x", 10)}, 10, time.Second)
+	as.ErrorIs(err, ErrOutputTooLong)
+	as.Equal("abcd", out)
+
+	// 空循环体不会写入输出，只能靠超时结束等待
+	slow := template.Must(template.New("t").Parse(`{{range 100000}}{{range 100000}}{{end}}{{end}}`))
+	start := time.Now()
+	_, err = Execute(slow, nil, 10, 50*time.Millisecond)
+	as.ErrorIs(err, ErrTimeout)
+	as.Less(time.Since(start), time.Second)
+}
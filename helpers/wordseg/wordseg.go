@@ -0,0 +1,201 @@
+// Package wordseg 基于词典的中文分词，用于统计群聊中的热词。
+// 汉字部分按词频求最大概率切分（与 jieba 的做法相同，但没有用 HMM 识别未登录词），
+// 其他文字按连续的字母和数字切分
+package wordseg
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 词典来自 jieba 和 gse 的简体中文词典（MIT / Apache License 2.0，许可证见 assets/NOTICE），
+// 只保留了词频最高的10万个纯汉字词和全部单字，格式为每行“词 词频”
+//
+//go:embed assets/dict.txt
+var defaultDict string
+
+// 停用词来自 gse 的 stop_tokens.txt，加上了一些聊天中常见的口头禅
+//
+//go:embed assets/stop_words.txt
+var defaultStopWords string
+
+const (
+	maxWordLen    = 8
+	maxLatinLen   = 24
+	minKeywordLen = 2
+)
+
+// reNoise 链接、@用户名和命令不参与分词
+var reNoise = regexp.MustCompile(`https?://\S+|www\.\S+|@\w+|(?:^|\s)/\w+`)
+
+type Segmenter struct {
+	logProb map[string]float64
+	minProb float64
+	stop    map[string]struct{}
+}
+
+// New 从词典和停用词表创建分词器，stopWords 可以为 nil
+func New(dict, stopWords io.Reader) (*Segmenter, error) {
+	freq := make(map[string]float64)
+	var total float64
+	sc := bufio.NewScanner(dict)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("dict line %d: missing frequency", line)
+		}
+		f, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil || f <= 0 {
+			return nil, fmt.Errorf("dict line %d: invalid frequency %q", line, fields[1])
+		}
+		if utf8.RuneCountInString(fields[0]) > maxWordLen {
+			continue
+		}
+		freq[fields[0]] += f
+		total += f
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("empty dict")
+	}
+	s := &Segmenter{
+		logProb: make(map[string]float64, len(freq)),
+		minProb: math.Log(1 / total),
+		stop:    make(map[string]struct{}),
+	}
+	logTotal := math.Log(total)
+	for w, f := range freq {
+		s.logProb[w] = math.Log(f) - logTotal
+	}
+	if stopWords == nil {
+		return s, nil
+	}
+	sc = bufio.NewScanner(stopWords)
+	for sc.Scan() {
+		w := strings.TrimSpace(sc.Text())
+		if w == "" || strings.HasPrefix(w, "#") {
+			continue
+		}
+		s.stop[strings.ToLower(w)] = struct{}{}
+	}
+	return s, sc.Err()
+}
+
+// Default 使用内置词典和停用词表的分词器，第一次调用时加载
+var Default = sync.OnceValue(func() *Segmenter {
+	s, err := New(strings.NewReader(defaultDict), strings.NewReader(defaultStopWords))
+	if err != nil {
+		panic(err)
+	}
+	return s
+})
+
+// Cut 切分 text，返回全部词，拉丁字母转为小写，标点和空白被丢弃
+func (s *Segmenter) Cut(text string) []string {
+	var words []string
+	var run []rune
+	runHan := false
+	flush := func() {
+		if len(run) == 0 {
+			return
+		}
+		if runHan {
+			words = s.cutHan(run, words)
+		} else {
+			words = append(words, strings.ToLower(string(run)))
+		}
+		run = run[:0]
+	}
+	for _, r := range reNoise.ReplaceAllString(text, " ") {
+		isHan := unicode.Is(unicode.Han, r)
+		if !isHan && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if isHan != runHan {
+			flush()
+			runHan = isHan
+		}
+		run = append(run, r)
+	}
+	flush()
+	return words
+}
+
+// cutHan 对连续的汉字求最大概率切分，词典中没有的单字按最低词频计算
+func (s *Segmenter) cutHan(runes []rune, words []string) []string {
+	n := len(runes)
+	route := make([]float64, n+1)
+	next := make([]int, n+1)
+	for i := n - 1; i >= 0; i-- {
+		route[i] = math.Inf(-1)
+		for l := 1; l <= maxWordLen && i+l <= n; l++ {
+			p, ok := s.logProb[string(runes[i:i+l])]
+			if !ok {
+				if l > 1 {
+					continue
+				}
+				p = s.minProb
+			}
+			if v := p + route[i+l]; v > route[i] {
+				route[i], next[i] = v, i+l
+			}
+		}
+	}
+	for i := 0; i < n; i = next[i] {
+		words = append(words, string(runes[i:next[i]]))
+	}
+	return words
+}
+
+// IsStopWord 判断 w 是否在停用词表中，拉丁字母不区分大小写
+func (s *Segmenter) IsStopWord(w string) bool {
+	_, ok := s.stop[strings.ToLower(w)]
+	return ok
+}
+
+// isKeyword 过滤停用词、单字、纯数字、过长的字母串和同一个字的重复（例如“啊啊啊”）
+func (s *Segmenter) isKeyword(w string) bool {
+	n := utf8.RuneCountInString(w)
+	if n < minKeywordLen || s.IsStopWord(w) {
+		return false
+	}
+	first, _ := utf8.DecodeRuneInString(w)
+	if !unicode.Is(unicode.Han, first) && n > maxLatinLen {
+		return false
+	}
+	digits, repeated := true, true
+	for _, r := range w {
+		digits = digits && unicode.IsDigit(r)
+		repeated = repeated && r == first
+	}
+	return !digits && !repeated
+}
+
+// Keywords 返回 text 中可以作为热词的词，每个词只出现一次，按第一次出现的顺序排列
+func (s *Segmenter) Keywords(text string) []string {
+	var res []string
+	seen := make(map[string]struct{})
+	for _, w := range s.Cut(text) {
+		if _, ok := seen[w]; ok || !s.isKeyword(w) {
+			continue
+		}
+		seen[w] = struct{}{}
+		res = append(res, w)
+	}
+	return res
+}
@@ -0,0 +1,43 @@
+package wordseg
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCut(t *testing.T) {
+	as := require.New(t)
+	s := Default()
+	as.Equal([]string{"我", "来到", "北京", "清华大学"}, s.Cut("我来到北京清华大学"))
+	as.Equal([]string{"南京市", "长江大桥"}, s.Cut("南京市长江大桥"))
+	as.Equal([]string{"新", "版本", "的", "chatgpt", "发布", "了"}, s.Cut("新版本的ChatGPT发布了！https://openai.com"))
+	as.Equal([]string{"看", "统计"}, s.Cut("/stat@bot 看统计 @someone"))
+	as.Empty(s.Cut("，。！？ ..."))
+}
+
+func TestKeywords(t *testing.T) {
+	as := require.New(t)
+	s := Default()
+	as.Equal([]string{"天气", "不错", "火锅"}, s.Keywords("今天的天气真不错，我们去吃火锅吧，火锅！"))
+	as.Equal([]string{"显卡", "性能", "rtx5090"}, s.Keywords("这个显卡的性能 RTX5090 2025 啊啊啊 hhhh"))
+	as.Empty(s.Keywords("哈哈哈哈哈 就是 the and"))
+}
+
+func TestNew(t *testing.T) {
+	as := require.New(t)
+	s, err := New(strings.NewReader("测试 10\n测 1\n试 1\n"), strings.NewReader("# 注释\n测试\n"))
+	as.NoError(err)
+	as.Equal([]string{"测试", "未", "知"}, s.Cut("测试未知"))
+	as.True(s.IsStopWord("测试"))
+	as.False(s.IsStopWord("# 注释"))
+	as.Empty(s.Keywords("测试"))
+
+	_, err = New(strings.NewReader("测试\n"), nil)
+	as.Error(err)
+	_, err = New(strings.NewReader("测试 abc\n"), nil)
+	as.Error(err)
+	_, err = New(strings.NewReader(""), nil)
+	as.Error(err)
+}
@@ -19,10 +19,19 @@ import (
 	"time"
 
 	jsoniter "github.com/json-iterator/go"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/tidwall/gjson"
 )
 
 var Bin = "yt-dlp"
+
+var (
+	downloadsInProgress = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "ytdlp_downloads_in_progress", Help: "正在进行的下载数"}, []string{"downloader"})
+	downloadsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "ytdlp_downloads_total", Help: "下载次数"}, []string{"downloader", "result"})
+)
 var reA = regexp.MustCompile(`(?i)/(BV[123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz]+|av\d+)`)
 
 type RunError struct {
@@ -273,7 +282,7 @@ func (c *Req) runWithCtx(ctx context.Context) (resp *Resp, err error) {
 	if err != nil {
 		return resp, err
 	}
-	if strings.Contains(c.Url, "b23.tv") || strings.Contains(c.Url, "bilibili.com") {
+	if c.downloader() == "bbdown" {
 		return c.runWithCtxBBDown(ctx)
 	}
 	args := c.args()
@@ -312,8 +321,25 @@ func (c *Req) runWithCtx(ctx context.Context) (resp *Resp, err error) {
 	return resp, nil
 }
 
+func (c *Req) downloader() string {
+	if strings.Contains(c.Url, "b23.tv") || strings.Contains(c.Url, "bilibili.com") {
+		return "bbdown"
+	}
+	return "yt-dlp"
+}
+
 func (c *Req) RunWithTimeout(timeout time.Duration) (*Resp, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), timeout)
 	defer cancel()
-	return c.runWithCtx(ctx)
+	downloader := c.downloader()
+	gauge := downloadsInProgress.WithLabelValues(downloader)
+	gauge.Inc()
+	defer gauge.Dec()
+	resp, err := c.runWithCtx(ctx)
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	downloadsTotal.WithLabelValues(downloader, result).Inc()
+	return resp, err
 }
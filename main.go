@@ -23,13 +23,24 @@ import (
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/callbackquery"
-	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/inlinequery"
 	"github.com/PaulSonOfLars/gotgbot/v2/ext/handlers/filters/message"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 )
 
 var log = g.GetLogger("main", slog.LevelInfo)
 var compileTime = "unknown"
 
+var (
+	handlerHits = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_handler_hits_total", Help: "handler 处理的更新数"}, []string{"func", "checker"})
+	handlerErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "bot_handler_errors_total", Help: "handler 返回错误的次数"}, []string{"func", "checker"})
+	handlerDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name: "bot_handler_duration_seconds", Help: "handler 处理更新的耗时",
+		Buckets: append(prometheus.DefBuckets, 30, 60, 120)}, []string{"func", "checker"})
+)
+
 type GroupedDispatcher struct {
 	*ext.Dispatcher
 	autoInc int
@@ -65,8 +76,14 @@ func (h *HookedHandler) CheckUpdate(b *gotgbot.Bot, ctx *ext.Context) bool {
 func (h *HookedHandler) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
 	start := time.Now()
 	newCnt := h.hitCounter.Add(1)
+	handlerHits.WithLabelValues(h.funcName, h.checkerName).Inc()
+	var err error
 	defer func() {
 		dur := time.Since(start)
+		handlerDuration.WithLabelValues(h.funcName, h.checkerName).Observe(dur.Seconds())
+		if err != nil {
+			handlerErrors.WithLabelValues(h.funcName, h.checkerName).Inc()
+		}
 		h.logger.Debug("handle update",
 			"elapsed", dur,
 			"func_name", h.funcName,
@@ -75,7 +92,8 @@ func (h *HookedHandler) HandleUpdate(b *gotgbot.Bot, ctx *ext.Context) error {
 			"update_id", ctx.UpdateId,
 			"hit_count", newCnt)
 	}()
-	return h.Handler.HandleUpdate(b, ctx)
+	err = h.Handler.HandleUpdate(b, ctx)
+	return err
 }
 
 func (g *GroupedDispatcher) inc() int {
@@ -187,14 +205,14 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 	defer func() {
-		if err := g.Q.FlushChatStats(context.Background()); err != nil {
+		if _, err := g.Q.FlushChatStats(context.Background()); err != nil {
 			log.Error("flush chat stats", "err", err)
 		}
 	}()
 	go func() {
 		<-ctx.Done()
 		log.Info("save chat stats")
-		if err := g.Q.FlushChatStats(context.Background()); err != nil {
+		if _, err := g.Q.FlushChatStats(context.Background()); err != nil {
 			log.Error("flush chat stats", "err", err)
 		}
 		os.Exit(0)
@@ -203,6 +221,16 @@ func main() {
 	b := newBot(token)
 	hdrs.SetMainBot(b)
 	hdrs.StartChatStatScheduler()
+	go func() {
+		n, err := g.Q.MigrateLegacyChatStats(ctx, 200, time.Second)
+		if err != nil {
+			log.Error("migrate legacy chat stats", "migrated", n, "err", err)
+			return
+		}
+		if n > 0 {
+			log.Info("migrate legacy chat stats", "migrated", n)
+		}
+	}()
 	backend.GoListenAndServe("127.0.0.1:4021", b)
 	go hdrs.HttpListen4019()
 	dp := GroupedDispatcher{Dispatcher: ext.NewDispatcher(&ext.DispatcherOpts{
@@ -233,8 +261,11 @@ func main() {
 	)
 	genBotLogger := g.GetLogger("genbot", slog.LevelInfo)
 	genbot.Init(b, genBotLogger)
+	genbot.StartBlobGcScheduler()
+	genbot.StartScheduledPromptScheduler(hdrs.ChatStatScheduler())
 	dp.NewMessage(message.All, hdrs.StatMessage)
-	dp.NewInlineQuery(inlinequery.All, hdrs.BiliMsgConverterInline)
+	dp.NewInlineQuery(hdrs.IsBiliInlineQuery, hdrs.BiliMsgConverterInline)
+	dp.NewInlineQuery(genbot.IsTranslateInline, genbot.TranslateInline)
 
 	dp.Command("roll", hdrs.Roll)
 	dp.Command("ocr", hdrs.OcrMessage)
@@ -244,6 +275,15 @@ func main() {
 	dp.Command("downloadvideo", hdrs.DownloadVideo)
 	dp.Command("downloadaudio", hdrs.DownloadAudio)
 	dp.Command("getrank", hdrs.GetRank)
+	dp.Command("rank", hdrs.GetRank)
+	dp.Command("stat", hdrs.ChatStatRange)
+	dp.Command("stat_chart", hdrs.StatChart)
+	dp.Command("me", hdrs.MyStat)
+	dp.Command("stat_time", hdrs.SetStatTime)
+	dp.Command("stat_template", hdrs.SetStatTemplate)
+	dp.Command("stat_rebuild", hdrs.StatRebuild)
+	dp.Command("hot", hdrs.HotKeywords)
+	dp.Command("timezone", hdrs.SetTimezone)
 	dp.Command("diag_sendstat", hdrs.SendGroupStat)
 	dp.Command("cochelp", hdrs.CoCHelp)
 	dp.Command("list_attr", hdrs.ListDndAttr)
@@ -255,11 +295,31 @@ func main() {
 	dp.Command("sysprompt", genbot.UpdateGeminiSysPrompt)
 	dp.Command("reset_sysprompt", genbot.ResetGeminiSysPrompt)
 	dp.Command("get_sysprompt", genbot.GetGeminiSysPrompt)
+	dp.Command("sysprompt_history", genbot.GeminiSysPromptHistory)
+	dp.Command("sysprompt_rollback", genbot.GeminiSysPromptRollback)
+	dp.Command("sysprompt_preset", genbot.GeminiSysPromptPreset)
 	dp.Command("new_session", genbot.NewGeminiSession)
 	dp.Command("session_id", genbot.GetGeminiSessionId)
 	dp.Command("get_memories", genbot.GetMemories)
 	dp.Command("session_help", genbot.SessionHelp)
 	dp.Command("change_model", genbot.ChangeGeminiModel)
+	dp.Command("ai_config", genbot.ShowGeminiSettings)
+	dp.Command("ai_usage", genbot.GeminiUsage)
+	dp.Command("imagine", genbot.Imagine)
+	dp.Command("sessions", genbot.ListGeminiSessions)
+	dp.Command("session_export", genbot.ExportGeminiSession)
+	dp.Command("session_freeze", genbot.FreezeGeminiSession)
+	dp.Command("session_unfreeze", genbot.UnfreezeGeminiSession)
+	dp.Command("ai_schedule", genbot.ScheduleGeminiPrompt)
+	dp.Command("ai_schedule_del", genbot.DeleteGeminiSchedule)
+	dp.Command("ai_schedule_run", genbot.RunGeminiSchedule)
+	dp.Command("digest", genbot.DailyDigest)
+	dp.Command("ai_invite", genbot.CreateGeminiInvite)
+	dp.Command("ai_join", genbot.JoinGeminiPrivate)
+	dp.Command("ai_allow", genbot.ManageGeminiPrivateUsers)
+	dp.Command("ai_revoke", genbot.ManageGeminiPrivateUsers)
+	dp.Command("tr", genbot.Translate)
+	dp.Command("tr_lang", genbot.SetTranslateLang)
 	dp.NewMessage(hdrs.BiliMsgFilter, hdrs.BiliMsgConverter)
 	dp.NewMessage(hdrs.DetectNsfwPhoto, hdrs.NsfwDetect)
 	dp.NewMessage(hdrs.NeedSolve, hdrs.SolveMath)
@@ -271,6 +331,7 @@ func main() {
 	dp.NewMessage(hdrs.IsSacabam, hdrs.GenSacabam)
 	dp.NewMessage(hdrs.IsBattleCommand, hdrs.ExecuteBattleCommand)
 	dp.NewMessage(genbot.IsGeminiReq, genbot.GeminiReply)
+	dp.NewMessage(genbot.IsAutoTranslate, genbot.AutoTranslate)
 
 	dp.NewCallback(hdrs.IsStopBattle, hdrs.StopBattle)
 	dp.NewCallback(hdrs.IsNextRound, hdrs.NextRound)
@@ -279,6 +340,7 @@ func main() {
 	dp.NewCallback(hdrs.IsNsfwPicRateBtn, hdrs.RateNsfwPicByBtn)
 	dp.NewCallback(hdrs.IsDelMsgCallback, hdrs.DelMessage)
 	dp.NewCallback(callbackquery.Prefix(hdrs.GroupConfigModifyPrefix), hdrs.ModifyGroupConfigByButton)
+	dp.NewCallback(callbackquery.Prefix(genbot.GeminiSettingsPrefix), genbot.ModifyGeminiSettingsByButton)
 
 	err := updater.StartPolling(b, &ext.PollingOpts{
 		DropPendingUpdates:    g.GetConfig().DropPendingUpdates,
@@ -5,6 +5,12 @@ SELECT *
 FROM chat_cfg
 WHERE id = ?;
 
+-- name: ListDailyStatChats :many
+SELECT id
+FROM chat_cfg
+WHERE daily_stat = 1
+ORDER BY id;
+
 -- name: getChatIdByWebId :one
 SELECT id
 FROM chat_cfg
@@ -12,9 +18,11 @@ WHERE web_id = ?;
 
 -- name: CreateChatCfg :exec
 INSERT INTO chat_cfg (id, web_id, auto_cvt_bili, auto_ocr, auto_calculate, auto_exchange, auto_check_adult,
-                      save_messages, enable_coc, resp_nsfw_msg, timezone)
+                      save_messages, enable_coc, resp_nsfw_msg, timezone, daily_digest, digest_only,
+                      auto_translate, translate_lang, daily_stat, stat_time, stat_template, timezone_name)
 VALUES (?, ?, ?, ?, ?, ?,
-        ?, ?, ?, ?, ?);
+        ?, ?, ?, ?, ?, ?, ?,
+        ?, ?, ?, ?, ?, ?);
 
 -- name: updateChatCfg :exec
 UPDATE chat_cfg
@@ -25,7 +33,16 @@ SET auto_cvt_bili=?,
     auto_check_adult=?,
     save_messages=?,
     enable_coc=?,
-    resp_nsfw_msg=?
+    resp_nsfw_msg=?,
+    daily_digest=?,
+    digest_only=?,
+    auto_translate=?,
+    translate_lang=?,
+    daily_stat=?,
+    stat_time=?,
+    stat_template=?,
+    timezone=?,
+    timezone_name=?
 WHERE id = ?;
 
 -- name: createChatStatDaily :one
@@ -60,6 +77,103 @@ FROM chat_stat_daily
 WHERE chat_stat_daily.chat_id = ?
   AND chat_stat_daily.stat_date = ?;
 
+-- name: addChatUserStatTotal :exec
+INSERT INTO chat_user_stat_total (chat_id, user_id, msg_count, msg_len, photo_count, video_count, sticker_count,
+                                  forward_count)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET msg_count     = msg_count + excluded.msg_count,
+                          msg_len       = msg_len + excluded.msg_len,
+                          photo_count   = photo_count + excluded.photo_count,
+                          video_count   = video_count + excluded.video_count,
+                          sticker_count = sticker_count + excluded.sticker_count,
+                          forward_count = forward_count + excluded.forward_count;
+
+-- name: GetChatUserStatTotal :one
+SELECT *
+FROM chat_user_stat_total
+WHERE chat_id = ?
+  AND user_id = ?;
+
+-- name: GetChatUserStatRank :one
+SELECT COUNT(*) + 1 AS user_rank
+FROM chat_user_stat_total
+WHERE chat_id = ?
+  AND msg_count > ?;
+
+-- name: GetLastChatStatDate :one
+SELECT CAST(COALESCE(MAX(stat_date), 0) AS INTEGER) AS stat_date
+FROM chat_stat_daily
+WHERE chat_id = ?;
+
+-- name: listChatStatRange :many
+SELECT *
+FROM chat_stat_daily
+WHERE chat_id = ?
+  AND stat_date BETWEEN ? AND ?
+ORDER BY stat_date;
+
+-- name: listLegacyChatStats :many
+SELECT chat_id, stat_date, user_msg_stat, msg_count_by_time, msg_id_at_time_start
+FROM chat_stat_daily
+WHERE (length(user_msg_stat) > 0 AND substr(user_msg_stat, 1, 1) != x'81')
+   OR (length(msg_count_by_time) > 0 AND substr(msg_count_by_time, 1, 1) != x'81')
+   OR (length(msg_id_at_time_start) > 0 AND substr(msg_id_at_time_start, 1, 1) != x'81')
+LIMIT ?;
+
+-- name: updateLegacyChatStat :exec
+UPDATE chat_stat_daily
+SET user_msg_stat        = ?,
+    msg_count_by_time    = ?,
+    msg_id_at_time_start = ?
+WHERE chat_id = ?
+  AND stat_date = ?
+  AND ((length(user_msg_stat) > 0 AND substr(user_msg_stat, 1, 1) != x'81')
+    OR (length(msg_count_by_time) > 0 AND substr(msg_count_by_time, 1, 1) != x'81')
+    OR (length(msg_id_at_time_start) > 0 AND substr(msg_id_at_time_start, 1, 1) != x'81'));
+
+-- name: ListChatKeywordScans :many
+SELECT stat_date, scanned_until
+FROM chat_keyword_scan
+WHERE chat_id = ?
+  AND stat_date BETWEEN ? AND ?;
+
+-- name: SetChatKeywordScan :exec
+INSERT INTO chat_keyword_scan (chat_id, stat_date, scanned_until)
+VALUES (?, ?, ?)
+ON CONFLICT DO UPDATE SET scanned_until=excluded.scanned_until;
+
+-- name: AddChatKeywordCount :exec
+INSERT INTO chat_keyword_daily (chat_id, stat_date, word, count)
+VALUES (?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET count=count + excluded.count;
+
+-- name: MarkChatStatSent :execrows
+INSERT INTO chat_stat_sent (chat_id, stat_date)
+VALUES (?, ?)
+ON CONFLICT DO UPDATE SET stat_date = excluded.stat_date
+WHERE stat_date < excluded.stat_date;
+
+-- name: PruneChatKeywords :exec
+DELETE
+FROM chat_keyword_daily
+WHERE chat_id = ?
+  AND stat_date = ?
+  AND word NOT IN (SELECT word
+                   FROM chat_keyword_daily
+                   WHERE chat_id = ?
+                     AND stat_date = ?
+                   ORDER BY count DESC, word
+                   LIMIT ?);
+
+-- name: ListTopChatKeywords :many
+SELECT word, CAST(sum(count) AS INTEGER) AS total
+FROM chat_keyword_daily
+WHERE chat_id = ?
+  AND stat_date BETWEEN ? AND ?
+GROUP BY word
+ORDER BY total DESC, word
+LIMIT ?;
+
 -- name: createOrUpdateChatAttr :exec
 INSERT INTO chat_attr (id, type, title, username, first_name, last_name, is_forum)
 VALUES (?, ?, ?, ?, ?, ?, ?)
@@ -74,4 +188,9 @@ ON CONFLICT DO UPDATE SET type=excluded.type,
 -- name: UpdateChatTopicName :exec
 INSERT INTO chat_topics (chat_id, thread_id, name)
 VALUES (?, ?, ?)
-ON CONFLICT DO UPDATE SET name=excluded.name;
\ No newline at end of file
+ON CONFLICT DO UPDATE SET name=excluded.name;
+-- name: GetChatTopicName :one
+SELECT name
+FROM chat_topics
+WHERE chat_id = ?
+  AND thread_id = ?;
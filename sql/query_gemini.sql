@@ -15,19 +15,30 @@ INSERT INTO gemini_contents (session_id,
                              msg_type,
                              reply_to_msg_id,
                              text,
-                             blob,
+                             blob_hash,
                              mime_type,
                              quote_part,
-                             thought_signature)
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
+                             thought_signature,
+                             atable_username,
+                             user_id)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);
 
 -- name: getAllMsgInSessionReversed :many
 SELECT *
 FROM gemini_contents
 WHERE session_id = ?
+  AND msg_id > ?
 ORDER BY msg_id DESC
 LIMIT ?;
 
+-- name: GetLatestGeminiSummary :one
+SELECT *
+FROM gemini_contents
+WHERE session_id = ?
+  AND msg_type = 'summary'
+ORDER BY msg_id
+LIMIT 1;
+
 -- name: GetSessionIdByMessage :one
 SELECT gemini_contents.session_id
 FROM gemini_contents
@@ -82,4 +93,206 @@ SELECT *
 FROM gemini_memories
 WHERE chat_id = ?
   AND topic_id = ?
-LIMIT ?;
\ No newline at end of file
+LIMIT ?;
+
+-- name: GetGeminiChatSettings :one
+SELECT *
+FROM gemini_chat_settings
+WHERE chat_id = ?
+  AND thread_id = ?;
+
+-- name: CreateOrUpdateGeminiChatSettings :exec
+INSERT INTO gemini_chat_settings (chat_id, thread_id, model, temperature, thinking_budget,
+                                  enable_search, enable_code_execution, max_history)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET model=excluded.model,
+                          temperature=excluded.temperature,
+                          thinking_budget=excluded.thinking_budget,
+                          enable_search=excluded.enable_search,
+                          enable_code_execution=excluded.enable_code_execution,
+                          max_history=excluded.max_history;
+
+-- name: AddGeminiUsage :exec
+INSERT INTO gemini_usage (chat_id, user_id, model, usage_date, input_tokens, output_tokens)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET input_tokens=input_tokens + excluded.input_tokens,
+                          output_tokens=output_tokens + excluded.output_tokens;
+
+-- name: GetChatGeminiUsageSince :one
+SELECT CAST(COALESCE(SUM(input_tokens + output_tokens), 0) AS INTEGER) AS total
+FROM gemini_usage
+WHERE chat_id = ?
+  AND usage_date >= ?;
+
+-- name: GetUserGeminiUsageSince :one
+SELECT CAST(COALESCE(SUM(input_tokens + output_tokens), 0) AS INTEGER) AS total
+FROM gemini_usage
+WHERE user_id = ?
+  AND usage_date >= ?;
+
+-- name: ListChatGeminiUsageSince :many
+SELECT user_id,
+       model,
+       CAST(SUM(input_tokens) AS INTEGER)  AS input_tokens,
+       CAST(SUM(output_tokens) AS INTEGER) AS output_tokens
+FROM gemini_usage
+WHERE chat_id = ?
+  AND usage_date >= ?
+GROUP BY user_id, model;
+
+-- name: ListRecentGeminiSessions :many
+SELECT *
+FROM gemini_sessions
+WHERE chat_id = ?
+ORDER BY id DESC
+LIMIT ?;
+
+-- name: GetFirstGeminiContent :one
+SELECT *
+FROM gemini_contents
+WHERE session_id = ?
+  AND msg_id > 0
+ORDER BY msg_id
+LIMIT 1;
+
+-- name: SetGeminiSessionFrozen :exec
+UPDATE gemini_sessions
+SET frozen = ?
+WHERE id = ?;
+
+-- name: CreateGeminiBlob :exec
+INSERT INTO gemini_blobs (hash, data, size, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (hash) DO UPDATE SET created_at = excluded.created_at;
+
+-- name: GetGeminiBlobData :one
+SELECT data
+FROM gemini_blobs
+WHERE hash = ?;
+
+-- name: DeleteOrphanGeminiContents :execrows
+DELETE
+FROM gemini_contents
+WHERE NOT EXISTS (SELECT 1 FROM gemini_sessions WHERE gemini_sessions.id = gemini_contents.session_id);
+
+-- name: RecountGeminiBlobRefs :exec
+UPDATE gemini_blobs
+SET ref_count = (SELECT COUNT(*) FROM gemini_contents WHERE gemini_contents.blob_hash = gemini_blobs.hash);
+
+-- name: DeleteUnusedGeminiBlobs :execrows
+DELETE
+FROM gemini_blobs
+WHERE ref_count <= 0
+  AND created_at < ?
+  AND NOT EXISTS (SELECT 1 FROM gemini_contents WHERE gemini_contents.blob_hash = gemini_blobs.hash);
+
+-- name: CreateGeminiScheduledPrompt :one
+INSERT INTO gemini_scheduled_prompts (chat_id, thread_id, cron, prompt, created_by, created_at)
+VALUES (?, ?, ?, ?, ?, ?)
+RETURNING *;
+
+-- name: ListAllGeminiScheduledPrompts :many
+SELECT *
+FROM gemini_scheduled_prompts
+ORDER BY id;
+
+-- name: ListChatGeminiScheduledPrompts :many
+SELECT *
+FROM gemini_scheduled_prompts
+WHERE chat_id = ?
+ORDER BY id;
+
+-- name: GetGeminiScheduledPrompt :one
+SELECT *
+FROM gemini_scheduled_prompts
+WHERE id = ?;
+
+-- name: DeleteGeminiScheduledPrompt :execrows
+DELETE
+FROM gemini_scheduled_prompts
+WHERE id = ?
+  AND chat_id = ?;
+
+-- name: UpdateGeminiScheduledPromptRun :exec
+UPDATE gemini_scheduled_prompts
+SET session_id  = ?,
+    last_run_at = ?
+WHERE id = ?;
+
+-- name: AddGeminiSystemPromptHistory :exec
+INSERT INTO gemini_system_prompt_history (chat_id, thread_id, version, prompt, author_id, created_at)
+VALUES (?, ?, ?, ?, ?, ?);
+
+-- name: GetGeminiSystemPromptLatestVersion :one
+SELECT CAST(COALESCE(MAX(version), 0) AS INTEGER) AS version
+FROM gemini_system_prompt_history
+WHERE chat_id = ?
+  AND thread_id = ?;
+
+-- name: ListGeminiSystemPromptHistory :many
+SELECT *
+FROM gemini_system_prompt_history
+WHERE chat_id = ?
+  AND thread_id = ?
+ORDER BY version DESC
+LIMIT ?;
+
+-- name: GetGeminiSystemPromptVersion :one
+SELECT *
+FROM gemini_system_prompt_history
+WHERE chat_id = ?
+  AND thread_id = ?
+  AND version = ?;
+
+-- name: CreateOrUpdateGeminiPromptPreset :exec
+INSERT INTO gemini_prompt_presets (name, prompt, author_id, updated_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT DO UPDATE SET prompt=excluded.prompt,
+                          author_id=excluded.author_id,
+                          updated_at=excluded.updated_at;
+
+-- name: GetGeminiPromptPreset :one
+SELECT *
+FROM gemini_prompt_presets
+WHERE name = ?;
+
+-- name: ListGeminiPromptPresets :many
+SELECT *
+FROM gemini_prompt_presets
+ORDER BY name;
+
+-- name: DeleteGeminiPromptPreset :execrows
+DELETE
+FROM gemini_prompt_presets
+WHERE name = ?;
+
+-- name: AddGeminiPrivateUser :exec
+INSERT INTO gemini_private_users (user_id, invite_code, added_by, created_at)
+VALUES (?, ?, ?, ?)
+ON CONFLICT (hash) DO UPDATE SET created_at = excluded.created_at;
+
+-- name: GetGeminiPrivateUser :one
+SELECT *
+FROM gemini_private_users
+WHERE user_id = ?;
+
+-- name: ListGeminiPrivateUsers :many
+SELECT *
+FROM gemini_private_users
+ORDER BY created_at;
+
+-- name: DeleteGeminiPrivateUser :execrows
+DELETE
+FROM gemini_private_users
+WHERE user_id = ?;
+
+-- name: CreateGeminiInviteCode :exec
+INSERT INTO gemini_invite_codes (code, created_by, max_uses, created_at, expires_at)
+VALUES (?, ?, ?, ?, ?);
+
+-- name: UseGeminiInviteCode :execrows
+UPDATE gemini_invite_codes
+SET used_count = used_count + 1
+WHERE code = ?
+  AND used_count < max_uses
+  AND expires_at > ?;
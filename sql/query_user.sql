@@ -27,7 +27,8 @@ WHERE user_id = ?1;
 
 -- name: updateUserTimeZone :exec
 UPDATE users
-SET timezone = ?2
+SET timezone      = ?2,
+    timezone_name = ?3
 WHERE user_id = ?1
 RETURNING id;
 
@@ -10,7 +10,15 @@ CREATE TABLE IF NOT EXISTS chat_cfg
     save_messages    INT_BOOL            NOT NULL CHECK ( save_messages in (0, 1)),
     enable_coc       INT_BOOL            NOT NULL CHECK ( enable_coc in (0, 1)),
     resp_nsfw_msg    INT_BOOL            NOT NULL CHECK ( resp_nsfw_msg in (0, 1)),
-    timezone         INTEGER             NOT NULL CHECK ( timezone < 86400 AND timezone > -86400)
+    timezone         INTEGER             NOT NULL CHECK ( timezone < 86400 AND timezone > -86400), -- UTC偏移（秒），设置了 timezone_name 时只在时区数据中找不到该时区时使用
+    daily_digest     INT_BOOL            NOT NULL DEFAULT FALSE CHECK ( daily_digest in (0, 1)),
+    digest_only      INT_BOOL            NOT NULL DEFAULT FALSE CHECK ( digest_only in (0, 1)),
+    auto_translate   INT_BOOL            NOT NULL DEFAULT FALSE CHECK ( auto_translate in (0, 1)),
+    translate_lang   TEXT                NOT NULL DEFAULT 'zh', -- 翻译的目标语言，也是自动翻译时视为默认的语言
+    daily_stat       INT_BOOL            NOT NULL DEFAULT FALSE CHECK ( daily_stat in (0, 1)),
+    stat_time        INTEGER             NOT NULL DEFAULT 480 CHECK ( stat_time >= 0 AND stat_time < 1440), -- 聊天时区中发送每日统计的分钟数
+    stat_template    TEXT                NOT NULL DEFAULT '', -- 每日统计的 text/template 模板，为空时使用默认模板
+    timezone_name    TEXT                NOT NULL DEFAULT '' -- IANA 时区名，为空时使用 timezone 的固定偏移
 );
 
 CREATE INDEX IF NOT EXISTS idx_chat_cfg
@@ -40,7 +48,7 @@ CREATE TABLE chat_stat_daily
     dio_add_user_count   INTEGER              NOT NULL DEFAULT 0,
     dio_ban_user_count   INTEGER              NOT NULL DEFAULT 0,
 
-    -- serialized MessagePack
+    -- 版本号开头的 varint 编码，格式见 globalcfg/q/stat_blob.go，旧数据为 gob
     user_msg_stat        BLOB_USER_TO_CNT     NOT NULL DEFAULT x'',
     msg_count_by_time    BLOB_TEN_MINUTE_STAT NOT NULL DEFAULT x'',
     msg_id_at_time_start BLOB_TEN_MINUTE_STAT NOT NULL DEFAULT x'',
@@ -48,6 +56,46 @@ CREATE TABLE chat_stat_daily
     PRIMARY KEY (chat_id, stat_date)
 ) WITHOUT ROWID;
 
+-- 每个用户在聊天中的累计统计，ChatStat.Save 保存每日统计时累加变化的部分
+CREATE TABLE IF NOT EXISTS chat_user_stat_total
+(
+    chat_id       INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    msg_count     INTEGER NOT NULL DEFAULT 0,
+    msg_len       INTEGER NOT NULL DEFAULT 0,
+    photo_count   INTEGER NOT NULL DEFAULT 0,
+    video_count   INTEGER NOT NULL DEFAULT 0,
+    sticker_count INTEGER NOT NULL DEFAULT 0,
+    forward_count INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (chat_id, user_id)
+) WITHOUT ROWID;
+
+-- 最后一次发送每日统计时聊天时区的日期，每天只发送一次
+CREATE TABLE IF NOT EXISTS chat_stat_sent
+(
+    chat_id   INTEGER PRIMARY KEY,
+    stat_date INTEGER NOT NULL -- 与 chat_stat_daily 相同
+) WITHOUT ROWID;
+
+-- 每天的热词，count 为提到这个词的消息数，统计完成的日期只保留次数最多的一部分词
+CREATE TABLE IF NOT EXISTS chat_keyword_daily
+(
+    chat_id   INTEGER NOT NULL,
+    stat_date INTEGER NOT NULL, -- 与 chat_stat_daily 相同
+    word      TEXT    NOT NULL,
+    count     INTEGER NOT NULL,
+    PRIMARY KEY (chat_id, stat_date, word)
+) WITHOUT ROWID;
+
+-- 热词已经统计到的消息时间，下次只处理这之后的存档消息
+CREATE TABLE IF NOT EXISTS chat_keyword_scan
+(
+    chat_id       INTEGER NOT NULL,
+    stat_date     INTEGER NOT NULL,
+    scanned_until INTEGER NOT NULL, -- Unix 时间，不包含
+    PRIMARY KEY (chat_id, stat_date)
+) WITHOUT ROWID;
+
 CREATE TABLE IF NOT EXISTS chat_attr
 (
     id         INTEGER  NOT NULL PRIMARY KEY,
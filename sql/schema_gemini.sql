@@ -22,7 +22,7 @@ CREATE TABLE gemini_contents
     msg_type          TEXT         NOT NULL, -- 使用英语标识类型，包括 text, photo, sticker，将来可能有更多类型（或许）
     reply_to_msg_id   INTEGER,               -- 若有，代表该消息为回复消息
     text              TEXT,                  -- 可以与blob共存，若同时存在，则使用两个part，但两个至少应该有一个
-    blob              BLOB,
+    blob_hash         TEXT,                  -- gemini_blobs 中的sha256，相同的媒体只存储一份
     mime_type         TEXT,                  -- 若blob存在，mime_type必须存在
     quote_part        TEXT,                  -- 回复消息时，被回复的消息被引用的部分。
     thought_signature TEXT,                  -- 模型的思考签名
@@ -36,14 +36,45 @@ CREATE TABLE gemini_contents
         REFERENCES gemini_sessions (id)
         ON DELETE CASCADE,
     UNIQUE (chat_id, msg_id),
-    CHECK ( text IS NOT NULL OR blob IS NOT NULL ),
+    FOREIGN KEY (blob_hash)
+        REFERENCES gemini_blobs (hash),
+    CHECK ( text IS NOT NULL OR blob_hash IS NOT NULL ),
     CHECK (
-        (blob IS NULL AND mime_type IS NULL)
+        (blob_hash IS NULL AND mime_type IS NULL)
             OR
-        (blob IS NOT NULL AND mime_type IS NOT NULL)
+        (blob_hash IS NOT NULL AND mime_type IS NOT NULL)
         )
 ) WITHOUT ROWID;
 
+CREATE INDEX IF NOT EXISTS idx_gemini_contents_blob_hash ON gemini_contents (blob_hash) WHERE blob_hash IS NOT NULL;
+
+-- 按内容寻址的媒体存储，ref_count 为引用该媒体的 gemini_contents 数量
+-- 媒体可能较大，不使用 WITHOUT ROWID
+CREATE TABLE IF NOT EXISTS gemini_blobs
+(
+    hash       TEXT PRIMARY KEY, -- data 的 sha256，十六进制
+    data       BLOB         NOT NULL,
+    size       INTEGER      NOT NULL,
+    ref_count  INTEGER      NOT NULL DEFAULT 0,
+    created_at INT_UNIX_SEC NOT NULL
+);
+
+CREATE TRIGGER IF NOT EXISTS gemini_contents_blob_ref_inc
+    AFTER INSERT
+    ON gemini_contents
+    WHEN NEW.blob_hash IS NOT NULL
+BEGIN
+    UPDATE gemini_blobs SET ref_count = ref_count + 1 WHERE hash = NEW.blob_hash;
+END;
+
+CREATE TRIGGER IF NOT EXISTS gemini_contents_blob_ref_dec
+    AFTER DELETE
+    ON gemini_contents
+    WHEN OLD.blob_hash IS NOT NULL
+BEGIN
+    UPDATE gemini_blobs SET ref_count = ref_count - 1 WHERE hash = OLD.blob_hash;
+END;
+
 CREATE TABLE IF NOT EXISTS gemini_system_prompt
 (
     chat_id   INTEGER NOT NULL,
@@ -52,6 +83,27 @@ CREATE TABLE IF NOT EXISTS gemini_system_prompt
     PRIMARY KEY (chat_id, thread_id)
 ) WITHOUT ROWID;
 
+-- 系统提示词的修改历史，prompt 为空表示恢复默认提示词
+CREATE TABLE IF NOT EXISTS gemini_system_prompt_history
+(
+    chat_id    INTEGER      NOT NULL,
+    thread_id  INTEGER      NOT NULL,
+    version    INTEGER      NOT NULL,
+    prompt     TEXT         NOT NULL,
+    author_id  INTEGER      NOT NULL, -- 0 表示开始记录历史前已存在的提示词
+    created_at INT_UNIX_SEC NOT NULL,
+    PRIMARY KEY (chat_id, thread_id, version)
+) WITHOUT ROWID;
+
+-- 所有聊天共享的命名提示词预设
+CREATE TABLE IF NOT EXISTS gemini_prompt_presets
+(
+    name       TEXT PRIMARY KEY,
+    prompt     TEXT         NOT NULL,
+    author_id  INTEGER      NOT NULL,
+    updated_at INT_UNIX_SEC NOT NULL
+) WITHOUT ROWID;
+
 CREATE TABLE gemini_memories
 (
     id       INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -60,4 +112,67 @@ CREATE TABLE gemini_memories
     content  TEXT    NOT NULL
 );
 
-CREATE INDEX IF NOT EXISTS idx_gemini_memories ON gemini_memories (chat_id, topic_id);
\ No newline at end of file
+CREATE INDEX IF NOT EXISTS idx_gemini_memories ON gemini_memories (chat_id, topic_id);
+
+-- 每个聊天/话题独立的模型与工具配置，不存在时使用代码中的默认值
+CREATE TABLE IF NOT EXISTS gemini_chat_settings
+(
+    chat_id               INTEGER  NOT NULL,
+    thread_id             INTEGER  NOT NULL,
+    model                 TEXT     NOT NULL,
+    temperature           REAL     NOT NULL DEFAULT 1.0,
+    thinking_budget       INTEGER  NOT NULL DEFAULT -1, -- -1 由模型自行决定，0 关闭思考
+    enable_search         INT_BOOL NOT NULL DEFAULT TRUE,
+    enable_code_execution INT_BOOL NOT NULL DEFAULT TRUE,
+    max_history           INTEGER  NOT NULL DEFAULT 150,
+    PRIMARY KEY (chat_id, thread_id)
+) WITHOUT ROWID;
+
+-- 按天记录每个用户在每个聊天中各模型的token用量，用于配额与费用统计
+CREATE TABLE IF NOT EXISTS gemini_usage
+(
+    chat_id       INTEGER NOT NULL,
+    user_id       INTEGER NOT NULL,
+    model         TEXT    NOT NULL,
+    usage_date    INTEGER NOT NULL, -- 从Unix纪元开始的日期数量，使用服务器本地时区
+    input_tokens  INTEGER NOT NULL DEFAULT 0,
+    output_tokens INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (chat_id, user_id, model, usage_date)
+) WITHOUT ROWID;
+
+CREATE INDEX IF NOT EXISTS idx_gemini_usage_user ON gemini_usage (user_id, usage_date);
+
+-- 管理员设置的定时提示词，按 cron 表达式运行，结果发送到指定话题并保存在独立会话中
+CREATE TABLE IF NOT EXISTS gemini_scheduled_prompts
+(
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    chat_id     INTEGER      NOT NULL,
+    thread_id   INTEGER      NOT NULL DEFAULT 0,
+    cron        TEXT         NOT NULL,
+    prompt      TEXT         NOT NULL,
+    session_id  INTEGER      NOT NULL DEFAULT 0, -- 0 表示尚未运行过，首次运行时创建会话
+    created_by  INTEGER      NOT NULL,
+    created_at  INT_UNIX_SEC NOT NULL,
+    last_run_at INT_UNIX_SEC NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS idx_gemini_scheduled_prompts_chat ON gemini_scheduled_prompts (chat_id);
+
+-- 私聊AI模式的用户，私聊中的会话、提示词与记忆都以用户ID作为 chat_id
+CREATE TABLE IF NOT EXISTS gemini_private_users
+(
+    user_id     INTEGER PRIMARY KEY,
+    invite_code TEXT         NOT NULL DEFAULT '', -- 由管理员直接添加时为空
+    added_by    INTEGER      NOT NULL,
+    created_at  INT_UNIX_SEC NOT NULL
+) WITHOUT ROWID;
+
+CREATE TABLE IF NOT EXISTS gemini_invite_codes
+(
+    code       TEXT PRIMARY KEY,
+    created_by INTEGER      NOT NULL,
+    max_uses   INTEGER      NOT NULL,
+    used_count INTEGER      NOT NULL DEFAULT 0,
+    created_at INT_UNIX_SEC NOT NULL,
+    expires_at INT_UNIX_SEC NOT NULL
+) WITHOUT ROWID;
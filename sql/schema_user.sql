@@ -10,7 +10,8 @@ CREATE TABLE IF NOT EXISTS users
     username          TEXT,
     profile_update_at INT_UNIX_SEC NOT NULL,
     profile_photo     TEXT,
-    timezone          INTEGER      NOT NULL DEFAULT 480 -- 8:00，+8小时
+    timezone          INTEGER      NOT NULL DEFAULT 28800, -- UTC偏移（秒），设置了 timezone_name 时只在时区数据中找不到该时区时使用
+    timezone_name     TEXT         NOT NULL DEFAULT ''     -- IANA 时区名，为空时使用 timezone 的固定偏移
 );
 
 CREATE TABLE IF NOT EXISTS prpr_caches